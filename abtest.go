@@ -0,0 +1,217 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// A single variant of an A/B test:
+	tVariant struct {
+		sync.Mutex
+		name    string                 // the variant's name (e.g. `B`)
+		weight  int                    // relative share of requests
+		destURL string                 // (optional) the variant's backend
+		proxy   *httputil.ReverseProxy // proxy for `destURL`
+	}
+
+	// Per-host A/B test settings:
+	tABTest struct {
+		variants []*tVariant
+		total    int    // sum of all weights
+		cookie   string // (optional) cookie remembering the variant
+	}
+)
+
+const (
+	// Header telling backend and client the assigned variant:
+	abHeader = "X-Variant"
+)
+
+// `assign()` assigns `aRequest` to one of the test's variants and
+// sets the `X-Variant` header of both the request and the response.
+//
+// A variant named by the test's cookie is kept; otherwise the
+// variant is chosen by a hash of the client's IP address (and
+// remembered by the cookie if one is configured).
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to set the headers of.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `*tVariant`: The assigned variant.
+func (ab *tABTest) assign(aWriter http.ResponseWriter, aRequest *http.Request) *tVariant {
+	if nil == ab {
+		return nil
+	}
+
+	var result *tVariant
+	if "" != ab.cookie {
+		if cookie, err := aRequest.Cookie(ab.cookie); nil == err {
+			result = ab.find(cookie.Value)
+		}
+	}
+	if nil == result {
+		ip, _, err := net.SplitHostPort(aRequest.RemoteAddr)
+		if nil != err {
+			ip = aRequest.RemoteAddr
+		}
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(ip))
+		result = ab.pick(int(hash.Sum32() % uint32(ab.total)))
+
+		if "" != ab.cookie {
+			http.SetCookie(aWriter, &http.Cookie{
+				Name:     ab.cookie,
+				Value:    result.name,
+				Path:     "/",
+				MaxAge:   60 * 60 * 24 * 30,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+	aRequest.Header.Set(abHeader, result.name)
+	aWriter.Header().Set(abHeader, result.name)
+
+	return result
+} // assign()
+
+// `find()` returns the variant named `aName`.
+//
+// Parameters:
+// - `aName`: The variant's name.
+//
+// Returns:
+// - `*tVariant`: The variant or `nil` if there's none of that name.
+func (ab *tABTest) find(aName string) *tVariant {
+	for _, variant := range ab.variants {
+		if variant.name == aName {
+			return variant
+		}
+	}
+
+	return nil
+} // find()
+
+// `pick()` returns the variant whose share of the weights contains
+// `aPoint`.
+//
+// Parameters:
+// - `aPoint`: A number between zero and the total of all weights.
+//
+// Returns:
+// - `*tVariant`: The selected variant.
+func (ab *tABTest) pick(aPoint int) *tVariant {
+	for _, variant := range ab.variants {
+		if aPoint < variant.weight {
+			return variant
+		}
+		aPoint -= variant.weight
+	}
+
+	return ab.variants[len(ab.variants)-1]
+} // pick()
+
+// `reverseProxy()` returns the proxy forwarding requests to the
+// variant's own backend, creating it unless that was done with the
+// configuration already (see `createProxies()`).
+//
+// Parameters:
+// - `aTarget`: The host's backend configuration.
+//
+// Returns:
+// - `*httputil.ReverseProxy`: The variant's proxy or `nil` if the
+// variant uses the host's backend.
+// - `error`: A possible error creating the proxy.
+func (v *tVariant) reverseProxy(aTarget *tDestination) (*httputil.ReverseProxy, error) {
+	if (nil == v) || ("" == v.destURL) {
+		return nil, nil
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	if nil == v.proxy {
+		dest := *aTarget
+		dest.destHost, dest.destProxy = v.destURL, nil
+		proxy, err := createReverseProxy(&dest)
+		if nil != err {
+			return nil, err
+		}
+		v.proxy = proxy
+	}
+
+	return v.proxy, nil
+} // reverseProxy()
+
+// `readABTest()` reads the host's A/B test settings:
+//
+//	abVariants = A:80, B:20
+//	abDestB = http://123.168.123.234:8082
+//	abCookie = reprox_variant
+//
+// Variants without a weight get a weight of `1`, variants without
+// an `abDest<name>` setting use the host's `destURL`.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tABTest`: The host's A/B test or `nil` if there's none.
+func readABTest(aIni *ini.TSectionList, aSection string) *tABTest {
+	s, ok := hostString(aIni, aSection, "abVariants")
+	if !ok {
+		return nil
+	}
+
+	result := &tABTest{}
+	for _, entry := range strings.Split(s, ",") {
+		name, weight, hasWeight := strings.Cut(strings.TrimSpace(entry), ":")
+		if name = strings.TrimSpace(name); "" == name {
+			continue
+		}
+		variant := &tVariant{
+			name:   name,
+			weight: 1,
+		}
+		if hasWeight {
+			w, err := strconv.Atoi(strings.TrimSpace(weight))
+			if (nil != err) || (0 > w) {
+				logErr("ReProx/readABTest",
+					fmt.Sprintf("[%s] invalid weight of variant %q", aSection, name))
+				continue
+			}
+			variant.weight = w
+		}
+		variant.destURL, _ = aIni.AsString(aSection, "abDest"+name)
+		result.variants = append(result.variants, variant)
+		result.total += variant.weight
+	}
+	if 0 >= result.total {
+		return nil
+	}
+	result.cookie, _ = hostString(aIni, aSection, "abCookie")
+
+	return result
+} // readABTest()
+
+/* _EoF_ */
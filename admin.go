@@ -0,0 +1,71 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// `handleHealthz()` reports that the proxy is up and running.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func handleHealthz(aWriter http.ResponseWriter, aRequest *http.Request) {
+	header := aWriter.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(aWriter).Encode(map[string]string{
+		"status": "ok",
+		"uptime": time.Since(gStartTime).Round(time.Second).String(),
+	})
+} // handleHealthz()
+
+// `handleVersion()` sends the program's version information as JSON.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func handleVersion(aWriter http.ResponseWriter, aRequest *http.Request) {
+	aWriter.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(aWriter).Encode(GetVersionInfo())
+} // handleVersion()
+
+// `NewAdminHandler()` returns the handler serving the administrative
+// endpoints.
+//
+// It's meant to be used by a separate server listening on a private
+// address (see `TSetup.AdminListen`), not by the public proxy servers.
+//
+// Parameters:
+// - `aProxy`: The proxy handler to administer.
+//
+// Returns:
+// - `http.Handler`: The handler for the administrative endpoints.
+func NewAdminHandler(aProxy *TProxyHandler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cache", aProxy.handleCache)
+	mux.HandleFunc("/connections", handleConnections)
+	mux.HandleFunc("/debug", aProxy.handleDebug)
+	mux.HandleFunc("/drain", aProxy.handleDrain)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/hosts", aProxy.handleHosts)
+	mux.HandleFunc("/latency", handleLatency)
+	mux.HandleFunc("/metrics", aProxy.handleMetrics)
+	mux.HandleFunc("/maintenance", aProxy.handleMaintenance)
+	mux.HandleFunc("/ratelimits", handleRateLimits)
+	mux.HandleFunc("/smoketests", handleSmokeTests)
+	mux.HandleFunc("/version", handleVersion)
+
+	return mux
+} // NewAdminHandler()
+
+/* _EoF_ */
@@ -0,0 +1,178 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type (
+	// `TAlert` is the payload posted to the `AlertWebhook` (in the
+	// `generic` format) when a host's error rate crosses the threshold
+	// or returns to normal.
+	TAlert struct {
+		Host      string  `json:"host"`
+		Firing    bool    `json:"firing"`
+		Requests  uint64  `json:"requests"`
+		Errors    uint64  `json:"errors"`
+		ErrorRate float64 `json:"errorRate"`
+		Threshold float64 `json:"threshold"`
+		Window    string  `json:"window"`
+		Time      string  `json:"time"`
+	}
+
+	// Counters of a host at the end of the previous alert window:
+	tAlertState struct {
+		requests uint64
+		errors   uint64
+		firing   bool
+	}
+)
+
+const (
+	// `AlertGeneric` posts the `TAlert` structure as JSON.
+	AlertGeneric = "generic"
+
+	// `AlertSlack` posts a Slack compatible `{"text": …}` message.
+	AlertSlack = "slack"
+
+	// `AlertMatrix` posts a message for Matrix webhook bridges.
+	AlertMatrix = "matrix"
+)
+
+var (
+	// HTTP client used to post the alerts:
+	gAlertClient = &http.Client{
+		Timeout: time.Second << 2,
+	}
+)
+
+// `text()` returns a human readable description of the alert.
+//
+// Returns:
+// - `string`: The alert's message.
+func (a *TAlert) text() string {
+	if !a.Firing {
+		return fmt.Sprintf("[reprox] %s: error rate back to normal (%.1f%% of %d requests in %s)",
+			a.Host, a.ErrorRate*100, a.Requests, a.Window)
+	}
+
+	return fmt.Sprintf("[reprox] %s: error rate %.1f%% (%d of %d requests in %s) exceeds %.1f%%",
+		a.Host, a.ErrorRate*100, a.Errors, a.Requests, a.Window, a.Threshold*100)
+} // text()
+
+// `send()` posts the alert to `aURL` in the given `aFormat`.
+//
+// Parameters:
+// - `aURL`: The webhook to post to.
+// - `aFormat`: The payload format (`generic`, `slack`, or `matrix`).
+//
+// Returns:
+// - `error`: A possible error encoding or posting the alert.
+func (a *TAlert) send(aURL, aFormat string) error {
+	var payload any = a
+	switch aFormat {
+	case AlertSlack:
+		payload = map[string]string{"text": a.text()}
+	case AlertMatrix:
+		payload = map[string]string{"text": a.text(), "msgtype": "m.notice"}
+	}
+	data, err := json.Marshal(payload)
+	if nil != err {
+		return err
+	}
+
+	response, err := gAlertClient.Post(aURL, "application/json", bytes.NewReader(data))
+	if nil != err {
+		return err
+	}
+	defer response.Body.Close()
+
+	if http.StatusBadRequest <= response.StatusCode {
+		return fmt.Errorf("%w: alert: %s", ErrWebhook, response.Status)
+	}
+
+	return nil
+} // send()
+
+// `checkAlerts()` compares each host's error rate within the last
+// window to the configured threshold and posts an alert when it's
+// crossed (in either direction).
+//
+// Parameters:
+// - `aStates`: The hosts' counters at the end of the previous window.
+// - `aSetup`: The current configuration.
+func checkAlerts(aStates map[string]*tAlertState, aSetup *TSetup) {
+	gStats.Range(func(aKey, aValue any) bool {
+		host, hs := aKey.(string), aValue.(*tHostStats)
+		state, ok := aStates[host]
+		if !ok {
+			state = &tAlertState{}
+			aStates[host] = state
+		}
+		requests, errors := hs.requests.Load(), hs.errors.Load()
+		dReq, dErr := requests-state.requests, errors-state.errors
+		state.requests, state.errors = requests, errors
+		if uint64(aSetup.AlertMinRequests) > dReq {
+			return true
+		}
+
+		rate := float64(dErr) / float64(dReq)
+		firing := aSetup.AlertErrorRate <= rate
+		if firing == state.firing {
+			return true
+		}
+		state.firing = firing
+
+		alert := &TAlert{
+			Host:      host,
+			Firing:    firing,
+			Requests:  dReq,
+			Errors:    dErr,
+			ErrorRate: rate,
+			Threshold: aSetup.AlertErrorRate,
+			Window:    aSetup.AlertInterval.String(),
+			Time:      time.Now().Format(time.RFC3339),
+		}
+		logErr("ReProx/checkAlerts", alert.text())
+		go func() {
+			if err := alert.send(aSetup.AlertWebhook, aSetup.AlertFormat); nil != err {
+				logErr("ReProx/checkAlerts", err.Error())
+			}
+		}()
+		return true
+	})
+} // checkAlerts()
+
+// `WatchAlerts()` checks the hosts' error rates once per configured
+// `AlertInterval` and posts alerts to the `AlertWebhook`.
+//
+// The function does nothing unless an `AlertWebhook` is configured;
+// it's meant to be called once at program start.
+func WatchAlerts() {
+	if setup := CurrentSetup(); (nil == setup) || ("" == setup.AlertWebhook) {
+		return
+	}
+	states := make(map[string]*tAlertState)
+
+	goSafe("alerts", true, func() {
+		for {
+			time.Sleep(CurrentSetup().AlertInterval)
+			if setup := CurrentSetup(); "" != setup.AlertWebhook {
+				checkAlerts(states, setup)
+			}
+		}
+	})
+} // WatchAlerts()
+
+/* _EoF_ */
@@ -0,0 +1,174 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// A single API key with its permissions:
+	tAPIKey struct {
+		name     string   // name of the key's INI section
+		secret   string   // the key itself
+		prefixes []string // allowed path prefixes (empty: all)
+		rate     tLimiter // allowed requests per minute
+	}
+
+	// List of API keys accepted by a host:
+	tAPIKeys []*tAPIKey
+)
+
+// `allowsPath()` checks whether the key may be used for `aPath`.
+//
+// Parameters:
+// - `aPath`: The requested URL path.
+//
+// Returns:
+// - `bool`: `true` if `aPath` starts with one of the allowed prefixes.
+func (ak *tAPIKey) allowsPath(aPath string) bool {
+	if 0 == len(ak.prefixes) {
+		return true
+	}
+	for _, prefix := range ak.prefixes {
+		if strings.HasPrefix(aPath, prefix) {
+			return true
+		}
+	}
+
+	return false
+} // allowsPath()
+
+// `find()` returns the key matching `aSecret`.
+//
+// Parameters:
+// - `aSecret`: The key sent by the client.
+//
+// Returns:
+// - `*tAPIKey`: The matching key or `nil` if there's none.
+func (aks tAPIKeys) find(aSecret string) *tAPIKey {
+	for _, key := range aks {
+		if 1 == subtle.ConstantTimeCompare([]byte(key.secret), []byte(aSecret)) {
+			return key
+		}
+	}
+
+	return nil
+} // find()
+
+// `check()` validates the API key sent with `aRequest`.
+//
+// The key is expected in the `X-API-Key` header or as a bearer token
+// in the `Authorization` header.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `int`: The HTTP status to send if the request is refused, or `0`.
+func (aks tAPIKeys) check(aRequest *http.Request) int {
+	secret := aRequest.Header.Get("X-API-Key")
+	if "" == secret {
+		auth := aRequest.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") {
+			secret = strings.TrimSpace(auth[7:])
+		}
+	}
+	if "" == secret {
+		return http.StatusUnauthorized
+	}
+
+	key := aks.find(secret)
+	if nil == key {
+		return http.StatusUnauthorized
+	}
+	if !key.allowsPath(aRequest.URL.Path) {
+		return http.StatusForbidden
+	}
+	if !key.rate.allow() {
+		return http.StatusTooManyRequests
+	}
+
+	return 0
+} // check()
+
+// `readAPIKeys()` reads the API keys listed in a host's `apiKeys`
+// setting.
+//
+// The setting holds a comma separated list of INI section names,
+// each of which defines one key:
+//
+//	[someKey]
+//		key = env:SOME_API_KEY
+//		perMinute = 60
+//		algorithm = token
+//		burst = 20
+//		paths = /api/, /v2/
+//
+// `algorithm` selects the rate limiting algorithm (`fixed`, `sliding`,
+// `token`, or `leaky`; see `newLimiter()`).
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `tAPIKeys`: The host's API keys or `nil` if there are none.
+func readAPIKeys(aIni *ini.TSectionList, aSection string) (rKeys tAPIKeys) {
+	names, ok := hostString(aIni, aSection, "apiKeys")
+	if !ok {
+		return
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); "" == name {
+			continue
+		}
+		secret, ok := aIni.AsString(name, "key")
+		if !ok {
+			logErr("ReProx/readAPIKeys",
+				fmt.Sprintf("[%s] API key %q not found", aSection, name))
+			continue
+		}
+		secret, err := resolveSecret(secret)
+		if (nil != err) || ("" == secret) {
+			logErr("ReProx/readAPIKeys",
+				fmt.Sprintf("[%s] API key %q: %v", aSection, name, err))
+			continue
+		}
+
+		key := &tAPIKey{
+			name:   name,
+			secret: secret,
+		}
+		perMin, _ := aIni.AsInt(name, "perMinute")
+		algo, _ := aIni.AsString(name, "algorithm")
+		burst, _ := aIni.AsInt(name, "burst")
+		key.rate = newLimiter(parseRateAlgorithm(name, algo), perMin, time.Minute,
+			burst, rateStats("apiKey:"+name, perMin, time.Minute))
+		if paths, ok := aIni.AsString(name, "paths"); ok {
+			for _, path := range strings.Split(paths, ",") {
+				if path = strings.TrimSpace(path); "" != path {
+					key.prefixes = append(key.prefixes, path)
+				}
+			}
+		}
+		rKeys = append(rKeys, key)
+	}
+
+	return
+} // readAPIKeys()
+
+/* _EoF_ */
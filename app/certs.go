@@ -17,10 +17,23 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"log"
 	"math/big"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"time"
+
+	"github.com/mwat56/reprox"
+)
+
+type (
+	// The TLS certificate served by the HTTPS frontends and TCP
+	// routes, re-read whenever the configuration is reloaded:
+	tCertStore struct {
+		certFile, keyFile string
+		current           atomic.Pointer[tls.Certificate]
+	}
 )
 
 // `certFilenames()` generates the filenames for the certificate
@@ -127,46 +140,95 @@ func generateTLS(aServername, aPath string) error {
 	return nil
 } // generateTLS()
 
-// `certGet()` generates a TLS certificate from the provided certificate
+// `certGet()` loads a TLS certificate from the provided certificate
 // and key files.
 //
-// It takes four parameters: `aCertFile`, `aKeyFile`, `aServerName`, and
-// `aPath`.
+// It takes three parameters: `aCertFile`, `aKeyFile`, and `aServerName`.
 // `aCertFile` and `aKeyFile` are the paths to the certificate and key
 // files, respectively.
-// `aServerName` is the name of the server for which the certificate
+// `aServerName` is the name of the server for which a certificate
 // is generated.
-// `aPath` is the default directory to store/load the certificate files.
 //
-// If an error occurs while loading the certificate and key files, the
-// function will attempt to generate a new self-signed certificate and
-// key pair using the `generateTLS` function.
+// If the certificate and key files can't be loaded and `TLSFallback`
+// is `selfsigned`, the function generates a temporary self-signed
+// certificate and key pair using the `generateTLS` function; the
+// generated files are removed after loading them.
 //
 // The function returns a `tls.Certificate` object representing the
 // loaded or generated certificate and key pair, along with any
 // encountered error.
-func certGet(aCertFile, aKeyFile, aServerName, aPath string) (rCertificate tls.Certificate, rErr error) {
+func certGet(aCertFile, aKeyFile, aServerName string) (rCertificate tls.Certificate, rErr error) {
 	var err error
 
 	rCertificate, err = tls.LoadX509KeyPair(aCertFile, aKeyFile)
-	if nil == err {
+	if (nil == err) || (reprox.TLSSelfSigned != reprox.CurrentSetup().TLSFallback) {
+		rErr = err
 		return
 	}
 
-	if "" == aPath {
-		aPath = ConfDir()
-	}
-
-	e2 := generateTLS(aServerName, aPath)
+	tmpDir, e2 := os.MkdirTemp("", "reprox-tls-")
 	if nil != e2 {
 		rErr = fmt.Errorf("%s: %w", err.Error(), e2)
 		return
 	}
+	defer os.RemoveAll(tmpDir)
 
-	// try again:
-	rCertificate, rErr = tls.LoadX509KeyPair(aCertFile, aKeyFile)
+	if e2 = generateTLS(aServerName, tmpDir); nil != e2 {
+		rErr = fmt.Errorf("%s: %w", err.Error(), e2)
+		return
+	}
+	certFile, keyFile := certFilenames(aServerName, tmpDir)
+	if rCertificate, rErr = tls.LoadX509KeyPair(certFile, keyFile); nil == rErr {
+		s := fmt.Sprintf("%s: %v – serving a temporary self-signed certificate",
+			gMe, err)
+		log.Println(s)
+		gLog.Err("ReProx/certGet", s)
+	}
 
 	return
 } // certGet()
 
+// `newCertStore()` returns a store serving `aCertificate` until the
+// key pair `aCertFile` and `aKeyFile` is read again by a reload.
+//
+// Parameters:
+// - `aCertFile`: The name of the certificate file.
+// - `aKeyFile`: The name of the private key file.
+// - `aCertificate`: The certificate read at startup.
+//
+// Returns:
+// - `*tCertStore`: The new certificate store.
+func newCertStore(aCertFile, aKeyFile string, aCertificate tls.Certificate) *tCertStore {
+	result := &tCertStore{certFile: aCertFile, keyFile: aKeyFile}
+	result.current.Store(&aCertificate)
+	reprox.OnReload(func(_, _ *reprox.TSetup) {
+		result.reload()
+	})
+
+	return result
+} // newCertStore()
+
+// `GetCertificate()` returns the current certificate (for
+// `tls.Config.GetCertificate`).
+func (cs *tCertStore) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cs.current.Load(), nil
+} // GetCertificate()
+
+// `reload()` reads the key pair again, e.g. after it was renewed.
+//
+// The current certificate is kept if the files can't be read (which
+// happens after dropping the privileges or jailing the process if the
+// files aren't accessible anymore).
+func (cs *tCertStore) reload() {
+	certificate, err := tls.LoadX509KeyPair(cs.certFile, cs.keyFile)
+	if nil != err {
+		gLog.Err("ReProx/certificate",
+			fmt.Sprintf("%s: certificate not reloaded: %v", gMe, err))
+		return
+	}
+	cs.current.Store(&certificate)
+	gLog.Log("ReProx/certificate",
+		fmt.Sprintf("%s: certificate %s reloaded", gMe, cs.certFile))
+} // reload()
+
 /* _EoF_ */
@@ -11,13 +11,17 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // `ConfDir()` returns the directory path where the configuration files
 // for the running application should be stored.
 //
-// If the current user is root, the directory is "/etc/<program_name>".
-// Otherwise, it is "~/.config/<program_name>".
+// If the current user is root, the directory is "/etc/<program_name>"
+// ("/Library/Application Support/<program_name>" on macOS).
+// Otherwise, it is "~/.config/<program_name>" (the user's configuration
+// directory of the respective system). On Windows it's always
+// "%ProgramData%\<program_name>".
 //
 // If the directory does not yet exist, it is created with permissions 0770.
 //
@@ -25,15 +29,15 @@ import (
 // - string: The directory path to use for application-specific
 // configuration files.
 //
-// NOTE: This function is Linux-specific and considers only the
-// "happy path" (i.e. no proper error handling).
+// NOTE: This function considers only the "happy path" (i.e. no
+// proper error handling).
 func ConfDir() (rDir string) {
-	if 0 == os.Getuid() { // root user
-		rDir = filepath.Join("/etc/", filepath.Base(os.Args[0]))
-	} else {
-		confDir, _ := os.UserConfigDir()
-		rDir = filepath.Join(confDir, filepath.Base(os.Args[0]))
+	confDir := sysConfDir()
+	if "" == confDir {
+		confDir, _ = os.UserConfigDir()
 	}
+	rDir = filepath.Join(confDir,
+		strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe"))
 
 	if IsDirectory(rDir) {
 		return
@@ -0,0 +1,29 @@
+//go:build !unix
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+		All rights reserved
+	EMail : <support@mwat.de>
+*/
+package main
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import "os"
+
+// `sysConfDir()` returns the base directory of the system-wide
+// configuration files (`%ProgramData%` on Windows) which is used
+// since the program usually runs as a service.
+//
+// Returns:
+// - `string`: The base directory.
+func sysConfDir() string {
+	if dir := os.Getenv("ProgramData"); "" != dir {
+		return dir
+	}
+
+	return `C:\ProgramData`
+} // sysConfDir()
+
+/* _EoF_ */
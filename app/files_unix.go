@@ -0,0 +1,28 @@
+//go:build unix && !darwin
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+		All rights reserved
+	EMail : <support@mwat.de>
+*/
+package main
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import "os"
+
+// `sysConfDir()` returns the base directory of the system-wide
+// configuration files if running as root.
+//
+// Returns:
+// - `string`: The base directory or empty to use the user's one.
+func sysConfDir() string {
+	if 0 != os.Getuid() {
+		return ""
+	}
+
+	return "/etc"
+} // sysConfDir()
+
+/* _EoF_ */
@@ -1,3 +1,5 @@
+//go:build linux
+
 /*
 Copyright © 2024  M.Watermann, 10247 Berlin, Germany
 
@@ -9,48 +11,34 @@ package main
 //lint:file-ignore ST1017 - I prefer Yoda conditions
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"syscall"
+	"unsafe"
 
+	"github.com/mwat56/reprox"
 	"golang.org/x/sys/unix"
 
-	"github.com/mwat56/apachelogger"
 	se "github.com/mwat56/sourceerror"
 )
 
-// `ChRoot()` changes the root directory of the process to "/tmp". This is
-// done using the `syscall.Chroot()` function, which takes the new root
-// directory as an argument. If an error occurs during the chroot operation,
-// it is logged.
-//
-// The purpose of changing the root directory to "/tmp" is to isolate the
-// process from the rest of the file system and limit its access to the
-// "/tmp" directory only. This is a common technique used in
-// security-sensitive applications to prevent unauthorized access to
-// sensitive files and directories.
-//
-// Parameters:
-//   - None
+// `ChRoot()` changes the root directory of the process to the
+// configured `Chroot` directory or – by default – to "/tmp" (see
+// `Mount()`), to isolate the process from the rest of the file system
+// (see `reprox.Jail()`).
 //
 // Returns:
 // - error: An error if it encounters any issues while changing the root
 // directory.
 func ChRoot() error {
-
-	// This function is responsible for changing the root directory
-	// of the process to "/tmp". This is done using the `syscall.Chroot()`
-	// function, which takes the new root directory as an argument. If
-	// an error occurs during the chroot operation, it is logged.
-
-	// The purpose of changing the root directory to "/tmp" is to isolate
-	// the process from the rest of the file system and limit its access
-	// to the "/tmp" directory only. This is a common technique used in
-	// security-sensitive applications to prevent unauthorized access to
-	// sensitive files and directories.
-	if err := syscall.Chroot("/tmp"); nil != err {
-		apachelogger.Err("",
-			fmt.Sprintf("Failed chroot(/tmp): %v", err))
+	dir := reprox.CurrentSetup().Chroot
+	if "" == dir {
+		dir = "/tmp"
+	}
+	if err := reprox.Jail(dir); nil != err {
+		gLog.Err("",
+			fmt.Sprintf("Failed chroot(%s): %v", dir, err))
 		return se.Wrap(err, 3)
 	}
 
@@ -96,7 +84,7 @@ func DropCapabilities() error {
 	// not equal to 0), then the function sets the `err` variable to the
 	// error returned.
 	if err := unix.Capset(&header, &data); nil != err {
-		apachelogger.Err("",
+		gLog.Err("",
 			fmt.Sprintf("Failed to set Capabilities: %v", err))
 		return se.Wrap(err, 3)
 	}
@@ -107,8 +95,8 @@ func DropCapabilities() error {
 // `DropPrivileges()` drops all privileges of the process.
 //
 // It uses the `Unshare()` function to isolate the process from the parent
-// process. It then changes the root directory of the process to "/tmp" using
-// the `ChRoot()` function. After that, it drops all capabilities of the
+// process. It then changes the root directory of the process (see
+// `ChRoot()`). After that, it drops all capabilities of the
 // process using the `DropCapabilities()` function. Finally, it mounts a tmpfs
 // filesystem at "/tmp" with the `MS_RDONLY` flag using the `Mount()` function.
 //
@@ -159,8 +147,10 @@ func DropPrivileges() error {
 // drop the group and user privileges.
 //
 // Parameters:
-// - aUID: The user ID to drop to. If it's less than 0, it defaults to 65534.
-// - aGID: The group ID to drop to. If it's less than 0, it defaults to 65534.
+// - aUID: The user ID to drop to. If it's less than 0, the configured
+// `RunAsUser` (or `nobody`) is used.
+// - aGID: The group ID to drop to. If it's less than 0, the configured
+// `RunAsGroup` (or the user's primary group) is used.
 //
 // Returns:
 // - `rErr`: The error if it encounters any issues while dropping the
@@ -174,11 +164,22 @@ func DropUID(aUID, aGID int) error {
 	var err error
 
 	// Check the UID and GID to drop to
-	if 0 > aUID {
-		aUID = 65534 // unknown user
-	}
-	if 0 > aGID {
-		aGID = 65534 // unknown group
+	if (0 > aUID) || (0 > aGID) {
+		name := reprox.CurrentSetup().RunAsUser
+		if "" == name {
+			name = "nobody"
+		}
+		uid, gid, err := reprox.LookupRunAs(name, reprox.CurrentSetup().RunAsGroup)
+		if nil != err {
+			gLog.Err("", err.Error())
+			return se.Wrap(err, 3)
+		}
+		if 0 > aUID {
+			aUID = uid
+		}
+		if 0 > aGID {
+			aGID = gid
+		}
 	}
 
 	// The `syscall.Setgroups()` function is responsible for setting the
@@ -186,7 +187,7 @@ func DropUID(aUID, aGID int) error {
 	// error that it encounters while setting the groups.
 	var gids []int // empty group list
 	if err = syscall.Setgroups(gids); (nil != err) && (syscall.EPERM != err) {
-		apachelogger.Err("",
+		gLog.Err("",
 			fmt.Sprintf("Failed to clear Groups: %v", err))
 		return se.Wrap(err, 3)
 	}
@@ -197,7 +198,7 @@ func DropUID(aUID, aGID int) error {
 
 	// First, drop group privileges
 	if err = syscall.Setgid(aGID); (nil != err) && (syscall.EPERM != err) {
-		apachelogger.Err("",
+		gLog.Err("",
 			fmt.Sprintf("Failed to set GID: %v", err))
 		return se.Wrap(err, 3)
 	}
@@ -209,12 +210,12 @@ func DropUID(aUID, aGID int) error {
 
 	// Then drop user privileges
 	if err = syscall.Setuid(aUID); (nil != err) && (syscall.EPERM != err) {
-		apachelogger.Err("",
+		gLog.Err("",
 			fmt.Sprintf("Failed to set UID: %v", err))
 		return se.Wrap(err, 3)
 	}
 
-	apachelogger.Log("",
+	gLog.Log("",
 		fmt.Sprintf("Privileges dropped. Current UID: %d, GID: %d, last err: %v\n",
 			os.Getuid(), os.Getgid(), err))
 
@@ -243,7 +244,7 @@ func Mount() error {
 	// for others.
 	if err = syscall.Mount("tmpfs", "/tmp", "tmpfs",
 		syscall.MS_RDONLY, "size=4k,mode=100"); nil != err {
-		apachelogger.Err("",
+		gLog.Err("",
 			fmt.Sprintf("Failed mount(/tmp): %v", err))
 		return se.Wrap(err, 4)
 	}
@@ -252,13 +253,75 @@ func Mount() error {
 	// directory of the process to the specified directory. In this case,
 	// it changes the current working directory to /tmp.
 	if err = syscall.Chdir("/tmp"); nil != err {
-		apachelogger.Err("",
+		gLog.Err("",
 			fmt.Sprintf("Failed chdir(/tmp): %v", err))
 	}
 
 	return nil
 } // Mount()
 
+// `Seccomp()` installs a seccomp-bpf filter restricting all threads
+// of the process to the system calls a reverse proxy needs.
+//
+// Other system calls fail with `EPERM`; calls made with the numbers of
+// another architecture kill the process. Since neither `bind()` nor
+// `listen()` are allowed and the filter can't be removed again, it
+// must be loaded after the listening sockets are bound.
+//
+// Returns:
+// - `error`: An error if the filter couldn't be installed.
+func Seccomp() error {
+	if 0 == gSeccompArch {
+		err := errors.New("seccomp: unsupported architecture")
+		gLog.Err("", err.Error())
+		return se.Wrap(err, 3)
+	}
+	calls := append(gSeccompCalls[:len(gSeccompCalls):len(gSeccompCalls)],
+		gSeccompArchCalls...)
+
+	filter := []unix.SockFilter{
+		// load `seccomp_data.arch` and check it:
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 4},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, K: gSeccompArch},
+		{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_KILL_PROCESS},
+		// load `seccomp_data.nr`:
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 0},
+	}
+	for idx, nr := range calls {
+		// jump to the final `ALLOW` if the number matches:
+		filter = append(filter, unix.SockFilter{
+			Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K,
+			Jt:   uint8(len(calls) - idx),
+			K:    uint32(nr),
+		})
+	}
+	filter = append(filter,
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K,
+			K: unix.SECCOMP_RET_ERRNO | (uint32(unix.EPERM) & unix.SECCOMP_RET_DATA)},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ALLOW},
+	)
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+
+	// An unprivileged process may only install a filter if it can't
+	// gain privileges anymore.
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); nil != err {
+		gLog.Err("",
+			fmt.Sprintf("Failed to set NO_NEW_PRIVS: %v", err))
+		return se.Wrap(err, 3)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER,
+		unix.SECCOMP_FILTER_FLAG_TSYNC, uintptr(unsafe.Pointer(&prog))); 0 != errno {
+		gLog.Err("",
+			fmt.Sprintf("Failed to install seccomp filter: %v", errno))
+		return se.Wrap(errno, 3)
+	}
+
+	return nil
+} // Seccomp()
+
 // `Unshare()` unshares the certain resources and isolates the process
 // from the parent process.
 //
@@ -287,7 +350,7 @@ func Unshare() error {
 	// equal to nil), then the function logs the error and returns it.
 
 	if err = syscall.Unshare(flag); nil != err {
-		apachelogger.Err("",
+		gLog.Err("",
 			fmt.Sprintf("Failed to Unshare: %v", err))
 		return se.Wrap(err, 3)
 	}
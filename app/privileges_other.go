@@ -0,0 +1,30 @@
+//go:build !linux
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+		All rights reserved
+	EMail : <support@mwat.de>
+*/
+package main
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"errors"
+
+	se "github.com/mwat56/sourceerror"
+)
+
+// `Seccomp()` fails since seccomp filters are Linux-specific.
+//
+// Returns:
+// - `error`: Always an error.
+func Seccomp() error {
+	err := errors.New("seccomp: unsupported system")
+	gLog.Err("", err.Error())
+
+	return se.Wrap(err, 3)
+} // Seccomp()
+
+/* _EoF_ */
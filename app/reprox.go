@@ -11,7 +11,10 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -19,7 +22,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
-	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -32,14 +35,32 @@ var (
 	gMe = func() string {
 		return filepath.Base(os.Args[0])
 	}()
+
+	// Number of currently open client connections:
+	gConnections atomic.Int64
+
+	// Configuration file and profile given on the commandline:
+	gConfigFile, gProfile string
+
+	// Whether the seccomp filter is disabled (for debugging):
+	gNoSeccomp bool
+
+	// Host and parameters of a load test (see `runBench()`):
+	gBenchHost string
+	gBench     reprox.TBenchOptions
+
+	// The program's logger (see `setupLogSinks()`):
+	gLog = reprox.ApacheLogger()
+
+	// (optional) sink for the server's error messages:
+	gErrorSink io.Writer
 )
 
 // `createServ()` creates and returns a new HTTP server listening
 // on the provided port.
 // The server is configured with the provided handler and with reasonable
-// timeouts.
-// The server is also set up to handle graceful shutdowns when receiving
-// SIGINT or SIGTERM signals.
+// timeouts (which the public servers replace by the configured ones,
+// see `reprox.TTimeouts`).
 //
 // Parameters:
 // - `aHandler` (http.Handler): The handler to be invoked for each
@@ -57,8 +78,7 @@ func createServ(aHandler http.Handler, aPort string) *http.Server {
 	// 	context.Background(), time.Second << 3)
 	// defer cancelTimeout()
 
-	// We need a `server` reference to use it in `setup Signals()`
-	// and to set some reasonable timeouts:
+	// We need a `server` reference to set some reasonable timeouts:
 	server := &http.Server{
 		// The TCP address for the server to listen on:
 		Addr: aPort,
@@ -89,36 +109,55 @@ func createServ(aHandler http.Handler, aPort string) *http.Server {
 		WriteTimeout: -1, // disable
 	}
 
-	apachelogger.SetErrorLog(server)
-	setupSignals(server)
+	// Keep track of the open connections for the shutdown report:
+	server.ConnState = func(aConn net.Conn, aState http.ConnState) {
+		switch aState {
+		case http.StateNew:
+			gConnections.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			gConnections.Add(-1)
+		}
+	}
+
+	if nil != gErrorSink {
+		server.ErrorLog = log.New(gErrorSink, "", 0)
+	} else {
+		apachelogger.SetErrorLog(server)
+	}
 
 	return server
 } // createServ()
 
 // `createServer443()` creates and returns a new HTTPS server listening
-// on port 443.
+// on `aAddr` (port 443 by default).
 // The server is configured with the provided handler and with reasonable
 // timeouts.
-// The server is also set up to handle graceful shutdowns when receiving
-// SIGINT or SIGTERM signals.
 // Additionally, the server is configured with TLS settings to enhance
 // security, following Mozilla's SSL Configuration Generator recommendations.
 //
 // Parameters:
 // - `aHandler`: The handler to be invoked for each request received
 // by the server.
-// - `aCertificate`: The TLS certificate to be used for secure
+// - `aCerts`: The store of the TLS certificate to be used for secure
 // communication.
+// - `aAddr`: The TCP address for the server to listen on.
+// - `aProxy`: The proxy handler knowing the configured hostnames.
 //
 // Returns:
 // - `*http.Server`: A pointer to the newly created and configured HTTPS server.
-func createServer443(aHandler http.Handler, aCertificate tls.Certificate) *http.Server {
-	result := createServ(aHandler, ":443")
+func createServer443(aHandler http.Handler, aCerts *tCertStore, aAddr string, aProxy *reprox.TProxyHandler) *http.Server {
+	if "" == aAddr {
+		aAddr = ":443"
+	}
+	setup := reprox.CurrentSetup()
+	result := reprox.TrackConnections("https",
+		setup.HTTPSTimes.Apply(
+			setup.HTTPSLimits.Apply(createServ(aHandler, aAddr))))
 
 	// see:
 	// https://ssl-config.mozilla.org/#server=golang&version=1.14.1&config=old&guideline=5.4
 	result.TLSConfig = &tls.Config{
-		Certificates: []tls.Certificate{aCertificate},
+		GetCertificate: aCerts.GetCertificate,
 		CipherSuites: []uint16{
 			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
 			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
@@ -143,6 +182,14 @@ func createServer443(aHandler http.Handler, aCertificate tls.Certificate) *http.
 			tls.TLS_RSA_WITH_RC4_128_SHA,
 			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
 		},
+		GetConfigForClient: func(aHello *tls.ClientHelloInfo) (*tls.Config, error) {
+			// Reject unknown hostnames if so configured:
+			if (reprox.SNIClose == reprox.CurrentSetup().UnmatchedSNI) &&
+				!aProxy.HasHost(aHello.ServerName) {
+				return nil, fmt.Errorf("%w: %q", reprox.ErrHostNotFound, aHello.ServerName)
+			}
+			return nil, nil // use this configuration
+		},
 		InsecureSkipVerify:       true, // avoid certificate validation
 		MaxVersion:               tls.VersionTLS12,
 		MinVersion:               tls.VersionTLS10,
@@ -150,24 +197,37 @@ func createServer443(aHandler http.Handler, aCertificate tls.Certificate) *http.
 	} // #nosec G402
 	// server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
 
-	return result
+	if "" != setup.SecurityLog {
+		// report failed TLS handshakes to the security log:
+		errLog := log.Writer()
+		if nil != result.ErrorLog {
+			errLog = result.ErrorLog.Writer()
+		}
+		result.ErrorLog = log.New(reprox.WatchTLSErrors(errLog), "", 0)
+	}
+
+	return setup.HTTPSConns.Apply(result)
 } // createServer443()
 
 // `createServer80()` creates and returns a new HTTP server listening
-// on port 80.
+// on `aAddr` (port 80 by default).
 // The server is configured with the provided handler and with reasonable
 // timeouts.
-// The server is also set up to handle graceful shutdowns when receiving
-// SIGINT or SIGTERM signals.
 //
 // Parameters:
 // - `aHandler` (http.Handler): The handler to be invoked for each
 // request received by the server.
+// - `aAddr` (string): The TCP address for the server to listen on.
 //
 // Returns:
 // - `*http.Server`: A pointer to the newly created and configured HTTP server.
-func createServer80(aHandler http.Handler) *http.Server {
-	return createServ(aHandler, ":80")
+func createServer80(aHandler http.Handler, aAddr string) *http.Server {
+	setup := reprox.CurrentSetup()
+
+	return setup.HTTPConns.Apply(
+		reprox.TrackConnections("http",
+			setup.HTTPTimes.Apply(
+				setup.HTTPLimits.Apply(createServ(aHandler, aAddr)))))
 } // createServer80()
 
 // `exit()` logs `aMessage` and terminate the program.
@@ -176,98 +236,439 @@ func createServer80(aHandler http.Handler) *http.Server {
 //
 //	`aMessage` (string): The message to be logged and displayed.
 func exit(aMessage string) {
-	apachelogger.Err("ReProx/main", aMessage)
+	gLog.Err("ReProx/main", aMessage)
 	runtime.Gosched() // let the logger write
 	log.Fatalln(aMessage)
 } // exit()
 
-// `setupSignals()` configures the capture of the interrupts `SIGINT`
-// It also sets up a context for the server and registers a shutdown
-// function to be called when the context is canceled.
+// `parseFlags()` reads the commandline options which override the
+// respective settings read from the configuration file.
+//
+// The option `-config` (or `-ini`) names an INI file to use instead
+// of the files found in the default locations, the option `-profile`
+// selects the configuration profile to apply.
+func parseFlags() {
+	var (
+		accessLog, encrypt, errorLog, httpAddr, httpsAddr string
+	)
+	flag.StringVar(&accessLog, "access-log", "",
+		"name of the access logfile")
+	flag.StringVar(&gBenchHost, "bench", "",
+		"drive synthetic load against the given configured host, report, and exit")
+	flag.IntVar(&gBench.Concurrency, "bench-concurrency", 10,
+		"number of simultaneous load test requests")
+	flag.DurationVar(&gBench.Duration, "bench-duration", 0,
+		"longest duration of the load test (e.g. `30s`)")
+	flag.StringVar(&gBench.Path, "bench-path", "/",
+		"URL path requested by the load test")
+	flag.IntVar(&gBench.Requests, "bench-requests", 0,
+		"number of load test requests (default 1000 without -bench-duration)")
+	flag.StringVar(&gConfigFile, "config", "",
+		"name of the INI file to use")
+	flag.StringVar(&gConfigFile, "ini", "",
+		"same as -config")
+	flag.StringVar(&encrypt, "encrypt-config", "",
+		"encrypt the given INI file to <file>.enc (key in $REPROX_CONFIG_KEY) and exit")
+	flag.StringVar(&errorLog, "error-log", "",
+		"name of the error logfile")
+	flag.StringVar(&httpAddr, "http", "",
+		"address of the HTTP server (e.g. `:8080`)")
+	flag.StringVar(&httpsAddr, "https", "",
+		"address of the HTTPS server (e.g. `:8443`)")
+	flag.BoolVar(&gNoSeccomp, "no-seccomp", false,
+		"don't load the seccomp filter even if `Seccomp` is configured")
+	flag.StringVar(&gProfile, "profile", "",
+		"name of the configuration profile to use (default $REPROX_PROFILE)")
+	flag.Parse()
+
+	if "" != encrypt {
+		if err := reprox.EncryptConfig(encrypt, encrypt+".enc"); nil != err {
+			log.Fatalf("%s: %v", gMe, err)
+		}
+		os.Exit(0)
+	}
+
+	if ("" != gConfigFile) || ("" != gProfile) {
+		if err := reprox.LoadConfig(gConfigFile, gProfile); nil != err {
+			exit(fmt.Sprintf("%s: config %q: %v", gMe, gConfigFile, err))
+		}
+	}
+	// kept for reloaded configurations as well:
+	reprox.SetOverrides(reprox.TOverrides{
+		AccessLog:   accessLog,
+		ErrorLog:    errorLog,
+		HTTPListen:  httpAddr,
+		HTTPSListen: httpsAddr,
+	})
+} // parseFlags()
+
+// `runBench()` runs the load test requested by `-bench` and
+// terminates the program.
 //
 // Parameters:
+// - `aProxy`: The proxy handler to send the requests to.
+func runBench(aProxy *reprox.TProxyHandler) {
+	report, err := aProxy.Bench(gBenchHost, gBench)
+	if nil != err {
+		log.Fatalf("%s: %v", gMe, err)
+	}
+	fmt.Print(report.String())
+	os.Exit(0)
+} // runBench()
+
+// `setupLogSinks()` opens the sinks or lists of destinations
+// configured as `AccessLog`, `ErrorLog`, or `SecurityLog` (see
+// `reprox.OpenLogSink()`).
+//
+// Logs sent to a sink (or written in the W3C format) aren't written
+// to a file by the `ApacheLogger`; that's the case for all logfiles
+// if the process is jailed (see `reprox.Jail()`) since they must be
+// opened before. Such access logs are written by the returned
+// middleware which – like the `ApacheLogger` – is to wrap the whole
+// proxy handler, so requests answered before routing are logged, too.
+//
+// Returns:
+// - `string`: The name of the access logfile for the `ApacheLogger`.
+// - `string`: The name of the error logfile for the `ApacheLogger`.
+// - `reprox.TMiddleware`: The access logging middleware (or `nil`).
+func setupLogSinks() (string, string, reprox.TMiddleware) {
+	setup := reprox.CurrentSetup()
+	accessLog, errorLog := setup.AccessLog, setup.ErrorLog
+	jailed := "" != setup.Chroot
+	var accessLogger reprox.TMiddleware
+
+	if (jailed && ("" != errorLog)) || reprox.IsLogSink(errorLog) {
+		sink, err := reprox.OpenLogSink(errorLog, true)
+		if nil != err {
+			exit(fmt.Sprintf("%s: ErrorLog %q: %v", gMe, errorLog, err))
+		}
+		gErrorSink = sink
+		gLog = reprox.NewWriterLogger(sink)
+		reprox.SetLogger(gLog)
+		errorLog = os.DevNull
+	}
+	w3c := reprox.LogFormatW3C == setup.LogFormat
+	if w3c || (jailed && ("" != accessLog)) || reprox.IsLogSink(accessLog) {
+		sink, err := reprox.OpenLogSink(accessLog, false)
+		if nil != err {
+			exit(fmt.Sprintf("%s: AccessLog %q: %v", gMe, accessLog, err))
+		}
+		if w3c {
+			accessLogger = reprox.AccessLogW3C(sink, setup.LogFields)
+		} else {
+			accessLogger = reprox.AccessLog(sink)
+		}
+		accessLog = os.DevNull
+	}
+	if securityLog := setup.SecurityLog; "" != securityLog {
+		sink, err := reprox.OpenLogSink(securityLog, false)
+		if nil != err {
+			exit(fmt.Sprintf("%s: SecurityLog %q: %v", gMe, securityLog, err))
+		}
+		reprox.SetSecurityLog(sink, setup.SecurityFormat)
+	}
+
+	return accessLog, errorLog, accessLogger
+} // setupLogSinks()
+
+// `setupReload()` reloads the configuration whenever the program
+// receives a `SIGHUP` signal.
+func setupReload() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	go func() {
+		for range c {
+			_, _ = reprox.SdNotify(reprox.SdReloading)
+			err := reprox.LoadConfig(gConfigFile, gProfile)
+			_, _ = reprox.SdNotify(reprox.SdReady)
+			if nil != err {
+				gLog.Err("ReProx/reload",
+					fmt.Sprintf("%s: config not reloaded: %v", gMe, err))
+				continue
+			}
+			gLog.Log("ReProx/reload",
+				fmt.Sprintf("%s: configuration reloaded, %s",
+					gMe, reprox.GetVersionInfo()))
+		}
+	}()
+} // setupReload()
+
+// `setupSignals()` configures the capture of the interrupts `SIGINT`
+// and `SIGTERM` which send the shutdown report and stop the servers.
 //
-//	`aServer` *http.Server - The HTTP server to be gracefully shut down.
-func setupSignals(aServer *http.Server) {
+// Returns:
+// - `context.Context`: The context cancelled by the first signal.
+func setupSignals() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	// handle `CTRL-C` and `kill(15)`:
 	c := make(chan os.Signal, 2)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
-		for signal := range c {
-			msg := fmt.Sprintf("%s captured '%v', stopping program and exiting ...", gMe, signal)
-			apachelogger.Err(`ReProx/catchSignals`, msg)
-			log.Println(msg)
-			break
+		signal := <-c
+		msg := fmt.Sprintf("%s captured '%v', stopping program and exiting ...", gMe, signal)
+		gLog.Err(`ReProx/catchSignals`, msg)
+		log.Println(msg)
+
+		report := reprox.NewShutdownReport(
+			fmt.Sprintf("signal %v", signal), gConnections.Load())
+		if err := report.Send(); nil != err {
+			gLog.Err(`ReProx/catchSignals`, err.Error())
 		}
+		_, _ = reprox.SdNotify(reprox.SdStopping)
+		cancel()
+	}()
 
-		ctx, cancel := context.WithCancel(context.Background())
-		aServer.BaseContext = func(net.Listener) context.Context {
-			return ctx
-		}
-		aServer.RegisterOnShutdown(cancel)
+	return ctx
+} // setupSignals()
 
-		ctxTimeout, cancelTimeout := context.WithTimeout(
-			context.Background(), time.Second<<3,
-		)
-		defer cancelTimeout()
-		if err := aServer.Shutdown(ctxTimeout); err != nil {
-			exit(fmt.Sprintf("%s: %v", gMe, err))
+// `setupUpgrade()` starts a new process of the program taking over
+// the listening sockets whenever the program receives a `SIGUSR2`
+// signal; the new process stops this one once it's ready (see
+// `reprox.Upgrade()`).
+func setupUpgrade() {
+	if nil == gUpgradeSignal {
+		return
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, gUpgradeSignal)
+
+	go func() {
+		for range c {
+			if reprox.CurrentSetup().Seccomp && !gNoSeccomp {
+				gLog.Err("ReProx/upgrade",
+					gMe+": can't start a new process with the seccomp filter loaded")
+				continue
+			}
+			pid, err := reprox.Upgrade()
+			if errors.Is(err, reprox.ErrUpgradeRefused) {
+				continue // already logged
+			}
+			if nil != err {
+				gLog.Err("ReProx/upgrade",
+					fmt.Sprintf("%s: upgrade failed: %v", gMe, err))
+				continue
+			}
+			gLog.Log("ReProx/upgrade",
+				fmt.Sprintf("%s: started new process %d", gMe, pid))
 		}
 	}()
-} // setupSignals()
+} // setupUpgrade()
+
+// `plainFrontends()` returns the frontends not serving HTTPS.
+//
+// Parameters:
+// - `aFrontends`: The configured frontend listeners.
+//
+// Returns:
+// - `[]reprox.TListener`: The plain HTTP listeners.
+func plainFrontends(aFrontends []reprox.TListener) []reprox.TListener {
+	var result []reprox.TListener
+	for _, frontend := range aFrontends {
+		if !frontend.TLS {
+			result = append(result, frontend)
+		}
+	}
+
+	return result
+} // plainFrontends()
+
+// `plainTCPRoutes()` returns the TCP routes not terminating TLS.
+//
+// Parameters:
+// - `aRoutes`: The configured TCP routes.
+//
+// Returns:
+// - `[]reprox.TTCPRoute`: The plain TCP routes.
+func plainTCPRoutes(aRoutes []reprox.TTCPRoute) []reprox.TTCPRoute {
+	var result []reprox.TTCPRoute
+	for _, route := range aRoutes {
+		if !route.TLS {
+			result = append(result, route)
+		}
+	}
+
+	return result
+} // plainTCPRoutes()
+
+// `tlsAddress()` returns the address of the first frontend or TCP
+// route needing the TLS certificate.
+//
+// Parameters:
+// - `aFrontends`: The configured frontend listeners.
+// - `aRoutes`: The configured TCP routes.
+//
+// Returns:
+// - `string`: The address (or empty if no certificate is needed).
+func tlsAddress(aFrontends []reprox.TListener, aRoutes []reprox.TTCPRoute) string {
+	for _, frontend := range aFrontends {
+		if frontend.TLS {
+			return frontend.Address
+		}
+	}
+	for _, route := range aRoutes {
+		if route.TLS {
+			return route.Address
+		}
+	}
+
+	return ""
+} // tlsAddress()
 
 /*
 - @title Main function for the reverse proxy server.
 */
 func main() {
-	var (
-		wg sync.WaitGroup
-	)
-
+	// keep the package's messages in our error log:
+	reprox.SetLogger(gLog)
+	parseFlags()
+	reprox.SetErrorPagesDir(ConfDir())
 	ph := reprox.NewProxyHandler()
+	if "" != gBenchHost {
+		runBench(ph)
+	}
+	if err := reprox.LoadRateState(reprox.CurrentSetup().RateStateFile); nil != err {
+		gLog.Err("ReProx/main", fmt.Sprintf("%s: %v", gMe, err))
+	}
+	accessLog, errorLog, accessLogger := setupLogSinks()
 
-	// setup the `ApacheLogger`:
-	handler := apachelogger.Wrap(ph,
-		reprox.AppSetup.AccessLog, reprox.AppSetup.ErrorLog)
+	s := fmt.Sprintf("%s %s", gMe, reprox.GetVersionInfo())
+	log.Println(s)
+	gLog.Log("ReProx/main", s)
 
-	wg.Add(1)
-	go func() { // HTTP server
-		defer wg.Done()
+	setupReload()
+	reprox.WatchIngresses()
+	reprox.WatchAlerts()
 
-		s := fmt.Sprintf("%s listening HTTP at :80", gMe)
-		log.Println(s)
-		apachelogger.Log("ReProx/main", s)
+	// setup the `ApacheLogger` (and the access logging to sinks):
+	var handler http.Handler = ph
+	if nil != accessLogger {
+		handler = accessLogger(handler)
+	}
+	handler = apachelogger.Wrap(handler, accessLog, errorLog)
 
-		server80 := createServer80(handler)
-		if err := server80.ListenAndServe(); nil != err {
-			exit(fmt.Sprintf("%s:80 %v", gMe, err))
+	setup := reprox.CurrentSetup()
+	// Read the certificate while we may still access it.
+	frontends, tcpRoutes := setup.Frontends(), setup.TCPRoutes
+	var certs *tCertStore
+	if address := tlsAddress(frontends, tcpRoutes); "" != address {
+		serverName := "private.proxy"
+		certFile, keyFile := certFilenames(serverName, ConfDir())
+		certificate, err := certGet(certFile, keyFile, serverName)
+		if nil == err {
+			certs = newCertStore(certFile, keyFile, certificate)
+		} else {
+			if reprox.TLSHTTPOnly != setup.TLSFallback {
+				exit(fmt.Sprintf("%s:%s %v", gMe, address, err))
+			}
+			frontends, tcpRoutes = plainFrontends(frontends), plainTCPRoutes(tcpRoutes)
+			s := fmt.Sprintf("%s: %v – NOT serving HTTPS, only %d plain HTTP listener(s)",
+				gMe, err, len(frontends))
+			log.Println(s)
+			gLog.Err("ReProx/main", s)
+			if 0 == len(frontends)+len(tcpRoutes) {
+				exit(fmt.Sprintf("%s: no listener left to serve", gMe))
+			}
 		}
-	}()
+	}
 
-	wg.Add(1)
-	go func() { // HTTPS server
-		defer wg.Done()
+	// Refuse to run twice with the same PID file.
+	if err := reprox.LockPIDFile(setup.PIDFile); nil != err {
+		exit(fmt.Sprintf("%s: %v", gMe, err))
+	}
 
-		s := fmt.Sprintf("%s listening HTTPS at :443", gMe)
+	// Bind all sockets before dropping the privileges and restricting
+	// the system calls.
+	addrs := []string{setup.AdminListen}
+	for _, frontend := range frontends {
+		addrs = append(addrs, frontend.Address)
+	}
+	for _, route := range tcpRoutes {
+		addrs = append(addrs, route.Address)
+	}
+	listeners, err := reprox.ListenAndDrop(addrs...)
+	if nil != err {
+		exit(fmt.Sprintf("%s: %v", gMe, err))
+	}
+	if setup.Seccomp && !gNoSeccomp {
+		if err := Seccomp(); nil != err {
+			exit(fmt.Sprintf("%s: %v", gMe, err))
+		}
+		gLog.Log("ReProx/main", gMe+": seccomp filter loaded")
+	}
+
+	server := reprox.NewServer(ph)
+	if adminListener := listeners[0]; nil != adminListener {
+		addr := setup.AdminListen
+		s := fmt.Sprintf("%s listening ADMIN at %s", gMe, addr)
 		log.Println(s)
-		apachelogger.Log("ReProx/main", s)
+		gLog.Log("ReProx/main", s)
 
-		serverName := "private.proxy"
-		certPath := ConfDir()
-		certFile, keyFile := certFilenames(serverName, certPath)
-		certificate, err := certGet(certFile, keyFile, serverName, certPath)
-		if nil != err {
-			exit(fmt.Sprintf("%s:443 %v", gMe, err))
+		server.Add(createServ(reprox.NewAdminHandler(ph), addr), adminListener)
+	}
+
+	for idx, frontend := range frontends {
+		listener, addr := frontend.Listener(listeners[idx+1]), frontend.Address
+		if !frontend.TLS {
+			s = fmt.Sprintf("%s listening HTTP at %s", gMe, addr)
+			log.Println(s)
+			gLog.Log("ReProx/main", s)
+			server.Add(createServer80(handler, addr),
+				setup.HTTPConns.Listener(listener))
+			continue
 		}
 
-		server443 := createServer443(handler, certificate)
-		if err := server443.ListenAndServeTLS(certFile, keyFile); nil != err {
-			exit(fmt.Sprintf("%s:443 %v", gMe, err))
+		s = fmt.Sprintf("%s listening HTTPS at %s", gMe, addr)
+		log.Println(s)
+		gLog.Log("ReProx/main", s)
+		server443 := createServer443(handler, certs, addr, ph)
+		// fingerprint the clients' TLS handshakes:
+		server443.ConnContext = reprox.FingerprintContext
+		server.AddTLS(server443, reprox.FingerprintListener(
+			setup.HTTPSConns.Listener(listener)), "", "")
+	}
+
+	tcpListeners := listeners[1+len(frontends):]
+	for idx, route := range tcpRoutes {
+		s = fmt.Sprintf("%s forwarding TCP at %s to %s", gMe, route.Address, route.Backend)
+		log.Println(s)
+		gLog.Log("ReProx/main", s)
+		var config *tls.Config
+		if nil != certs {
+			config = &tls.Config{
+				GetCertificate: certs.GetCertificate,
+				MinVersion:     tls.VersionTLS12,
+			}
 		}
-	}()
+		server.AddTCP(route, tcpListeners[idx], config)
+	}
 
-	wg.Wait()
+	// stop the old process after an upgrade:
+	if err := reprox.HandoffComplete(); nil != err {
+		gLog.Err("ReProx/main", fmt.Sprintf("%s: %v", gMe, err))
+	}
+	setupUpgrade()
+
+	// tell systemd (`Type=notify`) we're ready to serve:
+	if _, err := reprox.SdNotify(fmt.Sprintf("%s\nMAINPID=%d",
+		reprox.SdReady, os.Getpid())); nil != err {
+		gLog.Err("ReProx/main", fmt.Sprintf("%s: sd_notify: %v", gMe, err))
+	}
+	reprox.GoSdWatchdog(ph)
+
+	// serve until `SIGINT` or `SIGTERM`, then drain the requests:
+	err = server.Start(setupSignals())
+	if e2 := reprox.SaveRateState(reprox.CurrentSetup().RateStateFile); nil != e2 {
+		gLog.Err("ReProx/main", fmt.Sprintf("%s: %v", gMe, e2))
+	}
+	if e2 := reprox.RemovePIDFile(); nil != e2 {
+		gLog.Err("ReProx/main", fmt.Sprintf("%s: %v", gMe, e2))
+	}
+	if nil != err {
+		exit(fmt.Sprintf("%s: %v", gMe, err))
+	}
 } // main()
 
 /* _EoF_ */
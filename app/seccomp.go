@@ -0,0 +1,53 @@
+//go:build linux && (amd64 || arm64)
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+		All rights reserved
+	EMail : <support@mwat.de>
+*/
+
+package main
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import "golang.org/x/sys/unix"
+
+// System calls needed by the reverse proxy on all supported
+// architectures (see `Seccomp()`):
+var gSeccompCalls = []uintptr{
+	// files and logs:
+	unix.SYS_READ, unix.SYS_WRITE, unix.SYS_READV, unix.SYS_WRITEV,
+	unix.SYS_PREAD64, unix.SYS_PWRITE64, unix.SYS_OPENAT, unix.SYS_CLOSE,
+	unix.SYS_LSEEK, unix.SYS_FSTAT, unix.SYS_STATX,
+	unix.SYS_FCNTL, unix.SYS_IOCTL, unix.SYS_GETDENTS64,
+	unix.SYS_READLINKAT, unix.SYS_FACCESSAT, unix.SYS_FACCESSAT2,
+	unix.SYS_FSYNC, unix.SYS_FDATASYNC, unix.SYS_FTRUNCATE,
+	unix.SYS_MKDIRAT, unix.SYS_RENAMEAT2,
+	unix.SYS_UNLINKAT, unix.SYS_GETCWD, unix.SYS_FCHMOD, unix.SYS_FCHMODAT,
+	// memory, threads, and signals (Go runtime):
+	unix.SYS_MMAP, unix.SYS_MUNMAP, unix.SYS_MPROTECT, unix.SYS_MADVISE,
+	unix.SYS_BRK, unix.SYS_FUTEX, unix.SYS_NANOSLEEP,
+	unix.SYS_CLOCK_GETTIME, unix.SYS_CLOCK_NANOSLEEP, unix.SYS_GETTIMEOFDAY,
+	unix.SYS_SCHED_YIELD, unix.SYS_SCHED_GETAFFINITY, unix.SYS_GETPID,
+	unix.SYS_GETTID, unix.SYS_TGKILL, unix.SYS_TKILL, unix.SYS_KILL,
+	unix.SYS_GETUID, unix.SYS_GETEUID, unix.SYS_GETGID, unix.SYS_GETEGID,
+	unix.SYS_UNAME, unix.SYS_PRLIMIT64, unix.SYS_GETRLIMIT,
+	unix.SYS_SET_ROBUST_LIST, unix.SYS_RSEQ, unix.SYS_RESTART_SYSCALL,
+	unix.SYS_EXIT, unix.SYS_EXIT_GROUP, unix.SYS_RT_SIGACTION,
+	unix.SYS_RT_SIGPROCMASK, unix.SYS_RT_SIGRETURN, unix.SYS_SIGALTSTACK,
+	unix.SYS_CLONE, unix.SYS_CLONE3, unix.SYS_GETRANDOM, unix.SYS_PRCTL,
+	unix.SYS_MEMBARRIER,
+	// network poller:
+	unix.SYS_EPOLL_CREATE1, unix.SYS_EPOLL_CTL, unix.SYS_EPOLL_PWAIT,
+	unix.SYS_EPOLL_PWAIT2, unix.SYS_EVENTFD2, unix.SYS_PIPE2,
+	unix.SYS_PPOLL, unix.SYS_PSELECT6, unix.SYS_DUP3,
+	// sockets (without `bind` and `listen`):
+	unix.SYS_SOCKET, unix.SYS_CONNECT, unix.SYS_ACCEPT4,
+	unix.SYS_SETSOCKOPT, unix.SYS_GETSOCKOPT, unix.SYS_GETSOCKNAME,
+	unix.SYS_GETPEERNAME, unix.SYS_SENDTO, unix.SYS_RECVFROM,
+	unix.SYS_SENDMSG, unix.SYS_RECVMSG, unix.SYS_SHUTDOWN,
+	unix.SYS_SENDFILE, unix.SYS_SPLICE,
+}
+
+/* _EoF_ */
@@ -0,0 +1,28 @@
+//go:build linux
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+		All rights reserved
+	EMail : <support@mwat.de>
+*/
+package main
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import "golang.org/x/sys/unix"
+
+// Architecture checked by the seccomp filter (see `Seccomp()`):
+const gSeccompArch = unix.AUDIT_ARCH_X86_64
+
+// Legacy system calls still used on amd64 (and ones not available
+// on all architectures):
+var gSeccompArchCalls = []uintptr{
+	unix.SYS_OPEN, unix.SYS_STAT, unix.SYS_LSTAT, unix.SYS_ACCESS,
+	unix.SYS_READLINK, unix.SYS_POLL, unix.SYS_SELECT, unix.SYS_PIPE,
+	unix.SYS_EPOLL_WAIT, unix.SYS_EPOLL_CREATE, unix.SYS_ARCH_PRCTL,
+	unix.SYS_TIME, unix.SYS_GETDENTS, unix.SYS_MKDIR, unix.SYS_RENAME,
+	unix.SYS_UNLINK, unix.SYS_DUP2, unix.SYS_RENAMEAT, unix.SYS_NEWFSTATAT,
+}
+
+/* _EoF_ */
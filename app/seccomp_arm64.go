@@ -0,0 +1,23 @@
+//go:build linux
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+		All rights reserved
+	EMail : <support@mwat.de>
+*/
+package main
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import "golang.org/x/sys/unix"
+
+// Architecture checked by the seccomp filter (see `Seccomp()`):
+const gSeccompArch = unix.AUDIT_ARCH_AARCH64
+
+// System calls not available on all architectures:
+var gSeccompArchCalls = []uintptr{
+	unix.SYS_RENAMEAT, unix.SYS_NEWFSTATAT,
+}
+
+/* _EoF_ */
@@ -0,0 +1,20 @@
+//go:build !linux || (!amd64 && !arm64)
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+		All rights reserved
+	EMail : <support@mwat.de>
+*/
+
+package main
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+// The seccomp filter isn't available on other systems or architectures
+// (see `Seccomp()`):
+const gSeccompArch = 0
+
+var gSeccompCalls, gSeccompArchCalls []uintptr
+
+/* _EoF_ */
@@ -0,0 +1,19 @@
+//go:build !unix
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+		All rights reserved
+	EMail : <support@mwat.de>
+*/
+package main
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import "os"
+
+// There's no signal requesting a binary upgrade on other systems
+// (see `setupUpgrade()`):
+var gUpgradeSignal os.Signal
+
+/* _EoF_ */
@@ -0,0 +1,21 @@
+//go:build unix
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+		All rights reserved
+	EMail : <support@mwat.de>
+*/
+package main
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signal requesting a binary upgrade (see `setupUpgrade()`):
+var gUpgradeSignal os.Signal = syscall.SIGUSR2
+
+/* _EoF_ */
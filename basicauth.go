@@ -0,0 +1,148 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mwat56/ini"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type (
+	// Per-host basic authentication settings:
+	tBasicAuth struct {
+		realm  string            // realm sent with the challenge
+		users  map[string][]byte // bcrypt hashes by username
+		passed sync.Map          // hashes of verified credentials
+	}
+)
+
+// `check()` validates the basic authentication credentials sent with
+// `aRequest`.
+//
+// Since bcrypt is slow by design, credentials once verified are
+// remembered (by their SHA-256 hash) until the next configuration load.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the credentials are valid.
+func (ba *tBasicAuth) check(aRequest *http.Request) bool {
+	user, pass, ok := aRequest.BasicAuth()
+	if !ok {
+		return false
+	}
+	hash, ok := ba.users[user]
+	if !ok {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(user + ":" + pass))
+	if _, ok = ba.passed.Load(sum); ok {
+		return true
+	}
+	if nil != bcrypt.CompareHashAndPassword(hash, []byte(pass)) {
+		return false
+	}
+	ba.passed.Store(sum, struct{}{})
+
+	return true
+} // check()
+
+// `challenge()` asks the client for credentials.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+func (ba *tBasicAuth) challenge(aWriter http.ResponseWriter) {
+	aWriter.Header().Set("WWW-Authenticate",
+		fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", ba.realm))
+	http.Error(aWriter, http.StatusText(http.StatusUnauthorized),
+		http.StatusUnauthorized)
+} // challenge()
+
+// `readHtpasswd()` reads the bcrypt hashed credentials from the
+// htpasswd-style file `aFilename` (`user:$2y$…` per line).
+//
+// Parameters:
+// - `aFilename`: The name of the credentials file.
+//
+// Returns:
+// - `map[string][]byte`: The hashes by username.
+// - `error`: A possible error reading the file.
+func readHtpasswd(aFilename string) (map[string][]byte, error) {
+	file, err := os.Open(aFilename) // #nosec G304
+	if nil != err {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make(map[string][]byte)
+	scanner := bufio.NewScanner(file)
+	for lNo := 1; scanner.Scan(); lNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if ("" == line) || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || !strings.HasPrefix(hash, "$2") {
+			logErr("ReProx/readHtpasswd",
+				fmt.Sprintf("%s:%d: not a bcrypt entry", aFilename, lNo))
+			continue
+		}
+		result[user] = []byte(hash)
+	}
+
+	return result, scanner.Err()
+} // readHtpasswd()
+
+// `readBasicAuth()` reads the host's basic authentication settings:
+//
+//	authBasic = /etc/reprox/dashboard.htpasswd
+//	authRealm = Dashboard
+//
+// If the credentials file can't be read the error is logged and all
+// requests are refused.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tBasicAuth`: The host's settings or `nil` if it's disabled.
+func readBasicAuth(aIni *ini.TSectionList, aSection string) *tBasicAuth {
+	fName, ok := hostString(aIni, aSection, "authBasic")
+	if !ok || ("" == fName) {
+		return nil
+	}
+
+	users, err := readHtpasswd(fName)
+	if nil != err {
+		logErr("ReProx/readBasicAuth",
+			fmt.Sprintf("[%s] authBasic: %v", aSection, err))
+	}
+	result := &tBasicAuth{
+		realm: "Restricted",
+		users: users,
+	}
+	if s, ok := hostString(aIni, aSection, "authRealm"); ok {
+		result.realm = s
+	}
+
+	return result
+} // readBasicAuth()
+
+/* _EoF_ */
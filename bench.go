@@ -0,0 +1,188 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// `TBenchOptions` holds the parameters of a load test (see `Bench()`).
+	TBenchOptions struct {
+		Path        string        // URL path to request (default `/`)
+		Requests    int           // number of requests (`0`: until `Duration`)
+		Duration    time.Duration // (optional) longest duration of the test
+		Concurrency int           // simultaneous requests (default `10`)
+	}
+
+	// `TBenchReport` holds the results of a load test.
+	TBenchReport struct {
+		Requests int           // requests sent
+		Failures int           // requests failing with a `5xx` status
+		Statuses map[int]int   // number of responses by status
+		Elapsed  time.Duration // duration of the test
+		Rate     float64       // requests per second
+		P50      time.Duration // median latency
+		P90      time.Duration // 90th percentile of the latencies
+		P99      time.Duration // 99th percentile of the latencies
+		Max      time.Duration // longest latency
+		Allocs   uint64        // heap allocations per request
+		Bytes    uint64        // allocated bytes per request
+	}
+)
+
+const (
+	// User agent of the synthetic load test requests:
+	benchUserAgent = "reprox-bench"
+)
+
+// `Bench()` drives synthetic load against the configured `aHost`
+// through the proxy handler (i.e. including routing, the host's
+// settings, and the backend) and reports throughput, latencies, and
+// allocations, to make performance regressions visible.
+//
+// Parameters:
+// - `aHost`: The (outside) hostname to test.
+// - `aOptions`: The parameters of the test.
+//
+// Returns:
+// - `*TBenchReport`: The test's results.
+// - `error`: `ErrHostNotFound` if `aHost` isn't configured.
+func (ph *TProxyHandler) Bench(aHost string, aOptions TBenchOptions) (*TBenchReport, error) {
+	host := normaliseHost(aHost)
+	if _, ok := ph.routes.Load().backendServers[host]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrHostNotFound, aHost)
+	}
+	if "" == aOptions.Path {
+		aOptions.Path = "/"
+	}
+	if 0 >= aOptions.Concurrency {
+		aOptions.Concurrency = 10
+	}
+	if (0 >= aOptions.Requests) && (0 >= aOptions.Duration) {
+		aOptions.Requests = 1000
+	}
+	var deadline time.Time
+	if 0 < aOptions.Duration {
+		deadline = time.Now().Add(aOptions.Duration)
+	}
+
+	var (
+		mtx       sync.Mutex
+		next      atomic.Int64
+		latencies []time.Duration
+		wg        sync.WaitGroup
+		before    runtime.MemStats
+		after     runtime.MemStats
+	)
+	result := &TBenchReport{Statuses: make(map[int]int)}
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for range aOptions.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var (
+				own      []time.Duration
+				statuses = make(map[int]int)
+			)
+			for {
+				if n := next.Add(1); (0 < aOptions.Requests) && (int64(aOptions.Requests) < n) {
+					break
+				}
+				if !deadline.IsZero() && time.Now().After(deadline) {
+					break
+				}
+				request, err := http.NewRequest(http.MethodGet, "http://"+host+aOptions.Path, nil)
+				if nil != err {
+					break
+				}
+				request.Header.Set("User-Agent", benchUserAgent)
+				request.RemoteAddr = "127.0.0.1:0"
+				writer := &tSmokeWriter{header: make(http.Header)}
+
+				began := time.Now()
+				ph.ServeHTTP(writer, request)
+				own = append(own, time.Since(began))
+				if 0 == writer.status {
+					writer.status = http.StatusOK
+				}
+				statuses[writer.status]++
+			}
+
+			mtx.Lock()
+			latencies = append(latencies, own...)
+			for status, count := range statuses {
+				result.Statuses[status] += count
+			}
+			mtx.Unlock()
+		}()
+	}
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	if result.Requests = len(latencies); 0 == result.Requests {
+		return result, nil
+	}
+	for status, count := range result.Statuses {
+		if http.StatusInternalServerError <= status {
+			result.Failures += count
+		}
+	}
+	result.Rate = float64(result.Requests) / result.Elapsed.Seconds()
+	slices.Sort(latencies)
+	percentile := func(aShare float64) time.Duration {
+		return latencies[int(aShare*float64(len(latencies)-1))]
+	}
+	result.P50, result.P90, result.P99 = percentile(0.5), percentile(0.9), percentile(0.99)
+	result.Max = latencies[len(latencies)-1]
+	result.Allocs = (after.Mallocs - before.Mallocs) / uint64(result.Requests)
+	result.Bytes = (after.TotalAlloc - before.TotalAlloc) / uint64(result.Requests)
+
+	return result, nil
+} // Bench()
+
+// `String()` returns the report in human readable form.
+//
+// Returns:
+// - `string`: The formatted report.
+func (br *TBenchReport) String() string {
+	statuses := make([]int, 0, len(br.Statuses))
+	for status := range br.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "requests:  %d in %v (%.1f/s), %d failed\n",
+		br.Requests, br.Elapsed.Round(time.Millisecond), br.Rate, br.Failures)
+	fmt.Fprintf(&sb, "latency:   p50 %v, p90 %v, p99 %v, max %v\n",
+		br.P50, br.P90, br.P99, br.Max)
+	fmt.Fprintf(&sb, "allocs:    %d (%d bytes) per request\n", br.Allocs, br.Bytes)
+	sb.WriteString("statuses: ")
+	for _, status := range statuses {
+		fmt.Fprintf(&sb, " %d×%d", status, br.Statuses[status])
+	}
+	sb.WriteByte('\n')
+
+	return sb.String()
+} // String()
+
+/* _EoF_ */
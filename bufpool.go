@@ -0,0 +1,71 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"sync"
+)
+
+type (
+	// Pool of the buffers used to copy response bodies, shared by all
+	// reverse proxies (implements `httputil.BufferPool`):
+	tBufferPool struct {
+		pool    sync.Pool // pointers to the buffers
+		holders sync.Pool // unused pointers (to avoid allocating them)
+	}
+)
+
+const (
+	// Size of the buffers used to copy response bodies (the same as
+	// `httputil.ReverseProxy` allocates without a pool):
+	bufferSize = 32 << 10
+)
+
+var (
+	// The proxies' buffer pool:
+	gBufferPool = &tBufferPool{
+		pool: sync.Pool{
+			New: func() any {
+				buf := make([]byte, bufferSize)
+				return &buf
+			},
+		},
+	}
+)
+
+// `Get()` returns a buffer from the pool.
+//
+// Returns:
+// - `[]byte`: A buffer of `bufferSize` bytes.
+func (bp *tBufferPool) Get() []byte {
+	holder := bp.pool.Get().(*[]byte)
+	result := *holder
+	*holder = nil
+	bp.holders.Put(holder)
+
+	return result
+} // Get()
+
+// `Put()` returns `aBuffer` to the pool.
+//
+// Parameters:
+// - `aBuffer`: The buffer to reuse.
+func (bp *tBufferPool) Put(aBuffer []byte) {
+	if bufferSize != cap(aBuffer) {
+		return
+	}
+	holder, ok := bp.holders.Get().(*[]byte)
+	if !ok {
+		holder = new([]byte)
+	}
+	*holder = aBuffer[:bufferSize]
+	bp.pool.Put(holder)
+} // Put()
+
+/* _EoF_ */
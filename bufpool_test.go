@@ -0,0 +1,104 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"sync"
+	"testing"
+)
+
+type (
+	// `ResponseWriter` dropping the response (to measure the proxy only):
+	tDiscardWriter struct {
+		header http.Header
+	}
+
+	// The former buffer pool allocating a pointer with each `Put()`
+	// (kept to compare the allocations):
+	tLegacyPool struct {
+		pool sync.Pool
+	}
+)
+
+func (lp *tLegacyPool) Get() []byte {
+	return *lp.pool.Get().(*[]byte)
+}
+
+func (lp *tLegacyPool) Put(aBuffer []byte) {
+	if bufferSize != cap(aBuffer) {
+		return
+	}
+	aBuffer = aBuffer[:bufferSize]
+	lp.pool.Put(&aBuffer)
+}
+
+func (dw *tDiscardWriter) Header() http.Header             { return dw.header }
+func (dw *tDiscardWriter) Write(aData []byte) (int, error) { return len(aData), nil }
+func (dw *tDiscardWriter) WriteHeader(int)                 {}
+
+func BenchmarkProxyLargeBody(b *testing.B) {
+	body := bytes.Repeat([]byte("0123456789abcdef"), 64<<10) // 1 MiB
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	defer backend.Close()
+
+	for _, bc := range []struct {
+		name string
+		pool httputil.BufferPool
+	}{
+		{"unpooled", nil},
+		{"pooled", gBufferPool},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			proxy := newTestProxy(b, backend.URL, func(aDest *tDestination) {
+				rp, err := createReverseProxy(aDest)
+				if nil != err {
+					b.Fatal(err)
+				}
+				rp.BufferPool = bc.pool
+				aDest.destProxy = rp
+			})
+			req := httptest.NewRequest(http.MethodGet, "http://"+testHost+"/", nil)
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				proxy.ServeHTTP(&tDiscardWriter{header: make(http.Header)}, req)
+			}
+		})
+	}
+} // BenchmarkProxyLargeBody()
+
+func BenchmarkBufferPool(b *testing.B) {
+	newBuffer := func() any {
+		buf := make([]byte, bufferSize)
+		return &buf
+	}
+	for _, bc := range []struct {
+		name string
+		pool httputil.BufferPool
+	}{
+		{"pointer", &tLegacyPool{pool: sync.Pool{New: newBuffer}}},
+		{"holders", &tBufferPool{pool: sync.Pool{New: newBuffer}}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				bc.pool.Put(bc.pool.Get())
+			}
+		})
+	}
+} // BenchmarkBufferPool()
+
+/* _EoF_ */
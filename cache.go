@@ -0,0 +1,530 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// A single cached backend response:
+	tCacheEntry struct {
+		path    string // the request's URL path
+		status  int
+		header  http.Header
+		body    []byte
+		stored  time.Time
+		expires time.Time
+	}
+
+	// Per-host in-memory cache of backend responses:
+	tHostCache struct {
+		sync.RWMutex
+		entries   map[string]*tCacheEntry
+		size      int64         // current size of all bodies
+		maxSize   int64         // maximum size of all bodies
+		maxObject int64         // maximum size of a single body
+		ttl       time.Duration // (optional) TTL overriding the backend's
+	}
+
+	// Type of the context key holding a request's `tCacheRef`:
+	tCacheKeyKey struct{}
+
+	// Cache key and URL path of an incoming request:
+	tCacheRef struct {
+		key  string
+		path string
+	}
+
+	// Response body wrapper capturing a cacheable response:
+	tCacheBody struct {
+		io.ReadCloser
+		buf   bytes.Buffer
+		cache *tHostCache
+		key   string
+		entry *tCacheEntry
+		full  bool // whether the body was read completely
+	}
+
+	// `TCacheReport` holds the cache statistics of a single host.
+	TCacheReport struct {
+		Entries int    `json:"entries"`
+		Size    int64  `json:"size"`
+		Hits    uint64 `json:"hits"`
+		Misses  uint64 `json:"misses"`
+	}
+)
+
+// `newResponseCache()` returns a new, empty response cache.
+//
+// Parameters:
+// - `aMaxSize`: The maximum size of all cached bodies.
+// - `aMaxObject`: The maximum size of a single cached body.
+// - `aTTL`: The TTL to use instead of the backend's (`0`: none).
+//
+// Returns:
+// - `*tHostCache`: The new cache.
+func newResponseCache(aMaxSize, aMaxObject int64, aTTL time.Duration) *tHostCache {
+	return &tHostCache{
+		entries:   make(map[string]*tCacheEntry),
+		maxSize:   aMaxSize,
+		maxObject: aMaxObject,
+		ttl:       aTTL,
+	}
+} // newResponseCache()
+
+// `cacheKey()` returns the key under which the response to `aRequest`
+// is cached, or an empty string if it mustn't be cached.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `string`: The request's cache key.
+func cacheKey(aRequest *http.Request) string {
+	// responses to requests with cookies are likely personalised:
+	if (http.MethodGet != aRequest.Method) ||
+		("" != aRequest.Header.Get("Authorization")) ||
+		("" != aRequest.Header.Get("Cookie")) ||
+		("" != aRequest.Header.Get("Range")) {
+		return ""
+	}
+
+	// the encoding is part of the key since the backend (or our
+	// own compression) may send differently encoded bodies, and
+	// so is an A/B test's variant:
+	return normaliseHost(aRequest.Host) + aRequest.URL.RequestURI() + "\x00" +
+		aRequest.Header.Get("Accept-Encoding") + "\x00" +
+		aRequest.Header.Get(abHeader)
+} // cacheKey()
+
+// `varyKeyed()` checks whether all request headers named by the
+// response's `Vary` header are part of the cache key (see `cacheKey()`),
+// since a cached response would be served for other values otherwise.
+//
+// Parameters:
+// - `aHeader`: The backend's response headers.
+//
+// Returns:
+// - `bool`: `true` if the response may be cached under the key.
+func varyKeyed(aHeader http.Header) bool {
+	for _, value := range aHeader.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			switch http.CanonicalHeaderKey(strings.TrimSpace(name)) {
+			case "", "Accept-Encoding", abHeader:
+			default:
+				return false // including `*`
+			}
+		}
+	}
+
+	return true
+} // varyKeyed()
+
+// `cacheLifetime()` returns how long `aResponse` may be cached
+// according to its `Cache-Control` and `Expires` headers.
+//
+// Parameters:
+// - `aResponse`: The backend's response.
+//
+// Returns:
+// - `time.Duration`: The response's lifetime.
+// - `bool`: `false` if the response mustn't be cached at all.
+func cacheLifetime(aResponse *http.Response) (time.Duration, bool) {
+	var (
+		maxAge  time.Duration = -1
+		sMaxAge time.Duration = -1
+	)
+	for _, directive := range strings.Split(aResponse.Header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return 0, false
+		case "max-age":
+			if secs, err := strconv.Atoi(strings.Trim(value, `"`)); nil == err {
+				maxAge = time.Duration(secs) * time.Second
+			}
+		case "s-maxage":
+			if secs, err := strconv.Atoi(strings.Trim(value, `"`)); nil == err {
+				sMaxAge = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	if 0 <= sMaxAge {
+		return sMaxAge, true
+	}
+	if 0 <= maxAge {
+		return maxAge, true
+	}
+	if s := aResponse.Header.Get("Expires"); "" != s {
+		expires, err := http.ParseTime(s)
+		if nil != err {
+			return 0, false // invalid dates mean "already expired"
+		}
+		return time.Until(expires), true
+	}
+
+	return 0, true
+} // cacheLifetime()
+
+// `get()` returns the unexpired entry stored for `aKey`.
+//
+// Parameters:
+// - `aKey`: The request's cache key.
+//
+// Returns:
+// - `*tCacheEntry`: The cached response or `nil` if there's none.
+func (rc *tHostCache) get(aKey string) *tCacheEntry {
+	rc.RLock()
+	defer rc.RUnlock()
+
+	entry, ok := rc.entries[aKey]
+	if !ok || time.Now().After(entry.expires) {
+		return nil
+	}
+
+	return entry
+} // get()
+
+// `purge()` removes all entries whose request path starts with
+// `aPrefix`, or all entries if `aPrefix` is empty.
+//
+// Parameters:
+// - `aPrefix`: The path prefix of the entries to remove.
+//
+// Returns:
+// - `int`: The number of removed entries.
+func (rc *tHostCache) purge(aPrefix string) (rCount int) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	for key, entry := range rc.entries {
+		if strings.HasPrefix(entry.path, aPrefix) {
+			rc.size -= int64(len(entry.body))
+			gMemBudget.release(int64(len(entry.body)))
+			delete(rc.entries, key)
+			rCount++
+		}
+	}
+
+	return
+} // purge()
+
+// `retire()` empties the cache of a replaced configuration, returning
+// its memory to the budget; responses still being captured aren't
+// stored anymore.
+func (rc *tHostCache) retire() {
+	rc.Lock()
+	rc.maxSize = 0
+	rc.Unlock()
+
+	rc.purge("")
+} // retire()
+
+// `report()` returns the cache's current statistics.
+//
+// Parameters:
+// - `aHost`: The hostname whose counters to include.
+//
+// Returns:
+// - `TCacheReport`: The cache statistics.
+func (rc *tHostCache) report(aHost string) TCacheReport {
+	rc.RLock()
+	defer rc.RUnlock()
+
+	hs := hostStats(aHost)
+	return TCacheReport{
+		Entries: len(rc.entries),
+		Size:    rc.size,
+		Hits:    hs.cacheHits.Load(),
+		Misses:  hs.cacheMisses.Load(),
+	}
+} // report()
+
+// `store()` remembers `aEntry` under `aKey`.
+//
+// Expired entries are dropped if the cache is full; if there's still
+// not enough room the entry isn't stored.
+//
+// The entry's body is accounted for in the memory budget (see
+// `tCacheBody.Read()`) until it's removed from the cache.
+//
+// Parameters:
+// - `aKey`: The request's cache key.
+// - `aEntry`: The response to cache.
+//
+// Returns:
+// - `bool`: `false` if the entry wasn't stored.
+func (rc *tHostCache) store(aKey string, aEntry *tCacheEntry) bool {
+	rc.Lock()
+	defer rc.Unlock()
+
+	size := int64(len(aEntry.body))
+	if old, ok := rc.entries[aKey]; ok {
+		rc.size -= int64(len(old.body))
+		gMemBudget.release(int64(len(old.body)))
+		delete(rc.entries, aKey)
+	}
+	if rc.maxSize < rc.size+size {
+		now := time.Now()
+		for key, entry := range rc.entries {
+			if now.After(entry.expires) {
+				rc.size -= int64(len(entry.body))
+				gMemBudget.release(int64(len(entry.body)))
+				delete(rc.entries, key)
+			}
+		}
+		if rc.maxSize < rc.size+size {
+			return false // cache full
+		}
+	}
+	rc.entries[aKey] = aEntry
+	rc.size += size
+
+	return true
+} // store()
+
+// `Read()` reads from the wrapped body while capturing it for the
+// cache (unless it grows larger than the cache's object limit or the
+// memory budget is exhausted, in which case it's just streamed).
+//
+// Parameters:
+// - `aData`: The buffer to read into.
+//
+// Returns:
+// - `int`: The number of bytes read.
+// - `error`: A possible read error (including `io.EOF`).
+func (cb *tCacheBody) Read(aData []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(aData)
+	if (0 < n) && (nil != cb.entry) {
+		if (cb.cache.maxObject < int64(cb.buf.Len()+n)) || !gMemBudget.reserve(int64(n)) {
+			cb.drop()
+		} else {
+			cb.buf.Write(aData[:n])
+		}
+	}
+	if io.EOF == err {
+		cb.full = true
+	}
+
+	return n, err
+} // Read()
+
+// `Close()` closes the wrapped body and stores the captured response
+// if it was read completely.
+//
+// Returns:
+// - `error`: A possible error closing the wrapped body.
+func (cb *tCacheBody) Close() error {
+	if cb.full && (nil != cb.entry) {
+		cb.entry.body = bytes.Clone(cb.buf.Bytes())
+		if !cb.cache.store(cb.key, cb.entry) {
+			gMemBudget.release(int64(len(cb.entry.body)))
+		}
+		cb.entry = nil
+	}
+	cb.drop()
+
+	return cb.ReadCloser.Close()
+} // Close()
+
+// `drop()` stops capturing the body, returning the memory used so far
+// to the budget.
+func (cb *tCacheBody) drop() {
+	if nil != cb.entry {
+		gMemBudget.release(int64(cb.buf.Len()))
+		cb.entry = nil
+	}
+	cb.buf.Reset()
+} // drop()
+
+// `cacheCapture()` arranges for a cacheable backend response to be
+// stored in `aCache` while it's sent to the client.
+//
+// It's meant to be used as the last part of a proxy's
+// `ModifyResponse` hook so that the cached response includes all
+// other modifications.
+//
+// Parameters:
+// - `aCache`: The host's response cache.
+// - `aResponse`: The backend's response.
+func cacheCapture(aCache *tHostCache, aResponse *http.Response) {
+	ref, ok := aResponse.Request.Context().Value(tCacheKeyKey{}).(tCacheRef)
+	if !ok || (http.StatusOK != aResponse.StatusCode) ||
+		("" != aResponse.Header.Get("Set-Cookie")) ||
+		!varyKeyed(aResponse.Header) ||
+		(0 < len(aResponse.Trailer)) ||
+		(aCache.maxObject < aResponse.ContentLength) {
+		return
+	}
+
+	ttl, ok := cacheLifetime(aResponse)
+	if !ok {
+		return
+	}
+	if 0 < aCache.ttl {
+		ttl = aCache.ttl
+	}
+	if 0 >= ttl {
+		return
+	}
+
+	now := time.Now()
+	aResponse.Body = &tCacheBody{
+		ReadCloser: aResponse.Body,
+		cache:      aCache,
+		key:        ref.key,
+		entry: &tCacheEntry{
+			path:    ref.path,
+			status:  aResponse.StatusCode,
+			header:  aResponse.Header.Clone(),
+			stored:  now,
+			expires: now.Add(ttl),
+		},
+	}
+} // cacheCapture()
+
+// `serveCached()` sends the cached response for `aRequest` if there
+// is one; otherwise the request is marked for caching its response.
+//
+// Parameters:
+// - `aHost`: The (normalised) requested hostname.
+// - `aDestination`: The backend configuration of the requested host.
+// - `aWriter`: The `ResponseWriter` to write the cached response to.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `*http.Request`: The request to forward, or `nil` if it was served.
+func serveCached(aHost string, aDestination *tDestination, aWriter http.ResponseWriter, aRequest *http.Request) *http.Request {
+	if nil == aDestination.cache {
+		return aRequest
+	}
+	key := cacheKey(aRequest)
+	if "" == key {
+		return aRequest
+	}
+
+	if cc := aRequest.Header.Get("Cache-Control"); !strings.Contains(cc, "no-cache") {
+		if entry := aDestination.cache.get(key); nil != entry {
+			hostStats(aHost).cacheHits.Add(1)
+			header := aWriter.Header()
+			for name, values := range entry.header {
+				header[name] = values
+			}
+			header.Set("Age", strconv.Itoa(int(time.Since(entry.stored).Seconds())))
+			header.Set("Content-Length", strconv.Itoa(len(entry.body)))
+			header.Set("X-Cache", "HIT")
+			aWriter.WriteHeader(entry.status)
+			_, _ = aWriter.Write(entry.body)
+			return nil
+		}
+	}
+	hostStats(aHost).cacheMisses.Add(1)
+
+	// remember the original path since the backend's may differ:
+	return aRequest.WithContext(context.WithValue(aRequest.Context(),
+		tCacheKeyKey{}, tCacheRef{key, aRequest.URL.Path}))
+} // serveCached()
+
+// `PurgeCache()` removes the cached responses of `aHost` whose
+// request path starts with `aPrefix` (all if `aPrefix` is empty).
+//
+// Parameters:
+// - `aHost`: The (outside) hostname whose cache to purge.
+// - `aPrefix`: The path prefix of the responses to remove.
+//
+// Returns:
+// - `int`: The number of removed responses.
+// - `bool`: `false` if `aHost` isn't configured with a cache.
+func (ph *TProxyHandler) PurgeCache(aHost, aPrefix string) (int, bool) {
+	host := normaliseHost(aHost)
+	dest, ok := ph.routes.Load().backendServers[host]
+	if !ok || (nil == dest.cache) {
+		return 0, false
+	}
+
+	return dest.cache.purge(aPrefix), true
+} // PurgeCache()
+
+// `handleCache()` sends the cache statistics of all hosts as JSON
+// (`GET`) or purges a host's cache (`POST` with the form values
+// `host` and optionally `path`).
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (ph *TProxyHandler) handleCache(aWriter http.ResponseWriter, aRequest *http.Request) {
+	switch aRequest.Method {
+	case http.MethodGet:
+		reports := make(map[string]TCacheReport)
+		for host, dest := range ph.routes.Load().backendServers {
+			if nil != dest.cache {
+				reports[host] = dest.cache.report(host)
+			}
+		}
+		aWriter.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(aWriter).Encode(reports)
+
+	case http.MethodPost:
+		count, ok := ph.PurgeCache(aRequest.FormValue("host"), aRequest.FormValue("path"))
+		if !ok {
+			http.Error(aWriter, "unknown host or no cache", http.StatusNotFound)
+			return
+		}
+		aWriter.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(aWriter).Encode(map[string]int{"purged": count})
+
+	default:
+		http.Error(aWriter, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+	}
+} // handleCache()
+
+// `readCache()` reads the host's response cache settings:
+//
+//	cache = true
+//	cacheTTL = 5m
+//	cacheMaxObject = 1048576
+//	cacheMaxSize = 67108864
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tHostCache`: The host's cache or `nil` if it's disabled.
+func readCache(aIni *ini.TSectionList, aSection string) *tHostCache {
+	if on, _ := hostBool(aIni, aSection, "cache"); !on {
+		return nil
+	}
+
+	ttl, _ := hostDuration(aIni, aSection, "cacheTTL")
+	maxObject, ok := hostInt(aIni, aSection, "cacheMaxObject")
+	if !ok || (0 >= maxObject) {
+		maxObject = 1 << 20
+	}
+	maxSize, ok := hostInt(aIni, aSection, "cacheMaxSize")
+	if !ok || (0 >= maxSize) {
+		maxSize = 64 << 20
+	}
+
+	return newResponseCache(int64(maxSize), int64(maxObject), ttl)
+} // readCache()
+
+/* _EoF_ */
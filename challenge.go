@@ -0,0 +1,268 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host challenge of suspicious clients:
+	tChallenge struct {
+		mode    string        // `cookie` or `js`
+		secret  []byte        // key of the cookie's signature
+		ttl     time.Duration // validity of a passed challenge
+		headers bool          // whether missing common headers are suspicious
+		rate    *tClientLimit // (optional) request rate deemed suspicious
+	}
+)
+
+const (
+	// `ChallengeCookie` challenges clients by a redirect setting a
+	// cookie, to keep out clients which don't handle cookies.
+	ChallengeCookie = "cookie"
+
+	// `ChallengeJS` challenges clients by a page setting the cookie
+	// by JavaScript, to keep out clients which don't run scripts.
+	ChallengeJS = "js"
+
+	// Name of the cookie proving a passed challenge:
+	challengeName = "__reprox_ch"
+)
+
+var (
+	// Random key of the challenge cookies of hosts without a
+	// `challengeSecret` (kept across configuration reloads):
+	gChallengeKey = func() []byte {
+		result := make([]byte, 32)
+		_, _ = rand.Read(result)
+		return result
+	}()
+)
+
+// `token()` returns the cookie value proving that the client of
+// `aRequest` passed the challenge, valid until `aExpires`.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+// - `aExpires`: The end of the token's validity (Unix time).
+//
+// Returns:
+// - `string`: The cookie value.
+func (ch *tChallenge) token(aRequest *http.Request, aExpires int64) string {
+	client, _, err := net.SplitHostPort(aRequest.RemoteAddr)
+	if nil != err {
+		client = aRequest.RemoteAddr
+	}
+	expires := strconv.FormatInt(aExpires, 16)
+	mac := hmac.New(sha256.New, ch.secret)
+	mac.Write([]byte(client + "|" + normaliseHost(aRequest.Host) + "|" + expires))
+
+	return expires + "." + hex.EncodeToString(mac.Sum(nil))
+} // token()
+
+// `passed()` checks whether `aRequest` carries a valid cookie of a
+// passed challenge.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the client passed the challenge.
+func (ch *tChallenge) passed(aRequest *http.Request) bool {
+	cookie, err := aRequest.Cookie(challengeName)
+	if nil != err {
+		return false
+	}
+	hexExp, _, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(hexExp, 16, 64)
+	if (nil != err) || (time.Now().Unix() > expires) {
+		return false
+	}
+
+	return hmac.Equal([]byte(cookie.Value), []byte(ch.token(aRequest, expires)))
+} // passed()
+
+// `suspicious()` checks whether `aRequest` looks like coming from a
+// bot: missing headers every browser sends, or too many requests.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the client is suspicious.
+func (ch *tChallenge) suspicious(aRequest *http.Request) bool {
+	if ch.headers {
+		for _, name := range []string{"User-Agent", "Accept", "Accept-Language"} {
+			if "" == aRequest.Header.Get(name) {
+				return true
+			}
+		}
+	}
+
+	return !ch.rate.allow(aRequest)
+} // suspicious()
+
+// `stripCookie()` removes the challenge cookie from `aRequest` so it
+// doesn't reach the backend.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+func stripCookie(aRequest *http.Request) {
+	cookies := aRequest.Cookies()
+	aRequest.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if challengeName != cookie.Name {
+			aRequest.AddCookie(cookie)
+		}
+	}
+} // stripCookie()
+
+// `check()` lets clients which passed the challenge (or aren't
+// suspicious) through and challenges the others.
+//
+// Requests other than `GET` and `HEAD` can't be challenged and are
+// refused with `403 Forbidden`.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the request was answered by a challenge.
+func (ch *tChallenge) check(aWriter http.ResponseWriter, aRequest *http.Request) bool {
+	if nil == ch {
+		return false
+	}
+	if ch.passed(aRequest) {
+		stripCookie(aRequest)
+		return false
+	}
+	if !ch.suspicious(aRequest) {
+		return false
+	}
+	secEvent(secChallenged, 2, aRequest, ch.mode)
+
+	if (http.MethodGet != aRequest.Method) && (http.MethodHead != aRequest.Method) {
+		http.Error(aWriter, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return true
+	}
+
+	expires := time.Now().Add(ch.ttl).Unix()
+	cookie := &http.Cookie{
+		Name:     challengeName,
+		Value:    ch.token(aRequest, expires),
+		Path:     "/",
+		MaxAge:   int(ch.ttl.Seconds()),
+		SameSite: http.SameSiteLaxMode,
+		Secure:   nil != aRequest.TLS,
+	}
+	header := aWriter.Header()
+	header.Set("Cache-Control", "no-store")
+
+	if ChallengeCookie == ch.mode {
+		cookie.HttpOnly = true
+		http.SetCookie(aWriter, cookie)
+		http.Redirect(aWriter, aRequest, aRequest.URL.RequestURI(), http.StatusTemporaryRedirect)
+		return true
+	}
+
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	aWriter.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = fmt.Fprintf(aWriter, `<!DOCTYPE html>
+<html><head><title>Checking your browser</title></head>
+<body><h1>Checking your browser …</h1>
+<noscript><p>Please enable JavaScript to continue.</p></noscript>
+<script>document.cookie=%q;location.reload();</script>
+</body></html>
+`, cookie.String())
+
+	return true
+} // check()
+
+// `readChallenge()` reads the host's challenge settings:
+//
+//	challenge = js
+//	challengeHeaders = true
+//	challengeRate = 120
+//	challengeTTL = 1h
+//	challengeSecret = env:CHALLENGE_KEY
+//
+// `challenge` is `cookie` or `js`; clients are challenged if they
+// don't send the headers every browser sends (`challengeHeaders`,
+// default `true`) or more than `challengeRate` requests per minute.
+// Without `challengeSecret` a random key is used (i.e. clients are
+// challenged again after a restart).
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+// - `aHost`: The (normalised) configured hostname.
+//
+// Returns:
+// - `*tChallenge`: The host's settings or `nil` if it's disabled.
+func readChallenge(aIni *ini.TSectionList, aSection, aHost string) *tChallenge {
+	mode, ok := hostString(aIni, aSection, "challenge")
+	if !ok {
+		return nil
+	}
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case ChallengeCookie, ChallengeJS:
+	case "", "off", "none":
+		return nil
+	default:
+		logErr("ReProx/readChallenge",
+			fmt.Sprintf("[%s] challenge: invalid mode %q", aSection, mode))
+		return nil
+	}
+
+	result := &tChallenge{
+		mode:    mode,
+		ttl:     time.Hour,
+		headers: true,
+	}
+	if on, ok := hostBool(aIni, aSection, "challengeHeaders"); ok {
+		result.headers = on
+	}
+	if rate, ok := hostInt(aIni, aSection, "challengeRate"); ok && (0 < rate) {
+		result.rate = &tClientLimit{
+			algo:    RateSliding,
+			limit:   rate,
+			length:  time.Minute,
+			keyMode: ClientKeyIP,
+			stats:   rateStats("challenge:"+aHost, rate, time.Minute),
+		}
+	}
+	if ttl, ok := hostDuration(aIni, aSection, "challengeTTL"); ok && (0 < ttl) {
+		result.ttl = ttl
+	}
+	if secret, ok := hostString(aIni, aSection, "challengeSecret"); ok && ("" != secret) {
+		result.secret = []byte(secret)
+	} else {
+		result.secret = gChallengeKey
+	}
+
+	return result
+} // readChallenge()
+
+/* _EoF_ */
@@ -0,0 +1,234 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host request limit for each client:
+	tClientLimit struct {
+		algo    string        // rate limiting algorithm
+		limit   int           // allowed requests per window
+		length  time.Duration // length of a window
+		burst   int           // (optional) burst size of `token`/`leaky`
+		keyMode string        // how to derive the client key (see below)
+		mask4   net.IPMask    // network of IPv4 clients in `net` mode
+		mask6   net.IPMask    // network of IPv6 clients in `net` mode
+		trusted []*net.IPNet  // proxies whose `X-Forwarded-For` is used
+		stats   *tRateStats   // decisions made for all clients
+		windows sync.Map      // `tLimiter` by client key
+		swept   atomic.Int64  // time of the last cleanup (UnixNano)
+	}
+)
+
+const (
+	// `ClientKeyIP` limits each client address on its own.
+	ClientKeyIP = "ip"
+
+	// `ClientKeyNet` limits the clients of a network (by default a /24
+	// for IPv4 and a /64 for IPv6) together.
+	ClientKeyNet = "net"
+
+	// `ClientKeyXFF` limits the client addresses reported by trusted
+	// proxies in `X-Forwarded-For`.
+	ClientKeyXFF = "xff"
+)
+
+// `isTrusted()` checks whether `aIP` belongs to a trusted proxy.
+//
+// Parameters:
+// - `aIP`: The address to check.
+//
+// Returns:
+// - `bool`: `true` if `aIP` is within one of the trusted networks.
+func (cl *tClientLimit) isTrusted(aIP net.IP) bool {
+	return inNetworks(aIP, cl.trusted)
+} // isTrusted()
+
+// `key()` derives the key to count `aRequest` under.
+//
+// In `xff` mode the `X-Forwarded-For` list is walked from the right
+// (i.e. starting with the address added by the nearest proxy) as long
+// as the addresses are trusted; the first untrusted one is the client.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `string`: The client's key.
+func (cl *tClientLimit) key(aRequest *http.Request) string {
+	host, _, err := net.SplitHostPort(aRequest.RemoteAddr)
+	if nil != err {
+		host = aRequest.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if nil == ip {
+		return host
+	}
+
+	switch cl.keyMode {
+	case ClientKeyNet:
+		if ip4 := ip.To4(); nil != ip4 {
+			return ip4.Mask(cl.mask4).String()
+		}
+		return ip.Mask(cl.mask6).String()
+
+	case ClientKeyXFF:
+		if !cl.isTrusted(ip) {
+			break
+		}
+		hops := strings.Split(strings.Join(aRequest.Header.Values("X-Forwarded-For"), ","), ",")
+		for idx := len(hops) - 1; 0 <= idx; idx-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[idx]))
+			if nil == hop {
+				break
+			}
+			ip = hop
+			if !cl.isTrusted(hop) {
+				break
+			}
+		}
+	}
+
+	return ip.String()
+} // key()
+
+// `allow()` checks whether the client of `aRequest` may send another
+// request within the current window.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the request is within the client's limit.
+func (cl *tClientLimit) allow(aRequest *http.Request) bool {
+	if nil == cl {
+		return true
+	}
+	cl.sweep()
+
+	key := cl.key(aRequest)
+	window, ok := cl.windows.Load(key)
+	if !ok {
+		window, _ = cl.windows.LoadOrStore(key,
+			newLimiter(cl.algo, cl.limit, cl.length, cl.burst, cl.stats))
+	}
+
+	return window.(tLimiter).allow()
+} // allow()
+
+// `sweep()` drops the limiters of clients which are back to their
+// initial state (at most once per window).
+func (cl *tClientLimit) sweep() {
+	now := time.Now()
+	last := cl.swept.Load()
+	if (cl.length > now.Sub(time.Unix(0, last))) || !cl.swept.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	cl.windows.Range(func(aKey, aValue any) bool {
+		if aValue.(tLimiter).idle(now) {
+			cl.windows.Delete(aKey)
+		}
+		return true
+	})
+} // sweep()
+
+// `readClientLimit()` reads the host's per-client request limit:
+//
+//	clientLimit = 120
+//	clientWindow = 1m
+//	clientAlgorithm = token
+//	clientBurst = 20
+//	clientKey = net
+//	clientNetMask = 24, 64
+//	clientTrusted = 10.0.0.0/8, fd00::/8
+//
+// `clientAlgorithm` is one of `fixed` (default), `sliding`, `token`,
+// or `leaky` (see `newLimiter()`), `clientKey` is one of `ip`
+// (default), `net`, or `xff`; `clientTrusted` lists the proxies whose
+// `X-Forwarded-For` header is used in `xff` mode.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+// - `aHost`: The (normalised) configured hostname.
+//
+// Returns:
+// - `*tClientLimit`: The host's limit or `nil` if there's none.
+func readClientLimit(aIni *ini.TSectionList, aSection, aHost string) *tClientLimit {
+	limit, ok := hostInt(aIni, aSection, "clientLimit")
+	if !ok || (0 >= limit) {
+		return nil
+	}
+
+	result := &tClientLimit{
+		algo:    RateFixed,
+		limit:   limit,
+		length:  time.Minute,
+		keyMode: ClientKeyIP,
+		mask4:   net.CIDRMask(24, 32),
+		mask6:   net.CIDRMask(64, 128),
+	}
+	if length, ok := hostDuration(aIni, aSection, "clientWindow"); ok && (0 < length) {
+		result.length = length
+	}
+	if s, ok := hostString(aIni, aSection, "clientAlgorithm"); ok {
+		result.algo = parseRateAlgorithm(aSection, s)
+	}
+	result.burst, _ = hostInt(aIni, aSection, "clientBurst")
+	if s, ok := hostString(aIni, aSection, "clientKey"); ok {
+		switch s = strings.ToLower(strings.TrimSpace(s)); s {
+		case ClientKeyIP, ClientKeyNet, ClientKeyXFF:
+			result.keyMode = s
+		default:
+			logErr("ReProx/readClientLimit",
+				fmt.Sprintf("[%s] clientKey: invalid mode %q", aSection, s))
+		}
+	}
+	if s, ok := hostString(aIni, aSection, "clientNetMask"); ok {
+		v4, v6, _ := strings.Cut(s, ",")
+		if bits, err := strconv.Atoi(strings.TrimSpace(v4)); (nil == err) && (0 < bits) && (32 >= bits) {
+			result.mask4 = net.CIDRMask(bits, 32)
+		}
+		if bits, err := strconv.Atoi(strings.TrimSpace(v6)); (nil == err) && (0 < bits) && (128 >= bits) {
+			result.mask6 = net.CIDRMask(bits, 128)
+		}
+	}
+	if s, ok := hostString(aIni, aSection, "clientTrusted"); ok {
+		for _, cidr := range strings.Split(s, ",") {
+			if cidr = strings.TrimSpace(cidr); "" == cidr {
+				continue
+			}
+			_, network, err := net.ParseCIDR(cidr)
+			if nil != err {
+				logErr("ReProx/readClientLimit",
+					fmt.Sprintf("[%s] clientTrusted: %v", aSection, err))
+				continue
+			}
+			result.trusted = append(result.trusted, network)
+		}
+	}
+	result.stats = rateStats("client:"+aHost, result.limit, result.length)
+
+	return result
+} // readClientLimit()
+
+/* _EoF_ */
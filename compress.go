@@ -0,0 +1,186 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host response compression settings:
+	tCompression struct {
+		types   []string // compressible MIME types (`text/*` allowed)
+		minSize int64    // minimum body size to compress
+	}
+)
+
+var (
+	// MIME types compressed if a host doesn't configure its own list:
+	compressDefaultTypes = []string{
+		"text/*",
+		"application/javascript",
+		"application/json",
+		"application/xml",
+		"image/svg+xml",
+	}
+)
+
+// `acceptsGzip()` checks whether the client accepts `gzip` encoded
+// responses, i.e. lists `gzip` (or `*`) without `q=0`.
+//
+// Parameters:
+// - `aAccept`: The request's `Accept-Encoding` header.
+//
+// Returns:
+// - `bool`: `true` if a gzip encoded response is acceptable.
+func acceptsGzip(aAccept string) bool {
+	for _, coding := range strings.Split(aAccept, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if ("gzip" != name) && ("*" != name) {
+			continue
+		}
+		_, q, ok := strings.Cut(params, "q=")
+		if !ok {
+			return true
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(q), 64); (nil == err) && (0 < f) {
+			return true
+		}
+	}
+
+	return false
+} // acceptsGzip()
+
+// `typeAllowed()` checks whether `aContentType` matches one of the
+// MIME types in `aTypes` (which may contain `type/*` wildcards).
+//
+// Parameters:
+// - `aContentType`: The response's `Content-Type` header.
+// - `aTypes`: The list of allowed MIME types.
+//
+// Returns:
+// - `bool`: `true` if the MIME type is in the allow list.
+func typeAllowed(aContentType string, aTypes []string) bool {
+	mType, _, err := mime.ParseMediaType(aContentType)
+	if nil != err {
+		return false
+	}
+	for _, allowed := range aTypes {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mType, prefix+"/") {
+				return true
+			}
+		} else if mType == allowed {
+			return true
+		}
+	}
+
+	return false
+} // typeAllowed()
+
+// `compress()` replaces the body of `aResponse` by its gzip encoded
+// version if the client accepts that and the response isn't already
+// encoded, is of an allowed MIME type, and is large enough.
+// Responses announcing trailers are left alone since those may
+// refer to the body as sent (e.g. checksums).
+//
+// It's meant to be used as (part of) a proxy's `ModifyResponse` hook.
+//
+// Parameters:
+// - `aResponse`: The backend's response.
+func (c *tCompression) compress(aResponse *http.Response) {
+	if nil == c {
+		return
+	}
+	header := aResponse.Header
+	if (http.StatusOK != aResponse.StatusCode) ||
+		(http.MethodHead == aResponse.Request.Method) ||
+		("" != header.Get("Content-Encoding")) ||
+		("" != header.Get("Content-Range")) ||
+		(0 < len(aResponse.Trailer)) ||
+		!acceptsGzip(aResponse.Request.Header.Get("Accept-Encoding")) ||
+		!typeAllowed(header.Get("Content-Type"), c.types) {
+		return
+	}
+	if (0 <= aResponse.ContentLength) && (aResponse.ContentLength < c.minSize) {
+		return
+	}
+
+	body := aResponse.Body
+	reader, writer := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(writer)
+		_, err := io.Copy(zw, body)
+		if e2 := zw.Close(); nil == err {
+			err = e2
+		}
+		body.Close()
+		writer.CloseWithError(err)
+	}()
+
+	aResponse.Body = reader
+	aResponse.ContentLength = -1
+	header.Del("Content-Length")
+	header.Del("Accept-Ranges")
+	header.Set("Content-Encoding", "gzip")
+	header.Add("Vary", "Accept-Encoding")
+	if etag := header.Get("ETag"); ("" != etag) && !strings.HasPrefix(etag, "W/") {
+		// the encoded body isn't byte-identical anymore:
+		header.Set("ETag", "W/"+etag)
+	}
+} // compress()
+
+// `readCompression()` reads the host's compression settings:
+//
+//	compress = true
+//	compressTypes = text/*, application/json
+//	compressMinSize = 1024
+//
+// Only `gzip` is supported since the standard library doesn't
+// provide a brotli encoder.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tCompression`: The host's settings or `nil` if it's disabled.
+func readCompression(aIni *ini.TSectionList, aSection string) *tCompression {
+	if on, _ := hostBool(aIni, aSection, "compress"); !on {
+		return nil
+	}
+
+	result := &tCompression{
+		types:   compressDefaultTypes,
+		minSize: 1024,
+	}
+	if s, ok := hostString(aIni, aSection, "compressTypes"); ok {
+		result.types = nil
+		for _, mType := range strings.Split(s, ",") {
+			if mType = strings.ToLower(strings.TrimSpace(mType)); "" != mType {
+				result.types = append(result.types, mType)
+			}
+		}
+	}
+	if size, ok := hostInt(aIni, aSection, "compressMinSize"); ok && (0 <= size) {
+		result.minSize = int64(size)
+	}
+
+	return result
+} // readCompression()
+
+/* _EoF_ */
@@ -0,0 +1,161 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host caps of requests served at the same time (a bulkhead
+	// keeping a slow backend from tying up all connections):
+	tConcurrency struct {
+		sync.Mutex
+		host      chan struct{}  // (optional) semaphore of the host
+		perClient int            // (optional) requests per client address
+		clients   map[string]int // requests in progress by client address
+		queueWait time.Duration  // (optional) longest wait for a host slot
+		maxQueued int32          // (optional) most requests waiting
+		queued    atomic.Int32   // requests currently waiting
+	}
+)
+
+// `acquire()` reserves a slot for `aRequest` if neither the host's
+// nor the client's cap is reached.
+//
+// If the host's cap is reached the request waits up to `queueWait`
+// for a slot to become free, unless `maxQueued` requests are already
+// waiting.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `func()`: The function to release the slot after serving the request.
+// - `bool`: `false` if a cap is reached and the request must be refused.
+func (cc *tConcurrency) acquire(aRequest *http.Request) (func(), bool) {
+	if nil == cc {
+		return func() {}, true
+	}
+
+	if nil != cc.host {
+		select {
+		case cc.host <- struct{}{}:
+		default:
+			if !cc.wait(aRequest) {
+				return nil, false
+			}
+		}
+	}
+
+	client := ""
+	if 0 < cc.perClient {
+		var err error
+		if client, _, err = net.SplitHostPort(aRequest.RemoteAddr); nil != err {
+			client = aRequest.RemoteAddr
+		}
+		cc.Lock()
+		if cc.perClient <= cc.clients[client] {
+			cc.Unlock()
+			if nil != cc.host {
+				<-cc.host
+			}
+			return nil, false
+		}
+		cc.clients[client]++
+		cc.Unlock()
+	}
+
+	return func() {
+		if 0 < cc.perClient {
+			cc.Lock()
+			if cc.clients[client]--; 0 >= cc.clients[client] {
+				delete(cc.clients, client)
+			}
+			cc.Unlock()
+		}
+		if nil != cc.host {
+			<-cc.host
+		}
+	}, true
+} // acquire()
+
+// `wait()` queues `aRequest` for a slot of the host.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if a slot was reserved in time.
+func (cc *tConcurrency) wait(aRequest *http.Request) bool {
+	if 0 >= cc.queueWait {
+		return false
+	}
+	if n := cc.queued.Add(1); (0 < cc.maxQueued) && (cc.maxQueued < n) {
+		cc.queued.Add(-1)
+		return false
+	}
+	defer cc.queued.Add(-1)
+
+	timer := time.NewTimer(cc.queueWait)
+	defer timer.Stop()
+	select {
+	case cc.host <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-aRequest.Context().Done():
+	}
+
+	return false
+} // wait()
+
+// `readConcurrency()` reads the host's caps of concurrent requests:
+//
+//	maxConcurrent = 200
+//	maxPerClient = 10
+//	maxQueueWait = 500ms
+//	maxQueued = 50
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tConcurrency`: The host's caps or `nil` if there are none.
+func readConcurrency(aIni *ini.TSectionList, aSection string) *tConcurrency {
+	maxHost, _ := hostInt(aIni, aSection, "maxConcurrent")
+	maxClient, _ := hostInt(aIni, aSection, "maxPerClient")
+	if (0 >= maxHost) && (0 >= maxClient) {
+		return nil
+	}
+
+	result := &tConcurrency{
+		clients: make(map[string]int),
+	}
+	if 0 < maxHost {
+		result.host = make(chan struct{}, maxHost)
+	}
+	if 0 < maxClient {
+		result.perClient = maxClient
+	}
+	result.queueWait, _ = hostDuration(aIni, aSection, "maxQueueWait")
+	if queued, ok := hostInt(aIni, aSection, "maxQueued"); ok && (0 < queued) {
+		result.maxQueued = int32(queued)
+	}
+
+	return result
+} // readConcurrency()
+
+/* _EoF_ */
@@ -7,11 +7,18 @@ Copyright © 2024  M.Watermann, 10247 Berlin, Germany
 package reprox
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"net/http/httputil"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mwat56/ini"
 )
@@ -21,8 +28,51 @@ import (
 type (
 	// Structure to pair an external hostname with the internal machine:
 	tDestination struct {
-		destHost  string
-		destProxy *httputil.ReverseProxy
+		destHost   string
+		destProxy  *httputil.ReverseProxy
+		hostName   string         // the (normalised) configured hostname
+		sampleRate float64        // fraction of requests to send to `sampleURL`
+		sampleURL  string         // (optional) analytics sink for request samples
+		preload    *tPreloadCache // (optional) automatic preload hints
+		apiKeys    tAPIKeys       // (optional) keys required for access
+		hibernate  time.Duration  // idle time before the proxy is dropped
+		lastUsed   *atomic.Int64  // time of the last request (UnixNano)
+		lazyProxy  *tLazyProxy    // proxy of a hibernating host (if awake)
+		smokePath  string         // (optional) path to smoke test
+		smokeEvery time.Duration  // interval between smoke tests
+		pins       tPins          // (optional) pinned backend certificates
+		csp        *tCSPCollector // (optional) CSP report collection
+		maintOn    *atomic.Bool   // whether the host is in maintenance mode
+		maintPage  []byte         // (optional) page to send in maintenance
+		fromKube   bool           // whether it's from a Kubernetes Ingress
+		fwdStyle   tForwardStyle  // forwarding headers to send
+		reqHeaders *tHeaderRules  // (optional) request header changes
+		resHeaders *tHeaderRules  // (optional) response header changes
+		compress   *tCompression  // (optional) response compression
+		cache      *tHostCache    // (optional) response cache
+		wsIdle     time.Duration  // (optional) idle timeout of upgraded connections
+		cors       *tCORS         // (optional) CORS settings
+		basicAuth  *tBasicAuth    // (optional) required credentials
+		rewrite    *tBodyRewrite  // (optional) body URL rewriting
+		via        *tVia          // (optional) pseudonym for `Via` headers
+		uaFilter   *tUAFilter     // (optional) User-Agents to refuse
+		abTest     *tABTest       // (optional) A/B test variants
+		slowAfter  time.Duration  // (optional) slow request threshold
+		privacy    *tLogPrivacy   // (optional) access log anonymisation
+		debug      *tDebug        // debug capture settings
+		clientRate *tClientLimit  // (optional) per-client request limit
+		rateReject *tRateReject   // (optional) response to limited requests
+		concurrent *tConcurrency  // (optional) caps of concurrent requests
+		tlsBlock   tTLSBlock      // (optional) TLS fingerprints to refuse
+		reqPolicy  *tReqPolicy    // (optional) allowed methods and URLs
+		signature  *tSignature    // (optional) required request signature
+		challenge  *tChallenge    // (optional) challenge of suspicious clients
+		csrf       *tCSRF         // (optional) CSRF protection
+		static     *tStaticFiles  // (optional) files served from disk
+		transport  *tTransport    // (optional) backend connection tuning
+		flush      time.Duration  // (optional) response flush interval
+		prewarm    int            // (optional) connections to open on load
+		lowPrio    bool           // whether it's shed under memory pressure
 	}
 
 	// List of proxied servers:
@@ -32,18 +82,130 @@ type (
 	TSetup struct {
 		AccessLog   string // (optional) name of page access logfile
 		ErrorLog    string // (optional) name of page error logfile
+		HTTPListen  string // address of the HTTP server
+		HTTPSListen string // address of the HTTPS server
+		AdminListen string // (optional) address of the admin server
+		ConfigHash  string // hash of the loaded configuration
+		HealthPath  string // (optional) public path of the health check
+		LogFormat   string // format of the access log (`combined`/`w3c`)
+		LogFields   string // (optional) fields of W3C access logs
 		BackendList *tBackendServers
+
+		ShutdownWebhook string // (optional) URL for the shutdown report
+		UnmatchedSNI    string // policy for unknown hostnames (see below)
+		CatchAllHost    string // (optional) host to use for unknown hostnames
+		TLSFallback     string // policy for missing TLS material (see below)
+		SecurityLog     string // (optional) sink of security events
+		SecurityFormat  string // format of security events (`cef`/`ecs`)
+
+		KubeIngress  bool          // read hosts from Kubernetes Ingresses
+		KubeNS       string        // (optional) namespace to watch
+		KubeInterval time.Duration // interval between Ingress polls
+
+		AlertWebhook     string        // (optional) URL for error rate alerts
+		AlertFormat      string        // payload format of the alerts
+		AlertErrorRate   float64       // share of failed requests to alert at
+		AlertMinRequests int           // minimum requests per window to check
+		AlertInterval    time.Duration // length of the alert window
+
+		StrictParsing bool // whether to reject ambiguous requests
+		Seccomp       bool // whether to restrict the system calls
+		PanicRestart  bool // whether to restart panicked background tasks
+
+		HostCheck        bool     // whether to validate `Host` headers
+		HostAllow        []string // (optional) additional hostnames to accept
+		HostRejectStatus int      // HTTP status of rejected requests
+
+		TrustedProxies []*net.IPNet // (optional) proxies reporting client addresses
+
+		HTTPLimits  THeaderLimits // request header limits of the HTTP server
+		HTTPSLimits THeaderLimits // request header limits of the HTTPS server
+		HTTPTimes   TTimeouts     // client timeouts of the HTTP server
+		HTTPSTimes  TTimeouts     // client timeouts of the HTTPS server
+		HTTPConns   TConnLimits   // connection limits of the HTTP server
+		HTTPSConns  TConnLimits   // connection limits of the HTTPS server
+
+		Sockets TSocketOptions // options of the listening sockets
+
+		Listeners []TListener // (optional) frontend listeners (see `Frontends()`)
+		TCPRoutes []TTCPRoute // (optional) TCP streams to forward (`[tcp_routes]`)
+
+		RunAsUser string // (optional) user to run as once the sockets are bound
+		Chroot    string // (optional) root directory once the sockets are bound
+		PIDFile   string // (optional) file holding the process ID
+
+		RateStateFile string // (optional) file keeping the rate limits across restarts
+
+		RunAsGroup  string // (optional) group to run as (default: the user's)
+		KeepBindCap bool   // whether to keep binding privileged ports
+
+		ErrorPages string // (optional) directory of the page templates
+
+		MemoryBudget  int64 // (optional) memory for buffered bodies
+		MemoryMaxBody int64 // largest request body under memory pressure
+
+		iniData    *ini.TSectionList // the INI data the setup was created from
+		nextChange time.Time         // (optional) next `activeFrom`/`activeUntil` time
+	}
+
+	// `TReloadHook` is called with the old and the new configuration
+	// after a configuration change (see `OnReload()`).
+	TReloadHook func(aOld, aNew *TSetup)
+
+	// `TOverrides` holds settings given on the commandline which take
+	// precedence over those of every configuration loaded (see
+	// `SetOverrides()`); empty fields don't override anything.
+	TOverrides struct {
+		AccessLog   string // the access logfile
+		ErrorLog    string // the error logfile
+		HTTPListen  string // the address of the HTTP frontend
+		HTTPSListen string // the address of the HTTPS frontend
 	}
 )
 
+const (
+	// Name of the environment variable selecting a configuration profile:
+	profileEnv = "REPROX_PROFILE"
+
+	// `SNIClose` rejects TLS handshakes for unknown hostnames.
+	SNIClose = "close"
+
+	// `SNIDefault` presents the default certificate and a 404 page
+	// for unknown hostnames.
+	SNIDefault = "default"
+
+	// `SNICatchAll` serves unknown hostnames by the `CatchAllHost`.
+	SNICatchAll = "catchall"
+
+	// `TLSFail` stops the program if the TLS certificate can't be loaded.
+	TLSFail = "fail"
+
+	// `TLSHTTPOnly` serves the plain HTTP listeners only if the TLS
+	// certificate can't be loaded.
+	TLSHTTPOnly = "http"
+
+	// `TLSSelfSigned` serves HTTPS with a temporary self-signed
+	// certificate if the TLS certificate can't be loaded.
+	TLSSelfSigned = "selfsigned"
+)
+
 var (
 	// Name of the running program:
 	gMe = func() string {
 		return filepath.Base(os.Args[0])
 	}()
 
-	// application specific configuration
-	AppSetup *TSetup
+	// The application specific configuration (see `CurrentSetup()`):
+	gSetup atomic.Pointer[TSetup]
+
+	// Functions to call after a configuration change:
+	gReloadHooks []TReloadHook
+
+	// Guard for configuration changes, `gReloadHooks`, and `gOverrides`:
+	gReloadMtx sync.Mutex
+
+	// The commandline's settings (see `SetOverrides()`):
+	gOverrides TOverrides
 )
 
 // `init()` initialises the application setup by reading the configuration
@@ -51,58 +213,885 @@ var (
 //
 // The function is called automatically before the `main()` function starts.
 func init() {
-	AppSetup = readIni()
+	setup := readIni()
+	gSetup.Store(setup)
+	scheduleChange(setup)
 } // init()
 
-// `readIni()` reads the application configuration from an INI file.
-// It returns a pointer to a `TSetup` structure containing the required
-// configuration data.
-func readIni() *TSetup {
+// `CurrentSetup()` returns the current application configuration.
+//
+// The configuration is replaced as a whole by reloads (see
+// `applySetup()`), so the returned value must be treated as read-only;
+// callers reading several settings should call this function once.
+//
+// Returns:
+// - `*TSetup`: The current configuration.
+func CurrentSetup() *TSetup {
+	return gSetup.Load()
+} // CurrentSetup()
+
+// `hostBool()` returns the value of `aKey` in the host's `aSection`
+// as a boolean.
+//
+// If the host section doesn't define `aKey` the value from the
+// `[Default]` section is used instead.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+// - `aKey`: The name of the key to lookup.
+//
+// Returns:
+// - `bool`: The value associated with `aKey`.
+// - `bool`: `true` if `aKey` was found, or `false` otherwise.
+func hostBool(aIni *ini.TSectionList, aSection, aKey string) (bool, bool) {
+	if !aIni.HasSectionKey(aSection, aKey) {
+		aSection = ini.DefSection
+	}
+
+	return aIni.AsBool(aSection, aKey)
+} // hostBool()
+
+// `hostDuration()` returns the value of `aKey` in the host's `aSection`
+// as a time duration (e.g. `90s` or `15m`).
+//
+// If the host section doesn't define `aKey` the value from the
+// `[Default]` section is used instead.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+// - `aKey`: The name of the key to lookup.
+//
+// Returns:
+// - `time.Duration`: The value associated with `aKey`.
+// - `bool`: `true` if a valid `aKey` was found, or `false` otherwise.
+func hostDuration(aIni *ini.TSectionList, aSection, aKey string) (time.Duration, bool) {
+	s, ok := hostString(aIni, aSection, aKey)
+	if !ok {
+		return 0, false
+	}
+	result, err := time.ParseDuration(s)
+	if (nil != err) || (0 > result) {
+		logErr("ReProx/hostDuration",
+			fmt.Sprintf("[%s] %s: invalid duration %q", aSection, aKey, s))
+		return 0, false
+	}
+
+	return result, true
+} // hostDuration()
+
+// `hostFloat()` returns the value of `aKey` in the host's `aSection`
+// as a floating point number.
+//
+// If the host section doesn't define `aKey` the value from the
+// `[Default]` section is used instead.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+// - `aKey`: The name of the key to lookup.
+//
+// Returns:
+// - `float64`: The value associated with `aKey`.
+// - `bool`: `true` if `aKey` was found, or `false` otherwise.
+func hostFloat(aIni *ini.TSectionList, aSection, aKey string) (float64, bool) {
+	if !aIni.HasSectionKey(aSection, aKey) {
+		aSection = ini.DefSection
+	}
+
+	return aIni.AsFloat64(aSection, aKey)
+} // hostFloat()
+
+// `hostInt()` returns the value of `aKey` in the host's `aSection`
+// as an integer.
+//
+// If the host section doesn't define `aKey` the value from the
+// `[Default]` section is used instead.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+// - `aKey`: The name of the key to lookup.
+//
+// Returns:
+// - `int`: The value associated with `aKey`.
+// - `bool`: `true` if `aKey` was found, or `false` otherwise.
+func hostInt(aIni *ini.TSectionList, aSection, aKey string) (int, bool) {
+	if !aIni.HasSectionKey(aSection, aKey) {
+		aSection = ini.DefSection
+	}
+
+	return aIni.AsInt(aSection, aKey)
+} // hostInt()
+
+// `hostString()` returns the value of `aKey` in the host's `aSection`.
+//
+// If the host section doesn't define `aKey` the value from the
+// `[Default]` section is used instead.
+// Secret references (`env:NAME` or `file:/path`) are resolved; if that
+// fails the error is logged and the key is treated as missing.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+// - `aKey`: The name of the key to lookup.
+//
+// Returns:
+// - `string`: The value associated with `aKey`.
+// - `bool`: `true` if `aKey` was found, or `false` otherwise.
+func hostString(aIni *ini.TSectionList, aSection, aKey string) (string, bool) {
+	if !aIni.HasSectionKey(aSection, aKey) {
+		aSection = ini.DefSection
+	}
+
+	result, ok := aIni.AsString(aSection, aKey)
+	if !ok {
+		return result, ok
+	}
+
+	result, err := resolveSecret(result)
+	if nil != err {
+		logErr("ReProx/hostString",
+			fmt.Sprintf("[%s] %s: %v", aSection, aKey, err))
+		return "", false
+	}
+
+	return result, true
+} // hostString()
+
+// `applyProfile()` applies the settings of the configuration profile
+// `aProfile` to `aIni`.
+//
+// A profile consists of INI sections named `<profile>:<section>`,
+// e.g. `[dev:Default]` or `[prod:Host1]`, whose key/value pairs replace
+// those of the named section.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file(s).
+// - `aProfile`: The name of the profile to apply.
+func applyProfile(aIni *ini.TSectionList, aProfile string) {
+	if aProfile = strings.TrimSpace(aProfile); "" == aProfile {
+		return
+	}
+
+	type tOverride struct {
+		section, key, value string
+	}
+	var overrides []tOverride
+	prefix := aProfile + ":"
+
+	aIni.Walk(func(aSection, aKey, aValue string) {
+		if strings.HasPrefix(aSection, prefix) {
+			overrides = append(overrides, tOverride{
+				strings.TrimPrefix(aSection, prefix), aKey, aValue})
+		}
+	})
+	for _, o := range overrides {
+		aIni.UpdateSectKeyStr(o.section, o.key, o.value)
+	}
+} // applyProfile()
+
+// `applySetup()` makes `aSetup` the current configuration and calls all
+// hooks registered by `OnReload()`.
+//
+// Hosts discovered from Kubernetes Ingress resources are added to
+// the new configuration unless it configures them itself.
+//
+// Parameters:
+// - `aSetup`: The new configuration.
+func applySetup(aSetup *TSetup) {
+	gReloadMtx.Lock()
+	defer gReloadMtx.Unlock()
+
+	swapSetup(aSetup)
+} // applySetup()
+
+// `swapSetup()` does the work of `applySetup()`; the caller must hold
+// `gReloadMtx`.
+//
+// Parameters:
+// - `aSetup`: The new configuration.
+func swapSetup(aSetup *TSetup) {
+	gOverrides.apply(aSetup)
+	mergeIngressHosts(aSetup)
+	old := gSetup.Swap(aSetup)
+	scheduleChange(aSetup)
+	if nil != old {
+		for _, hook := range gReloadHooks {
+			hook(old, aSetup)
+		}
+	}
+} // swapSetup()
+
+// `SetOverrides()` makes `aOverrides` take precedence over the
+// settings of the current configuration and of all configurations
+// loaded later on (e.g. by a reload).
+//
+// Parameters:
+// - `aOverrides`: The settings given on the commandline.
+func SetOverrides(aOverrides TOverrides) {
+	gReloadMtx.Lock()
+	defer gReloadMtx.Unlock()
+
+	gOverrides = aOverrides
+	current := CurrentSetup()
+	if nil == current {
+		return
+	}
+	setup := *current
+	swapSetup(&setup)
+} // SetOverrides()
+
+// `apply()` sets the overridden settings in `aSetup`.
+//
+// A frontend address replaces that of the first `[ListenX]` listener
+// of its kind (if any) whose other listeners of that kind are dropped,
+// so the commandline decides where HTTP and HTTPS are served.
+//
+// Parameters:
+// - `aSetup`: The configuration to change.
+func (o TOverrides) apply(aSetup *TSetup) {
+	if "" != o.AccessLog {
+		aSetup.AccessLog = o.AccessLog
+	}
+	if "" != o.ErrorLog {
+		aSetup.ErrorLog = o.ErrorLog
+	}
+	if "" != o.HTTPListen {
+		aSetup.HTTPListen = o.HTTPListen
+	}
+	if "" != o.HTTPSListen {
+		aSetup.HTTPSListen = o.HTTPSListen
+	}
+	if (0 == len(aSetup.Listeners)) || (("" == o.HTTPListen) && ("" == o.HTTPSListen)) {
+		return
+	}
+
+	listeners := make([]TListener, 0, len(aSetup.Listeners)+2)
+	var seenHTTP, seenHTTPS bool
+	for _, listener := range aSetup.Listeners {
+		switch {
+		case !listener.TLS && ("" != o.HTTPListen):
+			if seenHTTP {
+				continue
+			}
+			seenHTTP, listener.Address = true, o.HTTPListen
+		case listener.TLS && ("" != o.HTTPSListen):
+			if seenHTTPS {
+				continue
+			}
+			seenHTTPS, listener.Address = true, o.HTTPSListen
+		}
+		listeners = append(listeners, listener)
+	}
+	if !seenHTTP && ("" != o.HTTPListen) {
+		listeners = append(listeners, TListener{Name: "http", Address: o.HTTPListen})
+	}
+	if !seenHTTPS && ("" != o.HTTPSListen) {
+		listeners = append(listeners, TListener{Name: "https", Address: o.HTTPSListen, TLS: true})
+	}
+	aSetup.Listeners = listeners
+} // apply()
+
+// `LoadConfig()` reads the application configuration from the INI
+// file `aFilename` and makes it the current configuration.
+//
+// It's the same as `LoadConfigContext()` with a background context.
+//
+// Parameters:
+// - `aFilename`: The name of the INI file to read.
+// - `aProfile`: The name of the configuration profile to apply.
+//
+// Returns:
+// - `error`: An error if the file can't be read.
+func LoadConfig(aFilename, aProfile string) error {
+	return LoadConfigContext(context.Background(), aFilename, aProfile)
+} // LoadConfig()
+
+// `LoadConfigContext()` reads the application configuration from the
+// INI file `aFilename` and makes it the current configuration.
+// Afterwards all hooks registered by `OnReload()` are called.
+//
+// If `aFilename` is empty the INI files in the default locations are
+// read; otherwise the file may be encrypted (see `EncryptConfig()`).
+// If `aProfile` is empty the profile named by the environment
+// variable `REPROX_PROFILE` (if any) is used.
+//
+// If `aCtx` is cancelled before the configuration is read completely
+// the current configuration stays unchanged.
+//
+// Parameters:
+// - `aCtx`: The context to observe.
+// - `aFilename`: The name of the INI file to read.
+// - `aProfile`: The name of the configuration profile to apply.
+//
+// Returns:
+// - `error`: An error if the file can't be read or `aCtx` is done.
+func LoadConfigContext(aCtx context.Context, aFilename, aProfile string) error {
+	type tResult struct {
+		setup *TSetup
+		err   error
+	}
+	done := make(chan tResult, 1)
+
+	go func() {
+		var (
+			err  error
+			inif *ini.TSectionList
+		)
+		if "" == aFilename {
+			_, inif = ini.ReadIniData(gMe)
+		} else if inif, err = openConfig(jailPath(aFilename)); nil != err {
+			done <- tResult{nil, err}
+			return
+		}
+		if nil == inif {
+			done <- tResult{nil, fmt.Errorf("%w: can't read INI data", ErrConfigParse)}
+			return
+		}
+
+		if "" == aProfile {
+			aProfile = os.Getenv(profileEnv)
+		}
+		applyProfile(inif, aProfile)
+		expandVars(inif)
+		setup, err := newSetup(inif)
+		done <- tResult{setup, err}
+	}()
+
+	select {
+	case <-aCtx.Done():
+		return aCtx.Err()
+
+	case result := <-done:
+		if nil != result.err {
+			return result.err
+		}
+		if err := aCtx.Err(); nil != err {
+			return err
+		}
+		applySetup(result.setup)
+	}
+
+	return nil
+} // LoadConfigContext()
+
+// `newDestination()` returns a backend configuration for `aDestURL`
+// with all other settings at their defaults.
+//
+// Parameters:
+// - `aDestURL`: The URL of the backend server.
+//
+// Returns:
+// - `tDestination`: The new backend configuration.
+func newDestination(aDestURL string) tDestination {
+	return tDestination{
+		destHost: aDestURL,
+		maintOn:  &atomic.Bool{},
+		debug:    &tDebug{},
+		fwdStyle: fwdLegacy,
+	}
+} // newDestination()
+
+// `SaveConfig()` writes the current configuration to the INI file
+// `aFilename`.
+//
+// It's the same as `SaveConfigContext()` with a background context.
+//
+// Parameters:
+// - `aFilename`: The name of the INI file to write.
+//
+// Returns:
+// - `error`: A possible write error.
+func SaveConfig(aFilename string) error {
+	return SaveConfigContext(context.Background(), aFilename)
+} // SaveConfig()
+
+// `SaveConfigContext()` writes the current (effective) configuration,
+// i.e. with the selected profile applied and template variables
+// expanded, to the INI file `aFilename`.
+//
+// The data is written to a temporary file which replaces `aFilename`
+// only if `aCtx` isn't done by then.
+//
+// Parameters:
+// - `aCtx`: The context to observe.
+// - `aFilename`: The name of the INI file to write.
+//
+// Returns:
+// - `error`: A possible write error or the context's error.
+func SaveConfigContext(aCtx context.Context, aFilename string) error {
+	setup := CurrentSetup()
+	if (nil == setup) || (nil == setup.iniData) {
+		return ErrNoConfig
+	}
+	if err := aCtx.Err(); nil != err {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(aFilename), filepath.Base(aFilename)+".*")
+	if nil != err {
+		return err
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName) // no-op after successful rename
+
+	_, err = tmpFile.WriteString(setup.iniData.String())
+	if e2 := tmpFile.Close(); nil == err {
+		err = e2
+	}
+	if nil != err {
+		return err
+	}
+	if err = aCtx.Err(); nil != err {
+		return err
+	}
+
+	return os.Rename(tmpName, aFilename)
+} // SaveConfigContext()
+
+// `OnReload()` registers `aHook` to be called whenever a new
+// configuration was applied (by `LoadConfig()` or `WatchIngresses()`).
+//
+// The hooks are called in the order of their registration with both
+// the previous and the new configuration.
+//
+// Parameters:
+// - `aHook`: The function to call after a configuration change.
+func OnReload(aHook TReloadHook) {
+	if nil == aHook {
+		return
+	}
+
+	gReloadMtx.Lock()
+	defer gReloadMtx.Unlock()
+
+	gReloadHooks = append(gReloadHooks, aHook)
+} // OnReload()
+
+// `newSetup()` creates the application configuration from the given
+// INI data.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file(s).
+//
+// Hostnames which are configured more than once (possibly differing
+// only in case or IDN encoding) are reported as an error.
+//
+// Returns:
+// - `*TSetup`: The application configuration.
+// - `error`: An error listing conflicting host entries.
+func newSetup(aIni *ini.TSectionList) (*TSetup, error) {
 	var (
-		// Regular expression to identify `HostX` sections
-		isHostRE = regexp.MustCompile(`^\s*(Host\d)\s*$`)
-		ok       bool
-		s        string
+		conflicts []string
+		ok        bool
+		s         string
 	)
 
-	config, inif := ini.ReadIniData(gMe)
-	if (nil == config) || (nil == inif) {
-		panic("can't read INI data")
+	setup := TSetup{
+		iniData: aIni,
 	}
-
-	setup := TSetup{}
-	s, ok = config.AsString("AccessLog")
+	s, ok = aIni.AsString(ini.DefSection, "AccessLog")
 	if !ok {
 		s = fmt.Sprintf("%s.%s.log", "access", gMe)
 	}
 	setup.AccessLog = s
 
-	if s, ok = config.AsString("ErrorLog"); !ok {
+	if s, ok = aIni.AsString(ini.DefSection, "ErrorLog"); !ok {
 		s = fmt.Sprintf("%s.%s.log", "error", gMe)
 	}
 	setup.ErrorLog = s
 
-	//TODO: process listen port numbers
+	setup.LogFormat = LogFormatCombined
+	if s, ok = aIni.AsString(ini.DefSection, "AccessLogFormat"); ok {
+		switch s = strings.ToLower(strings.TrimSpace(s)); s {
+		case LogFormatCombined, LogFormatW3C:
+			setup.LogFormat = s
+		default:
+			conflicts = append(conflicts,
+				fmt.Sprintf("invalid AccessLogFormat %q", s))
+		}
+	}
+	setup.LogFields, _ = aIni.AsString(ini.DefSection, "AccessLogFields")
+	setup.SecurityLog, _ = aIni.AsString(ini.DefSection, "SecurityLog")
+	setup.SecurityFormat = SecLogCEF
+	if s, ok = aIni.AsString(ini.DefSection, "SecurityLogFormat"); ok {
+		switch s = strings.ToLower(strings.TrimSpace(s)); s {
+		case SecLogCEF, SecLogECS:
+			setup.SecurityFormat = s
+		default:
+			conflicts = append(conflicts,
+				fmt.Sprintf("invalid SecurityLogFormat %q", s))
+		}
+	}
 
-	sections, sLen := inif.Sections()
-	bes := make(tBackendServers, sLen-1) // ignore default section
+	if s, ok = aIni.AsString(ini.DefSection, "HTTPListen"); !ok {
+		s = ":80"
+	}
+	setup.HTTPListen = s
+
+	if s, ok = aIni.AsString(ini.DefSection, "HTTPSListen"); !ok {
+		s = ":443"
+	}
+	setup.HTTPSListen = s
+
+	listeners, errs := readListeners(aIni)
+	setup.Listeners = listeners
+	conflicts = append(conflicts, errs...)
+
+	tcpRoutes, errs := readTCPRoutes(aIni)
+	setup.TCPRoutes = tcpRoutes
+	conflicts = append(conflicts, errs...)
+
+	if s, ok = aIni.AsString(ini.DefSection, "AdminListen"); ok {
+		setup.AdminListen = s
+	}
+	if s, ok = aIni.AsString(ini.DefSection, "HealthPath"); ok {
+		setup.HealthPath = s
+	}
+	setup.StrictParsing, _ = aIni.AsBool(ini.DefSection, "StrictParsing")
+	setup.Seccomp, _ = aIni.AsBool(ini.DefSection, "Seccomp")
+	setup.PanicRestart, _ = aIni.AsBool(ini.DefSection, "PanicRestart")
+	if s, ok = aIni.AsString(ini.DefSection, "RunAsUser"); ok {
+		setup.RunAsUser = s
+	}
+	if s, ok = aIni.AsString(ini.DefSection, "RunAsGroup"); ok {
+		setup.RunAsGroup = s
+	}
+	setup.KeepBindCap, _ = aIni.AsBool(ini.DefSection, "KeepBindCapability")
+	if s, ok = aIni.AsString(ini.DefSection, "Chroot"); ok {
+		setup.Chroot = s
+	}
+	if s, ok = aIni.AsString(ini.DefSection, "PIDFile"); ok {
+		setup.PIDFile = s
+	}
+	if s, ok = aIni.AsString(ini.DefSection, "RateStateFile"); ok {
+		setup.RateStateFile = s
+	}
+	if s, ok = aIni.AsString(ini.DefSection, "ErrorPages"); ok {
+		setup.ErrorPages = s
+	}
+	if s, ok = aIni.AsString(ini.DefSection, "TrustedProxies"); ok {
+		var err error
+		if setup.TrustedProxies, err = parseNetworks(s); nil != err {
+			conflicts = append(conflicts,
+				fmt.Sprintf("invalid TrustedProxies: %v", err))
+		}
+	}
+	setup.HostCheck, _ = aIni.AsBool(ini.DefSection, "HostCheck")
+	if s, ok = aIni.AsString(ini.DefSection, "HostAllow"); ok {
+		for _, host := range strings.Split(s, ",") {
+			if host = normaliseHost(host); "" != host {
+				setup.HostAllow = append(setup.HostAllow, host)
+			}
+		}
+	}
+	setup.HostRejectStatus = http.StatusMisdirectedRequest
+	if i, ok := hostInt(aIni, ini.DefSection, "HostRejectStatus"); ok {
+		if (http.StatusBadRequest <= i) && (600 > i) {
+			setup.HostRejectStatus = i
+		} else {
+			conflicts = append(conflicts,
+				fmt.Sprintf("invalid HostRejectStatus %d", i))
+		}
+	}
+	if s, ok = aIni.AsString(ini.DefSection, "ShutdownWebhook"); ok {
+		setup.ShutdownWebhook = s
+	}
+	setup.UnmatchedSNI = SNIDefault
+	if s, ok = aIni.AsString(ini.DefSection, "UnmatchedSNI"); ok {
+		switch s = strings.ToLower(strings.TrimSpace(s)); s {
+		case SNIClose, SNIDefault, SNICatchAll:
+			setup.UnmatchedSNI = s
+		default:
+			conflicts = append(conflicts,
+				fmt.Sprintf("invalid UnmatchedSNI %q", s))
+		}
+	}
+	setup.TLSFallback = TLSSelfSigned
+	if s, ok = aIni.AsString(ini.DefSection, "TLSFallback"); ok {
+		switch s = strings.ToLower(strings.TrimSpace(s)); s {
+		case TLSFail, TLSHTTPOnly, TLSSelfSigned:
+			setup.TLSFallback = s
+		default:
+			conflicts = append(conflicts,
+				fmt.Sprintf("invalid TLSFallback %q", s))
+		}
+	}
+	if s, ok = aIni.AsString(ini.DefSection, "CatchAllHost"); ok {
+		setup.CatchAllHost = normaliseHost(s)
+	}
+	setup.KubeIngress, _ = aIni.AsBool(ini.DefSection, "KubeIngress")
+	setup.KubeNS, _ = aIni.AsString(ini.DefSection, "KubeNamespace")
+	if setup.KubeInterval, ok = hostDuration(aIni, ini.DefSection, "KubeInterval"); !ok || (0 >= setup.KubeInterval) {
+		setup.KubeInterval = time.Second * 30
+	}
+	setup.AlertWebhook, _ = aIni.AsString(ini.DefSection, "AlertWebhook")
+	setup.AlertFormat = AlertGeneric
+	if s, ok = aIni.AsString(ini.DefSection, "AlertFormat"); ok {
+		switch s = strings.ToLower(strings.TrimSpace(s)); s {
+		case AlertGeneric, AlertSlack, AlertMatrix:
+			setup.AlertFormat = s
+		default:
+			conflicts = append(conflicts,
+				fmt.Sprintf("invalid AlertFormat %q", s))
+		}
+	}
+	if setup.AlertErrorRate, ok = hostFloat(aIni, ini.DefSection, "AlertErrorRate"); !ok || (0 >= setup.AlertErrorRate) {
+		setup.AlertErrorRate = 0.05
+	}
+	if setup.AlertMinRequests, ok = hostInt(aIni, ini.DefSection, "AlertMinRequests"); !ok || (0 >= setup.AlertMinRequests) {
+		setup.AlertMinRequests = 20
+	}
+	if setup.AlertInterval, ok = hostDuration(aIni, ini.DefSection, "AlertInterval"); !ok || (0 == setup.AlertInterval) {
+		setup.AlertInterval = time.Minute
+	}
+	setup.HTTPLimits = readHeaderLimits(aIni, "HTTP")
+	setup.HTTPSLimits = readHeaderLimits(aIni, "HTTPS")
+	setup.HTTPTimes = readTimeouts(aIni, "HTTP")
+	setup.HTTPSTimes = readTimeouts(aIni, "HTTPS")
+	setup.HTTPConns = readConnLimits(aIni, "HTTP")
+	setup.HTTPSConns = readConnLimits(aIni, "HTTPS")
+	setup.Sockets = readSocketOptions(aIni)
+	if size, ok := hostInt(aIni, ini.DefSection, "MemoryBudget"); ok && (0 < size) {
+		setup.MemoryBudget = int64(size)
+	}
+	setup.MemoryMaxBody = 1 << 20
+	if size, ok := hostInt(aIni, ini.DefSection, "MemoryMaxBody"); ok && (0 <= size) {
+		setup.MemoryMaxBody = int64(size)
+	}
+	setup.ConfigHash = configHash(aIni.String())
+
+	sections, sLen := aIni.Sections()
+	type tJob struct {
+		section, host, destURL string
+	}
+	jobs := make([]tJob, 0, sLen)
+	seen := make(map[string]string, sLen)         // hostname -> section
+	windows := make(map[string][]tSchedule, sLen) // hostname -> schedules
+	now := time.Now()
 
 	for _, section := range sections {
 		if "" != isHostRE.FindString(section) {
-			outside, ok := inif.AsString(section, "outside")
+			outside, ok := aIni.AsString(section, "outside")
 			if !ok {
 				continue
 			}
-			destURL, ok := inif.AsString(section, "destURL")
+			host := normaliseHost(outside)
+			schedule, err := readSchedule(aIni, section)
+			if nil != err {
+				conflicts = append(conflicts, err.Error())
+				continue
+			}
+			for _, other := range windows[host] {
+				// both active now: reported as duplicates below
+				if schedule.overlaps(other) && !(schedule.activeAt(now) && other.activeAt(now)) {
+					conflicts = append(conflicts, fmt.Sprintf("[%s] and [%s] schedule %q at the same time",
+						other.section, section, outside))
+				}
+			}
+			windows[host] = append(windows[host], schedule)
+			setup.nextChange = schedule.nextChange(setup.nextChange, now)
+			if !schedule.activeAt(now) {
+				continue
+			}
+			if other, dup := seen[host]; dup {
+				first, _ := aIni.AsString(other, "outside")
+				conflicts = append(conflicts, fmt.Sprintf("[%s] %q and [%s] %q",
+					other, first, section, outside))
+				continue
+			}
+			seen[host] = section
+			destURL, ok := aIni.AsString(section, "destURL")
 			if !ok {
 				continue
 			}
-			bes[outside] = tDestination{destURL, nil}
+			jobs = append(jobs, tJob{section, host, destURL})
 		}
 	} // for
+
+	// read the hosts' settings concurrently (for large host lists):
+	dests := make([]tDestination, len(jobs))
+	forEachParallel(len(jobs), func(aIdx int) {
+		job := jobs[aIdx]
+		dests[aIdx] = readDestination(aIni, job.section, job.host, job.destURL)
+	})
+	bes := make(tBackendServers, len(jobs))
+	for idx, job := range jobs {
+		bes[job.host] = dests[idx]
+	}
 	setup.BackendList = &bes
 
-	return &setup
+	if SNICatchAll == setup.UnmatchedSNI {
+		if _, ok = bes[setup.CatchAllHost]; !ok {
+			conflicts = append(conflicts,
+				fmt.Sprintf("CatchAllHost %q not configured", setup.CatchAllHost))
+		}
+	}
+
+	if 0 < len(conflicts) {
+		return &setup, &TConfigError{Problems: conflicts}
+	}
+
+	return &setup, nil
+} // newSetup()
+
+// `readDestination()` reads the backend configuration of a host.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+// - `aHost`: The (normalised) configured hostname.
+// - `aDestURL`: The URL of the host's backend server.
+//
+// Returns:
+// - `tDestination`: The host's backend configuration.
+func readDestination(aIni *ini.TSectionList, aSection, aHost, aDestURL string) tDestination {
+	var (
+		ok bool
+		s  string
+	)
+	dest := newDestination(aDestURL)
+	if s, ok = hostString(aIni, aSection, "forwarded"); ok {
+		dest.fwdStyle = parseForwardStyle(s)
+	}
+	dest.reqHeaders = readHeaderRules(aIni, aSection, "requestHeader")
+	dest.resHeaders = readHeaderRules(aIni, aSection, "responseHeader")
+	dest.compress = readCompression(aIni, aSection)
+	dest.cache = readCache(aIni, aSection)
+	dest.cors = readCORS(aIni, aSection)
+	dest.basicAuth = readBasicAuth(aIni, aSection)
+	dest.rewrite = readBodyRewrite(aIni, aSection, aDestURL)
+	if s, ok = hostString(aIni, aSection, "via"); ok {
+		dest.via = newVia(s)
+	}
+	dest.uaFilter = readUAFilter(aIni, aSection)
+	dest.abTest = readABTest(aIni, aSection)
+	dest.slowAfter, _ = hostDuration(aIni, aSection, "slowRequest")
+	dest.privacy = readLogPrivacy(aIni, aSection)
+	dest.clientRate = readClientLimit(aIni, aSection, aHost)
+	dest.rateReject = readRateReject(aIni, aSection)
+	dest.concurrent = readConcurrency(aIni, aSection)
+	dest.tlsBlock = readFingerprintBlock(aIni, aSection)
+	dest.reqPolicy = readReqPolicy(aIni, aSection)
+	dest.signature = readSignature(aIni, aSection)
+	dest.challenge = readChallenge(aIni, aSection, aHost)
+	dest.csrf = readCSRF(aIni, aSection)
+	dest.static = readStatic(aIni, aSection)
+	dest.transport = readTransport(aIni, aSection)
+	dest.prewarm, _ = hostInt(aIni, aSection, "prewarm")
+	dest.lowPrio = readLowPriority(aIni, aSection)
+	if s, ok = hostString(aIni, aSection, "flushInterval"); ok {
+		if "-1" == strings.TrimSpace(s) {
+			dest.flush = -1 // flush after each write
+		} else {
+			dest.flush, _ = hostDuration(aIni, aSection, "flushInterval")
+		}
+	}
+	if on, ok := hostBool(aIni, aSection, "debug"); ok {
+		dest.debug.on.Store(on)
+	}
+	dest.debug.bodySize, _ = hostInt(aIni, aSection, "debugBodySize")
+	if on, ok := hostBool(aIni, aSection, "maintenance"); ok {
+		dest.maintOn.Store(on)
+	}
+	if on, ok := aIni.AsBool(aSection, "enabled"); ok && !on {
+		dest.maintOn.Store(true)
+	}
+	if s, ok = hostString(aIni, aSection, "maintenancePage"); ok {
+		page, err := os.ReadFile(s) // #nosec G304
+		if nil != err {
+			logErr("ReProx/newSetup",
+				fmt.Sprintf("[%s] maintenancePage: %v", aSection, err))
+		}
+		dest.maintPage = page
+	}
+	if s, ok = hostString(aIni, aSection, "sampleURL"); ok {
+		dest.sampleURL = s
+		if dest.sampleRate, ok = hostFloat(aIni, aSection, "sampleRate"); !ok {
+			dest.sampleRate = 0.01
+		}
+	}
+	if ok, _ = hostBool(aIni, aSection, "autoPreload"); ok {
+		dest.preload = newPreloadCache()
+	}
+	dest.apiKeys = readAPIKeys(aIni, aSection)
+	if s, ok = hostString(aIni, aSection, "cspReportPath"); ok {
+		limit, ok := hostInt(aIni, aSection, "cspReportLimit")
+		if !ok {
+			limit = 60
+		}
+		dest.csp = &tCSPCollector{
+			path: s,
+			rate: newRateWindow("csp:"+aHost, limit, time.Minute),
+		}
+	}
+	if s, ok = aIni.AsString(aSection, "pinSHA256"); ok {
+		dest.pins = parsePins(aSection, s)
+	}
+	if dest.hibernate, ok = hostDuration(aIni, aSection, "hibernate"); ok {
+		dest.lastUsed = &atomic.Int64{}
+	}
+	if dest.smokePath, ok = hostString(aIni, aSection, "smokePath"); ok {
+		if dest.smokeEvery, ok = hostDuration(aIni, aSection, "smokeInterval"); !ok || (0 == dest.smokeEvery) {
+			dest.smokeEvery = time.Minute
+		}
+	}
+	dest.wsIdle, _ = hostDuration(aIni, aSection, "wsIdleTimeout")
+
+	return dest
+} // readDestination()
+
+// `forEachParallel()` calls `aFunc` for the indices `0` to `aCount-1`
+// by a bounded number of concurrent workers.
+//
+// Parameters:
+// - `aCount`: The number of calls.
+// - `aFunc`: The function to call with each index.
+func forEachParallel(aCount int, aFunc func(aIdx int)) {
+	workers := min(runtime.GOMAXPROCS(0), aCount)
+	if 1 >= workers {
+		for idx := range aCount {
+			aFunc(idx)
+		}
+		return
+	}
+
+	var (
+		next atomic.Int64
+		wg   sync.WaitGroup
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := int(next.Add(1) - 1); idx < aCount; idx = int(next.Add(1) - 1) {
+				aFunc(idx)
+			}
+		}()
+	}
+	wg.Wait()
+} // forEachParallel()
+
+// `readIni()` reads the application configuration from the INI files
+// found in the default locations.
+// It returns a pointer to a `TSetup` structure containing the required
+// configuration data.
+func readIni() *TSetup {
+	config, inif := ini.ReadIniData(gMe)
+	if (nil == config) || (nil == inif) {
+		panic("can't read INI data")
+	}
+	applyProfile(inif, os.Getenv(profileEnv))
+	expandVars(inif)
+
+	setup, err := newSetup(inif)
+	if nil != err {
+		panic(err.Error())
+	}
+
+	return setup
 } // readIni()
 
 /* _EoF_ */
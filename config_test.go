@@ -0,0 +1,87 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestOverridesFrontends(t *testing.T) {
+	setup := &TSetup{
+		HTTPListen:  ":80",
+		HTTPSListen: ":443",
+		Listeners: []TListener{
+			{Name: "Listen1", Address: "192.0.2.1:80"},
+			{Name: "Listen2", Address: "192.0.2.1:443", TLS: true},
+			{Name: "Listen3", Address: "192.0.2.2:80"},
+		},
+	}
+	TOverrides{HTTPListen: ":8080"}.apply(setup)
+
+	got := setup.Frontends()
+	want := []TListener{
+		{Name: "Listen1", Address: ":8080"},
+		{Name: "Listen2", Address: "192.0.2.1:443", TLS: true},
+	}
+	if len(want) != len(got) {
+		t.Fatalf("frontends = %v, want %v", got, want)
+	}
+	for idx := range want {
+		if (want[idx].Name != got[idx].Name) ||
+			(want[idx].Address != got[idx].Address) || (want[idx].TLS != got[idx].TLS) {
+			t.Errorf("frontend %d = %v, want %v", idx, got[idx], want[idx])
+		}
+	}
+	if ":8080" != setup.HTTPListen {
+		t.Errorf("HTTPListen = %q, want %q", setup.HTTPListen, ":8080")
+	}
+} // TestOverridesFrontends()
+
+func TestReloadStartsSmokeTests(t *testing.T) {
+	ph := newTestProxy(t, "http://127.0.0.1:8080", nil)
+	old := CurrentSetup()
+	dest := newDestination("http://127.0.0.1:8081")
+	dest.smokePath, dest.smokeEvery = "/health", time.Hour
+	servers := tBackendServers{testHost: dest}
+	setup := &TSetup{BackendList: &servers}
+
+	for range 2 {
+		ph.reload(old, setup)
+	}
+	ph.Lock()
+	defer ph.Unlock()
+	if (1 != len(ph.smokeTests)) || !ph.smokeTests[smokeKey(testHost, "/health", time.Hour)] {
+		t.Errorf("smoke tests = %v, want one for %s/health", ph.smokeTests, testHost)
+	}
+} // TestReloadStartsSmokeTests()
+
+func BenchmarkReload(b *testing.B) {
+	for _, hosts := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("hosts=%d", hosts), func(b *testing.B) {
+			ph := newTestProxy(b, "http://127.0.0.1:8080", nil)
+			old := CurrentSetup()
+			servers := make(tBackendServers, hosts)
+			for idx := range hosts {
+				servers[fmt.Sprintf("h%d.example.com", idx)] =
+					newDestination(fmt.Sprintf("http://127.0.0.1:%d", 8000+idx))
+			}
+			setup := &TSetup{BackendList: &servers}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				ph.reload(old, setup)
+			}
+		})
+	}
+} // BenchmarkReload()
+
+/* _EoF_ */
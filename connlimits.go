@@ -0,0 +1,119 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/mwat56/ini"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+)
+
+type (
+	// `TConnLimits` holds the client connection limits of a listener.
+	TConnLimits struct {
+		MaxConns   int    // simultaneous connections (`0`: unlimited)
+		MaxStreams uint32 // concurrent HTTP/2 streams (`0`: Go's default)
+		KeepAlive  bool   // whether to keep connections between requests
+		H2C        bool   // whether to accept HTTP/2 without TLS
+	}
+)
+
+// `Apply()` sets the listener's keep-alive and HTTP/2 settings for
+// `aServer`.
+//
+// As the HTTP/2 settings depend on the server's TLS configuration it
+// must be set before. A server without TLS accepts HTTP/2 "prior
+// knowledge" connections (e.g. of gRPC clients) if `H2C` is set.
+//
+// Parameters:
+// - `aServer`: The server to configure.
+//
+// Returns:
+// - `*http.Server`: The configured server.
+func (cl TConnLimits) Apply(aServer *http.Server) *http.Server {
+	aServer.SetKeepAlivesEnabled(cl.KeepAlive)
+	if (0 < cl.MaxStreams) && (nil != aServer.TLSConfig) {
+		err := http2.ConfigureServer(aServer, &http2.Server{
+			MaxConcurrentStreams: cl.MaxStreams,
+		})
+		if nil != err {
+			logErr("ReProx/TConnLimits.Apply", err.Error())
+		}
+	}
+	if cl.H2C && (nil == aServer.TLSConfig) {
+		aServer.Handler = h2c.NewHandler(aServer.Handler, &http2.Server{
+			MaxConcurrentStreams: cl.MaxStreams,
+		})
+	}
+
+	return aServer
+} // Apply()
+
+// `Listener()` limits the number of simultaneous connections
+// accepted by `aListener`; further clients wait in the kernel's
+// backlog until a connection is closed.
+//
+// Parameters:
+// - `aListener`: The listener to limit.
+//
+// Returns:
+// - `net.Listener`: The limited listener.
+func (cl TConnLimits) Listener(aListener net.Listener) net.Listener {
+	if 0 >= cl.MaxConns {
+		return aListener
+	}
+
+	return netutil.LimitListener(aListener, cl.MaxConns)
+} // Listener()
+
+// `readConnLimits()` reads the connection limits of the listener
+// whose settings start with `aPrefix` (`HTTP` or `HTTPS`).
+//
+// The listener specific `<prefix>MaxConnections`,
+// `<prefix>MaxConcurrentStreams`, and `<prefix>KeepAlive` settings
+// default to the general ones without prefix, and those to
+// unlimited, Go's default (`250`), and `true` respectively;
+// `<prefix>H2C` defaults to `false`.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aPrefix`: The listener's settings prefix.
+//
+// Returns:
+// - `TConnLimits`: The listener's limits.
+func readConnLimits(aIni *ini.TSectionList, aPrefix string) (rLimits TConnLimits) {
+	value := func(aKey string) (int, bool) {
+		if result, ok := hostInt(aIni, ini.DefSection, aPrefix+aKey); ok {
+			return result, true
+		}
+		return hostInt(aIni, ini.DefSection, aKey)
+	}
+
+	if n, ok := value("MaxConnections"); ok && (0 < n) {
+		rLimits.MaxConns = n
+	}
+	if n, ok := value("MaxConcurrentStreams"); ok && (0 < n) {
+		rLimits.MaxStreams = uint32(n)
+	}
+	rLimits.KeepAlive = true
+	if on, ok := hostBool(aIni, ini.DefSection, aPrefix+"KeepAlive"); ok {
+		rLimits.KeepAlive = on
+	} else if on, ok := hostBool(aIni, ini.DefSection, "KeepAlive"); ok {
+		rLimits.KeepAlive = on
+	}
+	rLimits.H2C, _ = hostBool(aIni, ini.DefSection, aPrefix+"H2C")
+
+	return
+} // readConnLimits()
+
+/* _EoF_ */
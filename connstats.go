@@ -0,0 +1,159 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// Connection counters of a single listener:
+	tConnStats struct {
+		states   sync.Map      // current `http.ConnState` by connection
+		open     atomic.Int64  // connections not yet closed
+		active   atomic.Int64  // connections serving a request
+		idle     atomic.Int64  // keep-alive connections between requests
+		hijacked atomic.Uint64 // connections taken over (e.g. WebSockets)
+		total    atomic.Uint64 // connections accepted
+	}
+
+	// `TConnReport` holds the connection counters of a listener.
+	TConnReport struct {
+		Open     int64  `json:"open"`
+		Active   int64  `json:"active"`
+		Idle     int64  `json:"idle"`
+		Hijacked uint64 `json:"hijacked"`
+		Total    uint64 `json:"total"`
+	}
+)
+
+var (
+	// Connection counters by listener name:
+	gConnStats sync.Map
+)
+
+// `gauge()` returns the counter tracking connections in `aState`.
+//
+// Parameters:
+// - `aState`: The connection state.
+//
+// Returns:
+// - `*atomic.Int64`: The counter or `nil` for untracked states.
+func (cs *tConnStats) gauge(aState http.ConnState) *atomic.Int64 {
+	switch aState {
+	case http.StateActive:
+		return &cs.active
+	case http.StateIdle:
+		return &cs.idle
+	}
+
+	return nil
+} // gauge()
+
+// `track()` updates the counters for a connection changing to `aState`.
+//
+// Parameters:
+// - `aConn`: The connection changing its state.
+// - `aState`: The connection's new state.
+func (cs *tConnStats) track(aConn net.Conn, aState http.ConnState) {
+	if prev, ok := cs.states.Load(aConn); ok {
+		if gauge := cs.gauge(prev.(http.ConnState)); nil != gauge {
+			gauge.Add(-1)
+		}
+	}
+
+	switch aState {
+	case http.StateNew:
+		cs.total.Add(1)
+		cs.open.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		if http.StateHijacked == aState {
+			cs.hijacked.Add(1)
+		}
+		cs.open.Add(-1)
+		cs.states.Delete(aConn)
+		return
+	}
+	if gauge := cs.gauge(aState); nil != gauge {
+		gauge.Add(1)
+	}
+	cs.states.Store(aConn, aState)
+} // track()
+
+// `report()` returns the current counters.
+//
+// Returns:
+// - `TConnReport`: The listener's connection counters.
+func (cs *tConnStats) report() TConnReport {
+	return TConnReport{
+		Open:     cs.open.Load(),
+		Active:   cs.active.Load(),
+		Idle:     cs.idle.Load(),
+		Hijacked: cs.hijacked.Load(),
+		Total:    cs.total.Load(),
+	}
+} // report()
+
+// `TrackConnections()` counts the open, active, idle and hijacked
+// connections of `aServer` under the listener name `aName`.
+//
+// A `ConnState` hook already set on `aServer` is called as well.
+//
+// Parameters:
+// - `aName`: The name to report the listener's counters under.
+// - `aServer`: The server to track.
+//
+// Returns:
+// - `*http.Server`: The tracked `aServer`.
+func TrackConnections(aName string, aServer *http.Server) *http.Server {
+	value, _ := gConnStats.LoadOrStore(aName, &tConnStats{})
+	cs := value.(*tConnStats)
+
+	next := aServer.ConnState
+	aServer.ConnState = func(aConn net.Conn, aState http.ConnState) {
+		cs.track(aConn, aState)
+		if nil != next {
+			next(aConn, aState)
+		}
+	}
+
+	return aServer
+} // TrackConnections()
+
+// `ConnectionReports()` returns the connection counters of all
+// listeners tracked by `TrackConnections()`.
+//
+// Returns:
+// - `map[string]TConnReport`: The counters by listener name.
+func ConnectionReports() map[string]TConnReport {
+	result := make(map[string]TConnReport)
+	gConnStats.Range(func(aKey, aValue any) bool {
+		result[aKey.(string)] = aValue.(*tConnStats).report()
+		return true
+	})
+
+	return result
+} // ConnectionReports()
+
+// `handleConnections()` sends the connection counters of all tracked
+// listeners as JSON.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func handleConnections(aWriter http.ResponseWriter, aRequest *http.Request) {
+	aWriter.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(aWriter).Encode(ConnectionReports())
+} // handleConnections()
+
+/* _EoF_ */
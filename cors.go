@@ -0,0 +1,166 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host CORS settings:
+	tCORS struct {
+		origins     []string // allowed origins (`*`: any)
+		methods     string   // allowed methods for preflights
+		headers     string   // allowed request headers for preflights
+		credentials bool     // whether credentials are allowed
+		maxAge      int      // seconds a preflight may be cached
+	}
+)
+
+// `allowedOrigin()` returns the value for the
+// `Access-Control-Allow-Origin` header for requests from `aOrigin`.
+//
+// Parameters:
+// - `aOrigin`: The request's `Origin` header.
+//
+// Returns:
+// - `string`: The value to send, or an empty string if not allowed.
+func (c *tCORS) allowedOrigin(aOrigin string) string {
+	if "" == aOrigin {
+		return ""
+	}
+	for _, origin := range c.origins {
+		if "*" == origin {
+			if c.credentials {
+				// `*` isn't allowed together with credentials:
+				return aOrigin
+			}
+			return "*"
+		}
+		if strings.EqualFold(origin, aOrigin) {
+			return aOrigin
+		}
+	}
+
+	return ""
+} // allowedOrigin()
+
+// `preflight()` answers a CORS preflight request.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if `aRequest` was a preflight and got answered.
+func (c *tCORS) preflight(aWriter http.ResponseWriter, aRequest *http.Request) bool {
+	if (nil == c) || (http.MethodOptions != aRequest.Method) ||
+		("" == aRequest.Header.Get("Access-Control-Request-Method")) {
+		return false
+	}
+	origin := aRequest.Header.Get("Origin")
+	if "" == origin {
+		return false
+	}
+
+	header := aWriter.Header()
+	header.Add("Vary", "Origin")
+	if allowed := c.allowedOrigin(origin); "" != allowed {
+		header.Set("Access-Control-Allow-Origin", allowed)
+		header.Set("Access-Control-Allow-Methods", c.methods)
+		if "" != c.headers {
+			header.Set("Access-Control-Allow-Headers", c.headers)
+		} else if requested := aRequest.Header.Get("Access-Control-Request-Headers"); "" != requested {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if c.credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if 0 < c.maxAge {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(c.maxAge))
+		}
+	}
+	aWriter.WriteHeader(http.StatusNoContent)
+
+	return true
+} // preflight()
+
+// `inject()` adds the CORS headers to `aResponse` unless the backend
+// already sent them itself.
+//
+// It's meant to be used as (part of) a proxy's `ModifyResponse` hook.
+//
+// Parameters:
+// - `aResponse`: The backend's response.
+func (c *tCORS) inject(aResponse *http.Response) {
+	if nil == c {
+		return
+	}
+	header := aResponse.Header
+	if "" != header.Get("Access-Control-Allow-Origin") {
+		return
+	}
+
+	header.Add("Vary", "Origin")
+	allowed := c.allowedOrigin(aResponse.Request.Header.Get("Origin"))
+	if "" == allowed {
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", allowed)
+	if c.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+} // inject()
+
+// `readCORS()` reads the host's CORS settings:
+//
+//	corsOrigins = https://app.example.com, https://admin.example.com
+//	corsMethods = GET, POST, PUT, DELETE
+//	corsHeaders = Content-Type, Authorization
+//	corsCredentials = true
+//	corsMaxAge = 600
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tCORS`: The host's settings or `nil` if CORS isn't configured.
+func readCORS(aIni *ini.TSectionList, aSection string) *tCORS {
+	s, ok := hostString(aIni, aSection, "corsOrigins")
+	if !ok {
+		return nil
+	}
+
+	result := &tCORS{
+		methods: "GET, HEAD, POST",
+	}
+	for _, origin := range strings.Split(s, ",") {
+		if origin = strings.TrimSpace(origin); "" != origin {
+			result.origins = append(result.origins, origin)
+		}
+	}
+	if 0 == len(result.origins) {
+		return nil
+	}
+	if s, ok = hostString(aIni, aSection, "corsMethods"); ok {
+		result.methods = strings.ToUpper(s)
+	}
+	result.headers, _ = hostString(aIni, aSection, "corsHeaders")
+	result.credentials, _ = hostBool(aIni, aSection, "corsCredentials")
+	result.maxAge, _ = hostInt(aIni, aSection, "corsMaxAge")
+
+	return result
+} // readCORS()
+
+/* _EoF_ */
@@ -0,0 +1,265 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mwat56/ini"
+)
+
+const (
+	// Header identifying an encrypted configuration file:
+	cryptMagic = "REPROX-AES256GCM\n"
+
+	// Environment variable holding the base64 encoded config key:
+	cryptKeyEnv = "REPROX_CONFIG_KEY"
+
+	// Environment variable naming a file holding the config key:
+	cryptKeyFileEnv = "REPROX_CONFIG_KEYFILE"
+
+	// Size of the AES-256 key:
+	cryptKeySize = 32
+)
+
+// `configKey()` returns the key for encrypting/decrypting the
+// configuration file.
+//
+// The key is read either base64 encoded from the environment variable
+// `REPROX_CONFIG_KEY` or (raw or base64 encoded) from the file named
+// by `REPROX_CONFIG_KEYFILE`.
+//
+// Returns:
+// - `[]byte`: The 256 bit key.
+// - `error`: An error if there's no (valid) key.
+func configKey() ([]byte, error) {
+	var data []byte
+
+	if s, ok := os.LookupEnv(cryptKeyEnv); ok {
+		data = []byte(s)
+	} else if fName, ok := os.LookupEnv(cryptKeyFileEnv); ok {
+		raw, err := os.ReadFile(fName) // #nosec G304
+		if nil != err {
+			return nil, err
+		}
+		if cryptKeySize == len(raw) {
+			return raw, nil
+		}
+		data = raw
+	} else {
+		return nil, ErrNoConfigKey
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if nil != err {
+		return nil, err
+	}
+	if cryptKeySize != len(key) {
+		return nil, fmt.Errorf("%w: configuration key must have %d bytes",
+			ErrConfigParse, cryptKeySize)
+	}
+
+	return key, nil
+} // configKey()
+
+// `configCipher()` returns the AES-GCM cipher using the configuration key.
+//
+// Returns:
+// - `cipher.AEAD`: The cipher to use.
+// - `error`: An error if there's no (valid) key.
+func configCipher() (cipher.AEAD, error) {
+	key, err := configKey()
+	if nil != err {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if nil != err {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+} // configCipher()
+
+// `EncryptConfig()` encrypts the configuration file `aSrc` writing
+// the result to `aDst`.
+//
+// Parameters:
+// - `aSrc`: The name of the plain text INI file.
+// - `aDst`: The name of the encrypted file to write.
+//
+// Returns:
+// - `error`: A possible error reading, encrypting, or writing.
+func EncryptConfig(aSrc, aDst string) error {
+	plain, err := os.ReadFile(aSrc) // #nosec G304
+	if nil != err {
+		return err
+	}
+	aead, err := configCipher()
+	if nil != err {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); nil != err {
+		return err
+	}
+	data := append([]byte(cryptMagic), nonce...)
+	data = aead.Seal(data, nonce, plain, []byte(cryptMagic))
+
+	return os.WriteFile(aDst, data, 0600)
+} // EncryptConfig()
+
+// `decryptConfig()` decrypts the contents of an encrypted
+// configuration file.
+//
+// Parameters:
+// - `aData`: The file's contents (including the header).
+//
+// Returns:
+// - `[]byte`: The decrypted INI data.
+// - `error`: A possible decryption error.
+func decryptConfig(aData []byte) ([]byte, error) {
+	aead, err := configCipher()
+	if nil != err {
+		return nil, err
+	}
+
+	aData = aData[len(cryptMagic):]
+	if aead.NonceSize() > len(aData) {
+		return nil, fmt.Errorf("%w: encrypted configuration truncated", ErrConfigParse)
+	}
+	nonce, sealed := aData[:aead.NonceSize()], aData[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, sealed, []byte(cryptMagic))
+} // decryptConfig()
+
+// `openConfig()` reads the INI file `aFilename` which may be stored
+// either as plain text or encrypted by `EncryptConfig()`.
+//
+// Decrypted data is parsed in memory (see `parseDecrypted()`) so that
+// it never touches the disk and doesn't depend on `/proc` (which may
+// be missing in the `Chroot` jail at reload time).
+//
+// Parameters:
+// - `aFilename`: The name of the INI file to read.
+//
+// Returns:
+// - `*ini.TSectionList`: The INI data read.
+// - `error`: A possible error reading or decrypting the file.
+func openConfig(aFilename string) (*ini.TSectionList, error) {
+	data, err := os.ReadFile(aFilename) // #nosec G304
+	if nil != err {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(cryptMagic)) {
+		return ini.NewIni(aFilename)
+	}
+
+	if data, err = decryptConfig(data); nil != err {
+		return nil, fmt.Errorf("%s: %w", aFilename, err)
+	}
+	result, err := parseDecrypted(data)
+	clear(data)
+	if nil != err {
+		return nil, err
+	}
+
+	return result.SetFilename(aFilename), nil
+} // openConfig()
+
+// `parseDecrypted()` parses the decrypted configuration `aData` in
+// memory, following the INI file syntax: `[Section]` lines, `key =
+// value` lines (a value's surrounding quotes removed, a trailing
+// backslash continuing it on the next line), and comment lines
+// starting with `#` or `;`. Keys before the first section belong to
+// `ini.DefSection`. It must read the same values as `ini.NewIni()`
+// does from the plain text file (see `crypt_test.go`).
+//
+// Parameters:
+// - `aData`: The decrypted INI data.
+//
+// Returns:
+// - `*ini.TSectionList`: The INI data read.
+// - `error`: A possible error reading the data.
+func parseDecrypted(aData []byte) (*ini.TSectionList, error) {
+	var (
+		key, value strings.Builder
+		section    = ini.DefSection
+	)
+	result := ini.NewSections()
+	scanner := bufio.NewScanner(bytes.NewReader(aData))
+	scanner.Buffer(make([]byte, 0, 4096), len(aData)+1)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if 0 < key.Len() { // continuation of the previous value
+			more, ok := strings.CutSuffix(line, "\\")
+			value.WriteString(more)
+			if !ok {
+				result.UpdateSectKeyStr(section, key.String(), unquote(value.String()))
+				key.Reset()
+				value.Reset()
+			}
+			continue
+		}
+		if ("" == line) || ('#' == line[0]) || (';' == line[0]) {
+			continue
+		}
+		if ('[' == line[0]) && (']' == line[len(line)-1]) {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if "" == k {
+			continue
+		}
+		if more, ok := strings.CutSuffix(v, "\\"); ok {
+			key.WriteString(k)
+			value.WriteString(strings.TrimSpace(more))
+			continue
+		}
+		result.UpdateSectKeyStr(section, k, unquote(v))
+	}
+	if 0 < key.Len() {
+		result.UpdateSectKeyStr(section, key.String(), unquote(value.String()))
+	}
+
+	return result, scanner.Err()
+} // parseDecrypted()
+
+// `unquote()` removes the quotes surrounding an INI value (if any).
+//
+// Parameters:
+// - `aValue`: The (trimmed) value.
+//
+// Returns:
+// - `string`: The value without quotes.
+func unquote(aValue string) string {
+	if (2 <= len(aValue)) &&
+		((('"' == aValue[0]) && ('"' == aValue[len(aValue)-1])) ||
+			(('\'' == aValue[0]) && ('\'' == aValue[len(aValue)-1]))) {
+		return aValue[1 : len(aValue)-1]
+	}
+
+	return aValue
+} // unquote()
+
+/* _EoF_ */
@@ -0,0 +1,90 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mwat56/ini"
+)
+
+// `iniValues()` returns the values of `aIni` by section and key.
+func iniValues(aIni *ini.TSectionList) map[string]map[string]string {
+	result := make(map[string]map[string]string)
+	aIni.Walk(func(aSection, aKey, aValue string) {
+		if nil == result[aSection] {
+			result[aSection] = make(map[string]string)
+		}
+		result[aSection][aKey] = aValue
+	})
+
+	return result
+} // iniValues()
+
+func TestEncryptedConfigParsedLikePlain(t *testing.T) {
+	t.Setenv(cryptKeyEnv, base64.StdEncoding.EncodeToString(
+		[]byte(strings.Repeat("k", cryptKeySize))))
+	sample, err := os.ReadFile("reprox.ini.sample")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]string{
+		"sample": string(sample),
+		"syntax": `top = level
+; a comment
+[ Spaced ]
+	quoted = "quoted value"
+	single = 'single value'
+	inline = value # comment?
+	dup = first
+	dup = second
+	long = first part \
+		second part
+	empty =
+[Other]
+	key = value
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			plain, encrypted := filepath.Join(dir, "plain.ini"), filepath.Join(dir, "crypt.ini")
+			if err := os.WriteFile(plain, []byte(data), 0o600); nil != err {
+				t.Fatal(err)
+			}
+			if err := EncryptConfig(plain, encrypted); nil != err {
+				t.Fatal(err)
+			}
+
+			got, err := openConfig(encrypted)
+			if nil != err {
+				t.Fatal(err)
+			}
+			want, err := ini.NewIni(plain)
+			if nil != err {
+				t.Fatal(err)
+			}
+			wantValues := iniValues(want)
+			if 0 == len(wantValues) {
+				t.Skip("the ini package read no data")
+			}
+			if gotValues := iniValues(got); !reflect.DeepEqual(wantValues, gotValues) {
+				t.Errorf("decrypted configuration differs:\ngot  %v\nwant %v",
+					gotValues, wantValues)
+			}
+		})
+	}
+} // TestEncryptedConfigParsedLikePlain()
+
+/* _EoF_ */
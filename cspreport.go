@@ -0,0 +1,127 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type (
+	// The fields of a CSP violation report we're interested in:
+	tCSPViolation struct {
+		DocumentURI        string `json:"document-uri"`
+		DocumentURL        string `json:"documentURL"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedURI         string `json:"blocked-uri"`
+		BlockedURL         string `json:"blockedURL"`
+	}
+
+	// Legacy `report-uri` format:
+	tCSPReport struct {
+		Report tCSPViolation `json:"csp-report"`
+	}
+
+	// Reporting API (`report-to`) format:
+	tCSPReportEntry struct {
+		Type string        `json:"type"`
+		Body tCSPViolation `json:"body"`
+	}
+
+	// Per-host CSP report collection settings:
+	tCSPCollector struct {
+		path string       // URL path receiving the reports
+		rate *tRateWindow // allowed reports per minute
+	}
+)
+
+const (
+	// Maximum size of a CSP report request body:
+	cspMaxBodySize = 1 << 16
+)
+
+// `cspViolations()` decodes the CSP violations contained in `aBody`
+// which may use either the legacy or the Reporting API format.
+//
+// Parameters:
+// - `aBody`: The report request's body.
+//
+// Returns:
+// - `[]tCSPViolation`: The reported violations.
+func cspViolations(aBody []byte) []tCSPViolation {
+	var (
+		entries []tCSPReportEntry
+		report  tCSPReport
+		result  []tCSPViolation
+	)
+	if nil == json.Unmarshal(aBody, &entries) {
+		for _, entry := range entries {
+			if "csp-violation" == entry.Type {
+				result = append(result, entry.Body)
+			}
+		}
+		return result
+	}
+	if nil == json.Unmarshal(aBody, &report) {
+		result = append(result, report.Report)
+	}
+
+	return result
+} // cspViolations()
+
+// `serve()` handles a CSP report sent to `aHost`, logging a summary
+// of each violation.
+//
+// Parameters:
+// - `aHost`: The (normalised) requested hostname.
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming report request.
+func (cc *tCSPCollector) serve(aHost string, aWriter http.ResponseWriter, aRequest *http.Request) {
+	if http.MethodPost != aRequest.Method {
+		http.Error(aWriter, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+	if !cc.rate.allow() {
+		http.Error(aWriter, http.StatusText(http.StatusTooManyRequests),
+			http.StatusTooManyRequests)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(aRequest.Body, cspMaxBodySize))
+	if nil != err {
+		http.Error(aWriter, http.StatusText(http.StatusBadRequest),
+			http.StatusBadRequest)
+		return
+	}
+
+	for _, v := range cspViolations(body) {
+		hostStats(aHost).cspReports.Add(1)
+		document, directive, blocked := v.DocumentURI, v.ViolatedDirective, v.BlockedURI
+		if "" == document {
+			document = v.DocumentURL
+		}
+		if "" == directive {
+			directive = v.EffectiveDirective
+		}
+		if "" == blocked {
+			blocked = v.BlockedURL
+		}
+		logErr("ReProx/CSP",
+			fmt.Sprintf("host=%q document=%q directive=%q blocked=%q",
+				aHost, document, directive, blocked))
+	}
+
+	aWriter.WriteHeader(http.StatusNoContent)
+} // serve()
+
+/* _EoF_ */
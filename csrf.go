@@ -0,0 +1,236 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host double-submit CSRF protection:
+	tCSRF struct {
+		cookie string // name of the token cookie
+		header string // header carrying the token
+		field  string // form field carrying the token
+		inject bool   // whether to add the token to HTML forms
+	}
+
+	// Key of a request's CSRF token in the request context:
+	tCSRFKey struct{}
+)
+
+const (
+	// Largest form body searched for the token:
+	csrfMaxForm = 1 << 20
+)
+
+// `isSafeMethod()` checks whether `aMethod` doesn't change state.
+//
+// Parameters:
+// - `aMethod`: The request's HTTP method.
+//
+// Returns:
+// - `bool`: `true` if the method is a safe one.
+func isSafeMethod(aMethod string) bool {
+	switch aMethod {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return false
+} // isSafeMethod()
+
+// `sentToken()` returns the token sent with the state-changing
+// `aRequest` in the header or, for HTML forms, in the form field.
+//
+// The form body is read (up to `csrfMaxForm` bytes) and put back for
+// the backend.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `string`: The token sent (if any).
+func (cs *tCSRF) sentToken(aRequest *http.Request) string {
+	if token := aRequest.Header.Get(cs.header); "" != token {
+		return token
+	}
+	cType := aRequest.Header.Get("Content-Type")
+	if (nil == aRequest.Body) ||
+		!(strings.HasPrefix(cType, "application/x-www-form-urlencoded") ||
+			strings.HasPrefix(cType, "multipart/form-data")) {
+		return ""
+	}
+
+	src := aRequest.Body
+	body, err := io.ReadAll(io.LimitReader(src, csrfMaxForm+1))
+	if (nil != err) || (csrfMaxForm < len(body)) {
+		// let the backend see what was read and the rest:
+		aRequest.Body = &tReadCloser{
+			Reader: io.MultiReader(bytes.NewReader(body), src),
+			Closer: src,
+		}
+		return ""
+	}
+	_ = src.Close()
+	aRequest.Body = io.NopCloser(bytes.NewReader(body))
+
+	form := aRequest.Clone(aRequest.Context())
+	form.Body = io.NopCloser(bytes.NewReader(body))
+
+	return form.PostFormValue(cs.field)
+} // sentToken()
+
+// `check()` issues the CSRF token cookie to clients which don't have
+// one yet, and verifies that state-changing requests submit the token
+// of their cookie as well (double-submit).
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `*http.Request`: The request to forward or `nil` if it was refused.
+func (cs *tCSRF) check(aWriter http.ResponseWriter, aRequest *http.Request) *http.Request {
+	if nil == cs {
+		return aRequest
+	}
+	token := ""
+	if cookie, err := aRequest.Cookie(cs.cookie); nil == err {
+		if raw, err := hex.DecodeString(cookie.Value); (nil == err) && (32 == len(raw)) {
+			token = cookie.Value
+		}
+	}
+
+	if !isSafeMethod(aRequest.Method) {
+		sent := cs.sentToken(aRequest)
+		if ("" == token) || (1 != subtle.ConstantTimeCompare([]byte(sent), []byte(token))) {
+			secEvent(secCSRF, 5, aRequest, "missing or invalid CSRF token")
+			http.Error(aWriter, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return nil
+		}
+	} else if "" == token {
+		raw := make([]byte, 32)
+		_, _ = rand.Read(raw)
+		token = hex.EncodeToString(raw)
+		http.SetCookie(aWriter, &http.Cookie{
+			Name:     cs.cookie,
+			Value:    token,
+			Path:     "/",
+			SameSite: http.SameSiteLaxMode,
+			Secure:   nil != aRequest.TLS,
+		})
+	}
+	if !cs.inject {
+		return aRequest
+	}
+
+	return aRequest.WithContext(context.WithValue(aRequest.Context(),
+		tCSRFKey{}, token))
+} // check()
+
+// `injectToken()` adds a hidden field with the client's token to the
+// (lower case) `<form>`s of an HTML response.
+//
+// It's meant to be used as (part of) a proxy's `ModifyResponse` hook.
+// Since the body then holds the token of a single client, such a
+// response is marked `private` so that neither the host's response
+// cache nor shared caches downstream store it.
+//
+// Parameters:
+// - `aResponse`: The backend's response.
+func (cs *tCSRF) injectToken(aResponse *http.Response) {
+	if (nil == cs) || !cs.inject {
+		return
+	}
+	token, ok := aResponse.Request.Context().Value(tCSRFKey{}).(string)
+	if !ok {
+		return
+	}
+
+	field := `<input type="hidden" name="` + html.EscapeString(cs.field) +
+		`" value="` + token + `"></form>`
+	if replaceBody(aResponse, rewriteDefaultTypes, []byte("</form>"), []byte(field)) {
+		markPrivate(aResponse.Header)
+	}
+} // injectToken()
+
+// `markPrivate()` restricts the `Cache-Control` of a response to the
+// client's own cache, keeping the other directives.
+//
+// Parameters:
+// - `aHeader`: The response headers to change.
+func markPrivate(aHeader http.Header) {
+	directives := []string{"private"}
+	for _, directive := range strings.Split(aHeader.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		name, _, _ := strings.Cut(directive, "=")
+		switch strings.ToLower(name) {
+		case "", "private", "public", "s-maxage":
+			continue
+		}
+		directives = append(directives, directive)
+	}
+	aHeader.Set("Cache-Control", strings.Join(directives, ", "))
+} // markPrivate()
+
+// `readCSRF()` reads the host's CSRF protection settings:
+//
+//	csrf = true
+//	csrfCookie = __reprox_csrf
+//	csrfHeader = X-CSRF-Token
+//	csrfField = csrf_token
+//	csrfInject = true
+//
+// State-changing requests must send the value of the `csrfCookie`
+// in the `csrfHeader` (e.g. by JavaScript) or in the `csrfField` of a
+// form; with `csrfInject` the field is added to the HTML forms sent
+// by the backend.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tCSRF`: The host's settings or `nil` if it's disabled.
+func readCSRF(aIni *ini.TSectionList, aSection string) *tCSRF {
+	if on, _ := hostBool(aIni, aSection, "csrf"); !on {
+		return nil
+	}
+
+	result := &tCSRF{
+		cookie: "__reprox_csrf",
+		header: "X-CSRF-Token",
+		field:  "csrf_token",
+	}
+	if s, ok := hostString(aIni, aSection, "csrfCookie"); ok && ("" != s) {
+		result.cookie = s
+	}
+	if s, ok := hostString(aIni, aSection, "csrfHeader"); ok && ("" != s) {
+		result.header = s
+	}
+	if s, ok := hostString(aIni, aSection, "csrfField"); ok && ("" != s) {
+		result.field = s
+	}
+	result.inject, _ = hostBool(aIni, aSection, "csrfInject")
+
+	return result
+} // readCSRF()
+
+/* _EoF_ */
@@ -0,0 +1,189 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+type (
+	// Per-host debug capture settings:
+	tDebug struct {
+		on       atomic.Bool // whether to dump requests and responses
+		bodySize int         // (optional) number of body bytes to dump
+	}
+)
+
+var (
+	// Headers whose values are never dumped:
+	debugRedacted = map[string]bool{
+		"Authorization":       true,
+		"Cookie":              true,
+		"Proxy-Authorization": true,
+		"Set-Cookie":          true,
+		"X-Api-Key":           true,
+	}
+)
+
+// `dumpHeader()` writes the sanitised `aHeader` to `aBuffer`, one
+// header line per value in sorted order.
+//
+// Parameters:
+// - `aBuffer`: The buffer to write to.
+// - `aHeader`: The headers to dump.
+func dumpHeader(aBuffer *bytes.Buffer, aHeader http.Header) {
+	names := make([]string, 0, len(aHeader))
+	for name := range aHeader {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range aHeader[name] {
+			if debugRedacted[http.CanonicalHeaderKey(name)] {
+				value = "[redacted]"
+			}
+			fmt.Fprintf(aBuffer, "\n\t%s: %s", name, value)
+		}
+	}
+} // dumpHeader()
+
+// `dumpBody()` appends up to `bodySize` bytes of `aBody` to `aBuffer`
+// and returns a body still providing all the data.
+//
+// Parameters:
+// - `aBuffer`: The buffer to write to.
+// - `aBody`: The body to dump.
+//
+// Returns:
+// - `io.ReadCloser`: The body to use instead of `aBody`.
+func (d *tDebug) dumpBody(aBuffer *bytes.Buffer, aBody io.ReadCloser) io.ReadCloser {
+	if (0 >= d.bodySize) || (nil == aBody) || (http.NoBody == aBody) {
+		return aBody
+	}
+	head := make([]byte, d.bodySize)
+	n, err := io.ReadFull(aBody, head)
+	head = head[:n]
+	fmt.Fprintf(aBuffer, "\n\t[body] %s", strconv.Quote(string(head)))
+	if nil == err {
+		aBuffer.WriteString(" …")
+	}
+
+	return &tReadCloser{
+		Reader: io.MultiReader(bytes.NewReader(head), aBody),
+		Closer: aBody,
+	}
+} // dumpBody()
+
+// `dumpRequest()` logs the request sent to the backend if debug
+// capture is on for the host.
+//
+// Parameters:
+// - `aRequest`: The request to forward to the backend.
+func (d *tDebug) dumpRequest(aRequest *http.Request) {
+	if (nil == d) || !d.on.Load() {
+		return
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "> %s %s %s", aRequest.Method, aRequest.URL, aRequest.Proto)
+	dumpHeader(&buf, aRequest.Header)
+	aRequest.Body = d.dumpBody(&buf, aRequest.Body)
+
+	logErr("ReProx/debug", buf.String())
+} // dumpRequest()
+
+// `dumpResponse()` logs the backend's response (before it's modified
+// by the proxy) if debug capture is on for the host.
+//
+// Parameters:
+// - `aResponse`: The backend's response.
+func (d *tDebug) dumpResponse(aResponse *http.Response) {
+	if (nil == d) || !d.on.Load() {
+		return
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "< %s %s %s", aResponse.Proto, aResponse.Status,
+		aResponse.Request.URL)
+	dumpHeader(&buf, aResponse.Header)
+	if http.StatusSwitchingProtocols != aResponse.StatusCode {
+		aResponse.Body = d.dumpBody(&buf, aResponse.Body)
+	}
+
+	logErr("ReProx/debug", buf.String())
+} // dumpResponse()
+
+// `SetDebug()` switches the debug capture mode of `aHost`.
+//
+// While it's on, the (sanitised) headers of the host's requests and
+// responses, and optionally the start of their bodies, are written to
+// the error log.
+//
+// Parameters:
+// - `aHost`: The (outside) hostname to switch.
+// - `aOn`: Whether to turn debug capture on or off.
+//
+// Returns:
+// - `bool`: `false` if `aHost` isn't configured.
+func (ph *TProxyHandler) SetDebug(aHost string, aOn bool) bool {
+	dest, ok := ph.routes.Load().backendServers[normaliseHost(aHost)]
+	if !ok {
+		return false
+	}
+	dest.debug.on.Store(aOn)
+	logInfo("ReProx/SetDebug",
+		fmt.Sprintf("host %q debug capture: %v", aHost, aOn))
+
+	return true
+} // SetDebug()
+
+// `handleDebug()` lists the hosts in debug capture mode (`GET`) or
+// switches a host's debug capture mode (`POST` with the form values
+// `host` and `on`).
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (ph *TProxyHandler) handleDebug(aWriter http.ResponseWriter, aRequest *http.Request) {
+	switch aRequest.Method {
+	case http.MethodGet:
+		hosts := []string{}
+		for host, dest := range ph.routes.Load().backendServers {
+			if dest.debug.on.Load() {
+				hosts = append(hosts, host)
+			}
+		}
+		aWriter.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(aWriter).Encode(hosts)
+
+	case http.MethodPost:
+		on, err := strconv.ParseBool(aRequest.FormValue("on"))
+		if nil != err {
+			http.Error(aWriter, "invalid value of `on`", http.StatusBadRequest)
+			return
+		}
+		if !ph.SetDebug(aRequest.FormValue("host"), on) {
+			http.Error(aWriter, "unknown host", http.StatusNotFound)
+			return
+		}
+		aWriter.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(aWriter, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+	}
+} // handleDebug()
+
+/* _EoF_ */
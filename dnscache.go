@@ -0,0 +1,157 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+type (
+	// Resolved addresses of a backend hostname:
+	tDNSEntry struct {
+		addrs      []string  // IP addresses of the host
+		expires    time.Time // end of the addresses' validity
+		refreshing bool      // whether a background lookup is running
+	}
+
+	// In-process cache of the backends' addresses:
+	tDNSCache struct {
+		sync.Mutex
+		entries map[string]*tDNSEntry
+	}
+
+	// Function to establish a backend connection:
+	tDialFunc = func(aCtx context.Context, aNetwork, aAddr string) (net.Conn, error)
+)
+
+const (
+	// Longest time to wait for a background lookup:
+	dnsRefreshTimeout = 10 * time.Second
+)
+
+var (
+	// The backends' address cache:
+	gDNSCache = &tDNSCache{entries: make(map[string]*tDNSEntry)}
+)
+
+// `resolve()` looks `aHost` up and caches its addresses for `aTTL`.
+//
+// Parameters:
+// - `aCtx`: The context of the lookup.
+// - `aHost`: The hostname to resolve.
+// - `aTTL`: The validity of the addresses.
+//
+// Returns:
+// - `[]string`: The host's addresses.
+// - `error`: A possible error of the lookup.
+func (dc *tDNSCache) resolve(aCtx context.Context, aHost string, aTTL time.Duration) ([]string, error) {
+	addrs, err := net.DefaultResolver.LookupHost(aCtx, aHost)
+
+	dc.Lock()
+	defer dc.Unlock()
+	if nil != err {
+		if entry, ok := dc.entries[aHost]; ok {
+			entry.refreshing = false
+		}
+		return nil, err
+	}
+	dc.entries[aHost] = &tDNSEntry{
+		addrs:   addrs,
+		expires: time.Now().Add(aTTL),
+	}
+
+	return addrs, nil
+} // resolve()
+
+// `lookup()` returns the cached addresses of `aHost`.
+//
+// Expired addresses are still returned while they're refreshed in the
+// background; unknown hosts are looked up at once.
+//
+// Parameters:
+// - `aCtx`: The context of the lookup.
+// - `aHost`: The hostname to resolve.
+// - `aTTL`: The validity of the addresses.
+//
+// Returns:
+// - `[]string`: The host's addresses.
+// - `error`: A possible error of the lookup.
+func (dc *tDNSCache) lookup(aCtx context.Context, aHost string, aTTL time.Duration) ([]string, error) {
+	dc.Lock()
+	entry, ok := dc.entries[aHost]
+	if !ok {
+		dc.Unlock()
+		return dc.resolve(aCtx, aHost, aTTL)
+	}
+	addrs := entry.addrs
+	if time.Now().After(entry.expires) && !entry.refreshing {
+		entry.refreshing = true
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), dnsRefreshTimeout)
+			defer cancel()
+			_, _ = dc.resolve(ctx, aHost, aTTL)
+		}()
+	}
+	dc.Unlock()
+
+	return addrs, nil
+} // lookup()
+
+// `dialer()` returns a dial function connecting to the cached
+// addresses of a backend; if none of them accepts the connection the
+// hostname is resolved again and the connection retried.
+//
+// Parameters:
+// - `aDialer`: The dialer to establish the connections.
+// - `aTTL`: The validity of the cached addresses.
+//
+// Returns:
+// - `tDialFunc`: The transport's dial function.
+func (dc *tDNSCache) dialer(aDialer *net.Dialer, aTTL time.Duration) tDialFunc {
+	dialAll := func(aCtx context.Context, aNetwork, aPort string, aAddrs []string) (net.Conn, error) {
+		var errs []error
+		for _, addr := range aAddrs {
+			conn, err := aDialer.DialContext(aCtx, aNetwork, net.JoinHostPort(addr, aPort))
+			if nil == err {
+				return conn, nil
+			}
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	return func(aCtx context.Context, aNetwork, aAddr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(aAddr)
+		if (nil != err) || (nil != net.ParseIP(host)) {
+			return aDialer.DialContext(aCtx, aNetwork, aAddr)
+		}
+
+		addrs, err := dc.lookup(aCtx, host, aTTL)
+		if nil != err {
+			return nil, err
+		}
+		conn, err := dialAll(aCtx, aNetwork, port, addrs)
+		if nil == err {
+			return conn, nil
+		}
+
+		// the backend may have moved:
+		if addrs, err = dc.resolve(aCtx, host, aTTL); nil != err {
+			return nil, err
+		}
+
+		return dialAll(aCtx, aNetwork, port, addrs)
+	}
+} // dialer()
+
+/* _EoF_ */
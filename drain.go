@@ -0,0 +1,214 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// Runtime state of a backend server:
+	tBackendState struct {
+		draining atomic.Bool  // whether new requests are refused
+		inFlight atomic.Int64 // requests currently forwarded
+	}
+
+	// `TBackendReport` describes a backend's state as sent by the
+	// admin server's `/drain` endpoint.
+	TBackendReport struct {
+		Backend  string `json:"backend"`
+		Draining bool   `json:"draining"`
+		InFlight int64  `json:"inFlight"`
+	}
+)
+
+var (
+	// Runtime state by backend URL (`*tBackendState`), kept across
+	// configuration reloads:
+	gBackends sync.Map
+)
+
+// `backendKey()` returns the key of the backend `aURL` in `gBackends`.
+//
+// Parameters:
+// - `aURL`: The backend's URL.
+//
+// Returns:
+// - `string`: The normalised URL.
+func backendKey(aURL string) string {
+	return strings.TrimSuffix(strings.TrimSpace(aURL), "/")
+} // backendKey()
+
+// `backendState()` returns the runtime state of the backend `aURL`.
+//
+// Parameters:
+// - `aURL`: The backend's URL.
+//
+// Returns:
+// - `*tBackendState`: The backend's state.
+func backendState(aURL string) *tBackendState {
+	key := backendKey(aURL)
+	if state, ok := gBackends.Load(key); ok {
+		return state.(*tBackendState)
+	}
+	state, _ := gBackends.LoadOrStore(key, &tBackendState{})
+
+	return state.(*tBackendState)
+} // backendState()
+
+// `serve()` forwards `aRequest` by `aProxy`, counting it as in-flight;
+// once the last request of a draining backend is done, the proxy's
+// idle connections are closed.
+//
+// Parameters:
+// - `aProxy`: The backend's reverse proxy.
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (bs *tBackendState) serve(aProxy *httputil.ReverseProxy, aWriter http.ResponseWriter, aRequest *http.Request) {
+	bs.inFlight.Add(1)
+	defer func() {
+		if (0 == bs.inFlight.Add(-1)) && bs.draining.Load() {
+			closeIdleTransport(aProxy.Transport)
+		}
+	}()
+
+	aProxy.ServeHTTP(aWriter, aRequest)
+} // serve()
+
+// `SetDraining()` switches the drain mode of the backend `aBackend`:
+// while draining, the requests already forwarded to it are finished
+// but no new ones are sent (e.g. for a rolling restart of the
+// backends); they're answered by `503 Service Unavailable` instead,
+// or – for an A/B test variant – forwarded to the host's backend.
+//
+// Parameters:
+// - `aBackend`: The URL of the backend (as configured by `destURL`
+// or `abDest<name>`).
+// - `aOn`: Whether to turn drain mode on or off.
+//
+// Returns:
+// - `bool`: `false` if `aBackend` isn't configured.
+func (ph *TProxyHandler) SetDraining(aBackend string, aOn bool) bool {
+	key := backendKey(aBackend)
+	if _, ok := ph.backends()[key]; !ok {
+		return false
+	}
+
+	backendState(key).draining.Store(aOn)
+	if aOn {
+		ph.closeIdleBackend(key)
+	}
+	logInfo("ReProx/SetDraining",
+		fmt.Sprintf("backend %q draining: %v", key, aOn))
+
+	return true
+} // SetDraining()
+
+// `backends()` returns the URLs of all configured backends.
+//
+// Returns:
+// - `map[string]bool`: The normalised backend URLs.
+func (ph *TProxyHandler) backends() map[string]bool {
+	result := make(map[string]bool)
+	for _, dest := range ph.routes.Load().backendServers {
+		result[backendKey(dest.destHost)] = true
+		if nil != dest.abTest {
+			for _, variant := range dest.abTest.variants {
+				if "" != variant.destURL {
+					result[backendKey(variant.destURL)] = true
+				}
+			}
+		}
+	}
+
+	return result
+} // backends()
+
+// `closeIdleBackend()` closes the idle connections to the backend
+// `aKey` which won't be used again while it's draining.
+//
+// Parameters:
+// - `aKey`: The normalised backend URL.
+func (ph *TProxyHandler) closeIdleBackend(aKey string) {
+	servers := make(tBackendServers)
+	for host, dest := range ph.routes.Load().backendServers {
+		if aKey == backendKey(dest.destHost) {
+			servers[host] = dest
+			continue
+		}
+		if nil != dest.abTest {
+			for _, variant := range dest.abTest.variants {
+				if aKey == backendKey(variant.destURL) {
+					servers[host] = dest
+				}
+			}
+		}
+	}
+	closeIdleProxies(servers)
+} // closeIdleBackend()
+
+// `BackendReports()` returns the state of all configured backends.
+//
+// Returns:
+// - `[]TBackendReport`: The backends sorted by URL.
+func (ph *TProxyHandler) BackendReports() []TBackendReport {
+	result := []TBackendReport{}
+	for key := range ph.backends() {
+		state := backendState(key)
+		result = append(result, TBackendReport{
+			Backend:  key,
+			Draining: state.draining.Load(),
+			InFlight: state.inFlight.Load(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Backend < result[j].Backend })
+
+	return result
+} // BackendReports()
+
+// `handleDrain()` lists the backends with their drain mode and
+// in-flight requests (`GET`) or switches a backend's drain mode
+// (`POST` with the form values `backend` and `on`).
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (ph *TProxyHandler) handleDrain(aWriter http.ResponseWriter, aRequest *http.Request) {
+	switch aRequest.Method {
+	case http.MethodGet:
+		aWriter.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(aWriter).Encode(ph.BackendReports())
+
+	case http.MethodPost:
+		on, err := strconv.ParseBool(aRequest.FormValue("on"))
+		if nil != err {
+			http.Error(aWriter, "invalid value of `on`", http.StatusBadRequest)
+			return
+		}
+		if !ph.SetDraining(aRequest.FormValue("backend"), on) {
+			http.Error(aWriter, "unknown backend", http.StatusNotFound)
+			return
+		}
+		aWriter.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(aWriter, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+	}
+} // handleDrain()
+
+/* _EoF_ */
@@ -0,0 +1,200 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// The page templates read from the `ErrorPages` directory:
+	tErrorPages struct {
+		mtx    sync.Mutex
+		defDir string                                        // directory used if none is configured
+		pages  atomic.Pointer[map[string]*template.Template] // template name -> template
+	}
+
+	// The variables available to the page templates:
+	tPageData struct {
+		Host       string    // the requested hostname
+		RequestID  string    // the request's `X-Request-Id`
+		Time       time.Time // the time of the response
+		Status     int       // the response's HTTP status
+		StatusText string    // the status' text (e.g. `Bad Gateway`)
+		Message    string    // a message describing the error
+	}
+)
+
+const (
+	// Template of the maintenance page:
+	pageMaintenance = "maintenance.html"
+
+	// Template of all error pages without a template of their own:
+	pageError = "error.html"
+)
+
+var (
+	// The process' page templates:
+	gErrorPages tErrorPages
+)
+
+// `SetErrorPagesDir()` sets the directory to read the page templates
+// from if the configuration doesn't name one by `ErrorPages`; the
+// templates are (re-)read with each configuration loaded.
+//
+// Parameters:
+// - `aDir`: The default directory of the page templates.
+func SetErrorPagesDir(aDir string) {
+	gErrorPages.mtx.Lock()
+	gErrorPages.defDir = aDir
+	gErrorPages.mtx.Unlock()
+} // SetErrorPagesDir()
+
+// `setup()` reads the page templates of the directory configured by
+// `aSetup`:
+//
+//   - `maintenance.html` for hosts in maintenance mode,
+//   - `error-<status>.html` (e.g. `error-502.html`) for a single status,
+//   - `error.html` for all other error responses.
+//
+// Templates missing or invalid are replaced by the built-in pages.
+//
+// Parameters:
+// - `aSetup`: The configuration just loaded.
+func (ep *tErrorPages) setup(aSetup *TSetup) {
+	ep.mtx.Lock()
+	defer ep.mtx.Unlock()
+
+	dir := aSetup.ErrorPages
+	if "" == dir {
+		dir = ep.defDir
+	}
+	if "" == dir {
+		ep.pages.Store(nil)
+		return
+	}
+	dir = jailPath(dir)
+
+	names, _ := filepath.Glob(filepath.Join(dir, "error-[1-5][0-9][0-9].html"))
+	names = append(names,
+		filepath.Join(dir, pageMaintenance), filepath.Join(dir, pageError))
+	pages := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		page, err := template.ParseFiles(name)
+		if nil != err {
+			if !errors.Is(err, fs.ErrNotExist) {
+				logErr("ReProx/ErrorPages", err.Error())
+			}
+			continue
+		}
+		pages[filepath.Base(name)] = page
+	}
+	if 0 < len(pages) {
+		logInfo("ReProx/ErrorPages",
+			fmt.Sprintf("%d page template(s) read from %q", len(pages), dir))
+	}
+	ep.pages.Store(&pages)
+} // setup()
+
+// `render()` sends the page template `aName` (if there's one).
+//
+// Parameters:
+// - `aName`: The name of the page template.
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+// - `aStatus`: The HTTP status to send.
+// - `aMsg`: The message describing the error.
+//
+// Returns:
+// - `bool`: `false` if there's no (usable) template.
+func (ep *tErrorPages) render(aName string, aWriter http.ResponseWriter, aRequest *http.Request, aStatus int, aMsg string) bool {
+	pages := ep.pages.Load()
+	if nil == pages {
+		return false
+	}
+	page, ok := (*pages)[aName]
+	if !ok {
+		return false
+	}
+
+	data := tPageData{
+		Host:       aRequest.Host,
+		RequestID:  requestID(aRequest),
+		Time:       time.Now(),
+		Status:     aStatus,
+		StatusText: http.StatusText(aStatus),
+		Message:    aMsg,
+	}
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, data); nil != err {
+		logErr("ReProx/ErrorPages", fmt.Sprintf("%s: %v", aName, err))
+		return false
+	}
+
+	header := aWriter.Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("X-Request-Id", data.RequestID)
+	aWriter.WriteHeader(aStatus)
+	_, _ = aWriter.Write(buf.Bytes())
+
+	return true
+} // render()
+
+// `requestID()` returns the `X-Request-Id` header of `aRequest` or a
+// new random ID if there's none.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `string`: The request's ID.
+func requestID(aRequest *http.Request) string {
+	if id := aRequest.Header.Get("X-Request-Id"); "" != id {
+		return id
+	}
+	raw := make([]byte, 8)
+	_, _ = rand.Read(raw)
+
+	return hex.EncodeToString(raw)
+} // requestID()
+
+// `sendError()` answers `aRequest` with the error page of `aStatus`
+// (see `tErrorPages.setup()`) or – if there's no template – with the
+// plain text `aMsg`.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+// - `aMsg`: The message describing the error.
+// - `aStatus`: The HTTP status to send.
+func sendError(aWriter http.ResponseWriter, aRequest *http.Request, aMsg string, aStatus int) {
+	if gErrorPages.render("error-"+strconv.Itoa(aStatus)+".html", aWriter, aRequest, aStatus, aMsg) {
+		return
+	}
+	if gErrorPages.render(pageError, aWriter, aRequest, aStatus, aMsg) {
+		return
+	}
+
+	http.Error(aWriter, aMsg, aStatus)
+} // sendError()
+
+/* _EoF_ */
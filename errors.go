@@ -0,0 +1,83 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"errors"
+	"strings"
+)
+
+type (
+	// `TConfigError` lists the problems found in a configuration.
+	//
+	// It matches `ErrConfigParse` when checked by `errors.Is()`.
+	TConfigError struct {
+		Problems []string // descriptions of the individual problems
+	}
+)
+
+var (
+	// `ErrHostNotFound` is returned for hostnames not configured.
+	ErrHostNotFound = errors.New("host not found")
+
+	// `ErrInvalidTarget` is returned for unusable backend URLs.
+	ErrInvalidTarget = errors.New("invalid backend URL")
+
+	// `ErrConfigParse` is returned if the configuration can't be read
+	// or holds invalid settings.
+	ErrConfigParse = errors.New("configuration error")
+
+	// `ErrNoConfig` is returned if there's no configuration loaded.
+	ErrNoConfig = errors.New("no configuration loaded")
+
+	// `ErrNoConfigKey` is returned if no key to encrypt or decrypt the
+	// configuration file is available.
+	ErrNoConfigKey = errors.New("no configuration key in $" +
+		cryptKeyEnv + " or $" + cryptKeyFileEnv)
+
+	// `ErrInvalidLogSink` is returned for unusable log sink targets.
+	ErrInvalidLogSink = errors.New("invalid log sink")
+
+	// `ErrSecretNotFound` is returned if a secret reference can't be
+	// resolved.
+	ErrSecretNotFound = errors.New("secret not found")
+
+	// `ErrPinMismatch` is returned if a backend presents no pinned
+	// certificate.
+	ErrPinMismatch = errors.New("backend certificate doesn't match any pin")
+
+	// `ErrWebhook` is returned if a webhook doesn't accept a post.
+	ErrWebhook = errors.New("webhook failed")
+
+	// `ErrAlreadyRunning` is returned if another instance holds the
+	// PID file's lock.
+	ErrAlreadyRunning = errors.New("already running")
+
+	// `ErrUpgradeRefused` is returned by `Upgrade()` if the process
+	// can't start a working new one.
+	ErrUpgradeRefused = errors.New("upgrade refused")
+)
+
+// `Error()` returns the configuration problems as a single message.
+//
+// Returns:
+// - `string`: The error message.
+func (ce *TConfigError) Error() string {
+	return ErrConfigParse.Error() + "s: " + strings.Join(ce.Problems, ", ")
+} // Error()
+
+// `Unwrap()` returns `ErrConfigParse`.
+//
+// Returns:
+// - `error`: The sentinel error of configuration problems.
+func (ce *TConfigError) Unwrap() error {
+	return ErrConfigParse
+} // Unwrap()
+
+/* _EoF_ */
@@ -0,0 +1,421 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"crypto/md5" // #nosec G501 – required by JA3
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// `TFingerprint` holds the TLS ClientHello fingerprints of a
+	// client connection.
+	TFingerprint struct {
+		JA3 string // MD5 hash of the JA3 string
+		JA4 string // JA4 fingerprint
+	}
+
+	// Connection capturing the ClientHello sent by the client:
+	tHelloConn struct {
+		net.Conn
+		buf  []byte                       // data read until the ClientHello is complete
+		done bool                         // whether the ClientHello was processed
+		fp   atomic.Pointer[TFingerprint] // the connection's fingerprints
+	}
+
+	// Key of the fingerprinted connection in the request context:
+	tHelloKey struct{}
+
+	// Listener returning `tHelloConn` connections:
+	tHelloListener struct {
+		net.Listener
+	}
+
+	// Fields of a ClientHello used by the fingerprints:
+	tClientHello struct {
+		version    uint16   // legacy protocol version
+		ciphers    []uint16 // cipher suites
+		extensions []uint16 // extension types in the order sent
+		curves     []uint16 // supported groups
+		points     []uint8  // EC point formats
+		sigAlgs    []uint16 // signature algorithms
+		versions   []uint16 // supported versions
+		alpn       string   // first ALPN protocol
+		sni        bool     // whether a server name was sent
+	}
+
+	// Per-host list of TLS fingerprints to refuse:
+	tTLSBlock map[string]bool
+)
+
+const (
+	// Largest ClientHello to capture:
+	helloMaxSize = 1 << 14
+)
+
+// `isGREASE()` checks whether `aValue` is a GREASE value (RFC 8701)
+// to be ignored by the fingerprints.
+func isGREASE(aValue uint16) bool {
+	return (0x0a0a == aValue&0x0f0f) && (aValue>>8 == aValue&0xff)
+} // isGREASE()
+
+// `parseClientHello()` parses the TLS record `aData`.
+//
+// Parameters:
+// - `aData`: The data received from the client so far.
+//
+// Returns:
+// - `*tClientHello`: The parsed ClientHello (`nil` if it's invalid).
+// - `bool`: `true` if more data is needed.
+func parseClientHello(aData []byte) (*tClientHello, bool) {
+	if 5 > len(aData) {
+		return nil, true
+	}
+	if 0x16 != aData[0] { // not a handshake record
+		return nil, false
+	}
+	recLen := int(binary.BigEndian.Uint16(aData[3:5]))
+	if 5+recLen > len(aData) {
+		return nil, true
+	}
+	msg := aData[5 : 5+recLen]
+	if (4 > len(msg)) || (0x01 != msg[0]) { // not a ClientHello
+		return nil, false
+	}
+	msg = msg[4:]
+
+	var (
+		result tClientHello
+		ok     = true
+	)
+	next := func(aLen int) []byte {
+		if !ok || (aLen > len(msg)) {
+			ok = false
+			return nil
+		}
+		field := msg[:aLen]
+		msg = msg[aLen:]
+		return field
+	}
+	vector16 := func(aLenSize int) []uint16 {
+		var l int
+		if b := next(aLenSize); !ok {
+			return nil
+		} else if 1 == aLenSize {
+			l = int(b[0])
+		} else {
+			l = int(binary.BigEndian.Uint16(b))
+		}
+		data := next(l)
+		list := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			list = append(list, binary.BigEndian.Uint16(data[i:]))
+		}
+		return list
+	}
+
+	if b := next(2); ok {
+		result.version = binary.BigEndian.Uint16(b)
+	}
+	next(32) // random
+	if b := next(1); ok {
+		next(int(b[0])) // session ID
+	}
+	result.ciphers = vector16(2)
+	if b := next(1); ok {
+		next(int(b[0])) // compression methods
+	}
+	if !ok {
+		return nil, false
+	}
+	if 2 > len(msg) { // no extensions
+		return &result, false
+	}
+	exts := next(int(binary.BigEndian.Uint16(next(2))))
+	for ok && (4 <= len(exts)) {
+		extType := binary.BigEndian.Uint16(exts)
+		extLen := int(binary.BigEndian.Uint16(exts[2:]))
+		if 4+extLen > len(exts) {
+			break
+		}
+		data := exts[4 : 4+extLen]
+		exts = exts[4+extLen:]
+		result.extensions = append(result.extensions, extType)
+
+		msg, ok = data, true
+		switch extType {
+		case 0x0000:
+			result.sni = true
+		case 0x000a:
+			result.curves = vector16(2)
+		case 0x000b:
+			if b := next(1); ok {
+				result.points = next(int(b[0]))
+			}
+		case 0x000d:
+			result.sigAlgs = vector16(2)
+		case 0x0010:
+			if b := next(2); ok && (0 < binary.BigEndian.Uint16(b)) {
+				if l := next(1); ok {
+					result.alpn = string(next(int(l[0])))
+				}
+			}
+		case 0x002b:
+			result.versions = vector16(1)
+		}
+	}
+
+	return &result, false
+} // parseClientHello()
+
+// `ja3()` returns the MD5 hash of the ClientHello's JA3 string.
+//
+// Returns:
+// - `string`: The JA3 fingerprint.
+func (ch *tClientHello) ja3() string {
+	join := func(aList []uint16) string {
+		parts := make([]string, 0, len(aList))
+		for _, v := range aList {
+			if !isGREASE(v) {
+				parts = append(parts, strconv.Itoa(int(v)))
+			}
+		}
+		return strings.Join(parts, "-")
+	}
+	points := make([]string, len(ch.points))
+	for i, p := range ch.points {
+		points[i] = strconv.Itoa(int(p))
+	}
+	s := fmt.Sprintf("%d,%s,%s,%s,%s", ch.version, join(ch.ciphers),
+		join(ch.extensions), join(ch.curves), strings.Join(points, "-"))
+	sum := md5.Sum([]byte(s)) // #nosec G401
+
+	return hex.EncodeToString(sum[:])
+} // ja3()
+
+// `ja4()` returns the ClientHello's JA4 fingerprint.
+//
+// Returns:
+// - `string`: The JA4 fingerprint.
+func (ch *tClientHello) ja4() string {
+	hexList := func(aList []uint16, aSkip ...uint16) []string {
+		result := make([]string, 0, len(aList))
+	next:
+		for _, v := range aList {
+			if isGREASE(v) {
+				continue
+			}
+			for _, skip := range aSkip {
+				if v == skip {
+					continue next
+				}
+			}
+			result = append(result, fmt.Sprintf("%04x", v))
+		}
+		return result
+	}
+	hash12 := func(aValue string) string {
+		if "" == aValue {
+			return "000000000000"
+		}
+		sum := sha256.Sum256([]byte(aValue))
+		return hex.EncodeToString(sum[:])[:12]
+	}
+
+	version := ch.version
+	for _, v := range ch.versions {
+		if !isGREASE(v) && (v > version) {
+			version = v
+		}
+	}
+	ver := map[uint16]string{0x0304: "13", 0x0303: "12", 0x0302: "11",
+		0x0301: "10", 0x0300: "s3"}[version]
+	if "" == ver {
+		ver = "00"
+	}
+	sni := "i"
+	if ch.sni {
+		sni = "d"
+	}
+	alpn := "00"
+	if 0 < len(ch.alpn) {
+		alpn = string(ch.alpn[0]) + string(ch.alpn[len(ch.alpn)-1])
+	}
+
+	ciphers := hexList(ch.ciphers)
+	exts := hexList(ch.extensions)
+	a := fmt.Sprintf("t%s%s%02d%02d%s", ver, sni,
+		min(len(ciphers), 99), min(len(exts), 99), alpn)
+
+	sort.Strings(ciphers)
+	sorted := hexList(ch.extensions, 0x0000, 0x0010)
+	sort.Strings(sorted)
+	c := strings.Join(sorted, ",")
+	if sigs := hexList(ch.sigAlgs); 0 < len(sigs) {
+		c += "_" + strings.Join(sigs, ",")
+	}
+
+	return a + "_" + hash12(strings.Join(ciphers, ",")) + "_" + hash12(c)
+} // ja4()
+
+// `Read()` reads from the connection, capturing the ClientHello.
+func (hc *tHelloConn) Read(aData []byte) (int, error) {
+	n, err := hc.Conn.Read(aData)
+	if hc.done || (0 >= n) {
+		return n, err
+	}
+
+	hc.buf = append(hc.buf, aData[:n]...)
+	hello, more := parseClientHello(hc.buf)
+	if more && (helloMaxSize > len(hc.buf)) {
+		return n, err
+	}
+	hc.done, hc.buf = true, nil
+	if nil != hello {
+		hc.fp.Store(&TFingerprint{JA3: hello.ja3(), JA4: hello.ja4()})
+	}
+
+	return n, err
+} // Read()
+
+// `Accept()` waits for the next connection.
+func (hl tHelloListener) Accept() (net.Conn, error) {
+	conn, err := hl.Listener.Accept()
+	if nil != err {
+		return nil, err
+	}
+
+	return &tHelloConn{Conn: conn}, nil
+} // Accept()
+
+// `FingerprintListener()` wraps the TLS server's `aListener` to
+// fingerprint the ClientHello of each connection (see `Fingerprint()`);
+// the server's `ConnContext` must be set to `FingerprintContext()`.
+//
+// Parameters:
+// - `aListener`: The (plain TCP) listener of the TLS server.
+//
+// Returns:
+// - `net.Listener`: The fingerprinting listener.
+func FingerprintListener(aListener net.Listener) net.Listener {
+	return tHelloListener{aListener}
+} // FingerprintListener()
+
+// `FingerprintContext()` remembers the fingerprinted connection
+// `aConn` in the context of its requests (see `http.Server.ConnContext`).
+//
+// Parameters:
+// - `aCtx`: The connection's base context.
+// - `aConn`: The accepted connection.
+//
+// Returns:
+// - `context.Context`: The context of the connection's requests.
+func FingerprintContext(aCtx context.Context, aConn net.Conn) context.Context {
+	if tc, ok := aConn.(*tls.Conn); ok {
+		aConn = tc.NetConn()
+	}
+	if hc, ok := aConn.(*tHelloConn); ok {
+		return context.WithValue(aCtx, tHelloKey{}, hc)
+	}
+
+	return aCtx
+} // FingerprintContext()
+
+// `Fingerprint()` returns the TLS fingerprints of the connection
+// `aRequest` was received on.
+//
+// The connection is found by the request's context (rather than its
+// `RemoteAddr`, which may have been replaced by the client address
+// reported by a trusted proxy or anonymised for the logs).
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `TFingerprint`: The connection's fingerprints.
+// - `bool`: `false` if there are none (e.g. plain HTTP).
+func Fingerprint(aRequest *http.Request) (TFingerprint, bool) {
+	hc, ok := aRequest.Context().Value(tHelloKey{}).(*tHelloConn)
+	if !ok {
+		return TFingerprint{}, false
+	}
+	fp := hc.fp.Load()
+	if nil == fp {
+		return TFingerprint{}, false
+	}
+
+	return *fp, true
+} // Fingerprint()
+
+// `refuse()` checks whether the client's TLS fingerprint is blocked
+// and answers the request with `403 Forbidden` if so.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the request was refused.
+func (fb tTLSBlock) refuse(aWriter http.ResponseWriter, aRequest *http.Request) bool {
+	if 0 == len(fb) {
+		return false
+	}
+	fp, ok := Fingerprint(aRequest)
+	if !ok || !(fb[fp.JA3] || fb[fp.JA4]) {
+		return false
+	}
+	http.Error(aWriter, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+	return true
+} // refuse()
+
+// `readFingerprintBlock()` reads the host's list of TLS fingerprints
+// (JA3 hashes or JA4 strings) to refuse:
+//
+//	tlsBlock = e7d705a3286e19ea42f587b344ee6865, t13d1516h2_8daaf6152771_02713d6af862
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `tTLSBlock`: The host's list or `nil` if there's none.
+func readFingerprintBlock(aIni *ini.TSectionList, aSection string) tTLSBlock {
+	s, ok := hostString(aIni, aSection, "tlsBlock")
+	if !ok {
+		return nil
+	}
+
+	result := make(tTLSBlock)
+	for _, fp := range strings.Split(s, ",") {
+		if fp = strings.ToLower(strings.TrimSpace(fp)); "" != fp {
+			result[fp] = true
+		}
+	}
+	if 0 == len(result) {
+		return nil
+	}
+
+	return result
+} // readFingerprintBlock()
+
+/* _EoF_ */
@@ -0,0 +1,102 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+type (
+	// Bit set of the forwarding header styles to send:
+	tForwardStyle uint8
+)
+
+const (
+	// Send the legacy `X-Forwarded-For/-Host/-Proto` headers:
+	fwdLegacy tForwardStyle = 1 << iota
+
+	// Send the RFC 7239 `Forwarded` header:
+	fwdRFC7239
+)
+
+// `parseForwardStyle()` converts the configured forwarding header
+// style (`legacy`, `rfc7239`, or `both`) to a bit set.
+//
+// Parameters:
+// - `aStyle`: The configured style name.
+//
+// Returns:
+// - `tForwardStyle`: The header styles to send (default: `legacy`).
+func parseForwardStyle(aStyle string) tForwardStyle {
+	switch strings.ToLower(strings.TrimSpace(aStyle)) {
+	case "rfc7239", "forwarded":
+		return fwdRFC7239
+	case "both":
+		return fwdLegacy | fwdRFC7239
+	}
+
+	return fwdLegacy
+} // parseForwardStyle()
+
+// `forwardedNode()` formats `aAddr` as a RFC 7239 node identifier,
+// quoting IPv6 addresses.
+//
+// Parameters:
+// - `aAddr`: The client's remote address (`host:port`).
+//
+// Returns:
+// - `string`: The value for the `for=` parameter.
+func forwardedNode(aAddr string) string {
+	host, _, err := net.SplitHostPort(aAddr)
+	if nil != err {
+		host = aAddr
+	}
+	if strings.Contains(host, ":") {
+		return `"[` + host + `]"`
+	}
+
+	return host
+} // forwardedNode()
+
+// `setForwarded()` adds the forwarding headers of the configured
+// `aStyle` to the outgoing request `aRequest`.
+//
+// It's meant to be called from the proxy's `Director` which sees the
+// incoming request's `Host`, `RemoteAddr`, and `TLS` state.
+//
+// Parameters:
+// - `aStyle`: The header styles to send.
+// - `aRequest`: The request to forward to the backend.
+func setForwarded(aStyle tForwardStyle, aRequest *http.Request) {
+	proto := "http"
+	if nil != aRequest.TLS {
+		proto = "https"
+	}
+
+	if 0 != aStyle&fwdRFC7239 {
+		value := "for=" + forwardedNode(aRequest.RemoteAddr) +
+			";proto=" + proto + `;host="` + aRequest.Host + `"`
+		if prior := aRequest.Header.Get("Forwarded"); "" != prior {
+			value = prior + ", " + value
+		}
+		aRequest.Header.Set("Forwarded", value)
+	}
+
+	if 0 != aStyle&fwdLegacy {
+		aRequest.Header.Set("X-Forwarded-Host", aRequest.Host)
+		aRequest.Header.Set("X-Forwarded-Proto", proto)
+	} else {
+		// keep `httputil.ReverseProxy` from adding `X-Forwarded-For`:
+		aRequest.Header["X-Forwarded-For"] = nil
+	}
+} // setForwarded()
+
+/* _EoF_ */
@@ -6,9 +6,13 @@ require (
 	github.com/mwat56/apachelogger v1.7.0
 	github.com/mwat56/ini v1.9.0
 	github.com/mwat56/sourceerror v0.2.1
+	golang.org/x/crypto v0.31.0
+	golang.org/x/net v0.33.0
 	golang.org/x/sys v0.28.0
 )
 
+require golang.org/x/text v0.21.0 // indirect
+
 replace (
 	github.com/mwat56/apachelogger => ../apachelogger
 	github.com/mwat56/cssfs => ../cssfs
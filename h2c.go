@@ -0,0 +1,103 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	// Scheme of backend URLs speaking HTTP/2 without TLS (e.g. gRPC
+	// services), like `h2c://127.0.0.1:50051`:
+	schemeH2C = "h2c"
+
+	// gRPC status code `UNAVAILABLE`:
+	grpcUnavailable = 14
+)
+
+// `h2cURL()` returns the HTTP URL to send requests for a `h2c://`
+// backend URL to.
+//
+// Parameters:
+// - `aURL`: The backend's URL.
+//
+// Returns:
+// - `string`: `aURL` with the `http` scheme if it's a `h2c` one.
+// - `bool`: Whether `aURL` is a `h2c` URL.
+func h2cURL(aURL string) (string, bool) {
+	scheme, rest, ok := strings.Cut(aURL, "://")
+	if !ok || !strings.EqualFold(schemeH2C, scheme) {
+		return aURL, false
+	}
+
+	return "http://" + rest, true
+} // h2cURL()
+
+// `h2cTransport()` returns a transport speaking HTTP/2 without TLS
+// ("prior knowledge") to a `h2c://` backend, so that gRPC streams
+// and trailers are passed through end-to-end.
+//
+// Parameters:
+// - `aTransport`: The host's backend connection settings (or `nil`).
+//
+// Returns:
+// - `*http2.Transport`: The backend's transport.
+func h2cTransport(aTransport *tTransport) *http2.Transport {
+	dial := aTransport.dialer()
+
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(aCtx context.Context, aNetwork, aAddr string, _ *tls.Config) (net.Conn, error) {
+			return dial(aCtx, aNetwork, aAddr)
+		},
+		DisableCompression: true,
+		// detect backends gone away on long-lived streams:
+		ReadIdleTimeout: 30 * time.Second,
+		PingTimeout:     15 * time.Second,
+	}
+} // h2cTransport()
+
+// `isGRPC()` checks whether `aRequest` is a gRPC call.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if it's a gRPC request.
+func isGRPC(aRequest *http.Request) bool {
+	return (2 == aRequest.ProtoMajor) &&
+		strings.HasPrefix(aRequest.Header.Get("Content-Type"), "application/grpc")
+} // isGRPC()
+
+// `sendGRPCError()` answers a gRPC call with the status `aCode` as
+// a "trailers-only" response, since gRPC clients don't understand
+// HTTP error pages.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers.
+// - `aCode`: The gRPC status code.
+// - `aMsg`: The error message.
+func sendGRPCError(aWriter http.ResponseWriter, aCode int, aMsg string) {
+	header := aWriter.Header()
+	header.Set("Content-Type", "application/grpc")
+	header.Set("Grpc-Status", strconv.Itoa(aCode))
+	header.Set("Grpc-Message", url.PathEscape(aMsg))
+	aWriter.WriteHeader(http.StatusOK)
+} // sendGRPCError()
+
+/* _EoF_ */
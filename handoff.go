@@ -0,0 +1,249 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// Listening sockets handed over to a new process (see `Upgrade()`):
+	tHandoff struct {
+		sync.Mutex
+		bound     map[string]*net.TCPListener // sockets bound by `Listen()`
+		inherited map[string]net.Listener     // sockets of the old process
+		parsed    bool                        // whether the environment was read
+	}
+)
+
+const (
+	// Environment variable listing the addresses of the inherited
+	// sockets (file descriptors 3, 4, …):
+	handoffFDsEnv = "REPROX_LISTEN_FDS"
+
+	// Environment variable holding the process ID of the old process:
+	handoffPIDEnv = "REPROX_PARENT_PID"
+
+	// File descriptor of the first inherited socket:
+	handoffFirstFD = 3
+)
+
+var (
+	// The sockets to hand over or taken over:
+	gHandoff tHandoff
+)
+
+// `inherit()` returns the socket bound to `aAddr` by the old process.
+//
+// Parameters:
+// - `aAddr`: The address to listen at.
+//
+// Returns:
+// - `net.Listener`: The inherited socket or `nil` if there's none.
+func (h *tHandoff) inherit(aAddr string) net.Listener {
+	h.Lock()
+	defer h.Unlock()
+
+	if !h.parsed {
+		h.parsed = true
+		h.inherited = make(map[string]net.Listener)
+		if list := os.Getenv(handoffFDsEnv); "" != list {
+			for idx, addr := range strings.Split(list, ",") {
+				file := os.NewFile(uintptr(handoffFirstFD+idx), addr)
+				listener, err := net.FileListener(file)
+				_ = file.Close()
+				if nil != err {
+					logErr("ReProx/inherit",
+						fmt.Sprintf("socket %q: %v", addr, err))
+					continue
+				}
+				h.inherited[addr] = listener
+			}
+			_ = os.Unsetenv(handoffFDsEnv)
+		}
+	}
+	result, ok := h.inherited[aAddr]
+	if ok {
+		delete(h.inherited, aAddr)
+	}
+
+	return result
+} // inherit()
+
+// `register()` remembers `aListener` to hand it over by `Upgrade()`.
+//
+// Parameters:
+// - `aAddr`: The address the socket is bound to.
+// - `aListener`: The bound socket.
+func (h *tHandoff) register(aAddr string, aListener net.Listener) {
+	tcp, ok := aListener.(*net.TCPListener)
+	if !ok {
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	if nil == h.bound {
+		h.bound = make(map[string]*net.TCPListener)
+	}
+	h.bound[aAddr] = tcp
+} // register()
+
+// `Upgrade()` starts a new process of the (possibly replaced) program
+// binary with the same commandline, handing over all sockets bound
+// by `TSocketOptions.Listen()`; the new process takes them over by
+// its own calls of `Listen()` for the same addresses.
+//
+// Both processes accept connections until the new one calls
+// `HandoffComplete()` which tells the old one to shut down, so no
+// connection is refused during the upgrade.
+//
+// Since the seccomp filter doesn't allow to execute programs, `Upgrade()`
+// fails if it's loaded; use `ReusePort` to start the new version
+// independently then.
+// The same goes for a process jailed in its `Chroot` directory (where
+// the program binary isn't found) or running as `RunAsUser` (whose
+// new process couldn't read the root-owned certificates and logfiles
+// at startup), which is refused with `ErrUpgradeRefused`.
+//
+// The state of the rate limiters is saved to the `RateStateFile` (if
+// any) for the new process to continue with (see `SaveRateState()`).
+//
+// Returns:
+// - `int`: The process ID of the new process.
+// - `error`: A possible error starting the new process.
+func Upgrade() (int, error) {
+	if reason := upgradeBlocker(); "" != reason {
+		logErr("ReProx/Upgrade", reason)
+		return 0, fmt.Errorf("%w: %s", ErrUpgradeRefused, reason)
+	}
+	exe, err := os.Executable()
+	if nil != err {
+		return 0, err
+	}
+
+	gHandoff.Lock()
+	defer gHandoff.Unlock()
+
+	if 0 == len(gHandoff.bound) {
+		return 0, errors.New("no sockets to hand over")
+	}
+	var (
+		addrs []string
+		files []*os.File
+	)
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+	for addr, listener := range gHandoff.bound {
+		file, err := listener.File()
+		if nil != err {
+			return 0, fmt.Errorf("socket %q: %w", addr, err)
+		}
+		addrs = append(addrs, addr)
+		files = append(files, file)
+	}
+
+	if setup := CurrentSetup(); nil != setup {
+		if err := SaveRateState(setup.RateStateFile); nil != err {
+			logErr("ReProx/Upgrade", fmt.Sprintf("rate state: %v", err))
+		}
+	}
+
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, entry := range os.Environ() {
+		if !strings.HasPrefix(entry, handoffFDsEnv+"=") &&
+			!strings.HasPrefix(entry, handoffPIDEnv+"=") {
+			env = append(env, entry)
+		}
+	}
+	env = append(env,
+		handoffFDsEnv+"="+strings.Join(addrs, ","),
+		handoffPIDEnv+"="+strconv.Itoa(os.Getpid()))
+
+	process, err := os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...),
+	})
+	if nil != err {
+		return 0, err
+	}
+	pid := process.Pid
+	_ = process.Release()
+
+	// the new process takes the PID file over:
+	gPIDFile.Lock()
+	gPIDFile.handedOver = true
+	gPIDFile.Unlock()
+
+	return pid, nil
+} // Upgrade()
+
+// `upgradeBlocker()` returns why the process can't start a new one.
+//
+// Returns:
+// - `string`: The reason (or empty if an upgrade is possible).
+func upgradeBlocker() string {
+	gJail.RLock()
+	jail := gJail.dir
+	gJail.RUnlock()
+	if "" != jail {
+		return fmt.Sprintf("process is jailed in %q", jail)
+	}
+
+	setup := CurrentSetup()
+	if gDropped.Load() ||
+		((nil != setup) && ("" != setup.RunAsUser) && (0 != os.Geteuid())) {
+		return fmt.Sprintf("process dropped its privileges (UID %d)", os.Geteuid())
+	}
+
+	return ""
+} // upgradeBlocker()
+
+// `HandoffComplete()` closes the inherited sockets not taken over by
+// `Listen()` and tells the old process (if any) to shut down.
+//
+// The program should call it once it has bound all its sockets.
+//
+// Returns:
+// - `error`: A possible error signalling the old process.
+func HandoffComplete() error {
+	gHandoff.Lock()
+	for addr, listener := range gHandoff.inherited {
+		_ = listener.Close()
+		delete(gHandoff.inherited, addr)
+	}
+	gHandoff.Unlock()
+
+	s := os.Getenv(handoffPIDEnv)
+	if "" == s {
+		return nil
+	}
+	_ = os.Unsetenv(handoffPIDEnv)
+	pid, err := strconv.Atoi(s)
+	if nil != err {
+		return fmt.Errorf("%s: %w", handoffPIDEnv, err)
+	}
+	if pid != os.Getppid() {
+		return fmt.Errorf("process %d isn't our parent", pid)
+	}
+
+	return terminate(pid)
+} // HandoffComplete()
+
+/* _EoF_ */
@@ -0,0 +1,123 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// A single header name/value pair:
+	tHeaderPair struct {
+		name  string
+		value string
+	}
+
+	// Header changes to apply to a request or response:
+	tHeaderRules struct {
+		del []string      // names of headers to remove
+		set []tHeaderPair // headers to replace
+		add []tHeaderPair // headers to append
+	}
+)
+
+// `apply()` applies the rules to `aHeader`: first the headers to
+// delete are removed, then the ones to set are replaced, and finally
+// the ones to add are appended.
+//
+// Parameters:
+// - `aHeader`: The header list to modify.
+func (hr *tHeaderRules) apply(aHeader http.Header) {
+	if nil == hr {
+		return
+	}
+	for _, name := range hr.del {
+		aHeader.Del(name)
+	}
+	for _, pair := range hr.set {
+		aHeader.Set(pair.name, pair.value)
+	}
+	for _, pair := range hr.add {
+		aHeader.Add(pair.name, pair.value)
+	}
+} // apply()
+
+// `parseHeaderPairs()` splits `aList` into header name/value pairs.
+//
+// The list holds `Name: value` entries separated by `|` (since
+// header values may contain both commas and semicolons).
+//
+// Parameters:
+// - `aSection`: The name of the host's INI section (for logging).
+// - `aList`: The configured list of headers.
+//
+// Returns:
+// - `[]tHeaderPair`: The valid header pairs.
+func parseHeaderPairs(aSection, aList string) (rPairs []tHeaderPair) {
+	for _, entry := range strings.Split(aList, "|") {
+		if entry = strings.TrimSpace(entry); "" == entry {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, ":")
+		if name = strings.TrimSpace(name); !ok || ("" == name) {
+			logErr("ReProx/parseHeaderPairs",
+				fmt.Sprintf("[%s] invalid header %q", aSection, entry))
+			continue
+		}
+		rPairs = append(rPairs, tHeaderPair{
+			name:  http.CanonicalHeaderKey(name),
+			value: strings.TrimSpace(value),
+		})
+	}
+
+	return
+} // parseHeaderPairs()
+
+// `readHeaderRules()` reads the header rules with the key prefix
+// `aPrefix` from the host's INI section:
+//
+//	<prefix>Add = X-Env: prod | X-Other: value
+//	<prefix>Set = X-Env: prod
+//	<prefix>Del = Cookie, X-Debug
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+// - `aPrefix`: The key prefix (e.g. `requestHeader`).
+//
+// Returns:
+// - `*tHeaderRules`: The host's rules or `nil` if there are none.
+func readHeaderRules(aIni *ini.TSectionList, aSection, aPrefix string) *tHeaderRules {
+	var result tHeaderRules
+
+	if s, ok := hostString(aIni, aSection, aPrefix+"Del"); ok {
+		for _, name := range strings.Split(s, ",") {
+			if name = strings.TrimSpace(name); "" != name {
+				result.del = append(result.del, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	if s, ok := hostString(aIni, aSection, aPrefix+"Set"); ok {
+		result.set = parseHeaderPairs(aSection, s)
+	}
+	if s, ok := hostString(aIni, aSection, aPrefix+"Add"); ok {
+		result.add = parseHeaderPairs(aSection, s)
+	}
+	if (0 == len(result.del)) && (0 == len(result.set)) && (0 == len(result.add)) {
+		return nil
+	}
+
+	return &result
+} // readHeaderRules()
+
+/* _EoF_ */
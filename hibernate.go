@@ -0,0 +1,114 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http/httputil"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Reverse proxy of a host configuring `hibernate`, created by the
+	// first request and dropped when the host is idle:
+	tLazyProxy struct {
+		atomic.Pointer[httputil.ReverseProxy]
+	}
+)
+
+const (
+	// Interval for checking for idle hosts:
+	hibernateInterval = time.Minute
+)
+
+// `get()` returns the proxy of the hibernating host `aDestination`,
+// creating it if the host is asleep.
+//
+// No lock is taken: if concurrent requests wake the host, the proxy
+// of the first one is used by all of them.
+//
+// Parameters:
+// - `aDestination`: The host's backend configuration.
+//
+// Returns:
+// - `*httputil.ReverseProxy`: The host's proxy (or `nil` if it can't
+// be created).
+func (lp *tLazyProxy) get(aDestination *tDestination) *httputil.ReverseProxy {
+	var created *httputil.ReverseProxy
+	for {
+		if proxy := lp.Load(); nil != proxy {
+			return proxy
+		}
+		if nil == created {
+			var err error
+			if created, err = createReverseProxy(aDestination); nil != err {
+				return nil
+			}
+		}
+		if lp.CompareAndSwap(nil, created) {
+			return created
+		}
+	}
+} // get()
+
+// `proxy()` returns the reverse proxy forwarding requests to the
+// host's backend.
+//
+// The proxies of hosts configuring `hibernate` are created by the
+// first request after the host went to sleep (see `goHibernate()`);
+// those of all other hosts are created with the configuration (see
+// `createProxies()`).
+//
+// Returns:
+// - `*httputil.ReverseProxy`: The host's proxy (or `nil` if the
+// backend's URL is invalid).
+func (d *tDestination) proxy() *httputil.ReverseProxy {
+	if (nil != d.destProxy) || (nil == d.lazyProxy) {
+		return d.destProxy
+	}
+
+	return d.lazyProxy.get(d)
+} // proxy()
+
+// `goHibernate()` periodically drops the reverse proxies (and closes
+// the backend connections) of hosts which weren't requested for longer
+// than their configured `hibernate` duration.
+//
+// The proxy is created again when the host is requested the next
+// time (see `tDestination.proxy()`).
+//
+// The method is meant to run in its own goroutine for the lifetime
+// of the program; it's started with the first host configuring
+// `hibernate` (see `startWorkers()`).
+func (ph *TProxyHandler) goHibernate() {
+	ticker := time.NewTicker(hibernateInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+
+		for host, dest := range ph.routes.Load().backendServers {
+			if (0 >= dest.hibernate) || (nil == dest.lazyProxy) ||
+				(dest.hibernate > now.Sub(time.Unix(0, dest.lastUsed.Load()))) {
+				continue
+			}
+			proxy := dest.lazyProxy.Swap(nil)
+			if nil == proxy {
+				continue // already asleep
+			}
+			// requests still being served finish with the dropped proxy
+			closeIdleTransport(proxy.Transport)
+			logInfo("ReProx/goHibernate",
+				fmt.Sprintf("host %q idle, proxy dropped", host))
+		}
+	}
+} // goHibernate()
+
+/* _EoF_ */
@@ -0,0 +1,109 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Precomputed `Via` header entries of the proxy's pseudonym:
+	tVia struct {
+		pseudonym string
+		http11    string // entry of HTTP/1.1 messages
+		http2     string // entry of HTTP/2 messages
+	}
+)
+
+var (
+	// Hop-by-hop headers which mustn't be forwarded (RFC 9110, 7.6.1):
+	hopHeaders = []string{
+		"Connection",
+		"Proxy-Connection", // non-standard but still sent
+		"Keep-Alive",
+		"Proxy-Authenticate",
+		"Proxy-Authorization",
+		"Te",
+		"Trailer",
+		"Transfer-Encoding",
+		"Upgrade",
+	}
+)
+
+// `newVia()` returns the `Via` header entries of `aPseudonym`.
+//
+// Parameters:
+// - `aPseudonym`: The name to identify the proxy.
+//
+// Returns:
+// - `*tVia`: The header entries or `nil` if `aPseudonym` is empty.
+func newVia(aPseudonym string) *tVia {
+	if "" == aPseudonym {
+		return nil
+	}
+
+	return &tVia{
+		pseudonym: aPseudonym,
+		http11:    "1.1 " + aPseudonym,
+		http2:     "2 " + aPseudonym,
+	}
+} // newVia()
+
+// `add()` appends the proxy's entry to the `Via` header.
+//
+// The entries of the common protocol versions are prepared by
+// `newVia()` to keep them from being built for each message.
+//
+// Parameters:
+// - `aHeader`: The header list to modify.
+// - `aMajor`, `aMinor`: The protocol version of the received message.
+func (v *tVia) add(aHeader http.Header, aMajor, aMinor int) {
+	if nil == v {
+		return
+	}
+
+	switch {
+	case (1 == aMajor) && (1 == aMinor):
+		aHeader.Add("Via", v.http11)
+	case (2 == aMajor) && (0 == aMinor):
+		aHeader.Add("Via", v.http2)
+	default:
+		version := strconv.Itoa(aMajor)
+		if (1 == aMajor) || (0 != aMinor) {
+			version += "." + strconv.Itoa(aMinor)
+		}
+		aHeader.Add("Via", version+" "+v.pseudonym)
+	}
+} // add()
+
+// `stripHopHeaders()` removes the hop-by-hop headers from `aHeader`,
+// including all headers named by the `Connection` header.
+//
+// `httputil.ReverseProxy` does the same, but before `ModifyResponse`
+// is called, so headers added by the configuration afterwards would
+// slip through otherwise.
+//
+// Parameters:
+// - `aHeader`: The header list to clean up.
+func stripHopHeaders(aHeader http.Header) {
+	for _, value := range aHeader.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); "" != name {
+				aHeader.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		aHeader.Del(name)
+	}
+} // stripHopHeaders()
+
+/* _EoF_ */
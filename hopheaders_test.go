@@ -0,0 +1,65 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// `legacyAddVia()` is the former `Via` handling building the entry
+// for each message (kept to compare the allocations).
+func legacyAddVia(aHeader http.Header, aMajor, aMinor int, aPseudonym string) {
+	if "" == aPseudonym {
+		return
+	}
+
+	version := strconv.Itoa(aMajor)
+	if (1 == aMajor) || (0 != aMinor) {
+		version += "." + strconv.Itoa(aMinor)
+	}
+	aHeader.Add("Via", version+" "+aPseudonym)
+} // legacyAddVia()
+
+func TestViaAdd(t *testing.T) {
+	via := newVia("reprox")
+	for _, tc := range []struct {
+		major, minor int
+	}{
+		{1, 0}, {1, 1}, {2, 0}, {3, 0},
+	} {
+		want, got := make(http.Header), make(http.Header)
+		legacyAddVia(want, tc.major, tc.minor, "reprox")
+		via.add(got, tc.major, tc.minor)
+		if want.Get("Via") != got.Get("Via") {
+			t.Errorf("HTTP/%d.%d: Via = %q, want %q",
+				tc.major, tc.minor, got.Get("Via"), want.Get("Via"))
+		}
+	}
+} // TestViaAdd()
+
+func BenchmarkVia(b *testing.B) {
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			legacyAddVia(make(http.Header, 1), 1, 1, "reprox")
+		}
+	})
+	b.Run("precomputed", func(b *testing.B) {
+		via := newVia("reprox")
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			via.add(make(http.Header, 1), 1, 1)
+		}
+	})
+} // BenchmarkVia()
+
+/* _EoF_ */
@@ -0,0 +1,250 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mwat56/ini"
+)
+
+var (
+	// Regular expression to identify `HostX` sections:
+	isHostRE = regexp.MustCompile(`^\s*(Host\d+)\s*$`)
+)
+
+// `AddHost()` adds the host `aHost` forwarding requests to `aDestURL`
+// to the configuration or – if `aHost` is configured already – changes
+// its backend server.
+//
+// The changed configuration replaces the current configuration like a reloaded one,
+// so the proxies and transports of all hosts are recreated (see
+// `OnReload()`); the host's other settings are kept.
+// It's meant to be called on `CurrentSetup()`.
+//
+// Parameters:
+// - `aHost`: The (outside) hostname to serve.
+// - `aDestURL`: The URL of the host's backend server.
+// - `aFilename`: The INI file to save the configuration to (or empty
+// to change the running configuration only; see `SaveConfig()`).
+//
+// Returns:
+// - `error`: `ErrInvalidTarget`, or a possible configuration or write error.
+func (s *TSetup) AddHost(aHost, aDestURL, aFilename string) error {
+	host := normaliseHost(aHost)
+	if "" == host {
+		return fmt.Errorf("%w: %q", ErrHostNotFound, aHost)
+	}
+	u, err := url.Parse(aDestURL)
+	if nil != err {
+		return fmt.Errorf("%w %q: %w", ErrInvalidTarget, aDestURL, err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", schemeH2C:
+	default:
+		return fmt.Errorf("%w %q", ErrInvalidTarget, aDestURL)
+	}
+	if "" == u.Host {
+		return fmt.Errorf("%w %q", ErrInvalidTarget, aDestURL)
+	}
+
+	return s.changeHosts(aFilename, func(aIni *ini.TSectionList) error {
+		section := hostSection(aIni, host)
+		if "" == section {
+			section = freeHostSection(aIni)
+			aIni.UpdateSectKeyStr(section, "outside", host)
+		}
+		aIni.UpdateSectKeyStr(section, "destURL", aDestURL)
+		logInfo("ReProx/AddHost",
+			fmt.Sprintf("[%s] %q -> %q", section, host, aDestURL))
+
+		return nil
+	})
+} // AddHost()
+
+// `RemoveHost()` removes the host `aHost` from the configuration.
+//
+// The changed configuration replaces the current configuration like a reloaded one,
+// so the proxies and transports of all hosts are recreated (see
+// `OnReload()`); requests being served by the host are finished.
+// It's meant to be called on `CurrentSetup()`.
+//
+// Parameters:
+// - `aHost`: The (outside) hostname to remove.
+// - `aFilename`: The INI file to save the configuration to (or empty
+// to change the running configuration only; see `SaveConfig()`).
+//
+// Returns:
+// - `error`: `ErrHostNotFound`, or a possible configuration or write error.
+func (s *TSetup) RemoveHost(aHost, aFilename string) error {
+	host := normaliseHost(aHost)
+	if (SNICatchAll == s.UnmatchedSNI) && (host == s.CatchAllHost) {
+		return fmt.Errorf("%q is the CatchAllHost", aHost)
+	}
+
+	return s.changeHosts(aFilename, func(aIni *ini.TSectionList) error {
+		section := hostSection(aIni, host)
+		if "" == section {
+			return fmt.Errorf("%w: %q", ErrHostNotFound, aHost)
+		}
+		aIni.RemoveSection(section)
+		logInfo("ReProx/RemoveHost", fmt.Sprintf("[%s] %q", section, host))
+
+		return nil
+	})
+} // RemoveHost()
+
+// `changeHosts()` changes a copy of the current configuration's INI
+// data by `aChange` and applies the resulting configuration.
+//
+// `gReloadMtx` is held from taking the copy until the configuration
+// is applied (and saved), so neither concurrent changes nor a reload
+// are lost. The current configuration (and its INI data) is left
+// untouched if `aChange` or reading the changed data fails.
+//
+// Parameters:
+// - `aFilename`: The INI file to save the configuration to (or empty).
+// - `aChange`: The function changing the INI data.
+//
+// Returns:
+// - `error`: A possible configuration or write error.
+func (s *TSetup) changeHosts(aFilename string, aChange func(aIni *ini.TSectionList) error) error {
+	if nil == s {
+		return ErrNoConfig
+	}
+
+	gReloadMtx.Lock()
+	defer gReloadMtx.Unlock()
+
+	current := CurrentSetup()
+	if (nil == current) || (nil == current.iniData) {
+		return ErrNoConfig
+	}
+	iniData := cloneIni(current.iniData)
+	if err := aChange(iniData); nil != err {
+		return err
+	}
+	setup, err := newSetup(iniData)
+	if nil != err {
+		return err
+	}
+	swapSetup(setup)
+	if "" == aFilename {
+		return nil
+	}
+
+	return SaveConfig(aFilename)
+} // changeHosts()
+
+// `cloneIni()` returns a copy of the INI data `aIni`.
+//
+// Parameters:
+// - `aIni`: The INI data to copy.
+//
+// Returns:
+// - `*ini.TSectionList`: The copied INI data.
+func cloneIni(aIni *ini.TSectionList) *ini.TSectionList {
+	result := ini.NewSections()
+	aIni.Walk(func(aSection, aKey, aValue string) {
+		result.UpdateSectKeyStr(aSection, aKey, aValue)
+	})
+
+	return result
+} // cloneIni()
+
+// `hostSection()` returns the INI section configuring `aHost`.
+//
+// Parameters:
+// - `aIni`: The INI data of the configuration.
+// - `aHost`: The (normalised) hostname to look up.
+//
+// Returns:
+// - `string`: The name of the host's section (or empty if there's none).
+func hostSection(aIni *ini.TSectionList, aHost string) string {
+	sections, _ := aIni.Sections()
+	for _, section := range sections {
+		if "" == isHostRE.FindString(section) {
+			continue
+		}
+		if outside, ok := aIni.AsString(section, "outside"); ok && (normaliseHost(outside) == aHost) {
+			return section
+		}
+	}
+
+	return ""
+} // hostSection()
+
+// `freeHostSection()` returns the name of an unused `HostX` section.
+//
+// Parameters:
+// - `aIni`: The INI data of the configuration.
+//
+// Returns:
+// - `string`: The name of the new section.
+func freeHostSection(aIni *ini.TSectionList) string {
+	sections, _ := aIni.Sections()
+	used := make(map[string]bool, len(sections))
+	for _, section := range sections {
+		used[section] = true
+	}
+	for idx := 1; ; idx++ {
+		if name := "Host" + strconv.Itoa(idx); !used[name] {
+			return name
+		}
+	}
+} // freeHostSection()
+
+// `handleHosts()` lists the configured hosts and their backend
+// servers (`GET`), adds or changes a host (`POST` with the form
+// values `host` and `destURL`), or removes a host (`DELETE` with the
+// form value `host`).
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (ph *TProxyHandler) handleHosts(aWriter http.ResponseWriter, aRequest *http.Request) {
+	var err error
+
+	switch aRequest.Method {
+	case http.MethodGet:
+		hosts := make(map[string]string)
+		for host, dest := range ph.routes.Load().backendServers {
+			hosts[host] = dest.destHost
+		}
+		aWriter.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(aWriter).Encode(hosts)
+		return
+
+	case http.MethodPost:
+		err = CurrentSetup().AddHost(aRequest.FormValue("host"),
+			aRequest.FormValue("destURL"), "")
+
+	case http.MethodDelete:
+		err = CurrentSetup().RemoveHost(aRequest.FormValue("host"), "")
+
+	default:
+		http.Error(aWriter, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	if nil != err {
+		http.Error(aWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	aWriter.WriteHeader(http.StatusNoContent)
+} // handleHosts()
+
+/* _EoF_ */
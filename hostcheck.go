@@ -0,0 +1,90 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+type (
+	// Validation of the `Host` header of incoming requests:
+	tHostCheck struct {
+		allow  map[string]bool // additional hostnames to accept
+		status int             // HTTP status of rejected requests
+	}
+)
+
+// `newHostCheck()` returns the `Host` header validation configured
+// by `aSetup`.
+//
+// Parameters:
+// - `aSetup`: The application's configuration.
+//
+// Returns:
+// - `*tHostCheck`: The validation or `nil` if it's disabled.
+func newHostCheck(aSetup *TSetup) *tHostCheck {
+	if !aSetup.HostCheck {
+		return nil
+	}
+
+	result := &tHostCheck{
+		allow:  make(map[string]bool, len(aSetup.HostAllow)),
+		status: aSetup.HostRejectStatus,
+	}
+	for _, host := range aSetup.HostAllow {
+		result.allow[host] = true
+	}
+
+	return result
+} // newHostCheck()
+
+// `checkHost()` checks whether the `Host` header of `aRequest` names
+// a configured (or explicitly allowed) host and, for TLS connections,
+// agrees with the server name (SNI) the client asked for.
+//
+// This protects the backend servers against DNS rebinding and
+// `Host` header injection.
+//
+// Parameters:
+// - `aCheck`: The validation settings.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the request is acceptable.
+func (ph *TProxyHandler) checkHost(aCheck *tHostCheck, aRequest *http.Request) bool {
+	host := normaliseHost(aRequest.Host)
+	if h, _, err := net.SplitHostPort(host); nil == err {
+		host = h
+	}
+	if "" == host {
+		return false
+	}
+
+	if (nil != aRequest.TLS) && ("" != aRequest.TLS.ServerName) &&
+		(host != normaliseHost(aRequest.TLS.ServerName)) {
+		return false
+	}
+
+	return aCheck.allow[host] || ph.HasHost(host)
+} // checkHost()
+
+// `reject()` answers a request with an invalid `Host` header.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (hc *tHostCheck) reject(aWriter http.ResponseWriter, aRequest *http.Request) {
+	logErr("ReProx/hostCheck",
+		fmt.Sprintf("rejected Host %q from %s", aRequest.Host, aRequest.RemoteAddr))
+	http.Error(aWriter, http.StatusText(hc.status), hc.status)
+} // reject()
+
+/* _EoF_ */
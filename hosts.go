@@ -0,0 +1,83 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// `normaliseHost()` returns `aHost` in its canonical form, i.e.
+// lower-cased, without a trailing dot, and with internationalised
+// domain names converted to punycode (e.g. `müller.example` becomes
+// `xn--mller-kva.example`).
+//
+// An optional port number is preserved. If the hostname can't be
+// converted it's returned lower-cased but otherwise unchanged.
+//
+// Parameters:
+// - `aHost`: The hostname (optionally with port) to normalise.
+//
+// Returns:
+// - `string`: The normalised hostname.
+func normaliseHost(aHost string) string {
+	if isNormalHost(aHost) {
+		// the common case, without any allocation
+		return aHost
+	}
+	host, port := strings.TrimSpace(aHost), ""
+	if h, p, err := net.SplitHostPort(host); nil == err {
+		host, port = h, p
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if ascii, err := idna.Lookup.ToASCII(host); nil == err {
+		host = ascii
+	}
+	if "" != port {
+		return net.JoinHostPort(host, port)
+	}
+
+	return host
+} // normaliseHost()
+
+// `isNormalHost()` checks whether `aHost` is in canonical form
+// already, i.e. consists of lower-case ASCII letters, digits, dots,
+// and hyphens only (not ending in a dot), optionally followed by a
+// port number.
+//
+// Parameters:
+// - `aHost`: The hostname (optionally with port) to check.
+//
+// Returns:
+// - `bool`: `true` if `aHost` needs no normalisation.
+func isNormalHost(aHost string) bool {
+	host, port, hasPort := strings.Cut(aHost, ":")
+	if ("" == host) || ('.' == host[len(host)-1]) || (hasPort && ("" == port)) {
+		return false
+	}
+	for idx := 0; idx < len(host); idx++ {
+		switch c := host[idx]; {
+		case ('a' <= c) && ('z' >= c), ('0' <= c) && ('9' >= c), '.' == c, '-' == c:
+		default:
+			return false
+		}
+	}
+	for idx := 0; idx < len(port); idx++ {
+		if ('0' > port[idx]) || ('9' < port[idx]) {
+			return false
+		}
+	}
+
+	return true
+} // isNormalHost()
+
+/* _EoF_ */
@@ -0,0 +1,121 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// The directory the process is jailed in (see `Jail()`):
+	tJail struct {
+		sync.RWMutex
+		dir string // the jail's directory outside the jail
+		cwd string // the working directory before jailing
+	}
+)
+
+const (
+	// `JailEmpty` as `Chroot` value jails the process in a private
+	// empty directory.
+	JailEmpty = "empty"
+)
+
+var (
+	// The process's jail:
+	gJail tJail
+)
+
+// `Jail()` changes the root directory of the process to `aDir`.
+//
+// With `JailEmpty` a new empty directory is created for that; any
+// other directory should contain the files read after jailing: the
+// configuration file for reloads (see `LoadConfig()`) and, if the
+// backends are named by hostname, `/etc/hosts` and `/etc/resolv.conf`.
+// Logfiles have to be opened before (see `OpenLogSink()`), and no
+// program can be executed afterwards (see `Upgrade()`).
+// Jails aren't supported on Windows.
+//
+// Parameters:
+// - `aDir`: The directory to jail the process in (or empty to do nothing).
+//
+// Returns:
+// - `error`: A possible error changing the root directory.
+func Jail(aDir string) error {
+	if "" == aDir {
+		return nil
+	}
+
+	cwd, err := os.Getwd()
+	if nil != err {
+		return err
+	}
+	if JailEmpty == aDir {
+		if aDir, err = os.MkdirTemp("", "reprox-jail-"); nil != err {
+			return err
+		}
+		if err = os.Chmod(aDir, 0o555); nil != err { // #nosec G302
+			return err
+		}
+	} else if aDir, err = filepath.Abs(aDir); nil != err {
+		return err
+	}
+
+	// load the local time zone while it can still be read:
+	_ = time.Now().Local()
+
+	if err = chroot(aDir); nil != err {
+		return fmt.Errorf("chroot(%s): %w", aDir, err)
+	}
+	if err = os.Chdir("/"); nil != err {
+		return fmt.Errorf("chdir(/): %w", err)
+	}
+
+	gJail.Lock()
+	gJail.dir, gJail.cwd = aDir, cwd
+	gJail.Unlock()
+	logInfo("ReProx/Jail", fmt.Sprintf("root directory changed to %q", aDir))
+
+	return nil
+} // Jail()
+
+// `jailPath()` returns the name of `aPath` inside the process's jail.
+//
+// Parameters:
+// - `aPath`: The (absolute or relative) filename outside the jail.
+//
+// Returns:
+// - `string`: The filename inside the jail (or `aPath` unchanged if
+// the process isn't jailed or the file isn't inside the jail).
+func jailPath(aPath string) string {
+	gJail.RLock()
+	dir, cwd := gJail.dir, gJail.cwd
+	gJail.RUnlock()
+	if "" == dir {
+		return aPath
+	}
+
+	path := aPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	rel, err := filepath.Rel(dir, path)
+	if (nil != err) || strings.HasPrefix(rel, "..") {
+		return aPath
+	}
+
+	return filepath.Join("/", rel)
+} // jailPath()
+
+/* _EoF_ */
@@ -0,0 +1,296 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// The parts of a Kubernetes `IngressList` we're interested in:
+	tIngressList struct {
+		Items []struct {
+			Metadata struct {
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+			Spec struct {
+				Rules []struct {
+					Host string `json:"host"`
+					HTTP struct {
+						Paths []struct {
+							Path    string `json:"path"`
+							Backend struct {
+								Service struct {
+									Name string `json:"name"`
+									Port struct {
+										Number int    `json:"number"`
+										Name   string `json:"name"`
+									} `json:"port"`
+								} `json:"service"`
+							} `json:"backend"`
+						} `json:"paths"`
+					} `json:"http"`
+				} `json:"rules"`
+			} `json:"spec"`
+		} `json:"items"`
+	}
+)
+
+const (
+	// Directory holding the pod's service account credentials:
+	kubeAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+)
+
+var (
+	// Hosts (hostname -> backend URL) from the latest Ingress poll:
+	gIngressHosts map[string]string
+
+	// Guard for `gIngressHosts`:
+	gIngressMtx sync.RWMutex
+)
+
+// `ingressHosts()` converts the Ingress rules in `aList` to a map of
+// hostnames to backend URLs.
+//
+// Since `reprox` routes by hostname only, the backend of a rule's
+// `/` path (or else its first path) is used.
+//
+// Parameters:
+// - `aList`: The Ingress resources read from the API server.
+//
+// Returns:
+// - `map[string]string`: The backend URLs by hostname.
+func ingressHosts(aList *tIngressList) map[string]string {
+	result := make(map[string]string)
+
+	for _, item := range aList.Items {
+		for _, rule := range item.Spec.Rules {
+			if ("" == rule.Host) || (0 == len(rule.HTTP.Paths)) {
+				continue
+			}
+			path := rule.HTTP.Paths[0]
+			for _, p := range rule.HTTP.Paths {
+				if ("/" == p.Path) || ("" == p.Path) {
+					path = p
+					break
+				}
+			}
+			service := path.Backend.Service
+			port := service.Port.Name
+			if 0 < service.Port.Number {
+				port = strconv.Itoa(service.Port.Number)
+			}
+			if ("" == service.Name) || ("" == port) {
+				continue
+			}
+			result[normaliseHost(rule.Host)] = "http://" + net.JoinHostPort(
+				fmt.Sprintf("%s.%s.svc", service.Name, item.Metadata.Namespace), port)
+		}
+	}
+
+	return result
+} // ingressHosts()
+
+// `kubeClient()` returns an HTTP client and the request to list the
+// Ingress resources using the pod's service account.
+//
+// The request doesn't hold the account's token which is rotated by
+// Kubernetes; it's read before each request (see `pollIngresses()`).
+//
+// Parameters:
+// - `aNamespace`: The namespace to watch (empty: all namespaces).
+//
+// Returns:
+// - `*http.Client`: The client trusting the cluster's CA.
+// - `*http.Request`: The request listing the Ingress resources.
+// - `error`: An error if not running inside a Kubernetes cluster.
+func kubeClient(aNamespace string) (*http.Client, *http.Request, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if ("" == host) || ("" == port) {
+		return nil, nil, errors.New("not running inside a Kubernetes cluster")
+	}
+	if _, err := os.Stat(kubeAccountDir + "token"); nil != err {
+		return nil, nil, err
+	}
+	caCert, err := os.ReadFile(kubeAccountDir + "ca.crt")
+	if nil != err {
+		return nil, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caCert)
+
+	path := "/apis/networking.k8s.io/v1/ingresses"
+	if "" != aNamespace {
+		path = "/apis/networking.k8s.io/v1/namespaces/" + aNamespace + "/ingresses"
+	}
+	request, err := http.NewRequest(http.MethodGet,
+		"https://"+net.JoinHostPort(host, port)+path, nil)
+	if nil != err {
+		return nil, nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	client := &http.Client{
+		Timeout: time.Second << 3,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				RootCAs:    pool,
+			},
+		},
+	}
+
+	return client, request, nil
+} // kubeClient()
+
+// `mergeIngressHosts()` adds the hosts discovered from Kubernetes
+// Ingress resources to `aSetup`, replacing those from a previous poll.
+// Hosts configured in the INI file take precedence.
+//
+// Parameters:
+// - `aSetup`: The configuration to update.
+func mergeIngressHosts(aSetup *TSetup) {
+	gIngressMtx.RLock()
+	defer gIngressMtx.RUnlock()
+
+	if (nil == aSetup.BackendList) || ((0 == len(gIngressHosts)) && !aSetup.KubeIngress) {
+		return
+	}
+
+	bes := make(tBackendServers, len(*aSetup.BackendList)+len(gIngressHosts))
+	for host, dest := range *aSetup.BackendList {
+		if !dest.fromKube {
+			bes[host] = dest
+		}
+	}
+	for host, destURL := range gIngressHosts {
+		if _, exists := bes[host]; exists {
+			continue
+		}
+		dest := newDestination(destURL)
+		dest.fromKube = true
+		bes[host] = dest
+	}
+	aSetup.BackendList = &bes
+} // mergeIngressHosts()
+
+// `WatchIngresses()` periodically reads the Kubernetes Ingress
+// resources and applies changed hosts to the current configuration,
+// allowing `reprox` to act as a simple ingress controller.
+//
+// The function does nothing unless `KubeIngress` is enabled; it's
+// meant to be called once at program start.
+func WatchIngresses() {
+	setup := CurrentSetup()
+	if (nil == setup) || !setup.KubeIngress {
+		return
+	}
+	client, request, err := kubeClient(setup.KubeNS)
+	if nil != err {
+		logErr("ReProx/WatchIngresses", err.Error())
+		return
+	}
+
+	goSafe("ingresses", true, func() {
+		for {
+			// a reload may have changed the settings:
+			setup := CurrentSetup()
+			if setup.KubeIngress {
+				pollIngresses(client, request)
+			}
+			time.Sleep(setup.KubeInterval)
+		}
+	})
+} // WatchIngresses()
+
+// `pollIngresses()` reads the Ingress resources once and applies the
+// hosts if they changed since the last poll.
+//
+// The service account's current token is read for each poll.
+//
+// Parameters:
+// - `aClient`: The client to use.
+// - `aRequest`: The request listing the Ingress resources.
+func pollIngresses(aClient *http.Client, aRequest *http.Request) {
+	// the (projected) token is rotated about hourly:
+	token, err := os.ReadFile(kubeAccountDir + "token")
+	if nil != err {
+		logErr("ReProx/pollIngresses", err.Error())
+		return
+	}
+	request := aRequest.Clone(aRequest.Context())
+	request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	response, err := aClient.Do(request)
+	if nil != err {
+		logErr("ReProx/pollIngresses", err.Error())
+		return
+	}
+	defer response.Body.Close()
+
+	if http.StatusOK != response.StatusCode {
+		logErr("ReProx/pollIngresses", response.Status)
+		return
+	}
+	var list tIngressList
+	if err = json.NewDecoder(response.Body).Decode(&list); nil != err {
+		logErr("ReProx/pollIngresses", err.Error())
+		return
+	}
+
+	hosts := ingressHosts(&list)
+	gIngressMtx.Lock()
+	changed := !reflect.DeepEqual(hosts, gIngressHosts)
+	gIngressHosts = hosts
+	gIngressMtx.Unlock()
+	if !changed {
+		return
+	}
+
+	applyIngressHosts()
+	logInfo("ReProx/pollIngresses",
+		fmt.Sprintf("%d hosts from Kubernetes Ingresses applied", len(hosts)))
+} // pollIngresses()
+
+// `applyIngressHosts()` applies a copy of the current configuration
+// with the hosts of the last Ingress poll merged in.
+//
+// The copy is taken while holding `gReloadMtx`, so a configuration
+// loaded concurrently is neither lost nor shares its hosts with the
+// copy.
+func applyIngressHosts() {
+	gReloadMtx.Lock()
+	defer gReloadMtx.Unlock()
+
+	current := CurrentSetup()
+	if nil == current {
+		return
+	}
+	setup := *current
+	if nil != current.BackendList {
+		bes := maps.Clone(*current.BackendList)
+		setup.BackendList = &bes
+	}
+	swapSetup(&setup)
+} // applyIngressHosts()
+
+/* _EoF_ */
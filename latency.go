@@ -0,0 +1,157 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Upstream latency histogram of a single host:
+	tLatency struct {
+		buckets [len(latencyBounds) + 1]atomic.Uint64 // last: `+Inf`
+		sum     atomic.Int64                          // total in µs
+	}
+
+	// Type of the context key holding a request's `tLatencyRef`:
+	tLatencyKey struct{}
+
+	// Data needed to measure the upstream latency of a request:
+	tLatencyRef struct {
+		host      string        // the (normalised) configured hostname
+		start     time.Time     // time the request was forwarded
+		slowAfter time.Duration // (optional) slow request threshold
+	}
+
+	// `TLatencyReport` holds the upstream latency histogram of a host.
+	TLatencyReport struct {
+		Buckets map[string]uint64 `json:"buckets"` // cumulative counts by upper bound
+		Count   uint64            `json:"count"`
+		SumMs   float64           `json:"sumMs"`
+	}
+)
+
+var (
+	// Upper bounds of the latency histogram's buckets:
+	latencyBounds = [...]time.Duration{
+		time.Millisecond * 5,
+		time.Millisecond * 10,
+		time.Millisecond * 25,
+		time.Millisecond * 50,
+		time.Millisecond * 100,
+		time.Millisecond * 250,
+		time.Millisecond * 500,
+		time.Second,
+		time.Millisecond * 2500,
+		time.Second * 5,
+		time.Second * 10,
+	}
+)
+
+// `observe()` adds `aDuration` to the histogram.
+//
+// Parameters:
+// - `aDuration`: The measured latency.
+func (l *tLatency) observe(aDuration time.Duration) {
+	idx := len(latencyBounds)
+	for i, bound := range latencyBounds {
+		if aDuration <= bound {
+			idx = i
+			break
+		}
+	}
+	l.buckets[idx].Add(1)
+	l.sum.Add(aDuration.Microseconds())
+} // observe()
+
+// `report()` returns the histogram's current (cumulative) counts.
+//
+// Returns:
+// - `TLatencyReport`: The histogram's data.
+func (l *tLatency) report() TLatencyReport {
+	result := TLatencyReport{
+		Buckets: make(map[string]uint64, len(l.buckets)),
+		SumMs:   float64(l.sum.Load()) / 1000,
+	}
+	for i := range l.buckets {
+		result.Count += l.buckets[i].Load()
+		le := "+Inf"
+		if i < len(latencyBounds) {
+			le = latencyBounds[i].String()
+		}
+		result.Buckets[le] = result.Count
+	}
+
+	return result
+} // report()
+
+// `latencyStart()` remembers the time `aRequest` gets forwarded to
+// the backend of `aHost`.
+//
+// Parameters:
+// - `aHost`: The (normalised) configured hostname.
+// - `aSlowAfter`: The host's slow request threshold (`0`: none).
+// - `aRequest`: The request to forward.
+//
+// Returns:
+// - `*http.Request`: The request to forward to the backend.
+func latencyStart(aHost string, aSlowAfter time.Duration, aRequest *http.Request) *http.Request {
+	return aRequest.WithContext(context.WithValue(aRequest.Context(),
+		tLatencyKey{}, tLatencyRef{aHost, time.Now(), aSlowAfter}))
+} // latencyStart()
+
+// `latencyStop()` records the upstream round-trip time of a request
+// (i.e. the time until the backend's response headers arrived or the
+// request failed) and its status class, and logs requests slower than
+// the host's threshold.
+//
+// Parameters:
+// - `aRequest`: The request forwarded to the backend.
+// - `aStatus`: The backend's response status (`0`: request failed).
+func latencyStop(aRequest *http.Request, aStatus int) {
+	ref, ok := aRequest.Context().Value(tLatencyKey{}).(tLatencyRef)
+	if !ok {
+		return
+	}
+	duration := time.Since(ref.start)
+	hs := hostStats(ref.host)
+	hs.latency.observe(duration)
+	hs.countStatus(aStatus)
+
+	if (0 < ref.slowAfter) && (ref.slowAfter <= duration) {
+		logErr("ReProx/slowRequest",
+			fmt.Sprintf("%s %s %s: status %d after %v",
+				ref.host, aRequest.Method, aRequest.URL.RequestURI(),
+				aStatus, duration.Round(time.Millisecond)))
+	}
+} // latencyStop()
+
+// `handleLatency()` sends the upstream latency histograms of all
+// hosts as JSON.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func handleLatency(aWriter http.ResponseWriter, aRequest *http.Request) {
+	reports := make(map[string]TLatencyReport)
+	gStats.Range(func(aKey, aValue any) bool {
+		reports[aKey.(string)] = aValue.(*tHostStats).latency.report()
+		return true
+	})
+
+	aWriter.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(aWriter).Encode(reports)
+} // handleLatency()
+
+/* _EoF_ */
@@ -0,0 +1,99 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// `THeaderLimits` holds the request header limits of a listener.
+	THeaderLimits struct {
+		MaxBytes int // maximum size of all headers (`0`: Go's default)
+		MaxCount int // maximum number of header fields (`0`: unlimited)
+	}
+)
+
+// `Apply()` sets the listener's header limits for `aServer`.
+//
+// Requests exceeding `MaxBytes` are answered by the server itself,
+// those exceeding `MaxCount` by the handler returned here; both with
+// `431 Request Header Fields Too Large`.
+//
+// Parameters:
+// - `aServer`: The server to configure.
+//
+// Returns:
+// - `*http.Server`: The configured server.
+func (hl THeaderLimits) Apply(aServer *http.Server) *http.Server {
+	if 0 < hl.MaxBytes {
+		aServer.MaxHeaderBytes = hl.MaxBytes
+	}
+	if 0 < hl.MaxCount {
+		aServer.Handler = limitHeaderCount(hl.MaxCount)(aServer.Handler)
+	}
+
+	return aServer
+} // Apply()
+
+// `limitHeaderCount()` returns a middleware refusing requests with
+// more than `aMax` header fields.
+//
+// Parameters:
+// - `aMax`: The maximum number of header fields.
+//
+// Returns:
+// - `TMiddleware`: The middleware checking the header count.
+func limitHeaderCount(aMax int) TMiddleware {
+	return func(aNext http.Handler) http.Handler {
+		return http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
+			count := 0
+			for _, values := range aRequest.Header {
+				count += len(values)
+			}
+			if aMax < count {
+				http.Error(aWriter,
+					http.StatusText(http.StatusRequestHeaderFieldsTooLarge),
+					http.StatusRequestHeaderFieldsTooLarge)
+				return
+			}
+			aNext.ServeHTTP(aWriter, aRequest)
+		})
+	}
+} // limitHeaderCount()
+
+// `readHeaderLimits()` reads the header limits of the listener whose
+// settings start with `aPrefix` (`HTTP` or `HTTPS`).
+//
+// The listener specific `<prefix>MaxHeaderBytes` and
+// `<prefix>MaxHeaderCount` settings default to the general
+// `MaxHeaderBytes` and `MaxHeaderCount` ones.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aPrefix`: The listener's settings prefix.
+//
+// Returns:
+// - `THeaderLimits`: The listener's limits.
+func readHeaderLimits(aIni *ini.TSectionList, aPrefix string) (rLimits THeaderLimits) {
+	var ok bool
+
+	if rLimits.MaxBytes, ok = aIni.AsInt(ini.DefSection, aPrefix+"MaxHeaderBytes"); !ok {
+		rLimits.MaxBytes, _ = aIni.AsInt(ini.DefSection, "MaxHeaderBytes")
+	}
+	if rLimits.MaxCount, ok = aIni.AsInt(ini.DefSection, aPrefix+"MaxHeaderCount"); !ok {
+		rLimits.MaxCount, _ = aIni.AsInt(ini.DefSection, "MaxHeaderCount")
+	}
+
+	return
+} // readHeaderLimits()
+
+/* _EoF_ */
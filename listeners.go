@@ -0,0 +1,122 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// `TListener` describes a frontend listener of the proxy.
+	TListener struct {
+		Name    string // the listener's INI section (e.g. `Listen1`)
+		Address string // the address to listen at (e.g. `[::1]:8443`)
+		TLS     bool   // whether to serve HTTPS (or plain HTTP)
+
+		// (optional) networks of the load balancers sending the
+		// PROXY protocol header (see `ProxyProtocolListener()`):
+		ProxyFrom []*net.IPNet
+	}
+)
+
+var (
+	// Regular expression to identify `ListenX` sections:
+	isListenRE = regexp.MustCompile(`^\s*(Listen\d+)\s*$`)
+)
+
+// `Frontends()` returns the configured frontend listeners or – if
+// there are none – the HTTP and HTTPS listeners at `HTTPListen` and
+// `HTTPSListen`.
+// Addresses given on the commandline take precedence over both (see
+// `SetOverrides()`).
+//
+// Returns:
+// - `[]TListener`: The listeners to serve.
+func (s *TSetup) Frontends() []TListener {
+	if 0 < len(s.Listeners) {
+		return s.Listeners
+	}
+
+	return []TListener{
+		{Name: "http", Address: s.HTTPListen},
+		{Name: "https", Address: s.HTTPSListen, TLS: true},
+	}
+} // Frontends()
+
+// `Listener()` wraps `aListener` to read the PROXY protocol header
+// of connections from the configured load balancers (if any).
+//
+// Parameters:
+// - `aListener`: The listener bound to the frontend's address.
+//
+// Returns:
+// - `net.Listener`: The (possibly wrapped) listener.
+func (tl TListener) Listener(aListener net.Listener) net.Listener {
+	return ProxyProtocolListener(aListener, tl.ProxyFrom)
+} // Listener()
+
+// `readListeners()` reads the `[ListenX]` sections configuring the
+// frontend listeners:
+//
+//	[Listen1]
+//	address = 192.0.2.1:443
+//	tls = true
+//	proxyProtocol = 10.0.0.0/8, 192.0.2.7
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+//
+// Returns:
+// - `[]TListener`: The configured listeners (if any).
+// - `[]string`: The configuration errors found.
+func readListeners(aIni *ini.TSectionList) ([]TListener, []string) {
+	var (
+		conflicts []string
+		result    []TListener
+	)
+	sections, _ := aIni.Sections()
+	seen := make(map[string]string) // address -> section
+
+	for _, section := range sections {
+		if "" == isListenRE.FindString(section) {
+			continue
+		}
+		addr, ok := aIni.AsString(section, "address")
+		if !ok || ("" == addr) {
+			conflicts = append(conflicts,
+				fmt.Sprintf("[%s] address missing", section))
+			continue
+		}
+		if other, dup := seen[addr]; dup {
+			conflicts = append(conflicts,
+				fmt.Sprintf("[%s] and [%s] listen at %q", other, section, addr))
+			continue
+		}
+		seen[addr] = section
+
+		listener := TListener{Name: section, Address: addr}
+		listener.TLS, _ = aIni.AsBool(section, "tls")
+		if s, ok := aIni.AsString(section, "proxyProtocol"); ok {
+			var err error
+			if listener.ProxyFrom, err = parseNetworks(s); nil != err {
+				conflicts = append(conflicts,
+					fmt.Sprintf("[%s] invalid proxyProtocol: %v", section, err))
+			}
+		}
+		result = append(result, listener)
+	}
+
+	return result, conflicts
+} // readListeners()
+
+/* _EoF_ */
@@ -0,0 +1,127 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/mwat56/apachelogger"
+)
+
+type (
+	// `TLogger` is the interface the package uses to log messages.
+	TLogger interface {
+		// `Log()` logs an informational message of `aSender`.
+		Log(aSender, aMessage string)
+
+		// `Err()` logs an error message of `aSender`.
+		Err(aSender, aMessage string)
+	}
+
+	// Logger writing to the `apachelogger` error log:
+	tApacheLogger struct{}
+
+	// Logger writing to a `log/slog` logger:
+	tSlogLogger struct {
+		logger *slog.Logger
+	}
+
+	// Wrapper allowing different `TLogger` types in an `atomic.Value`:
+	tLoggerBox struct {
+		TLogger
+	}
+)
+
+var (
+	// The logger currently used by the package (see `SetLogger()`):
+	gLogger = func() *atomic.Value {
+		result := &atomic.Value{}
+		result.Store(tLoggerBox{NewSlogLogger(nil)})
+		return result
+	}()
+)
+
+// `Log()` logs an informational message of `aSender`.
+func (tApacheLogger) Log(aSender, aMessage string) {
+	apachelogger.Log(aSender, aMessage)
+} // Log()
+
+// `Err()` logs an error message of `aSender`.
+func (tApacheLogger) Err(aSender, aMessage string) {
+	apachelogger.Err(aSender, aMessage)
+} // Err()
+
+// `Log()` logs an informational message of `aSender`.
+func (sl tSlogLogger) Log(aSender, aMessage string) {
+	sl.logger.Info(aMessage, "sender", aSender)
+} // Log()
+
+// `Err()` logs an error message of `aSender`.
+func (sl tSlogLogger) Err(aSender, aMessage string) {
+	sl.logger.Error(aMessage, "sender", aSender)
+} // Err()
+
+// `ApacheLogger()` returns a logger writing to the error log of the
+// `apachelogger` package (as the `reprox` program does).
+//
+// Returns:
+// - `TLogger`: The logger to pass to `SetLogger()`.
+func ApacheLogger() TLogger {
+	return tApacheLogger{}
+} // ApacheLogger()
+
+// `NewSlogLogger()` returns a logger writing to `aLogger`.
+//
+// Parameters:
+// - `aLogger`: The structured logger to use (`nil`: `slog.Default()`).
+//
+// Returns:
+// - `TLogger`: The logger to pass to `SetLogger()`.
+func NewSlogLogger(aLogger *slog.Logger) TLogger {
+	if nil == aLogger {
+		aLogger = slog.Default()
+	}
+
+	return tSlogLogger{logger: aLogger}
+} // NewSlogLogger()
+
+// `SetLogger()` selects the logger used by the package.
+//
+// By default messages are written to `slog.Default()`.
+//
+// Parameters:
+// - `aLogger`: The logger to use (`nil`: the default one).
+func SetLogger(aLogger TLogger) {
+	if nil == aLogger {
+		aLogger = NewSlogLogger(nil)
+	}
+	gLogger.Store(tLoggerBox{aLogger})
+} // SetLogger()
+
+// `logErr()` logs an error message of `aSender` by the current logger.
+//
+// Parameters:
+// - `aSender`: The name of the logging function.
+// - `aMessage`: The message to log.
+func logErr(aSender, aMessage string) {
+	gLogger.Load().(tLoggerBox).Err(aSender, aMessage)
+} // logErr()
+
+// `logInfo()` logs an informational message of `aSender` by the
+// current logger.
+//
+// Parameters:
+// - `aSender`: The name of the logging function.
+// - `aMessage`: The message to log.
+func logInfo(aSender, aMessage string) {
+	gLogger.Load().(tLoggerBox).Log(aSender, aMessage)
+} // logInfo()
+
+/* _EoF_ */
@@ -0,0 +1,503 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Writer sending each `Write()` as one entry to the systemd journal:
+	tJournalWriter struct {
+		sync.Mutex
+		conn     *net.UnixConn
+		priority int
+		tag      string
+	}
+
+	// Logger writing lines to an `io.Writer` (e.g. a log sink):
+	tWriterLogger struct {
+		sync.Mutex
+		writer io.Writer
+	}
+
+	// Sink writing each `Write()` to several destinations:
+	tMultiSink []io.WriteCloser
+
+	// Sink for the standard output streams which mustn't be closed:
+	tStdSink struct {
+		io.Writer
+	}
+
+	// `ResponseWriter` recording the status and size of a response:
+	tAccessWriter struct {
+		http.ResponseWriter
+		status int
+		size   int64
+	}
+)
+
+const (
+	// Address of the systemd journal's native protocol socket:
+	journalSocket = "/run/systemd/journal/socket"
+
+	// Name to identify the program's messages in syslog/journal:
+	logTag = "reprox"
+
+	// `LogFormatCombined` selects the Combined Log Format for access logs.
+	LogFormatCombined = "combined"
+
+	// `LogFormatW3C` selects the W3C Extended Log File Format for
+	// access logs.
+	LogFormatW3C = "w3c"
+
+	// `W3CDefaultFields` are the fields written by `AccessLogW3C()` if
+	// none are configured.
+	W3CDefaultFields = "date time c-ip cs-username cs-method cs-uri-stem cs-uri-query sc-status sc-bytes time-taken cs(User-Agent) cs(Referer)"
+)
+
+// `IsLogSink()` checks whether `aTarget` names a log sink or a list
+// of destinations (see `OpenLogSink()`) rather than a single file.
+//
+// Parameters:
+// - `aTarget`: The configured `AccessLog` or `ErrorLog` value.
+//
+// Returns:
+// - `bool`: `true` if `aTarget` isn't a single file.
+func IsLogSink(aTarget string) bool {
+	return strings.HasPrefix(aTarget, "syslog:") ||
+		strings.HasPrefix(aTarget, "syslog+") ||
+		("journald:" == aTarget) ||
+		("stdout:" == aTarget) || ("stderr:" == aTarget) ||
+		strings.Contains(aTarget, ",")
+} // IsLogSink()
+
+// `OpenLogSink()` opens the log sink `aTarget`:
+//
+//   - `syslog:` – the local syslog daemon,
+//   - `syslog://host:514` – a remote syslog server (UDP),
+//   - `syslog+tcp://host:514` – a remote syslog server (TCP),
+//   - `journald:` – the systemd journal,
+//   - `stdout:` or `stderr:` – the program's output streams.
+//
+// `aTarget` may list several of them (and logfiles) separated by
+// commas, to write each message to all of them, e.g.
+// `./access.log, stdout:, syslog:`.
+//
+// Each `Write()` to the sink creates one log entry.
+//
+// Parameters:
+// - `aTarget`: The configured `AccessLog` or `ErrorLog` value.
+// - `aError`: Whether the sink receives error (or access) messages.
+//
+// Returns:
+// - `io.WriteCloser`: The opened sink.
+// - `error`: An error if `aTarget` is invalid or can't be opened.
+func OpenLogSink(aTarget string, aError bool) (io.WriteCloser, error) {
+	if !strings.Contains(aTarget, ",") {
+		return openSink(strings.TrimSpace(aTarget), aError)
+	}
+
+	var result tMultiSink
+	for _, target := range strings.Split(aTarget, ",") {
+		if target = strings.TrimSpace(target); "" == target {
+			continue
+		}
+		sink, err := openSink(target, aError)
+		if nil != err {
+			_ = result.Close()
+			return nil, err
+		}
+		result = append(result, sink)
+	}
+
+	return result, nil
+} // OpenLogSink()
+
+// `openSink()` opens a single log destination (see `OpenLogSink()`);
+// targets which aren't sinks are opened as logfiles.
+//
+// Parameters:
+// - `aTarget`: The destination to open.
+// - `aError`: Whether the sink receives error (or access) messages.
+//
+// Returns:
+// - `io.WriteCloser`: The opened sink.
+// - `error`: An error if `aTarget` is invalid or can't be opened.
+func openSink(aTarget string, aError bool) (io.WriteCloser, error) {
+	switch aTarget {
+	case "stdout:":
+		return tStdSink{os.Stdout}, nil
+	case "stderr:":
+		return tStdSink{os.Stderr}, nil
+	}
+	if !IsLogSink(aTarget) {
+		return os.OpenFile(aTarget, // #nosec G304
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	}
+
+	if "journald:" == aTarget {
+		priority := 6 // `LOG_INFO`
+		if aError {
+			priority = 3 // `LOG_ERR`
+		}
+		conn, err := net.DialUnix("unixgram", nil,
+			&net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+		if nil != err {
+			return nil, err
+		}
+		return &tJournalWriter{
+			conn:     conn,
+			priority: priority,
+			tag:      logTag,
+		}, nil
+	}
+
+	if "syslog:" == aTarget {
+		return openSyslog("", "", aError)
+	}
+	target, err := url.Parse(aTarget)
+	if (nil != err) || ("" == target.Host) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidLogSink, aTarget)
+	}
+	network := "udp"
+	switch target.Scheme {
+	case "syslog":
+	case "syslog+tcp":
+		network = "tcp"
+	case "syslog+udp":
+	default:
+		return nil, fmt.Errorf("%w %q", ErrInvalidLogSink, aTarget)
+	}
+	host := target.Host
+	if "" == target.Port() {
+		host = net.JoinHostPort(host, "514")
+	}
+
+	return openSyslog(network, host, aError)
+} // openSink()
+
+// `Write()` writes `aData` to all destinations of the sink.
+//
+// Parameters:
+// - `aData`: The message to log.
+//
+// Returns:
+// - `int`: The number of bytes of `aData` written.
+// - `error`: The first write error (if any).
+func (ms tMultiSink) Write(aData []byte) (int, error) {
+	var result error
+	for _, sink := range ms {
+		if _, err := sink.Write(aData); (nil != err) && (nil == result) {
+			result = err
+		}
+	}
+	if nil != result {
+		return 0, result
+	}
+
+	return len(aData), nil
+} // Write()
+
+// `Close()` closes all destinations of the sink.
+//
+// Returns:
+// - `error`: The first error closing a destination (if any).
+func (ms tMultiSink) Close() error {
+	var result error
+	for _, sink := range ms {
+		if err := sink.Close(); (nil != err) && (nil == result) {
+			result = err
+		}
+	}
+
+	return result
+} // Close()
+
+// `Close()` does nothing since the standard streams stay open.
+//
+// Returns:
+// - `error`: Always `nil`.
+func (ss tStdSink) Close() error {
+	return nil
+} // Close()
+
+// `Write()` sends `aData` as one journal entry using the journal's
+// native protocol.
+//
+// Parameters:
+// - `aData`: The message to log.
+//
+// Returns:
+// - `int`: The number of bytes of `aData` written.
+// - `error`: A possible write error.
+func (jw *tJournalWriter) Write(aData []byte) (int, error) {
+	var entry bytes.Buffer
+
+	entry.WriteString("PRIORITY=" + strconv.Itoa(jw.priority) + "\n")
+	entry.WriteString("SYSLOG_IDENTIFIER=" + jw.tag + "\n")
+	// the binary format allows for line breaks within the message:
+	msg := bytes.TrimRight(aData, "\n")
+	entry.WriteString("MESSAGE\n")
+	_ = binary.Write(&entry, binary.LittleEndian, uint64(len(msg)))
+	entry.Write(msg)
+	entry.WriteByte('\n')
+
+	jw.Lock()
+	defer jw.Unlock()
+
+	if _, err := jw.conn.Write(entry.Bytes()); nil != err {
+		return 0, err
+	}
+
+	return len(aData), nil
+} // Write()
+
+// `Close()` closes the connection to the journal.
+//
+// Returns:
+// - `error`: A possible error closing the connection.
+func (jw *tJournalWriter) Close() error {
+	return jw.conn.Close()
+} // Close()
+
+// `Log()` logs an informational message of `aSender`.
+func (wl *tWriterLogger) Log(aSender, aMessage string) {
+	wl.write(aSender, aMessage)
+} // Log()
+
+// `Err()` logs an error message of `aSender`.
+func (wl *tWriterLogger) Err(aSender, aMessage string) {
+	wl.write(aSender, aMessage)
+} // Err()
+
+// `write()` writes a single log line.
+//
+// Parameters:
+// - `aSender`: The name of the logging function.
+// - `aMessage`: The message to log.
+func (wl *tWriterLogger) write(aSender, aMessage string) {
+	wl.Lock()
+	defer wl.Unlock()
+
+	if "" == aSender {
+		_, _ = fmt.Fprintln(wl.writer, aMessage)
+		return
+	}
+	_, _ = fmt.Fprintf(wl.writer, "%s: %s\n", aSender, aMessage)
+} // write()
+
+// `NewWriterLogger()` returns a logger writing one line per message
+// to `aWriter` (e.g. a sink returned by `OpenLogSink()`).
+//
+// Parameters:
+// - `aWriter`: The writer to log to.
+//
+// Returns:
+// - `TLogger`: The logger to pass to `SetLogger()`.
+func NewWriterLogger(aWriter io.Writer) TLogger {
+	return &tWriterLogger{writer: aWriter}
+} // NewWriterLogger()
+
+// `WriteHeader()` records the response's status code.
+func (aw *tAccessWriter) WriteHeader(aStatus int) {
+	if (0 == aw.status) && (http.StatusOK <= aStatus) {
+		aw.status = aStatus
+	}
+	aw.ResponseWriter.WriteHeader(aStatus)
+} // WriteHeader()
+
+// `Write()` records the response's size.
+func (aw *tAccessWriter) Write(aData []byte) (int, error) {
+	if 0 == aw.status {
+		aw.status = http.StatusOK
+	}
+	n, err := aw.ResponseWriter.Write(aData)
+	aw.size += int64(n)
+
+	return n, err
+} // Write()
+
+// `Unwrap()` returns the wrapped `ResponseWriter` (used by
+// `http.ResponseController`).
+func (aw *tAccessWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+} // Unwrap()
+
+// `AccessLog()` returns a middleware writing one line per request
+// in the Combined Log Format to `aWriter`.
+//
+// It's meant for access logs sent to a sink (see `OpenLogSink()`)
+// which the file based `apachelogger` can't write to. Like that it
+// should wrap the whole proxy handler (rather than be added by
+// `Use()`), so requests answered before routing are logged as well.
+//
+// Parameters:
+// - `aWriter`: The writer to log to.
+//
+// Returns:
+// - `TMiddleware`: The access logging middleware.
+func AccessLog(aWriter io.Writer) TMiddleware {
+	logger := &tWriterLogger{writer: aWriter}
+
+	return func(aNext http.Handler) http.Handler {
+		return http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
+			start := time.Now()
+			writer := &tAccessWriter{ResponseWriter: aWriter}
+			aNext.ServeHTTP(writer, aRequest)
+
+			ip, _, err := net.SplitHostPort(aRequest.RemoteAddr)
+			if nil != err {
+				ip = aRequest.RemoteAddr
+			}
+			user := "-"
+			if name, _, ok := aRequest.BasicAuth(); ok && ("" != name) {
+				user = name
+			}
+			if 0 == writer.status {
+				writer.status = http.StatusOK
+			}
+			logger.write("", fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %d %q %q`,
+				ip, user, start.Format("02/Jan/2006:15:04:05 -0700"),
+				aRequest.Method, aRequest.RequestURI, aRequest.Proto,
+				writer.status, writer.size,
+				aRequest.Referer(), aRequest.UserAgent()))
+		})
+	}
+} // AccessLog()
+
+// `w3cValue()` returns the value of the W3C log field `aField`.
+//
+// Besides the fields listed in the W3C's working draft (`date`,
+// `time`, `c-ip`, `cs-username`, `cs-method`, `cs-uri`, `cs-uri-stem`,
+// `cs-uri-query`, `cs-version`, `cs-host`, `sc-status`, `sc-bytes`,
+// and `time-taken`) and the client's TLS fingerprints (`x-ja3` and
+// `x-ja4`), any request or response header can be logged as
+// `cs(Name)` or `sc(Name)` respectively.
+//
+// Parameters:
+// - `aField`: The field's name.
+// - `aStart`: The time the request was received.
+// - `aWriter`: The writer which recorded the response.
+// - `aRequest`: The served request.
+//
+// Returns:
+// - `string`: The field's value (`-` if it's empty or unknown).
+func w3cValue(aField string, aStart time.Time, aWriter *tAccessWriter, aRequest *http.Request) string {
+	var result string
+
+	switch aField {
+	case "date":
+		result = aStart.UTC().Format("2006-01-02")
+	case "time":
+		result = aStart.UTC().Format("15:04:05")
+	case "c-ip":
+		ip, _, err := net.SplitHostPort(aRequest.RemoteAddr)
+		if nil != err {
+			ip = aRequest.RemoteAddr
+		}
+		result = ip
+	case "cs-username":
+		result, _, _ = aRequest.BasicAuth()
+	case "cs-method":
+		result = aRequest.Method
+	case "cs-uri":
+		result = aRequest.RequestURI
+	case "cs-uri-stem":
+		result = aRequest.URL.Path
+	case "cs-uri-query":
+		result = aRequest.URL.RawQuery
+	case "cs-version":
+		result = aRequest.Proto
+	case "cs-host":
+		result = aRequest.Host
+	case "sc-status":
+		result = strconv.Itoa(aWriter.status)
+	case "sc-bytes":
+		result = strconv.FormatInt(aWriter.size, 10)
+	case "time-taken":
+		result = strconv.FormatFloat(time.Since(aStart).Seconds(), 'f', 3, 64)
+	case "x-ja3":
+		fp, _ := Fingerprint(aRequest)
+		result = fp.JA3
+	case "x-ja4":
+		fp, _ := Fingerprint(aRequest)
+		result = fp.JA4
+	default:
+		if name, ok := strings.CutPrefix(aField, "cs("); ok {
+			result = aRequest.Header.Get(strings.TrimSuffix(name, ")"))
+		} else if name, ok := strings.CutPrefix(aField, "sc("); ok {
+			result = aWriter.Header().Get(strings.TrimSuffix(name, ")"))
+		}
+	}
+	if "" == result {
+		return "-"
+	}
+
+	// fields are separated by spaces:
+	return strings.ReplaceAll(result, " ", "+")
+} // w3cValue()
+
+// `AccessLogW3C()` returns a middleware writing one line per request
+// in the W3C Extended Log File Format to `aWriter`.
+//
+// The `#Fields` directive is written once before the first entry.
+// Like `AccessLog()` it should wrap the whole proxy handler.
+//
+// Parameters:
+// - `aWriter`: The writer to log to.
+// - `aFields`: The space separated names of the fields to log
+// (see `W3CDefaultFields`).
+//
+// Returns:
+// - `TMiddleware`: The access logging middleware.
+func AccessLogW3C(aWriter io.Writer, aFields string) TMiddleware {
+	fields := strings.Fields(aFields)
+	if 0 == len(fields) {
+		fields = strings.Fields(W3CDefaultFields)
+	}
+	logger := &tWriterLogger{writer: aWriter}
+	var directives sync.Once
+
+	return func(aNext http.Handler) http.Handler {
+		return http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
+			start := time.Now()
+			writer := &tAccessWriter{ResponseWriter: aWriter}
+			aNext.ServeHTTP(writer, aRequest)
+
+			if 0 == writer.status {
+				writer.status = http.StatusOK
+			}
+			values := make([]string, len(fields))
+			for i, field := range fields {
+				values[i] = w3cValue(field, start, writer, aRequest)
+			}
+			directives.Do(func() {
+				logger.write("", "#Version: 1.0")
+				logger.write("", "#Software: "+logTag)
+				logger.write("", "#Date: "+start.UTC().Format("2006-01-02 15:04:05"))
+				logger.write("", "#Fields: "+strings.Join(fields, " "))
+			})
+			logger.write("", strings.Join(values, " "))
+		})
+	}
+} // AccessLogW3C()
+
+/* _EoF_ */
@@ -0,0 +1,113 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// Page sent for hosts in maintenance mode without a custom page:
+	maintenanceDefaultPage = `<!DOCTYPE html>
+<html><head><title>Maintenance</title></head>
+<body><h1>Down for maintenance</h1>
+<p>This site is currently undergoing maintenance. Please try again later.</p>
+</body></html>
+`
+)
+
+// `serveMaintenance()` sends the host's maintenance page with a
+// `503 Service Unavailable` status: the host's `maintenancePage`,
+// the `maintenance.html` template (see `tErrorPages.setup()`) or the
+// built-in page.
+//
+// Parameters:
+// - `aDestination`: The backend configuration of the requested host.
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func serveMaintenance(aDestination *tDestination, aWriter http.ResponseWriter, aRequest *http.Request) {
+	header := aWriter.Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("Retry-After", "300")
+
+	page := aDestination.maintPage
+	if 0 == len(page) {
+		if gErrorPages.render(pageMaintenance, aWriter, aRequest,
+			http.StatusServiceUnavailable, "Down for maintenance") {
+			return
+		}
+		page = []byte(maintenanceDefaultPage)
+	}
+
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	aWriter.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = aWriter.Write(page)
+} // serveMaintenance()
+
+// `SetMaintenance()` switches the maintenance mode of `aHost`.
+//
+// Parameters:
+// - `aHost`: The (outside) hostname to switch.
+// - `aOn`: Whether to turn maintenance mode on or off.
+//
+// Returns:
+// - `bool`: `false` if `aHost` isn't configured.
+func (ph *TProxyHandler) SetMaintenance(aHost string, aOn bool) bool {
+	dest, ok := ph.routes.Load().backendServers[normaliseHost(aHost)]
+	if !ok {
+		return false
+	}
+	dest.maintOn.Store(aOn)
+	logInfo("ReProx/SetMaintenance",
+		fmt.Sprintf("host %q maintenance: %v", aHost, aOn))
+
+	return true
+} // SetMaintenance()
+
+// `handleMaintenance()` lists the hosts in maintenance mode (`GET`)
+// or switches a host's maintenance mode (`POST` with the form values
+// `host` and `on`).
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (ph *TProxyHandler) handleMaintenance(aWriter http.ResponseWriter, aRequest *http.Request) {
+	switch aRequest.Method {
+	case http.MethodGet:
+		hosts := []string{}
+		for host, dest := range ph.routes.Load().backendServers {
+			if dest.maintOn.Load() {
+				hosts = append(hosts, host)
+			}
+		}
+		aWriter.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(aWriter).Encode(hosts)
+
+	case http.MethodPost:
+		on, err := strconv.ParseBool(aRequest.FormValue("on"))
+		if nil != err {
+			http.Error(aWriter, "invalid value of `on`", http.StatusBadRequest)
+			return
+		}
+		if !ph.SetMaintenance(aRequest.FormValue("host"), on) {
+			http.Error(aWriter, "unknown host", http.StatusNotFound)
+			return
+		}
+		aWriter.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(aWriter, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+	}
+} // handleMaintenance()
+
+/* _EoF_ */
@@ -0,0 +1,156 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Global budget of the memory used by buffered bodies (i.e. the
+	// captured and cached responses):
+	tMemBudget struct {
+		limit   atomic.Int64 // size of the budget (`0`: unlimited)
+		maxBody atomic.Int64 // largest request body accepted under pressure
+		used    atomic.Int64 // currently used memory
+	}
+)
+
+const (
+	// Share (in percent) of the budget from which on it's under pressure:
+	memPressure = 90
+)
+
+var (
+	// The process' memory budget:
+	gMemBudget tMemBudget
+)
+
+// `setup()` sets the budget's limits from `aSetup`.
+//
+// Parameters:
+// - `aSetup`: The configuration just loaded.
+func (mb *tMemBudget) setup(aSetup *TSetup) {
+	mb.limit.Store(aSetup.MemoryBudget)
+	mb.maxBody.Store(aSetup.MemoryMaxBody)
+} // setup()
+
+// `reserve()` reserves `aSize` bytes of the budget.
+//
+// Parameters:
+// - `aSize`: The number of bytes needed.
+//
+// Returns:
+// - `bool`: `false` if the budget is exhausted.
+func (mb *tMemBudget) reserve(aSize int64) bool {
+	used := mb.used.Add(aSize)
+	if limit := mb.limit.Load(); (0 < limit) && (limit < used) {
+		mb.used.Add(-aSize)
+		return false
+	}
+
+	return true
+} // reserve()
+
+// `release()` returns `aSize` previously reserved bytes to the budget.
+//
+// Parameters:
+// - `aSize`: The number of bytes no longer used.
+func (mb *tMemBudget) release(aSize int64) {
+	mb.used.Add(-aSize)
+} // release()
+
+// `pressure()` checks whether the budget is (nearly) exhausted.
+//
+// Returns:
+// - `bool`: `true` if no more memory should be used.
+func (mb *tMemBudget) pressure() bool {
+	limit := mb.limit.Load()
+
+	return (0 < limit) && (limit*memPressure/100 <= mb.used.Load())
+} // pressure()
+
+// `refuse()` sheds the requests of low priority hosts and refuses
+// large request bodies while the budget is under pressure.
+//
+// Shed requests get `503 Service Unavailable`, refused bodies (and
+// bodies of unknown length) `413 Content Too Large`.
+//
+// Parameters:
+// - `aLowPrio`: Whether the requested host is of low priority.
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the request was refused.
+func (mb *tMemBudget) refuse(aLowPrio bool, aWriter http.ResponseWriter, aRequest *http.Request) bool {
+	if !mb.pressure() {
+		return false
+	}
+
+	if aLowPrio {
+		aWriter.Header().Set("Retry-After", "10")
+		sendError(aWriter, aRequest, http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable)
+		return true
+	}
+	if (nil == aRequest.Body) || (http.NoBody == aRequest.Body) {
+		return false
+	}
+	if (0 > aRequest.ContentLength) || (mb.maxBody.Load() < aRequest.ContentLength) {
+		http.Error(aWriter, http.StatusText(http.StatusRequestEntityTooLarge),
+			http.StatusRequestEntityTooLarge)
+		return true
+	}
+
+	return false
+} // refuse()
+
+// `retireCaches()` empties the response caches of `aOld` which aren't
+// used by `aNew` anymore, returning their memory to the budget.
+//
+// Parameters:
+// - `aOld`: The hosts of the previous configuration.
+// - `aNew`: The hosts of the configuration just loaded.
+func retireCaches(aOld, aNew tBackendServers) {
+	kept := make(map[*tHostCache]bool, len(aNew))
+	for _, dest := range aNew {
+		if nil != dest.cache {
+			kept[dest.cache] = true
+		}
+	}
+	for _, dest := range aOld {
+		if (nil != dest.cache) && !kept[dest.cache] {
+			dest.cache.retire()
+		}
+	}
+} // retireCaches()
+
+// `readLowPriority()` reads whether the host's requests are shed
+// first when the memory budget is under pressure:
+//
+//	priority = low
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `bool`: `true` if the host is of low priority.
+func readLowPriority(aIni *ini.TSectionList, aSection string) bool {
+	s, ok := hostString(aIni, aSection, "priority")
+
+	return ok && ("low" == strings.ToLower(strings.TrimSpace(s)))
+} // readLowPriority()
+
+/* _EoF_ */
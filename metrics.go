@@ -0,0 +1,276 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// `TMetric` describes a metric served by the admin server's
+	// `/metrics` endpoint.
+	//
+	// Names and labels of the listed metrics are kept stable across
+	// releases so dashboards built on them keep working; label values
+	// are bounded (see `MetricRegistry`).
+	TMetric struct {
+		Name   string   // Prometheus metric name
+		Type   string   // `counter`, `gauge`, or `histogram`
+		Help   string   // description of the metric
+		Labels []string // names of the metric's labels
+	}
+
+	// Writer of a single metric's samples in the Prometheus text format:
+	tMetricWriter struct {
+		*bufio.Writer
+		metric *TMetric
+	}
+)
+
+const (
+	// `LabelHost` holds the configured (outside) hostname.
+	LabelHost = "host"
+
+	// `LabelBackend` holds the backend URL of a host.
+	LabelBackend = "backend"
+
+	// `LabelStatusClass` holds the class of a response status
+	// (`1xx`…`5xx`, or `error` if the backend wasn't reachable).
+	LabelStatusClass = "status_class"
+
+	// `LabelListener` holds the name of a listener (`http` or `https`).
+	LabelListener = "listener"
+)
+
+var (
+	// `MetricRegistry` lists all metrics served by `/metrics`.
+	//
+	// `host` and `backend` values are limited to the configured hosts,
+	// `status_class` to six values, `listener` to the tracked servers,
+	// `state` to `open`, `active`, and `idle`, `limiter` to the
+	// configured rate limiters, and `subsystem` to the proxy's parts
+	// (e.g. `request` or `smoketest`).
+	MetricRegistry = []TMetric{
+		{"reprox_requests_total", "counter",
+			"Requests received per host.",
+			[]string{LabelHost, LabelBackend}},
+		{"reprox_errors_total", "counter",
+			"Requests per host failed by the backend (5xx or unreachable).",
+			[]string{LabelHost, LabelBackend}},
+		{"reprox_upstream_responses_total", "counter",
+			"Backend responses per host and status class.",
+			[]string{LabelHost, LabelBackend, LabelStatusClass}},
+		{"reprox_upstream_latency_seconds", "histogram",
+			"Time until the backend's response headers arrived.",
+			[]string{LabelHost, LabelBackend}},
+		{"reprox_cache_hits_total", "counter",
+			"Responses served from the host's cache.",
+			[]string{LabelHost, LabelBackend}},
+		{"reprox_cache_misses_total", "counter",
+			"Cacheable requests not found in the host's cache.",
+			[]string{LabelHost, LabelBackend}},
+		{"reprox_ua_blocked_total", "counter",
+			"Requests refused by the host's User-Agent filter.",
+			[]string{LabelHost, LabelBackend}},
+		{"reprox_connections", "gauge",
+			"Client connections per listener and state.",
+			[]string{LabelListener, "state"}},
+		{"reprox_connections_total", "counter",
+			"Client connections accepted per listener.",
+			[]string{LabelListener}},
+		{"reprox_connections_hijacked_total", "counter",
+			"Client connections taken over (e.g. by WebSockets) per listener.",
+			[]string{LabelListener}},
+		{"reprox_ratelimit_decisions_total", "counter",
+			"Decisions of the rate limiters.",
+			[]string{"limiter", "decision"}},
+		{"reprox_panics_total", "counter",
+			"Panics recovered per subsystem.",
+			[]string{"subsystem"}},
+	}
+
+	// Values of the `status_class` label by `tHostStats.statuses` index:
+	statusClasses = [...]string{"error", "1xx", "2xx", "3xx", "4xx", "5xx"}
+)
+
+// `metric()` returns the registered metric `aName`.
+//
+// Parameters:
+// - `aName`: The metric's name.
+//
+// Returns:
+// - `*TMetric`: The metric (it panics for unregistered names).
+func metric(aName string) *TMetric {
+	for idx := range MetricRegistry {
+		if aName == MetricRegistry[idx].Name {
+			return &MetricRegistry[idx]
+		}
+	}
+
+	panic("unregistered metric " + aName)
+} // metric()
+
+// `begin()` writes the `HELP` and `TYPE` lines of the metric `aName`.
+//
+// Parameters:
+// - `aWriter`: The writer to write the metric to.
+// - `aName`: The metric's name.
+//
+// Returns:
+// - `*tMetricWriter`: The writer for the metric's samples.
+func begin(aWriter *bufio.Writer, aName string) *tMetricWriter {
+	m := metric(aName)
+	fmt.Fprintf(aWriter, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, m.Type)
+
+	return &tMetricWriter{aWriter, m}
+} // begin()
+
+// `sample()` writes a single sample of the metric.
+//
+// Parameters:
+// - `aSuffix`: Suffix of the metric's name (e.g. `_bucket`).
+// - `aExtra`: (optional) additional label (e.g. a histogram's `le`).
+// - `aValue`: The sample's value.
+// - `aLabels`: The values of the metric's labels (in registry order).
+func (mw *tMetricWriter) sample(aSuffix, aExtra, aValue string, aLabels ...string) {
+	pairs := make([]string, 0, len(aLabels)+1)
+	for idx, value := range aLabels {
+		pairs = append(pairs, mw.metric.Labels[idx]+"="+strconv.Quote(value))
+	}
+	if "" != aExtra {
+		pairs = append(pairs, aExtra)
+	}
+
+	mw.WriteString(mw.metric.Name + aSuffix)
+	if 0 < len(pairs) {
+		mw.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	mw.WriteString(" " + aValue + "\n")
+} // sample()
+
+// `handleMetrics()` sends the proxy's metrics in the Prometheus text
+// exposition format.
+//
+// Only configured hosts are reported, to keep the number of series
+// bounded even if clients send arbitrary `Host` headers.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (ph *TProxyHandler) handleMetrics(aWriter http.ResponseWriter, aRequest *http.Request) {
+	type tHost struct {
+		name, backend string
+		stats         *tHostStats
+	}
+	var hosts []tHost
+
+	for name, dest := range ph.routes.Load().backendServers {
+		if hs, ok := gStats.Load(name); ok {
+			hosts = append(hosts, tHost{name, dest.destHost, hs.(*tHostStats)})
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].name < hosts[j].name })
+
+	aWriter.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w := bufio.NewWriter(aWriter)
+	defer w.Flush()
+
+	counters := []struct {
+		name  string
+		value func(*tHostStats) uint64
+	}{
+		{"reprox_requests_total", func(hs *tHostStats) uint64 { return hs.requests.Load() }},
+		{"reprox_errors_total", func(hs *tHostStats) uint64 { return hs.errors.Load() }},
+		{"reprox_cache_hits_total", func(hs *tHostStats) uint64 { return hs.cacheHits.Load() }},
+		{"reprox_cache_misses_total", func(hs *tHostStats) uint64 { return hs.cacheMisses.Load() }},
+		{"reprox_ua_blocked_total", func(hs *tHostStats) uint64 { return hs.uaBlocked.Load() }},
+	}
+	for _, counter := range counters {
+		mw := begin(w, counter.name)
+		for _, h := range hosts {
+			mw.sample("", "", strconv.FormatUint(counter.value(h.stats), 10), h.name, h.backend)
+		}
+	}
+
+	mw := begin(w, "reprox_upstream_responses_total")
+	for _, h := range hosts {
+		for class, name := range statusClasses {
+			mw.sample("", "", strconv.FormatUint(h.stats.statuses[class].Load(), 10),
+				h.name, h.backend, name)
+		}
+	}
+
+	mw = begin(w, "reprox_upstream_latency_seconds")
+	for _, h := range hosts {
+		var count uint64
+		for idx := range h.stats.latency.buckets {
+			count += h.stats.latency.buckets[idx].Load()
+			le := "+Inf"
+			if idx < len(latencyBounds) {
+				le = strconv.FormatFloat(latencyBounds[idx].Seconds(), 'f', -1, 64)
+			}
+			mw.sample("_bucket", "le="+strconv.Quote(le), strconv.FormatUint(count, 10),
+				h.name, h.backend)
+		}
+		mw.sample("_sum", "", strconv.FormatFloat(float64(h.stats.latency.sum.Load())/1e6, 'f', -1, 64),
+			h.name, h.backend)
+		mw.sample("_count", "", strconv.FormatUint(count, 10), h.name, h.backend)
+	}
+
+	conns := ConnectionReports()
+	listeners := make([]string, 0, len(conns))
+	for name := range conns {
+		listeners = append(listeners, name)
+	}
+	sort.Strings(listeners)
+	mw = begin(w, "reprox_connections")
+	for _, name := range listeners {
+		mw.sample("", "", strconv.FormatInt(conns[name].Open, 10), name, "open")
+		mw.sample("", "", strconv.FormatInt(conns[name].Active, 10), name, "active")
+		mw.sample("", "", strconv.FormatInt(conns[name].Idle, 10), name, "idle")
+	}
+	mw = begin(w, "reprox_connections_total")
+	for _, name := range listeners {
+		mw.sample("", "", strconv.FormatUint(conns[name].Total, 10), name)
+	}
+	mw = begin(w, "reprox_connections_hijacked_total")
+	for _, name := range listeners {
+		mw.sample("", "", strconv.FormatUint(conns[name].Hijacked, 10), name)
+	}
+
+	limits := RateLimitReports()
+	limiters := make([]string, 0, len(limits))
+	for name := range limits {
+		limiters = append(limiters, name)
+	}
+	sort.Strings(limiters)
+	mw = begin(w, "reprox_ratelimit_decisions_total")
+	for _, name := range limiters {
+		mw.sample("", "", strconv.FormatUint(limits[name].Allowed, 10), name, "allowed")
+		mw.sample("", "", strconv.FormatUint(limits[name].Limited, 10), name, "limited")
+	}
+
+	panics := PanicReports()
+	subsystems := make([]string, 0, len(panics))
+	for name := range panics {
+		subsystems = append(subsystems, name)
+	}
+	sort.Strings(subsystems)
+	mw = begin(w, "reprox_panics_total")
+	for _, name := range subsystems {
+		mw.sample("", "", strconv.FormatUint(panics[name], 10), name)
+	}
+} // handleMetrics()
+
+/* _EoF_ */
@@ -0,0 +1,105 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// `scrapeSeries()` returns the label sets of all samples served by
+// `/metrics`, by metric name.
+//
+// Parameters:
+// - `t`: The running test.
+// - `aProxy`: The proxy handler to scrape.
+//
+// Returns:
+// - `map[string]map[string]bool`: The label sets by metric name.
+func scrapeSeries(t *testing.T, aProxy *TProxyHandler) map[string]map[string]bool {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	aProxy.handleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	result := make(map[string]map[string]bool)
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if ("" == line) || strings.HasPrefix(line, "#") {
+			continue
+		}
+		series, _, _ := strings.Cut(line, " ")
+		name, labels, _ := strings.Cut(series, "{")
+		if nil == result[name] {
+			result[name] = make(map[string]bool)
+		}
+		result[name][labels] = true
+	}
+
+	return result
+} // scrapeSeries()
+
+func TestMetricsCardinalityBounded(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer backend.Close()
+	proxy := newTestProxy(t, backend.URL, nil)
+
+	send := func(aHost, aPath string) {
+		req := httptest.NewRequest(http.MethodGet, "http://"+aHost+aPath, nil)
+		proxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	send(testHost, "/")
+	send(testHost, "/fail")
+	before := scrapeSeries(t, proxy)
+
+	for idx := range 500 {
+		send(fmt.Sprintf("h%d.example.org", idx), "/")
+		send(testHost, fmt.Sprintf("/page/%d?q=%d", idx, idx))
+		send(testHost, fmt.Sprintf("/fail/%d", idx))
+	}
+	after := scrapeSeries(t, proxy)
+
+	for name, labels := range after {
+		if len(before[name]) != len(labels) {
+			t.Errorf("%s: %d label sets after distinct hosts and paths, %d before",
+				name, len(labels), len(before[name]))
+		}
+		for set := range labels {
+			if strings.Contains(set, LabelHost+"=") &&
+				!strings.Contains(set, LabelHost+`="`+testHost+`"`) {
+				t.Errorf("%s: unconfigured host reported: {%s", name, set)
+			}
+			if strings.Contains(set, "/page/") || strings.Contains(set, "/fail/") {
+				t.Errorf("%s: request path used as label: {%s", name, set)
+			}
+		}
+	}
+
+	// one host: a series per status class and latency bucket at most
+	if n := len(after["reprox_upstream_responses_total"]); len(statusClasses) < n {
+		t.Errorf("reprox_upstream_responses_total: %d label sets, want <= %d",
+			n, len(statusClasses))
+	}
+	if n := len(after["reprox_upstream_latency_seconds_bucket"]); len(latencyBounds)+1 < n {
+		t.Errorf("reprox_upstream_latency_seconds_bucket: %d label sets, want <= %d",
+			n, len(latencyBounds)+1)
+	}
+	for _, m := range MetricRegistry {
+		if (1 == len(m.Labels)) && (LabelHost == m.Labels[0]) && (1 < len(after[m.Name])) {
+			t.Errorf("%s: %d label sets for a single host", m.Name, len(after[m.Name]))
+		}
+	}
+} // TestMetricsCardinalityBounded()
+
+/* _EoF_ */
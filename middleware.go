@@ -0,0 +1,114 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"maps"
+	"net/http"
+)
+
+type (
+	// `TMiddleware` wraps a handler by another one, e.g. to inspect
+	// or modify requests before they're proxied.
+	TMiddleware func(http.Handler) http.Handler
+)
+
+// `buildChain()` wraps `aHandler` by all `aMiddleware` so that the
+// first one registered is the outermost.
+//
+// Parameters:
+// - `aHandler`: The innermost handler.
+// - `aMiddleware`: The middleware to apply.
+//
+// Returns:
+// - `http.Handler`: The handler running the whole chain.
+func buildChain(aHandler http.Handler, aMiddleware []TMiddleware) http.Handler {
+	for idx := len(aMiddleware) - 1; 0 <= idx; idx-- {
+		aHandler = aMiddleware[idx](aHandler)
+	}
+
+	return aHandler
+} // buildChain()
+
+// `Use()` adds `aMiddleware` to the chain run for all requests
+// before the backend server is looked up.
+//
+// Middleware runs in the order of registration, i.e. the first one
+// registered sees the request first.
+//
+// Parameters:
+// - `aMiddleware`: The middleware to add.
+//
+// Returns:
+// - `*TProxyHandler`: The proxy handler itself, allowing chained calls.
+func (ph *TProxyHandler) Use(aMiddleware ...TMiddleware) *TProxyHandler {
+	ph.update(func(aRoutes *tRoutes) {
+		for _, mw := range aMiddleware {
+			if nil != mw {
+				ph.middleware = append(ph.middleware, mw)
+			}
+		}
+		if 0 < len(ph.middleware) {
+			aRoutes.chain = buildChain(http.HandlerFunc(ph.route), ph.middleware)
+		}
+	})
+
+	return ph
+} // Use()
+
+// `UseHost()` adds `aMiddleware` to the chain run for the requests
+// of `aHost` after the global middleware (see `Use()`) and before
+// the host's own settings (maintenance, authentication, etc.) apply.
+//
+// Parameters:
+// - `aHost`: The (outside) hostname whose requests to handle.
+// - `aMiddleware`: The middleware to add.
+//
+// Returns:
+// - `*TProxyHandler`: The proxy handler itself, allowing chained calls.
+func (ph *TProxyHandler) UseHost(aHost string, aMiddleware ...TMiddleware) *TProxyHandler {
+	host := normaliseHost(aHost)
+	ph.update(func(aRoutes *tRoutes) {
+		if nil == ph.hostMiddleware {
+			ph.hostMiddleware = make(map[string][]TMiddleware)
+		}
+		for _, mw := range aMiddleware {
+			if nil != mw {
+				ph.hostMiddleware[host] = append(ph.hostMiddleware[host], mw)
+			}
+		}
+		if list := ph.hostMiddleware[host]; 0 < len(list) {
+			aRoutes.hostChains = maps.Clone(aRoutes.hostChains)
+			if nil == aRoutes.hostChains {
+				aRoutes.hostChains = make(map[string]http.Handler)
+			}
+			aRoutes.hostChains[host] = buildChain(http.HandlerFunc(ph.serveHost), list)
+		}
+	})
+
+	return ph
+} // UseHost()
+
+// `serveHost()` is the innermost handler of a host's middleware
+// chain forwarding the request to the host's backend server.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (ph *TProxyHandler) serveHost(aWriter http.ResponseWriter, aRequest *http.Request) {
+	host, target, ok := ph.lookup(aRequest)
+	if !ok {
+		notFound(aWriter, aRequest)
+		return
+	}
+
+	ph.forward(host, &target, aWriter, aRequest)
+} // serveHost()
+
+/* _EoF_ */
@@ -0,0 +1,137 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// First delay before restarting a failed background task:
+	panicRestartMin = time.Second
+
+	// Longest delay before restarting a failed background task:
+	panicRestartMax = time.Minute
+)
+
+var (
+	// Number of recovered panics by subsystem (`*atomic.Uint64`):
+	gPanics sync.Map
+)
+
+// `reportPanic()` logs the recovered panic `aValue` with the stack
+// trace of the panicking goroutine and counts it.
+//
+// Parameters:
+// - `aSubsystem`: The name of the panicking subsystem.
+// - `aValue`: The value passed to `panic()`.
+func reportPanic(aSubsystem string, aValue any) {
+	counter, _ := gPanics.LoadOrStore(aSubsystem, &atomic.Uint64{})
+	counter.(*atomic.Uint64).Add(1)
+
+	logErr("ReProx/panic",
+		fmt.Sprintf("%s: %v\n%s", aSubsystem, aValue, debug.Stack()))
+} // reportPanic()
+
+// `recoverRequest()` recovers a panic while serving `aRequest`,
+// reporting it (see `reportPanic()`) and answering the request with
+// `500 Internal Server Error`, so that neither the server nor the
+// client's connection is torn down.
+//
+// It must be deferred directly by the handler.
+// The `http.ErrAbortHandler` used to abort a response on purpose is
+// passed on.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func recoverRequest(aWriter http.ResponseWriter, aRequest *http.Request) {
+	value := recover()
+	if nil == value {
+		return
+	}
+	if http.ErrAbortHandler == value {
+		panic(value)
+	}
+
+	reportPanic("request", value)
+	sendError(aWriter, aRequest, "Internal Server Error",
+		http.StatusInternalServerError)
+} // recoverRequest()
+
+// `runSafe()` calls `aFunc` recovering a possible panic.
+//
+// Parameters:
+// - `aSubsystem`: The name of the subsystem running `aFunc`.
+// - `aFunc`: The function to call.
+//
+// Returns:
+// - `bool`: `true` if `aFunc` panicked.
+func runSafe(aSubsystem string, aFunc func()) (rPanicked bool) {
+	defer func() {
+		if value := recover(); nil != value {
+			reportPanic(aSubsystem, value)
+			rPanicked = true
+		}
+	}()
+	aFunc()
+
+	return
+} // runSafe()
+
+// `goSafe()` runs `aFunc` in a new goroutine whose panics are
+// recovered and reported (see `reportPanic()`) instead of crashing
+// the program.
+//
+// If `aRestart` is `true` and `PanicRestart` is configured, a
+// panicked `aFunc` is started again after a delay which doubles with
+// each panic (up to a minute).
+//
+// Parameters:
+// - `aSubsystem`: The name of the subsystem running `aFunc`.
+// - `aRestart`: Whether `aFunc` is a long-running task to restart.
+// - `aFunc`: The function to run.
+func goSafe(aSubsystem string, aRestart bool, aFunc func()) {
+	go func() {
+		delay := panicRestartMin
+		for runSafe(aSubsystem, aFunc) {
+			if setup := CurrentSetup(); !aRestart || (nil == setup) || !setup.PanicRestart {
+				return
+			}
+			logInfo("ReProx/panic",
+				fmt.Sprintf("%s: restarting in %s", aSubsystem, delay))
+			time.Sleep(delay)
+			if delay <<= 1; panicRestartMax < delay {
+				delay = panicRestartMax
+			}
+		}
+	}()
+} // goSafe()
+
+// `PanicReports()` returns the number of panics recovered so far by
+// subsystem (e.g. `request`).
+//
+// Returns:
+// - `map[string]uint64`: The number of panics by subsystem.
+func PanicReports() map[string]uint64 {
+	result := make(map[string]uint64)
+	gPanics.Range(func(aKey, aValue any) bool {
+		result[aKey.(string)] = aValue.(*atomic.Uint64).Load()
+		return true
+	})
+
+	return result
+} // PanicReports()
+
+/* _EoF_ */
@@ -0,0 +1,142 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+type (
+	// The locked PID file of the process (see `LockPIDFile()`):
+	tPIDFile struct {
+		sync.Mutex
+		file       *os.File // the open (and locked) file
+		name       string   // the file's name
+		handedOver bool     // whether a new process took over
+	}
+)
+
+var (
+	// The process's PID file:
+	gPIDFile tPIDFile
+)
+
+// `LockPIDFile()` writes the process ID to `aFilename` and locks the
+// file for as long as the process runs, so that no second instance
+// with the same configuration can be started.
+//
+// The lock (not the file's existence) marks the running instance,
+// so a file left over by a crashed process doesn't matter.
+// A new process started by `Upgrade()` takes the lock over once the
+// old process exits. The file should be locked before binding any
+// socket (see `ListenAndDrop()`).
+// Systems without `flock()` get the file written but not locked.
+//
+// Parameters:
+// - `aFilename`: The name of the PID file (or empty to do nothing).
+//
+// Returns:
+// - `error`: `ErrAlreadyRunning` or a possible error writing the file.
+func LockPIDFile(aFilename string) error {
+	if "" == aFilename {
+		return nil
+	}
+
+	file, err := os.OpenFile(aFilename, os.O_RDWR|os.O_CREATE, 0o644) // #nosec G302
+	if nil != err {
+		return err
+	}
+	gPIDFile.Lock()
+	gPIDFile.file, gPIDFile.name = file, aFilename
+	gPIDFile.Unlock()
+
+	err = lockFile(file, false)
+	switch {
+	case nil == err, errors.Is(err, errors.ErrUnsupported):
+		return writePID(file)
+
+	case "" != os.Getenv(handoffPIDEnv):
+		// the old process holds the lock until it's done:
+		go func() {
+			if err := lockFile(file, true); nil != err {
+				logErr("ReProx/LockPIDFile", fmt.Sprintf("%s: %v", aFilename, err))
+				return
+			}
+			if err := writePID(file); nil != err {
+				logErr("ReProx/LockPIDFile", fmt.Sprintf("%s: %v", aFilename, err))
+			}
+		}()
+		return nil
+	}
+
+	gPIDFile.Lock()
+	gPIDFile.file = nil
+	gPIDFile.Unlock()
+	buf := make([]byte, 32)
+	n, _ := file.Read(buf)
+	_ = file.Close()
+
+	return fmt.Errorf("%w: %s locked by process %s", ErrAlreadyRunning,
+		aFilename, bytes.TrimSpace(buf[:n]))
+} // LockPIDFile()
+
+// `writePID()` replaces the contents of `aFile` by the process ID.
+//
+// Parameters:
+// - `aFile`: The locked PID file.
+//
+// Returns:
+// - `error`: A possible write error.
+func writePID(aFile *os.File) error {
+	if err := aFile.Truncate(0); nil != err {
+		return err
+	}
+	_, err := aFile.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+
+	return err
+} // writePID()
+
+// `RemovePIDFile()` removes the PID file written by `LockPIDFile()`
+// unless a process started by `Upgrade()` took it over.
+//
+// After dropping the root privileges (see `ListenAndDrop()`) the
+// process usually can't remove the file from its (root-owned)
+// directory, or can't reach it from inside the jail; the file is
+// emptied through the still open descriptor then, so no stale process
+// ID is left behind (the next instance overwrites the empty file).
+//
+// Returns:
+// - `error`: A possible error removing or emptying the file.
+func RemovePIDFile() error {
+	gPIDFile.Lock()
+	defer gPIDFile.Unlock()
+
+	if nil == gPIDFile.file {
+		return nil
+	}
+	var err error
+	if !gPIDFile.handedOver {
+		if err = os.Remove(jailPath(gPIDFile.name)); nil != err {
+			if e2 := gPIDFile.file.Truncate(0); nil == e2 {
+				err = nil
+			}
+		}
+	}
+	_ = gPIDFile.file.Close()
+	gPIDFile.file = nil
+
+	return err
+} // RemovePIDFile()
+
+/* _EoF_ */
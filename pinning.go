@@ -0,0 +1,112 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+type (
+	// List of SHA-256 hashes of pinned backend certificates or keys:
+	tPins [][]byte
+)
+
+// `parsePins()` parses a comma separated list of base64 encoded SHA-256
+// hashes (optionally prefixed by `sha256/` like in HPKP headers).
+//
+// Listing two pins allows for rotating a backend's certificate.
+//
+// Parameters:
+// - `aSection`: The name of the host's INI section (for logging).
+// - `aList`: The configured list of pins.
+//
+// Returns:
+// - `tPins`: The decoded pins.
+func parsePins(aSection, aList string) (rPins tPins) {
+	for _, pin := range strings.Split(aList, ",") {
+		if pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/"); "" == pin {
+			continue
+		}
+		hash, err := base64.StdEncoding.DecodeString(pin)
+		if (nil != err) || (sha256.Size != len(hash)) {
+			logErr("ReProx/parsePins",
+				fmt.Sprintf("[%s] invalid pin %q", aSection, pin))
+			continue
+		}
+		rPins = append(rPins, hash)
+	}
+
+	return
+} // parsePins()
+
+// `matches()` checks whether `aHash` is one of the pins.
+//
+// Parameters:
+// - `aHash`: The SHA-256 hash to check.
+//
+// Returns:
+// - `bool`: `true` if `aHash` is pinned.
+func (p tPins) matches(aHash [sha256.Size]byte) bool {
+	for _, pin := range p {
+		if 1 == subtle.ConstantTimeCompare(pin, aHash[:]) {
+			return true
+		}
+	}
+
+	return false
+} // matches()
+
+// `verify()` checks the certificate chain presented by a backend
+// against the pins.
+//
+// A chain is accepted if the hash of any of its certificates or of any
+// certificate's public key (SPKI) is pinned.
+// It's meant to be used as `tls.Config.VerifyPeerCertificate`.
+//
+// Parameters:
+// - `aRawCerts`: The DER encoded certificates sent by the backend.
+// - `aChains`: The verified chains (unused).
+//
+// Returns:
+// - `error`: `ErrPinMismatch` if no certificate matches any pin.
+func (p tPins) verify(aRawCerts [][]byte, aChains [][]*x509.Certificate) error {
+	for _, raw := range aRawCerts {
+		if p.matches(sha256.Sum256(raw)) {
+			return nil
+		}
+		cert, err := x509.ParseCertificate(raw)
+		if nil != err {
+			continue
+		}
+		if p.matches(sha256.Sum256(cert.RawSubjectPublicKeyInfo)) {
+			return nil
+		}
+	}
+
+	return ErrPinMismatch
+} // verify()
+
+// `tlsConfig()` returns a TLS client configuration enforcing the pins.
+//
+// Returns:
+// - `*tls.Config`: The configuration for the backend connections.
+func (p tPins) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:            tls.VersionTLS12,
+		VerifyPeerCertificate: p.verify,
+	}
+} // tlsConfig()
+
+/* _EoF_ */
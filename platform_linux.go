@@ -0,0 +1,108 @@
+//go:build linux
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// `allThreads()` returns the result of a system call run for all
+// threads of the process by `syscall.AllThreadsSyscall()`.
+//
+// That's not supported if cgo is linked into the program; `aFunc` then
+// does the same for the calling thread only, which must be locked to
+// its goroutine (see `tRunAs.apply()`).
+//
+// Parameters:
+// - `aErrno`: The result of `syscall.AllThreadsSyscall()`.
+// - `aFunc`: The fallback changing the calling thread.
+//
+// Returns:
+// - `error`: A possible error of the system call.
+func allThreads(aErrno syscall.Errno, aFunc func() error) error {
+	switch aErrno {
+	case 0:
+		return nil
+	case syscall.ENOTSUP:
+		return aFunc()
+	}
+
+	return aErrno
+} // allThreads()
+
+// `dropCapabilities()` clears the capabilities of all threads of the
+// process, except for `CAP_NET_BIND_SERVICE` if `aKeepBind` is set;
+// that one is raised as an ambient capability then, so that a process
+// started by `Upgrade()` may bind privileged ports as well.
+//
+// In cgo builds only the calling thread keeps `CAP_NET_BIND_SERVICE`
+// (the others lost all capabilities by `setuid()` already).
+//
+// Parameters:
+// - `aKeepBind`: Whether to keep the right to bind privileged ports.
+//
+// Returns:
+// - `error`: A possible error clearing the capabilities.
+func dropCapabilities(aKeepBind bool) error {
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{}
+	if aKeepBind {
+		bind := uint32(1) << unix.CAP_NET_BIND_SERVICE
+		data[0].Effective, data[0].Permitted, data[0].Inheritable = bind, bind, bind
+	}
+
+	// capabilities are per thread:
+	_, _, errno := syscall.AllThreadsSyscall(unix.SYS_CAPSET,
+		uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if err := allThreads(errno, func() error {
+		return unix.Capset(&header, &data[0])
+	}); nil != err {
+		return err
+	}
+	if !aKeepBind {
+		return nil
+	}
+
+	_, _, errno = syscall.AllThreadsSyscall(unix.SYS_PRCTL,
+		unix.PR_SET_KEEPCAPS, 0, 0)
+	if err := allThreads(errno, func() error {
+		return unix.Prctl(unix.PR_SET_KEEPCAPS, 0, 0, 0, 0)
+	}); nil != err {
+		return err
+	}
+	_, _, errno = syscall.AllThreadsSyscall6(unix.SYS_PRCTL, unix.PR_CAP_AMBIENT,
+		unix.PR_CAP_AMBIENT_RAISE, unix.CAP_NET_BIND_SERVICE, 0, 0, 0)
+
+	return allThreads(errno, func() error {
+		return unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE,
+			unix.CAP_NET_BIND_SERVICE, 0, 0)
+	})
+} // dropCapabilities()
+
+// `keepCapabilities()` makes all threads of the process (or in cgo
+// builds the calling one) keep their permitted capabilities when
+// switching from root to another user (see `dropCapabilities()`).
+//
+// Returns:
+// - `error`: A possible error setting `PR_SET_KEEPCAPS`.
+func keepCapabilities() error {
+	_, _, errno := syscall.AllThreadsSyscall(unix.SYS_PRCTL,
+		unix.PR_SET_KEEPCAPS, 1, 0)
+
+	return allThreads(errno, func() error {
+		return unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0)
+	})
+} // keepCapabilities()
+
+/* _EoF_ */
@@ -0,0 +1,34 @@
+//go:build !linux
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+// `dropCapabilities()` does nothing since there are no capabilities
+// on other systems.
+//
+// Parameters:
+// - `aKeepBind`: Whether to keep the right to bind privileged ports.
+//
+// Returns:
+// - `error`: Always `nil`.
+func dropCapabilities(aKeepBind bool) error {
+	return nil
+} // dropCapabilities()
+
+// `keepCapabilities()` does nothing since there are no capabilities
+// on other systems.
+//
+// Returns:
+// - `error`: Always `nil`.
+func keepCapabilities() error {
+	return nil
+} // keepCapabilities()
+
+/* _EoF_ */
@@ -0,0 +1,95 @@
+//go:build !unix
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// `chroot()` fails since jails aren't supported on this system.
+//
+// Parameters:
+// - `aDir`: The new root directory.
+//
+// Returns:
+// - `error`: Always `errors.ErrUnsupported`.
+func chroot(aDir string) error {
+	return errors.ErrUnsupported
+} // chroot()
+
+// `lockFile()` fails since files can't be locked on this system.
+//
+// Parameters:
+// - `aFile`: The file to lock.
+// - `aWait`: Whether to wait for a lock held by another process.
+//
+// Returns:
+// - `error`: Always `errors.ErrUnsupported`.
+func lockFile(aFile *os.File, aWait bool) error {
+	return errors.ErrUnsupported
+} // lockFile()
+
+// `openSyslog()` fails since there's no syslog on this system.
+//
+// Parameters:
+// - `aNetwork`: The network to use (or empty for the local daemon).
+// - `aAddr`: The server's address (or empty for the local daemon).
+// - `aError`: Whether the sink receives error (or access) messages.
+//
+// Returns:
+// - `io.WriteCloser`: Always `nil`.
+// - `error`: Always `errors.ErrUnsupported`.
+func openSyslog(aNetwork, aAddr string, aError bool) (io.WriteCloser, error) {
+	return nil, errors.ErrUnsupported
+} // openSyslog()
+
+// `reusePort()` fails since `SO_REUSEPORT` isn't supported on this
+// system.
+//
+// Parameters:
+// - `aNetwork`: The socket's network.
+// - `aAddress`: The socket's address.
+// - `aConn`: The raw socket.
+//
+// Returns:
+// - `error`: Always `errors.ErrUnsupported`.
+func reusePort(aNetwork, aAddress string, aConn syscall.RawConn) error {
+	return errors.ErrUnsupported
+} // reusePort()
+
+// `switchUser()` fails since there are no user IDs on this system.
+//
+// Parameters:
+// - `aUID`: The user to run as.
+// - `aGID`: The group to run as.
+//
+// Returns:
+// - `error`: Always `errors.ErrUnsupported`.
+func switchUser(aUID, aGID int) error {
+	return errors.ErrUnsupported
+} // switchUser()
+
+// `terminate()` fails since processes can't be asked to shut down
+// on this system.
+//
+// Parameters:
+// - `aPid`: The process to terminate.
+//
+// Returns:
+// - `error`: Always `errors.ErrUnsupported`.
+func terminate(aPid int) error {
+	return errors.ErrUnsupported
+} // terminate()
+
+/* _EoF_ */
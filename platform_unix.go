@@ -0,0 +1,128 @@
+//go:build unix
+
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// `chroot()` changes the root directory of the process to `aDir`.
+//
+// Parameters:
+// - `aDir`: The new root directory.
+//
+// Returns:
+// - `error`: A possible error changing the root directory.
+func chroot(aDir string) error {
+	return syscall.Chroot(aDir)
+} // chroot()
+
+// `lockFile()` places an exclusive `flock()` lock on `aFile`.
+//
+// Parameters:
+// - `aFile`: The file to lock.
+// - `aWait`: Whether to wait for a lock held by another process.
+//
+// Returns:
+// - `error`: A possible error (e.g. `EWOULDBLOCK`) locking the file.
+func lockFile(aFile *os.File, aWait bool) error {
+	how := syscall.LOCK_EX
+	if !aWait {
+		how |= syscall.LOCK_NB
+	}
+
+	return syscall.Flock(int(aFile.Fd()), how)
+} // lockFile()
+
+// `openSyslog()` connects to a syslog server.
+//
+// Parameters:
+// - `aNetwork`: The network to use (or empty for the local daemon).
+// - `aAddr`: The server's address (or empty for the local daemon).
+// - `aError`: Whether the sink receives error (or access) messages.
+//
+// Returns:
+// - `io.WriteCloser`: The connected sink.
+// - `error`: A possible error connecting to the server.
+func openSyslog(aNetwork, aAddr string, aError bool) (io.WriteCloser, error) {
+	priority := syslog.LOG_DAEMON | syslog.LOG_INFO
+	if aError {
+		priority = syslog.LOG_DAEMON | syslog.LOG_ERR
+	}
+
+	return syslog.Dial(aNetwork, aAddr, priority, logTag)
+} // openSyslog()
+
+// `reusePort()` sets `SO_REUSEPORT` for a listening socket
+// (see `TSocketOptions.Listen()`).
+//
+// Parameters:
+// - `aNetwork`: The socket's network.
+// - `aAddress`: The socket's address.
+// - `aConn`: The raw socket.
+//
+// Returns:
+// - `error`: A possible error setting the option.
+func reusePort(aNetwork, aAddress string, aConn syscall.RawConn) error {
+	var sockErr error
+	err := aConn.Control(func(aFD uintptr) {
+		sockErr = unix.SetsockoptInt(int(aFD), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if nil != err {
+		return err
+	}
+
+	return sockErr
+} // reusePort()
+
+// `switchUser()` switches the process to the user `aUID` and the
+// group `aGID`, dropping all supplementary groups.
+//
+// Parameters:
+// - `aUID`: The user to run as.
+// - `aGID`: The group to run as.
+//
+// Returns:
+// - `error`: A possible error switching the user.
+func switchUser(aUID, aGID int) error {
+	// The order matters: groups and GID can't be changed anymore
+	// once the UID isn't root.
+	if err := syscall.Setgroups(nil); nil != err {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(aGID); nil != err {
+		return fmt.Errorf("setgid(%d): %w", aGID, err)
+	}
+	if err := syscall.Setuid(aUID); nil != err {
+		return fmt.Errorf("setuid(%d): %w", aUID, err)
+	}
+
+	return nil
+} // switchUser()
+
+// `terminate()` asks the process `aPid` to shut down gracefully.
+//
+// Parameters:
+// - `aPid`: The process to terminate.
+//
+// Returns:
+// - `error`: A possible error signalling the process.
+func terminate(aPid int) error {
+	return syscall.Kill(aPid, syscall.SIGTERM)
+} // terminate()
+
+/* _EoF_ */
@@ -0,0 +1,240 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Preload hints derived from a single HTML page:
+	tPreloadEntry struct {
+		links   []string  // values for `Link` headers
+		scanned time.Time // time the page was last scanned
+	}
+
+	// Per-host cache of preload hints, indexed by request path:
+	tPreloadCache struct {
+		sync.RWMutex
+		entries map[string]*tPreloadEntry
+	}
+
+	// Type of the context key holding the originally requested path:
+	tPreloadPathKey struct{}
+
+	// Response body wrapper capturing the start of an HTML page:
+	tPreloadBody struct {
+		io.ReadCloser
+		buf   bytes.Buffer
+		cache *tPreloadCache
+		path  string
+	}
+)
+
+const (
+	// Maximum number of paths remembered per host:
+	preloadMaxEntries = 1 << 10
+
+	// Maximum number of preload hints per page:
+	preloadMaxLinks = 16
+
+	// Number of bytes of an HTML page scanned for assets:
+	preloadScanSize = 1 << 16
+
+	// Time after which a page gets scanned again:
+	preloadTTL = time.Minute * 10
+)
+
+var (
+	// Regular expression matching `<link … rel="stylesheet" … href="…">`:
+	preloadStyleRE = regexp.MustCompile(
+		`(?i)<link\s[^>]*?rel\s*=\s*["']?stylesheet["']?[^>]*?href\s*=\s*["']([^"']+)["']|<link\s[^>]*?href\s*=\s*["']([^"']+)["'][^>]*?rel\s*=\s*["']?stylesheet["']?`)
+
+	// Regular expression matching `<script … src="…">`:
+	preloadScriptRE = regexp.MustCompile(
+		`(?i)<script\s[^>]*?src\s*=\s*["']([^"']+)["']`)
+)
+
+// `newPreloadCache()` returns a new, empty preload hint cache.
+//
+// Returns:
+// - `*tPreloadCache`: The new cache.
+func newPreloadCache() *tPreloadCache {
+	return &tPreloadCache{
+		entries: make(map[string]*tPreloadEntry),
+	}
+} // newPreloadCache()
+
+// `hints()` returns the cached preload hints for `aPath` and whether
+// the page should be scanned (again).
+//
+// Parameters:
+// - `aPath`: The requested URL path.
+//
+// Returns:
+// - `[]string`: The `Link` header values known for `aPath`.
+// - `bool`: `true` if the page's hints are missing or outdated.
+func (pc *tPreloadCache) hints(aPath string) ([]string, bool) {
+	pc.RLock()
+	defer pc.RUnlock()
+
+	entry, ok := pc.entries[aPath]
+	if !ok {
+		return nil, true
+	}
+
+	return entry.links, preloadTTL < time.Since(entry.scanned)
+} // hints()
+
+// `store()` remembers `aLinks` as the preload hints for `aPath`.
+//
+// Parameters:
+// - `aPath`: The requested URL path.
+// - `aLinks`: The `Link` header values found in the page.
+func (pc *tPreloadCache) store(aPath string, aLinks []string) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	if _, ok := pc.entries[aPath]; !ok && (preloadMaxEntries <= len(pc.entries)) {
+		return // cache full
+	}
+	pc.entries[aPath] = &tPreloadEntry{
+		links:   aLinks,
+		scanned: time.Now(),
+	}
+} // store()
+
+// `Read()` reads from the wrapped body while capturing the start of
+// the page.
+//
+// Parameters:
+// - `aData`: The buffer to read into.
+//
+// Returns:
+// - `int`: The number of bytes read.
+// - `error`: A possible read error (including `io.EOF`).
+func (pb *tPreloadBody) Read(aData []byte) (int, error) {
+	n, err := pb.ReadCloser.Read(aData)
+	if free := preloadScanSize - pb.buf.Len(); (0 < n) && (0 < free) {
+		if n < free {
+			free = n
+		}
+		pb.buf.Write(aData[:free])
+	}
+
+	return n, err
+} // Read()
+
+// `Close()` closes the wrapped body and stores the preload hints
+// found in the captured part of the page.
+//
+// Returns:
+// - `error`: A possible error closing the wrapped body.
+func (pb *tPreloadBody) Close() error {
+	pb.cache.store(pb.path, preloadLinks(pb.buf.Bytes()))
+
+	return pb.ReadCloser.Close()
+} // Close()
+
+// `preloadLinks()` returns the `Link` header values for the style
+// sheets and scripts referenced in `aPage`.
+//
+// Parameters:
+// - `aPage`: The (start of an) HTML page.
+//
+// Returns:
+// - `[]string`: The preload hints for the page's assets.
+func preloadLinks(aPage []byte) (rLinks []string) {
+	add := func(aURL, aType string) {
+		if ("" == aURL) || strings.HasPrefix(aURL, "data:") ||
+			(preloadMaxLinks <= len(rLinks)) {
+			return
+		}
+		rLinks = append(rLinks,
+			fmt.Sprintf("<%s>; rel=preload; as=%s", aURL, aType))
+	}
+
+	for _, match := range preloadStyleRE.FindAllSubmatch(aPage, -1) {
+		add(string(match[1])+string(match[2]), "style")
+	}
+	for _, match := range preloadScriptRE.FindAllSubmatch(aPage, -1) {
+		add(string(match[1]), "script")
+	}
+
+	return
+} // preloadLinks()
+
+// `preloadHints()` sends the cached preload hints for the requested
+// page as `103 Early Hints` to the client.
+//
+// Parameters:
+// - `aDestination`: The backend configuration of the requested host.
+// - `aWriter`: The `ResponseWriter` to write the hints to.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `*http.Request`: The request to forward to the backend.
+func preloadHints(aDestination *tDestination, aWriter http.ResponseWriter, aRequest *http.Request) *http.Request {
+	if (nil == aDestination.preload) || (http.MethodGet != aRequest.Method) {
+		return aRequest
+	}
+
+	path := aRequest.URL.Path
+	if links, _ := aDestination.preload.hints(path); 0 < len(links) {
+		header := aWriter.Header()
+		for _, link := range links {
+			header.Add("Link", link)
+		}
+		aWriter.WriteHeader(http.StatusEarlyHints)
+	}
+
+	// remember the original path since the backend's may differ:
+	return aRequest.WithContext(context.WithValue(aRequest.Context(),
+		tPreloadPathKey{}, path))
+} // preloadHints()
+
+// `preloadScan()` arranges for an HTML response to be scanned for
+// preloadable assets if the page's cached hints are missing or outdated.
+//
+// It's meant to be used as (part of) a proxy's `ModifyResponse` hook.
+//
+// Parameters:
+// - `aCache`: The host's preload hint cache.
+// - `aResponse`: The backend's response.
+func preloadScan(aCache *tPreloadCache, aResponse *http.Response) {
+	if (http.StatusOK != aResponse.StatusCode) ||
+		(http.MethodGet != aResponse.Request.Method) ||
+		("" != aResponse.Header.Get("Content-Encoding")) ||
+		!strings.HasPrefix(aResponse.Header.Get("Content-Type"), "text/html") {
+		return
+	}
+
+	path, ok := aResponse.Request.Context().Value(tPreloadPathKey{}).(string)
+	if !ok {
+		return
+	}
+	if _, outdated := aCache.hints(path); !outdated {
+		return
+	}
+	aResponse.Body = &tPreloadBody{
+		ReadCloser: aResponse.Body,
+		cache:      aCache,
+		path:       path,
+	}
+} // preloadScan()
+
+/* _EoF_ */
@@ -0,0 +1,104 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Longest time to wait for a pre-warming request:
+	prewarmTimeout = 10 * time.Second
+)
+
+// `goPrewarm()` opens the configured number of idle connections to
+// the backends of the hosts configured with `prewarm`, so the first
+// requests after a (re)load don't have to wait for connecting and TLS
+// handshakes.
+//
+// The method is meant to run in its own goroutine after each
+// configuration (re)load.
+func (ph *TProxyHandler) goPrewarm() {
+	type tWarm struct {
+		host      string
+		url       string
+		count     int
+		transport http.RoundTripper
+	}
+	var warm []tWarm
+
+	for host, dest := range ph.routes.Load().backendServers {
+		if 0 >= dest.prewarm {
+			continue
+		}
+		// wakes a hibernating host:
+		if proxy := dest.proxy(); nil != proxy {
+			url, _ := h2cURL(dest.destHost)
+			warm = append(warm, tWarm{host, url, dest.prewarm, proxy.Transport})
+		}
+	}
+
+	for _, w := range warm {
+		var (
+			failed atomic.Int32
+			wg     sync.WaitGroup
+		)
+		// concurrent requests need a connection each:
+		for range w.count {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := warmConnection(w.transport, w.url); nil != err {
+					failed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := failed.Load(); 0 < n {
+			logErr("ReProx/goPrewarm",
+				fmt.Sprintf("host %q: %d of %d connections failed", w.host, n, w.count))
+		}
+	}
+} // goPrewarm()
+
+// `warmConnection()` sends a `HEAD` request for `aURL` through
+// `aTransport`, leaving an idle connection behind.
+//
+// Parameters:
+// - `aTransport`: The transport of the host's reverse proxy.
+// - `aURL`: The backend's URL.
+//
+// Returns:
+// - `error`: A possible error of the request.
+func warmConnection(aTransport http.RoundTripper, aURL string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), prewarmTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, aURL, nil)
+	if nil != err {
+		return err
+	}
+	req.Header.Set("User-Agent", "reprox-prewarm")
+	resp, err := aTransport.RoundTrip(req)
+	if nil != err {
+		return err
+	}
+	// reading the (empty) body returns the connection to the pool:
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return resp.Body.Close()
+} // warmConnection()
+
+/* _EoF_ */
@@ -0,0 +1,158 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host anonymisation of the request data seen by access logs:
+	tLogPrivacy struct {
+		ipMode     string // how to anonymise client IPs (see below)
+		stripQuery bool   // whether to drop query strings
+	}
+)
+
+const (
+	// `AnonTruncate` zeroes the host part of client addresses (IPv4:
+	// last octet, IPv6: all but the first 48 bits).
+	AnonTruncate = "truncate"
+
+	// `AnonHash` replaces client addresses by a keyed hash which
+	// changes with every program start.
+	AnonHash = "hash"
+)
+
+var (
+	// Key for hashing client addresses (valid for the process lifetime):
+	gAnonKey = func() []byte {
+		result := make([]byte, 32)
+		_, _ = rand.Read(result)
+
+		return result
+	}()
+)
+
+// `anonymiseIP()` returns the anonymised form of the client address
+// `aIP` according to `aMode`.
+//
+// Parameters:
+// - `aIP`: The client's IP address.
+// - `aMode`: The anonymisation mode (`truncate` or `hash`).
+//
+// Returns:
+// - `string`: The anonymised address.
+func anonymiseIP(aIP, aMode string) string {
+	if AnonHash == aMode {
+		mac := hmac.New(sha256.New, gAnonKey)
+		mac.Write([]byte(aIP))
+
+		return hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+
+	ip := net.ParseIP(aIP)
+	if nil == ip {
+		return aIP
+	}
+	if ip4 := ip.To4(); nil != ip4 {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+} // anonymiseIP()
+
+// `remoteAddr()` returns the client address `aAddr` anonymised
+// according to the host's settings.
+//
+// Parameters:
+// - `aAddr`: The client's address (`IP:port`).
+//
+// Returns:
+// - `string`: The (anonymised) address.
+func (lp *tLogPrivacy) remoteAddr(aAddr string) string {
+	if (nil == lp) || ("" == lp.ipMode) {
+		return aAddr
+	}
+	ip, port, err := net.SplitHostPort(aAddr)
+	if nil != err {
+		ip, port = aAddr, "0"
+	}
+
+	return net.JoinHostPort(anonymiseIP(ip, lp.ipMode), port)
+} // remoteAddr()
+
+// `scrub()` anonymises the client address and query string of
+// `aRequest` according to the host's settings.
+//
+// It's meant to be called after the request was served, so access
+// loggers wrapping the proxy (e.g. `apachelogger` or `AccessLog()`)
+// record the anonymised values while the backend still got the
+// original ones.
+//
+// Parameters:
+// - `aRequest`: The served HTTP request.
+func (lp *tLogPrivacy) scrub(aRequest *http.Request) {
+	if nil == lp {
+		return
+	}
+
+	aRequest.RemoteAddr = lp.remoteAddr(aRequest.RemoteAddr)
+
+	if lp.stripQuery {
+		aRequest.URL.RawQuery = ""
+		aRequest.URL.ForceQuery = false
+		if idx := strings.IndexByte(aRequest.RequestURI, '?'); 0 <= idx {
+			aRequest.RequestURI = aRequest.RequestURI[:idx]
+		}
+	}
+} // scrub()
+
+// `readLogPrivacy()` reads the host's log anonymisation settings:
+//
+//	logAnonymiseIP = truncate
+//	logStripQuery = true
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tLogPrivacy`: The host's settings or `nil` if there are none.
+func readLogPrivacy(aIni *ini.TSectionList, aSection string) *tLogPrivacy {
+	result := &tLogPrivacy{}
+	if s, ok := hostString(aIni, aSection, "logAnonymiseIP"); ok {
+		switch s = strings.ToLower(strings.TrimSpace(s)); s {
+		case "", "none":
+		case AnonTruncate, AnonHash:
+			result.ipMode = s
+		default:
+			logErr("ReProx/readLogPrivacy",
+				fmt.Sprintf("[%s] logAnonymiseIP: invalid mode %q", aSection, s))
+		}
+	}
+	result.stripQuery, _ = hostBool(aIni, aSection, "logStripQuery")
+
+	if ("" == result.ipMode) && !result.stripQuery {
+		return nil
+	}
+
+	return result
+} // readLogPrivacy()
+
+/* _EoF_ */
@@ -0,0 +1,239 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+type (
+	// The user to run as (see `DropPrivileges()`):
+	tRunAs struct {
+		name     string
+		uid, gid int
+		keepBind bool // whether to keep `CAP_NET_BIND_SERVICE`
+	}
+)
+
+var (
+	// Whether the process switched to the `RunAsUser`:
+	gDropped atomic.Bool
+)
+
+// `ListenAndDrop()` binds listening sockets to all `aAddrs` (using
+// `CurrentSetup().Sockets`) and then drops the root privileges to the
+// configured `RunAsUser` and `RunAsGroup` (see `DropPrivileges()`),
+// jailing the process in the `Chroot` directory (if any) in between
+// (see `Jail()`).
+//
+// That way the program needs root privileges only to bind the
+// privileged ports (below 1024) at startup; everything read or
+// written afterwards (certificates generated later, logfiles, the
+// reloaded configuration) must be accessible to that user.
+//
+// Parameters:
+// - `aAddrs`: The addresses to listen at; an empty address is skipped.
+//
+// Returns:
+// - `[]net.Listener`: The bound sockets (`nil` for skipped addresses).
+// - `error`: A possible error binding a socket or dropping privileges.
+func ListenAndDrop(aAddrs ...string) ([]net.Listener, error) {
+	setup := CurrentSetup()
+	result := make([]net.Listener, len(aAddrs))
+	closeAll := func() {
+		for _, listener := range result {
+			if nil != listener {
+				_ = listener.Close()
+			}
+		}
+	}
+
+	for idx, addr := range aAddrs {
+		if "" == addr {
+			continue
+		}
+		listener, err := setup.Sockets.Listen(addr)
+		if nil != err {
+			closeAll()
+			return nil, fmt.Errorf("%s: %w", addr, err)
+		}
+		result[idx] = listener
+	}
+
+	// the user database isn't available inside the jail:
+	runAs, err := lookupRunAs(setup.RunAsUser, setup.RunAsGroup,
+		setup.KeepBindCap)
+	if nil == err {
+		if err = Jail(setup.Chroot); nil == err {
+			err = runAs.apply()
+		}
+	}
+	if nil != err {
+		closeAll()
+		return nil, err
+	}
+
+	return result, nil
+} // ListenAndDrop()
+
+// `DropPrivileges()` switches a process running as root to `aUser`
+// and `aGroup`, dropping all supplementary groups and capabilities –
+// except for `CAP_NET_BIND_SERVICE` (on Linux) if `aKeepBind` is set,
+// for binding privileged ports (below 1024) later on.
+//
+// Nothing is done if `aUser` is empty or the process doesn't run as
+// root.
+//
+// Parameters:
+// - `aUser`: The name or numeric ID of the user to run as.
+// - `aGroup`: The name or numeric ID of the group to run as (or empty
+// for the user's primary group).
+// - `aKeepBind`: Whether to keep the right to bind privileged ports.
+//
+// Returns:
+// - `error`: A possible error resolving the user or switching to it.
+func DropPrivileges(aUser, aGroup string, aKeepBind bool) error {
+	runAs, err := lookupRunAs(aUser, aGroup, aKeepBind)
+	if nil != err {
+		return err
+	}
+
+	return runAs.apply()
+} // DropPrivileges()
+
+// `LookupRunAs()` resolves the user and group to run as.
+//
+// Parameters:
+// - `aUser`: The name or numeric ID of the user.
+// - `aGroup`: The name or numeric ID of the group (or empty for the
+// user's primary group).
+//
+// Returns:
+// - `int`: The user's ID.
+// - `int`: The group's ID.
+// - `error`: A possible error resolving the user or group.
+func LookupRunAs(aUser, aGroup string) (int, int, error) {
+	runAs, err := resolveRunAs(aUser, aGroup)
+	if nil != err {
+		return -1, -1, err
+	}
+
+	return runAs.uid, runAs.gid, nil
+} // LookupRunAs()
+
+// `lookupRunAs()` resolves the user to run as.
+//
+// Parameters:
+// - `aUser`: The name or numeric ID of the user to run as.
+// - `aGroup`: The name or numeric ID of the group (or empty).
+// - `aKeepBind`: Whether to keep the right to bind privileged ports.
+//
+// Returns:
+// - `*tRunAs`: The user or `nil` if nothing is to be done.
+// - `error`: A possible error resolving the user.
+func lookupRunAs(aUser, aGroup string, aKeepBind bool) (*tRunAs, error) {
+	if ("" == aUser) || (0 != os.Geteuid()) {
+		return nil, nil
+	}
+
+	result, err := resolveRunAs(aUser, aGroup)
+	if nil != err {
+		return nil, err
+	}
+	if 0 == result.uid {
+		return nil, nil // stay root as requested
+	}
+	result.keepBind = aKeepBind
+
+	return result, nil
+} // lookupRunAs()
+
+// `resolveRunAs()` looks up the user and group in the system's
+// databases.
+//
+// Parameters:
+// - `aUser`: The name or numeric ID of the user.
+// - `aGroup`: The name or numeric ID of the group (or empty).
+//
+// Returns:
+// - `*tRunAs`: The user and group.
+// - `error`: A possible error resolving the user or group.
+func resolveRunAs(aUser, aGroup string) (*tRunAs, error) {
+	account, err := user.Lookup(aUser)
+	if nil != err {
+		if account, err = user.LookupId(aUser); nil != err {
+			return nil, fmt.Errorf("RunAsUser %q: %w", aUser, err)
+		}
+	}
+	result := &tRunAs{name: account.Username}
+	if result.uid, err = strconv.Atoi(account.Uid); nil != err {
+		return nil, fmt.Errorf("RunAsUser %q: %w", aUser, err)
+	}
+
+	gid := account.Gid
+	if "" != aGroup {
+		group, err := user.LookupGroup(aGroup)
+		if nil != err {
+			if group, err = user.LookupGroupId(aGroup); nil != err {
+				return nil, fmt.Errorf("RunAsGroup %q: %w", aGroup, err)
+			}
+		}
+		gid = group.Gid
+	}
+	if result.gid, err = strconv.Atoi(gid); nil != err {
+		return nil, fmt.Errorf("RunAsGroup %q: %w", aGroup, err)
+	}
+
+	return result, nil
+} // resolveRunAs()
+
+// `apply()` switches the process to the user.
+//
+// Returns:
+// - `error`: A possible error switching to the user.
+func (ra *tRunAs) apply() error {
+	if nil == ra {
+		return nil
+	}
+
+	// Where the capabilities can't be changed for all threads at
+	// once (in cgo builds) they're changed for this thread only;
+	// a thread keeping `CAP_NET_BIND_SERVICE` stays with its goroutine:
+	runtime.LockOSThread()
+	if !ra.keepBind {
+		defer runtime.UnlockOSThread()
+	}
+	if ra.keepBind {
+		if err := keepCapabilities(); nil != err {
+			return fmt.Errorf("PR_SET_KEEPCAPS: %w", err)
+		}
+	}
+	if err := switchUser(ra.uid, ra.gid); nil != err {
+		return err
+	}
+	// `setuid()` clears the permitted capabilities unless they were
+	// kept; make sure none but the wanted one are left over:
+	if err := dropCapabilities(ra.keepBind); nil != err {
+		return fmt.Errorf("capset: %w", err)
+	}
+	gDropped.Store(true)
+	logInfo("ReProx/DropPrivileges",
+		fmt.Sprintf("running as user %q (UID %d, GID %d, keep bind: %v)",
+			ra.name, ra.uid, ra.gid, ra.keepBind))
+
+	return nil
+} // apply()
+
+/* _EoF_ */
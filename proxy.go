@@ -10,17 +10,38 @@ package reprox
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-
-	"github.com/mwat56/apachelogger"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type (
 	// Page handler for proxy requests:
 	TProxyHandler struct {
+		sync.Mutex                             // guard of changes to `routes` and `smokeTests`
+		routes         atomic.Pointer[tRoutes] // current routing data
+		middleware     []TMiddleware           // global middleware (see `Use()`)
+		hostMiddleware map[string][]TMiddleware
+		hibernating    sync.Once       // starts `goHibernate()`
+		smokeTests     map[string]bool // running smoke tests (see `smokeKey()`)
+	}
+
+	// Routing data read by each request; it's never changed but
+	// replaced by a changed copy (see `update()`):
+	tRoutes struct {
 		backendServers tBackendServers
+		catchAll       string                  // (optional) host serving unknown hostnames
+		healthPath     string                  // (optional) path of the health check
+		strict         bool                    // whether to reject ambiguous requests
+		hostCheck      *tHostCheck             // (optional) `Host` header validation
+		trusted        []*net.IPNet            // (optional) trusted proxies' networks
+		chain          http.Handler            // global middleware chain
+		hostChains     map[string]http.Handler // per-host middleware chains
 	}
 )
 
@@ -33,6 +54,17 @@ type (
 // If an error occurs during the parsing of the target URL, the function
 // logs the error and exits the program.
 //
+// Interim (1xx) responses like `103 Early Hints` and HTTP trailers
+// are passed through to the client by `httputil.ReverseProxy`; the
+// `ModifyResponse` hook below doesn't compress, rewrite, or cache the
+// bodies of responses with trailers.
+// Upgraded connections (e.g. WebSockets) are passed through as well,
+// closed after the host's `wsIdleTimeout` without traffic.
+// Backend URLs with the `h2c` scheme are connected by HTTP/2 without
+// TLS, passing gRPC calls (streams and trailers) through end-to-end.
+// Backend errors are counted for the destination's configured
+// `hostName` (like its requests), whatever `Host` the client sent.
+//
 // Parameters:
 // - `aTarget` (tDestination): The URL struct representing the backend
 // server to which the requests will be forwarded.
@@ -48,49 +80,517 @@ func createReverseProxy(aDestination *tDestination) (*httputil.ReverseProxy, err
 	targetURL, err := url.ParseRequestURI(aDestination.destHost)
 	if nil != err {
 		msg := fmt.Sprintf("Internal Server Error [%s]", aDestination.destHost)
-		apachelogger.Err("ReProx/createReverseProxy", msg)
-		return nil, err
+		logErr("ReProx/createReverseProxy", msg)
+		return nil, fmt.Errorf("%w %q: %w", ErrInvalidTarget, aDestination.destHost, err)
+	}
+
+	isH2C := strings.EqualFold(schemeH2C, targetURL.Scheme)
+	if isH2C {
+		targetURL.Scheme = "http"
+	}
+	result := httputil.NewSingleHostReverseProxy(targetURL)
+	result.BufferPool = gBufferPool
+	result.FlushInterval = aDestination.flush
+	if isH2C {
+		result.Transport = h2cTransport(aDestination.transport)
+	} else if (0 < aDestination.hibernate) || (0 < len(aDestination.pins)) ||
+		(nil != aDestination.transport) || (0 < aDestination.prewarm) {
+		// use a private transport whose connections can be closed
+		// when the host goes to sleep, which checks the pins, and
+		// which is tuned for the backend:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if 0 < len(aDestination.pins) {
+			transport.TLSClientConfig = aDestination.pins.tlsConfig()
+		}
+		aDestination.transport.apply(transport)
+		if transport.MaxIdleConnsPerHost < aDestination.prewarm {
+			// keep the pre-warmed connections:
+			transport.MaxIdleConnsPerHost = aDestination.prewarm
+		}
+		result.Transport = transport
+	}
+	director, style := result.Director, aDestination.fwdStyle
+	reqHeaders, via := aDestination.reqHeaders, aDestination.via
+	debug, hostName := aDestination.debug, aDestination.hostName
+	result.Director = func(aRequest *http.Request) {
+		director(aRequest)
+		setForwarded(style, aRequest)
+		reqHeaders.apply(aRequest.Header)
+		via.add(aRequest.Header, aRequest.ProtoMajor, aRequest.ProtoMinor)
+		debug.dumpRequest(aRequest)
+	}
+	cache, resHeaders := aDestination.preload, aDestination.resHeaders
+	compression, respCache := aDestination.compress, aDestination.cache
+	cors, rewrite := aDestination.cors, aDestination.rewrite
+	csrf, wsIdle := aDestination.csrf, aDestination.wsIdle
+	result.ModifyResponse = func(aResponse *http.Response) error {
+		latencyStop(aResponse.Request, aResponse.StatusCode)
+		debug.dumpResponse(aResponse)
+		if http.StatusInternalServerError <= aResponse.StatusCode {
+			countError(hostName)
+		}
+		cors.inject(aResponse)
+		resHeaders.apply(aResponse.Header)
+		if http.StatusSwitchingProtocols == aResponse.StatusCode {
+			// the body is the upgraded connection (e.g. a WebSocket):
+			via.add(aResponse.Header, aResponse.ProtoMajor, aResponse.ProtoMinor)
+			upgraded(aResponse, wsIdle)
+			return nil
+		}
+		stripHopHeaders(aResponse.Header)
+		via.add(aResponse.Header, aResponse.ProtoMajor, aResponse.ProtoMinor)
+		if nil != cache {
+			preloadScan(cache, aResponse)
+		}
+		rewrite.rewrite(aResponse, hostName)
+		csrf.injectToken(aResponse)
+		compression.compress(aResponse)
+		if nil != respCache {
+			cacheCapture(respCache, aResponse)
+		}
+		return nil
+	}
+	result.ErrorHandler = func(aWriter http.ResponseWriter, aRequest *http.Request, aErr error) {
+		latencyStop(aRequest, 0)
+		countError(hostName)
+		logErr("ReProx/ErrorHandler",
+			fmt.Sprintf("%s: %v", aRequest.Host, aErr))
+		if isGRPC(aRequest) {
+			sendGRPCError(aWriter, grpcUnavailable, aErr.Error())
+			return
+		}
+		sendError(aWriter, aRequest, http.StatusText(http.StatusBadGateway),
+			http.StatusBadGateway)
 	}
 
-	return httputil.NewSingleHostReverseProxy(targetURL), nil
+	return result, nil
 } // createReverseProxy()
 
 // `ServeHTTP()` is the main entry point for the reverse proxy server.
 // It handles incoming HTTP requests and forwards them to the
 // appropriate backend server.
 //
+// Middleware registered by `Use()` is run before the backend server
+// is looked up; requests for the configured `HealthPath` are answered
+// directly. In `StrictParsing` mode ambiguous requests are refused
+// first; with `HostCheck` enabled so are requests for unknown hosts.
+// A panic while serving the request is recovered and answered by
+// `500 Internal Server Error` (see `recoverRequest()`).
+//
 // Parameters:
 // - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
 // - `aRequest`: The Request struct containing all the details of the
 // incoming HTTP request.
 func (ph *TProxyHandler) ServeHTTP(aWriter http.ResponseWriter, aRequest *http.Request) {
+	defer recoverRequest(aWriter, aRequest)
+
+	routes := ph.routes.Load()
+	chain, healthPath, strict := routes.chain, routes.healthPath, routes.strict
+	hostCheck, trusted := routes.hostCheck, routes.trusted
+
+	// Use the client address reported by trusted proxies.
+	if 0 < len(trusted) {
+		realClient(trusted, aRequest)
+	}
+
+	// Reject requests which backends might parse differently.
+	if strict && !ph.strictCheck(aRequest) {
+		secEvent(secBadRequest, 5, aRequest, "ambiguous request")
+		http.Error(aWriter, http.StatusText(http.StatusBadRequest),
+			http.StatusBadRequest)
+		return
+	}
+
+	// Answer health checks for all hostnames.
+	if ("" != healthPath) && (healthPath == aRequest.URL.Path) {
+		handleHealthz(aWriter, aRequest)
+		return
+	}
+	// Reject requests for hosts we don't serve.
+	if (nil != hostCheck) && !ph.checkHost(hostCheck, aRequest) {
+		secEvent(secBadHost, 5, aRequest, "unknown host or SNI mismatch")
+		hostCheck.reject(aWriter, aRequest)
+		return
+	}
+	if nil != chain {
+		chain.ServeHTTP(aWriter, aRequest)
+		return
+	}
+
+	ph.route(aWriter, aRequest)
+} // ServeHTTP()
+
+// `lookup()` returns the backend configuration for the host
+// requested by `aRequest`.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `string`: The (normalised) configured hostname.
+// - `tDestination`: The host's backend configuration.
+// - `bool`: `false` if there's no backend server for the host.
+func (ph *TProxyHandler) lookup(aRequest *http.Request) (string, tDestination, bool) {
+	host, routes := normaliseHost(aRequest.Host), ph.routes.Load()
+
+	target, ok := routes.backendServers[host]
+	if !ok && ("" != routes.catchAll) {
+		host = routes.catchAll
+		target, ok = routes.backendServers[host]
+	}
+
+	return host, target, ok
+} // lookup()
+
+// `notFound()` logs and answers a request for an unknown host.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func notFound(aWriter http.ResponseWriter, aRequest *http.Request) {
+	msg := fmt.Sprintf("Backend server %q not found", aRequest.Host)
+	logErr("ReProx/ServeHTTP", msg)
+	// If no backend server is found, send a 404 Not Found HTTP response
+	sendError(aWriter, aRequest, msg, http.StatusNotFound)
+} // notFound()
+
+// `route()` looks up the backend server for `aRequest` and forwards
+// the request to it, running the host's middleware (see `UseHost()`)
+// first.
+//
+// Once served, the request's client address and query string are
+// anonymised as configured for the host, before access loggers
+// wrapping the handler record them.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (ph *TProxyHandler) route(aWriter http.ResponseWriter, aRequest *http.Request) {
 	// Check if a backend server is available for the requested host.
-	target, ok := ph.backendServers[aRequest.Host]
+	host, target, ok := ph.lookup(aRequest)
 	if !ok {
-		msg := fmt.Sprintf("Backend server %q not found", aRequest.Host)
-		apachelogger.Err("ReProx/ServeHTTP", msg)
-		// If no backend server is found, send a 404 Not Found HTTP response
-		http.Error(aWriter, msg, http.StatusNotFound)
+		notFound(aWriter, aRequest)
 		return
 	}
+	// Anonymise what the access logs get to see.
+	defer target.privacy.scrub(aRequest)
 
-	// Create a new reverse proxy for the target backend server.
-	proxy, err := createReverseProxy(&target)
-	if nil != err {
-		// If an error occurs while creating the reverse proxy,
-		// send a 500 Internal Server Error HTTP response.
-		msg := "Internal Server Error"
-		// apachelogger.Err("ReProx/ServeHTTP", msg)
-		http.Error(aWriter, msg, http.StatusInternalServerError)
-		return // exit(err.Error())
+	if chain := ph.routes.Load().hostChains[host]; nil != chain {
+		chain.ServeHTTP(aWriter, aRequest)
+		return
+	}
+
+	ph.forward(host, &target, aWriter, aRequest)
+} // route()
+
+// `forward()` handles a request for the configured host `aHost`,
+// usually by forwarding it to the host's backend server.
+//
+// Parameters:
+// - `aHost`: The (normalised) configured hostname.
+// - `aTarget`: The host's backend configuration.
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func (ph *TProxyHandler) forward(aHost string, aTarget *tDestination, aWriter http.ResponseWriter, aRequest *http.Request) {
+	host, target := aHost, *aTarget
+	countRequest(host)
+	gInFlight.Add(1)
+	defer gInFlight.Add(-1)
+
+	// Shed load while the memory budget is exhausted.
+	if gMemBudget.refuse(target.lowPrio, aWriter, aRequest) {
+		return
+	}
+
+	// Refuse methods and URLs the backend isn't meant to see.
+	if target.reqPolicy.refuse(aWriter, aRequest) {
+		secEvent(secPolicy, 3, aRequest, "method or URL not allowed")
+		return
+	}
+
+	// Refuse clients with unwanted User-Agents.
+	if target.uaFilter.refuse(host, aWriter, aRequest) {
+		secEvent(secBlockedUA, 4, aRequest, "")
+		return
+	}
+
+	// Refuse clients with blocked TLS fingerprints.
+	if target.tlsBlock.refuse(aWriter, aRequest) {
+		secEvent(secBlockedTLS, 6, aRequest, "")
+		return
+	}
+
+	// Refuse clients sending more requests than allowed.
+	if !target.rateReject.isExempt(aRequest) && !target.clientRate.allow(aRequest) {
+		secEvent(secRateLimited, 3, aRequest, "client limit")
+		target.rateReject.send(aWriter)
+		return
+	}
+
+	// Challenge suspicious clients to prove they're browsers.
+	if target.challenge.check(aWriter, aRequest) {
+		return
+	}
+
+	// Refuse requests beyond the host's or the client's concurrency cap.
+	release, ok := target.concurrent.acquire(aRequest)
+	if !ok {
+		sendError(aWriter, aRequest, http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	// Send the maintenance page instead of forwarding the request.
+	if target.maintOn.Load() {
+		serveMaintenance(&target, aWriter, aRequest)
+		return
+	}
+
+	// Collect CSP violation reports instead of forwarding them.
+	if (nil != target.csp) && (target.csp.path == aRequest.URL.Path) {
+		target.csp.serve(host, aWriter, aRequest)
+		return
+	}
+
+	// Answer CORS preflights for backends which don't handle them.
+	if target.cors.preflight(aWriter, aRequest) {
+		return
+	}
+
+	// Check the client's credentials if the host requires them.
+	if (nil != target.basicAuth) && !target.basicAuth.check(aRequest) {
+		if _, _, ok := aRequest.BasicAuth(); ok {
+			secEvent(secAuthFailed, 5, aRequest, "invalid credentials")
+		}
+		target.basicAuth.challenge(aWriter)
+		return
+	}
+
+	// Check the request's signature if the host requires one.
+	if nil != target.signature {
+		if status := target.signature.verify(aRequest); 0 != status {
+			secEvent(secBadSignature, 6, aRequest, http.StatusText(status))
+			http.Error(aWriter, http.StatusText(status), status)
+			return
+		}
+	}
+
+	// Check the client's API key if the host requires one.
+	if 0 < len(target.apiKeys) {
+		if status := target.apiKeys.check(aRequest); http.StatusTooManyRequests == status {
+			secEvent(secRateLimited, 3, aRequest, "API key limit")
+			target.rateReject.send(aWriter)
+			return
+		} else if 0 != status {
+			secEvent(secAuthFailed, 5, aRequest, "invalid API key")
+			http.Error(aWriter, http.StatusText(status), status)
+			return
+		}
 	}
 
-	target.destProxy = proxy
-	ph.backendServers[aRequest.Host] = target
+	// Refuse state-changing requests without the client's CSRF token.
+	if aRequest = target.csrf.check(aWriter, aRequest); nil == aRequest {
+		return
+	}
+
+	// Send files of the host's static directory without the backend.
+	if target.static.serve(aWriter, aRequest) {
+		return
+	}
+
+	// Assign the request to a variant if the host runs an A/B test.
+	variant := target.abTest.assign(aWriter, aRequest)
+
+	// Send a cached response if there's a fresh one.
+	if aRequest = serveCached(host, &target, aWriter, aRequest); nil == aRequest {
+		return
+	}
+
+	// The reverse proxy was created with the configuration (or by
+	// the first request to a hibernating host, see `createProxies()`)
+	// unless the backend's URL is invalid.
+	proxy, backend := target.proxy(), backendState(target.destHost)
+	if nil == proxy {
+		sendError(aWriter, aRequest, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if vProxy, err := variant.reverseProxy(&target); nil != err {
+		sendError(aWriter, aRequest, "Internal Server Error", http.StatusInternalServerError)
+		return
+	} else if nil != vProxy {
+		// a draining variant's requests go to the host's backend:
+		if vBackend := backendState(variant.destURL); !vBackend.draining.Load() {
+			proxy, backend = vProxy, vBackend
+		}
+	}
+	// Refuse new requests for a draining backend.
+	if backend.draining.Load() {
+		aWriter.Header().Set("Retry-After", "10")
+		sendError(aWriter, aRequest, http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable)
+		return
+	}
+	if nil != target.lastUsed {
+		target.lastUsed.Store(time.Now().UnixNano())
+	}
+	sampleRequest(&target, aRequest)
+	aRequest = preloadHints(&target, aWriter, aRequest)
+	aRequest = latencyStart(host, target.slowAfter, aRequest)
+	if isUpgrade(aRequest) || isGRPC(aRequest) {
+		// switched connections and (streaming) gRPC calls mustn't
+		// be cut off by the server's timeouts:
+		prepareUpgrade(aWriter)
+	}
 
 	// Serve the incoming HTTP request using the reverse proxy.
-	proxy.ServeHTTP(aWriter, aRequest)
-} // ServeHTTP()
+	backend.serve(proxy, aWriter, aRequest)
+} // forward()
+
+// `HasHost()` checks whether `aName` is one of the configured
+// hostnames (regardless of any port given in the configuration).
+//
+// Parameters:
+// - `aName`: The hostname to check (e.g. a TLS client's SNI).
+//
+// Returns:
+// - `bool`: `true` if `aName` is configured.
+func (ph *TProxyHandler) HasHost(aName string) bool {
+	if aName = normaliseHost(aName); "" == aName {
+		return false
+	}
+
+	for host := range ph.routes.Load().backendServers {
+		if h, _, err := net.SplitHostPort(host); (nil == err) && (h == aName) {
+			return true
+		}
+		if host == aName {
+			return true
+		}
+	}
+
+	return false
+} // HasHost()
+
+// `reload()` replaces the list of backend servers by the one of the
+// new configuration `aNew`.
+//
+// The idle connections of the replaced proxies are closed; requests
+// still being served by them are finished.
+//
+// Parameters:
+// - `aOld`: The previous configuration (unused).
+// - `aNew`: The configuration just loaded.
+func (ph *TProxyHandler) reload(aOld, aNew *TSetup) {
+	var retired tBackendServers
+	servers := createProxies(*aNew.BackendList)
+	ph.update(func(aRoutes *tRoutes) {
+		retired = aRoutes.backendServers
+		retireCaches(aRoutes.backendServers, servers)
+		aRoutes.backendServers = servers
+		aRoutes.healthPath = aNew.HealthPath
+		aRoutes.strict = aNew.StrictParsing
+		aRoutes.hostCheck = newHostCheck(aNew)
+		aRoutes.trusted = aNew.TrustedProxies
+		gMemBudget.setup(aNew)
+		gErrorPages.setup(aNew)
+		aRoutes.catchAll = ""
+		if SNICatchAll == aNew.UnmatchedSNI {
+			aRoutes.catchAll = aNew.CatchAllHost
+		}
+	})
+	closeIdleProxies(retired)
+	goSafe("prewarm", false, ph.goPrewarm)
+	ph.startWorkers(servers)
+} // reload()
+
+// `startWorkers()` starts the background tasks needed by the hosts
+// `aServers`: a smoke test for each host configuring one (unless it's
+// running already) and – once – the check for hibernating hosts.
+//
+// Parameters:
+// - `aServers`: The hosts of the current configuration.
+func (ph *TProxyHandler) startWorkers(aServers tBackendServers) {
+	ph.Lock()
+	defer ph.Unlock()
+
+	for host, dest := range aServers {
+		if 0 < dest.hibernate {
+			ph.hibernating.Do(func() {
+				goSafe("hibernate", true, ph.goHibernate)
+			})
+		}
+		if "" == dest.smokePath {
+			continue
+		}
+		key := smokeKey(host, dest.smokePath, dest.smokeEvery)
+		if ph.smokeTests[key] {
+			continue
+		}
+		if nil == ph.smokeTests {
+			ph.smokeTests = make(map[string]bool)
+		}
+		ph.smokeTests[key] = true
+		goSafe("smoketest", true, func() {
+			ph.goSmokeTest(host, dest.smokePath, dest.smokeEvery)
+		})
+	}
+} // startWorkers()
+
+// `update()` replaces the routing data by a copy changed by `aChange`.
+//
+// Changes are serialised while requests keep reading the previous
+// data without any locking.
+//
+// Parameters:
+// - `aChange`: The function changing the copy (which must not
+// modify the maps of the copy but replace them).
+func (ph *TProxyHandler) update(aChange func(aRoutes *tRoutes)) {
+	ph.Lock()
+	defer ph.Unlock()
+
+	routes := *ph.routes.Load()
+	aChange(&routes)
+	ph.routes.Store(&routes)
+} // update()
+
+// `createProxies()` returns a copy of `aServers` with the reverse
+// proxies of all hosts (and of their A/B test variants) created, so
+// that requests never have to.
+//
+// Hosts configuring `hibernate` start asleep instead: their proxies
+// are created by the first request (see `tDestination.proxy()`).
+//
+// Parameters:
+// - `aServers`: The hosts of the configuration just loaded.
+//
+// Returns:
+// - `tBackendServers`: The hosts with their proxies.
+func createProxies(aServers tBackendServers) tBackendServers {
+	now := time.Now().UnixNano()
+	result := make(tBackendServers, len(aServers))
+	for host, dest := range aServers {
+		dest.hostName = host
+		if 0 < dest.hibernate {
+			if _, err := url.ParseRequestURI(dest.destHost); nil == err {
+				dest.lazyProxy = &tLazyProxy{}
+			}
+		} else if proxy, err := createReverseProxy(&dest); nil == err {
+			dest.destProxy = proxy
+			if nil != dest.abTest {
+				for _, variant := range dest.abTest.variants {
+					_, _ = variant.reverseProxy(&dest)
+				}
+			}
+		}
+		if nil != dest.lastUsed {
+			dest.lastUsed.Store(now)
+		}
+		result[host] = dest
+	}
+
+	return result
+} // createProxies()
 
 // `NewProxyHandler()` creates a new instance of TProxyHandler.
 // It initialises the internal backendServers map with the list of
@@ -99,9 +599,26 @@ func (ph *TProxyHandler) ServeHTTP(aWriter http.ResponseWriter, aRequest *http.R
 // Returns:
 // - *TProxyHandler: A pointer to a new instance of TProxyHandler.
 func NewProxyHandler() *TProxyHandler {
-	return &TProxyHandler{
-		backendServers: *AppSetup.BackendList,
+	setup := CurrentSetup()
+	routes := &tRoutes{
+		backendServers: createProxies(*setup.BackendList),
+		healthPath:     setup.HealthPath,
+		strict:         setup.StrictParsing,
+		hostCheck:      newHostCheck(setup),
+		trusted:        setup.TrustedProxies,
 	}
+	gErrorPages.setup(setup)
+	if SNICatchAll == setup.UnmatchedSNI {
+		routes.catchAll = setup.CatchAllHost
+	}
+	gMemBudget.setup(setup)
+	result := &TProxyHandler{}
+	result.routes.Store(routes)
+	OnReload(result.reload)
+	goSafe("prewarm", false, result.goPrewarm)
+	result.startWorkers(routes.backendServers)
+
+	return result
 } // NewProxyHandler()
 
 /* _EoF_ */
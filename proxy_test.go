@@ -0,0 +1,315 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	// Hostname the test proxies are configured for:
+	testHost = "example.com"
+)
+
+// `newTestProxy()` returns a proxy handler forwarding `testHost` to
+// `aBackendURL`, making its configuration the current one.
+//
+// Parameters:
+// - `tb`: The running test or benchmark.
+// - `aBackendURL`: The URL of the backend server.
+// - `aChange`: (optional) function changing the host's settings.
+//
+// Returns:
+// - `*TProxyHandler`: The new proxy handler.
+func newTestProxy(tb testing.TB, aBackendURL string, aChange func(*tDestination)) *TProxyHandler {
+	tb.Helper()
+
+	dest := newDestination(aBackendURL)
+	if nil != aChange {
+		aChange(&dest)
+	}
+	old := CurrentSetup()
+	tb.Cleanup(func() { gSetup.Store(old) })
+	gSetup.Store(&TSetup{
+		BackendList: &tBackendServers{testHost: dest},
+	})
+
+	return NewProxyHandler()
+} // newTestProxy()
+
+func TestTrailerPassthrough(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, "body")
+		w.Header().Set("X-Checksum", "abc")
+	}))
+	defer backend.Close()
+
+	for _, tc := range []struct {
+		name   string
+		change func(*tDestination)
+	}{
+		{"plain", nil},
+		{"cached", func(aDest *tDestination) {
+			aDest.cache = newResponseCache(1<<20, 1<<16, time.Minute)
+		}},
+		{"compressed", func(aDest *tDestination) {
+			aDest.compress = &tCompression{types: []string{"text/*"}}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			front := httptest.NewServer(newTestProxy(t, backend.URL, tc.change))
+			defer front.Close()
+
+			// twice, so a cached response would be served:
+			for range 2 {
+				req, _ := http.NewRequest(http.MethodGet, front.URL+"/", nil)
+				req.Host = testHost
+				resp, err := http.DefaultClient.Do(req)
+				if nil != err {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+				if "body" != string(body) {
+					t.Errorf("body = %q, want %q", body, "body")
+				}
+				if got := resp.Trailer.Get("X-Checksum"); "abc" != got {
+					t.Errorf("trailer X-Checksum = %q, want %q", got, "abc")
+				}
+			}
+		})
+	}
+} // TestTrailerPassthrough()
+
+func TestEarlyHintsPassthrough(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "page")
+	}))
+	defer backend.Close()
+	front := httptest.NewServer(newTestProxy(t, backend.URL, nil))
+	defer front.Close()
+
+	var hints []string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(aCode int, aHeader textproto.MIMEHeader) error {
+			if http.StatusEarlyHints == aCode {
+				hints = append(hints, aHeader.Values("Link")...)
+			}
+			return nil
+		},
+	}
+	req, _ := http.NewRequest(http.MethodGet, front.URL+"/", nil)
+	req.Host = testHost
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := http.DefaultClient.Do(req)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if http.StatusOK != resp.StatusCode {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if (1 != len(hints)) || !strings.Contains(hints[0], "/style.css") {
+		t.Errorf("103 Link headers = %q, want the preload of /style.css", hints)
+	}
+} // TestEarlyHintsPassthrough()
+
+func TestEarlyHintsNotCached(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Link", "</app.js>; rel=preload; as=script")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "page")
+	}))
+	defer backend.Close()
+	front := httptest.NewServer(newTestProxy(t, backend.URL, func(aDest *tDestination) {
+		aDest.cache = newResponseCache(1<<20, 1<<16, time.Minute)
+	}))
+	defer front.Close()
+
+	for range 2 {
+		req, _ := http.NewRequest(http.MethodGet, front.URL+"/", nil)
+		req.Host = testHost
+		resp, err := http.DefaultClient.Do(req)
+		if nil != err {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if (http.StatusOK != resp.StatusCode) || ("page" != string(body)) {
+			t.Errorf("got %d %q, want %d %q", resp.StatusCode, body, http.StatusOK, "page")
+		}
+	}
+	// the final response is cached, the interim one isn't replayed:
+	if n := calls.Load(); 1 != n {
+		t.Errorf("backend calls = %d, want 1", n)
+	}
+} // TestEarlyHintsNotCached()
+
+func TestCSRFTokenNotCached(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		_, _ = io.WriteString(w, `<form method="post"></form>`)
+	}))
+	defer backend.Close()
+	ph := newTestProxy(t, backend.URL, func(aDest *tDestination) {
+		aDest.cache = newResponseCache(1<<20, 1<<16, time.Minute)
+		aDest.csrf = &tCSRF{cookie: "__reprox_csrf", header: "X-CSRF-Token",
+			field: "csrf_token", inject: true}
+	})
+
+	for range 2 {
+		recorder := httptest.NewRecorder()
+		ph.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://"+testHost+"/", nil))
+		response := recorder.Result()
+		var token string
+		for _, cookie := range response.Cookies() {
+			if "__reprox_csrf" == cookie.Name {
+				token = cookie.Value
+			}
+		}
+		body, _ := io.ReadAll(response.Body)
+		if ("" == token) || !strings.Contains(string(body), `value="`+token+`"`) {
+			t.Errorf("form %q doesn't hold the client's token %q", body, token)
+		}
+		if cc := response.Header.Get("Cache-Control"); "private, max-age=60" != cc {
+			t.Errorf("Cache-Control = %q, want %q", cc, "private, max-age=60")
+		}
+	}
+} // TestCSRFTokenNotCached()
+
+func TestRewriteConfiguredHost(t *testing.T) {
+	var origin string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, `<a href="`+origin+`/page">`)
+	}))
+	defer backend.Close()
+	origin = backend.URL
+	ph := newTestProxy(t, backend.URL, func(aDest *tDestination) {
+		aDest.cache = newResponseCache(1<<20, 1<<16, time.Minute)
+		aDest.rewrite = &tBodyRewrite{origin: backend.URL, types: rewriteDefaultTypes}
+	})
+
+	for _, host := range []string{"Example.COM.", testHost} {
+		request := httptest.NewRequest(http.MethodGet, "http://"+testHost+"/", nil)
+		request.Host = host
+		recorder := httptest.NewRecorder()
+		ph.ServeHTTP(recorder, request)
+		if body, want := recorder.Body.String(), `<a href="http://`+testHost+`/page">`; want != body {
+			t.Errorf("Host %q: got %q, want %q", host, body, want)
+		}
+	}
+} // TestRewriteConfiguredHost()
+
+func TestErrorsCountedForConfiguredHost(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer backend.Close()
+	ph := newTestProxy(t, backend.URL, nil)
+	stats := hostStats(testHost)
+	requests, errors := stats.requests.Load(), stats.errors.Load()
+
+	hosts := []string{"EXAMPLE.com", "eXample.com", "Example.Com."}
+	for _, host := range hosts {
+		request := httptest.NewRequest(http.MethodGet, "http://"+testHost+"/", nil)
+		request.Host = host
+		ph.ServeHTTP(httptest.NewRecorder(), request)
+		if _, ok := gStats.Load(host); ok {
+			t.Errorf("counters created for %q", host)
+		}
+	}
+	if got := stats.requests.Load() - requests; uint64(len(hosts)) != got {
+		t.Errorf("requests = %d, want %d", got, len(hosts))
+	}
+	if got := stats.errors.Load() - errors; uint64(len(hosts)) != got {
+		t.Errorf("errors = %d, want %d", got, len(hosts))
+	}
+} // TestErrorsCountedForConfiguredHost()
+
+func TestHibernatingProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	ph := newTestProxy(t, backend.URL, func(aDest *tDestination) {
+		aDest.hibernate, aDest.lastUsed = time.Minute, &atomic.Int64{}
+	})
+	dest := ph.routes.Load().backendServers[testHost]
+	if (nil != dest.destProxy) || (nil == dest.lazyProxy) || (nil != dest.lazyProxy.Load()) {
+		t.Fatal("hibernating host's proxy created with the configuration")
+	}
+
+	for range 2 {
+		recorder := httptest.NewRecorder()
+		ph.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://"+testHost+"/", nil))
+		if body := recorder.Body.String(); "ok" != body {
+			t.Fatalf("got %q, want %q", body, "ok")
+		}
+		if nil == dest.lazyProxy.Load() {
+			t.Fatal("proxy not created by the request")
+		}
+		dest.lazyProxy.Swap(nil) // as done by `goHibernate()`
+	}
+} // TestHibernatingProxy()
+
+func BenchmarkServeHTTP(b *testing.B) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	proxy := newTestProxy(b, backend.URL, nil)
+	req := httptest.NewRequest(http.MethodGet, "http://"+testHost+"/", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		proxy.ServeHTTP(&tDiscardWriter{header: make(http.Header)}, req)
+	}
+} // BenchmarkServeHTTP()
+
+func BenchmarkDirector(b *testing.B) {
+	ph := newTestProxy(b, "http://127.0.0.1:8080", nil)
+	proxy := ph.routes.Load().backendServers[testHost].destProxy
+	if nil == proxy {
+		b.Fatal("no reverse proxy created")
+	}
+	in := httptest.NewRequest(http.MethodGet, "http://"+testHost+"/path?q=1", nil)
+	in.Header.Set("X-Forwarded-For", "192.0.2.1")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		req := in.Clone(in.Context())
+		proxy.Director(req)
+	}
+} // BenchmarkDirector()
+
+/* _EoF_ */
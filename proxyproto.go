@@ -0,0 +1,255 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Listener reading the PROXY protocol header sent by trusted
+	// load balancers:
+	tProxyProtoListener struct {
+		net.Listener
+		trusted []*net.IPNet
+	}
+
+	// Connection whose addresses are taken from its PROXY protocol header:
+	tProxyProtoConn struct {
+		net.Conn
+		once    sync.Once
+		trusted []*net.IPNet
+		reader  *bufio.Reader
+		remote  net.Addr // the client's address
+		local   net.Addr // the address the client connected to
+		err     error    // error reading the header
+	}
+)
+
+const (
+	// Longest time to wait for the PROXY protocol header:
+	proxyProtoTimeout = 5 * time.Second
+
+	// Longest header of PROXY protocol version 1:
+	proxyProtoV1Max = 107
+)
+
+var (
+	// Signature of PROXY protocol version 2 headers:
+	proxyProtoV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// `ErrProxyProtocol` is returned reading from a connection whose
+	// PROXY protocol header is missing or invalid.
+	ErrProxyProtocol = errors.New("invalid PROXY protocol header")
+)
+
+// `ProxyProtocolListener()` wraps `aListener` to read the PROXY
+// protocol header (version 1 or 2) of connections from the `aTrusted`
+// load balancers, whose `RemoteAddr()` then is the client's address;
+// connections from other addresses are used as they are.
+//
+// Parameters:
+// - `aListener`: The listener to wrap.
+// - `aTrusted`: The networks of the load balancers sending the header.
+//
+// Returns:
+// - `net.Listener`: The wrapped listener (or `aListener` if `aTrusted`
+// is empty).
+func ProxyProtocolListener(aListener net.Listener, aTrusted []*net.IPNet) net.Listener {
+	if 0 == len(aTrusted) {
+		return aListener
+	}
+
+	return tProxyProtoListener{Listener: aListener, trusted: aTrusted}
+} // ProxyProtocolListener()
+
+// `Accept()` waits for the next connection; its header is read by the
+// connection's first `Read()` or `RemoteAddr()` call so that a slow
+// client doesn't block the listener.
+//
+// Returns:
+// - `net.Conn`: The accepted connection.
+// - `error`: A possible error accepting the connection.
+func (pl tProxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := pl.Listener.Accept()
+	if nil != err {
+		return nil, err
+	}
+
+	return &tProxyProtoConn{Conn: conn, trusted: pl.trusted}, nil
+} // Accept()
+
+// `init()` reads the connection's PROXY protocol header once, if the
+// peer is trusted.
+func (pc *tProxyProtoConn) init() {
+	pc.once.Do(func() {
+		if tcp, ok := pc.Conn.RemoteAddr().(*net.TCPAddr); !ok || !inNetworks(tcp.IP, pc.trusted) {
+			return
+		}
+		pc.reader = bufio.NewReader(pc.Conn)
+		_ = pc.Conn.SetReadDeadline(time.Now().Add(proxyProtoTimeout))
+		pc.remote, pc.local, pc.err = readProxyHeader(pc.reader)
+		_ = pc.Conn.SetReadDeadline(time.Time{})
+		if nil != pc.err {
+			logErr("ReProx/ProxyProtocol",
+				fmt.Sprintf("%s: %v", pc.Conn.RemoteAddr(), pc.err))
+		}
+	})
+} // init()
+
+// `Read()` reads from the connection after its header.
+func (pc *tProxyProtoConn) Read(aData []byte) (int, error) {
+	pc.init()
+	if nil != pc.err {
+		return 0, pc.err
+	}
+	if nil != pc.reader {
+		return pc.reader.Read(aData)
+	}
+
+	return pc.Conn.Read(aData)
+} // Read()
+
+// `RemoteAddr()` returns the client's address.
+func (pc *tProxyProtoConn) RemoteAddr() net.Addr {
+	pc.init()
+	if nil != pc.remote {
+		return pc.remote
+	}
+
+	return pc.Conn.RemoteAddr()
+} // RemoteAddr()
+
+// `LocalAddr()` returns the address the client connected to.
+func (pc *tProxyProtoConn) LocalAddr() net.Addr {
+	pc.init()
+	if nil != pc.local {
+		return pc.local
+	}
+
+	return pc.Conn.LocalAddr()
+} // LocalAddr()
+
+// `readProxyHeader()` reads a PROXY protocol header of version 1
+// or 2 from `aReader`.
+//
+// Parameters:
+// - `aReader`: The connection's reader.
+//
+// Returns:
+// - `net.Addr`: The client's address (`nil` for `LOCAL`/`UNKNOWN`).
+// - `net.Addr`: The address the client connected to.
+// - `error`: `ErrProxyProtocol` if the header is invalid.
+func readProxyHeader(aReader *bufio.Reader) (net.Addr, net.Addr, error) {
+	start, err := aReader.Peek(len(proxyProtoV2Sig))
+	if nil != err {
+		return nil, nil, fmt.Errorf("%w: %v", ErrProxyProtocol, err)
+	}
+	if bytes.Equal(start, proxyProtoV2Sig) {
+		return readProxyHeaderV2(aReader)
+	}
+	if !bytes.HasPrefix(start, []byte("PROXY ")) {
+		return nil, nil, ErrProxyProtocol
+	}
+
+	// version 1: `PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n`
+	var line []byte
+	for {
+		b, err := aReader.ReadByte()
+		if nil != err {
+			return nil, nil, fmt.Errorf("%w: %v", ErrProxyProtocol, err)
+		}
+		if line = append(line, b); '\n' == b {
+			break
+		}
+		if proxyProtoV1Max <= len(line) {
+			return nil, nil, ErrProxyProtocol
+		}
+	}
+	fields := strings.Fields(strings.TrimSuffix(string(line), "\r\n"))
+	if (2 <= len(fields)) && ("UNKNOWN" == fields[1]) {
+		return nil, nil, nil
+	}
+	if (6 != len(fields)) || (("TCP4" != fields[1]) && ("TCP6" != fields[1])) {
+		return nil, nil, ErrProxyProtocol
+	}
+	src, dst := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if (nil == src) || (nil == dst) || (nil != err1) || (nil != err2) {
+		return nil, nil, ErrProxyProtocol
+	}
+
+	return &net.TCPAddr{IP: src, Port: int(srcPort)},
+		&net.TCPAddr{IP: dst, Port: int(dstPort)}, nil
+} // readProxyHeader()
+
+// `readProxyHeaderV2()` reads a binary PROXY protocol header.
+//
+// Parameters:
+// - `aReader`: The connection's reader.
+//
+// Returns:
+// - `net.Addr`: The client's address (`nil` for `LOCAL` or other
+// address families).
+// - `net.Addr`: The address the client connected to.
+// - `error`: `ErrProxyProtocol` if the header is invalid.
+func readProxyHeaderV2(aReader *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, len(proxyProtoV2Sig)+4)
+	if _, err := io.ReadFull(aReader, header); nil != err {
+		return nil, nil, fmt.Errorf("%w: %v", ErrProxyProtocol, err)
+	}
+	verCmd, family := header[12], header[13]
+	data := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(aReader, data); nil != err {
+		return nil, nil, fmt.Errorf("%w: %v", ErrProxyProtocol, err)
+	}
+	if 0x20 != (verCmd & 0xF0) {
+		return nil, nil, ErrProxyProtocol
+	}
+	switch verCmd & 0x0F {
+	case 0x00: // LOCAL (e.g. health checks)
+		return nil, nil, nil
+	case 0x01: // PROXY
+	default:
+		return nil, nil, ErrProxyProtocol
+	}
+
+	var size int
+	switch family >> 4 {
+	case 0x01: // AF_INET
+		size = net.IPv4len
+	case 0x02: // AF_INET6
+		size = net.IPv6len
+	default:
+		return nil, nil, nil
+	}
+	if len(data) < (size<<1)+4 {
+		return nil, nil, ErrProxyProtocol
+	}
+	src := net.IP(data[:size])
+	dst := net.IP(data[size : size<<1])
+	srcPort := binary.BigEndian.Uint16(data[size<<1:])
+	dstPort := binary.BigEndian.Uint16(data[(size<<1)+2:])
+
+	return &net.TCPAddr{IP: src, Port: int(srcPort)},
+		&net.TCPAddr{IP: dst, Port: int(dstPort)}, nil
+} // readProxyHeaderV2()
+
+/* _EoF_ */
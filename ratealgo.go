@@ -0,0 +1,322 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Common interface of the rate limiting algorithms:
+	tLimiter interface {
+		// `allow()` checks whether another request is allowed.
+		allow() bool
+
+		// `idle()` checks whether the limiter is back to its initial
+		// state at `aNow` (so it can be dropped).
+		idle(aNow time.Time) bool
+
+		// `save()` returns the limiter's state (see `SaveRateState()`).
+		save() tLimiterState
+
+		// `restore()` sets the limiter's state saved by `save()`.
+		restore(aState tLimiterState)
+	}
+
+	// Sliding window counter, weighting the previous window's count
+	// by its overlap with the sliding window:
+	tSlidingWindow struct {
+		sync.Mutex
+		limit  int           // allowed requests per window
+		length time.Duration // length of a window
+		start  time.Time     // start of the current window
+		count  int           // number of requests in the current window
+		prev   int           // number of requests in the previous window
+		stats  *tRateStats   // decisions made (kept across reloads)
+	}
+
+	// Token bucket, refilled at `limit` tokens per window and holding
+	// at most `burst` tokens:
+	tTokenBucket struct {
+		sync.Mutex
+		rate   float64     // tokens added per second
+		burst  float64     // capacity of the bucket
+		tokens float64     // tokens currently available
+		last   time.Time   // time of the last refill
+		stats  *tRateStats // decisions made (kept across reloads)
+	}
+
+	// Leaky bucket queue, passing requests on at an even pace and
+	// delaying up to `burst` requests waiting for their turn:
+	tLeakyBucket struct {
+		sync.Mutex
+		interval time.Duration // time between two requests
+		maxWait  time.Duration // longest delay allowed
+		next     time.Time     // time the next request may pass
+		stats    *tRateStats   // decisions made (kept across reloads)
+	}
+)
+
+const (
+	// `RateFixed` counts requests in fixed windows (the default).
+	RateFixed = "fixed"
+
+	// `RateSliding` counts requests in a window sliding with time.
+	RateSliding = "sliding"
+
+	// `RateToken` uses a token bucket allowing bursts of requests.
+	RateToken = "token"
+
+	// `RateLeaky` delays requests to pass them on at an even pace.
+	RateLeaky = "leaky"
+)
+
+// `newLimiter()` returns a rate limiter of the algorithm `aAlgorithm`
+// allowing `aLimit` requests per `aLength`.
+//
+// Parameters:
+// - `aAlgorithm`: The algorithm to use (`fixed`, `sliding`, `token`,
+// or `leaky`).
+// - `aLimit`: The number of requests allowed per window (`0`: unlimited
+// whatever the algorithm).
+// - `aLength`: The length of a window.
+// - `aBurst`: The size of bursts allowed by `token` and `leaky`
+// (`0`: same as `aLimit`).
+// - `aStats`: The counters of the limiter's decisions.
+//
+// Returns:
+// - `tLimiter`: The new limiter.
+func newLimiter(aAlgorithm string, aLimit int, aLength time.Duration, aBurst int, aStats *tRateStats) tLimiter {
+	if 0 >= aLimit {
+		// a fixed window without a limit allows all requests:
+		aAlgorithm = RateFixed
+	}
+	if 0 >= aBurst {
+		aBurst = aLimit
+	}
+
+	switch aAlgorithm {
+	case RateSliding:
+		return &tSlidingWindow{
+			limit:  aLimit,
+			length: aLength,
+			stats:  aStats,
+		}
+
+	case RateToken:
+		return &tTokenBucket{
+			rate:   float64(aLimit) / aLength.Seconds(),
+			burst:  float64(aBurst),
+			tokens: float64(aBurst),
+			last:   time.Now(),
+			stats:  aStats,
+		}
+
+	case RateLeaky:
+		interval := aLength / time.Duration(max(aLimit, 1))
+		return &tLeakyBucket{
+			interval: interval,
+			maxWait:  interval * time.Duration(aBurst),
+			stats:    aStats,
+		}
+	}
+
+	return &tRateWindow{
+		limit:  aLimit,
+		length: aLength,
+		stats:  aStats,
+	}
+} // newLimiter()
+
+// `parseRateAlgorithm()` checks the configured algorithm `aValue`.
+//
+// Parameters:
+// - `aSection`: The name of the INI section (for error messages).
+// - `aValue`: The configured algorithm.
+//
+// Returns:
+// - `string`: The algorithm's name (`fixed` if `aValue` is invalid).
+func parseRateAlgorithm(aSection, aValue string) string {
+	switch s := strings.ToLower(strings.TrimSpace(aValue)); s {
+	case RateFixed, RateSliding, RateToken, RateLeaky:
+		return s
+	case "":
+	default:
+		logErr("ReProx/parseRateAlgorithm",
+			fmt.Sprintf("[%s] invalid rate limit algorithm %q", aSection, s))
+	}
+
+	return RateFixed
+} // parseRateAlgorithm()
+
+// `count()` records a decision and returns it.
+//
+// Parameters:
+// - `aAllowed`: Whether the request is allowed.
+//
+// Returns:
+// - `bool`: `aAllowed`.
+func (rs *tRateStats) count(aAllowed bool) bool {
+	if aAllowed {
+		rs.allowed.Add(1)
+	} else {
+		rs.limited.Add(1)
+	}
+
+	return aAllowed
+} // count()
+
+// `allow()` checks whether another request is allowed within the
+// window ending now.
+//
+// Returns:
+// - `bool`: `true` if the request is within the limit.
+func (sw *tSlidingWindow) allow() bool {
+	sw.Lock()
+	defer sw.Unlock()
+
+	now := time.Now()
+	if elapsed := now.Sub(sw.start); sw.length <= elapsed {
+		sw.prev = sw.count
+		if (sw.length << 1) <= elapsed {
+			sw.prev = 0
+		}
+		sw.start, sw.count = now.Truncate(sw.length), 0
+	}
+	overlap := 1 - float64(now.Sub(sw.start))/float64(sw.length)
+	if float64(sw.limit) <= float64(sw.prev)*overlap+float64(sw.count) {
+		return sw.stats.count(false)
+	}
+	sw.count++
+
+	return sw.stats.count(true)
+} // allow()
+
+// `idle()` checks whether no requests were counted in the last two
+// windows.
+func (sw *tSlidingWindow) idle(aNow time.Time) bool {
+	sw.Lock()
+	defer sw.Unlock()
+
+	return (sw.length << 1) <= aNow.Sub(sw.start)
+} // idle()
+
+// `allow()` takes a token from the bucket if there's one.
+//
+// Returns:
+// - `bool`: `true` if the request is within the limit.
+func (tb *tTokenBucket) allow() bool {
+	tb.Lock()
+	defer tb.Unlock()
+
+	now := time.Now()
+	tb.tokens = min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+	if 1 > tb.tokens {
+		return tb.stats.count(false)
+	}
+	tb.tokens--
+
+	return tb.stats.count(true)
+} // allow()
+
+// `idle()` checks whether the bucket is full again.
+func (tb *tTokenBucket) idle(aNow time.Time) bool {
+	tb.Lock()
+	defer tb.Unlock()
+
+	return tb.burst <= tb.tokens+aNow.Sub(tb.last).Seconds()*tb.rate
+} // idle()
+
+// `allow()` waits for the request's turn, refusing it if the wait
+// would exceed the bucket's capacity.
+//
+// Returns:
+// - `bool`: `true` if the request may pass (after the delay).
+func (lb *tLeakyBucket) allow() bool {
+	lb.Lock()
+	now := time.Now()
+	if lb.next.Before(now) {
+		lb.next = now
+	}
+	wait := lb.next.Sub(now)
+	if lb.maxWait < wait {
+		lb.Unlock()
+		return lb.stats.count(false)
+	}
+	lb.next = lb.next.Add(lb.interval)
+	lb.Unlock()
+
+	if 0 < wait {
+		time.Sleep(wait)
+	}
+
+	return lb.stats.count(true)
+} // allow()
+
+// `idle()` checks whether no requests are waiting.
+func (lb *tLeakyBucket) idle(aNow time.Time) bool {
+	lb.Lock()
+	defer lb.Unlock()
+
+	return !lb.next.After(aNow)
+} // idle()
+
+// `save()` returns the counts of the current and previous window.
+func (sw *tSlidingWindow) save() tLimiterState {
+	sw.Lock()
+	defer sw.Unlock()
+
+	return tLimiterState{Start: sw.start, Count: sw.count, Prev: sw.prev}
+} // save()
+
+// `restore()` sets the counts of the current and previous window.
+func (sw *tSlidingWindow) restore(aState tLimiterState) {
+	sw.Lock()
+	defer sw.Unlock()
+
+	sw.start, sw.count, sw.prev = aState.Start, aState.Count, aState.Prev
+} // restore()
+
+// `save()` returns the bucket's tokens.
+func (tb *tTokenBucket) save() tLimiterState {
+	tb.Lock()
+	defer tb.Unlock()
+
+	return tLimiterState{Start: tb.last, Tokens: tb.tokens}
+} // save()
+
+// `restore()` sets the bucket's tokens (at most its capacity).
+func (tb *tTokenBucket) restore(aState tLimiterState) {
+	tb.Lock()
+	defer tb.Unlock()
+
+	tb.last, tb.tokens = aState.Start, min(tb.burst, aState.Tokens)
+} // restore()
+
+// `save()` returns the time the next request may pass.
+func (lb *tLeakyBucket) save() tLimiterState {
+	lb.Lock()
+	defer lb.Unlock()
+
+	return tLimiterState{Start: lb.next}
+} // save()
+
+// `restore()` sets the time the next request may pass.
+func (lb *tLeakyBucket) restore(aState tLimiterState) {
+	lb.Lock()
+	defer lb.Unlock()
+
+	lb.next = aState.Start
+} // restore()
+
+/* _EoF_ */
@@ -0,0 +1,28 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZeroLimitUnlimited(t *testing.T) {
+	for _, algo := range []string{RateFixed, RateSliding, RateToken, RateLeaky} {
+		limiter := newLimiter(algo, 0, time.Minute, 0, &tRateStats{})
+		for idx := range 100 {
+			if !limiter.allow() {
+				t.Errorf("%s: request %d refused without a limit", algo, idx)
+				break
+			}
+		}
+	}
+} // TestZeroLimitUnlimited()
+
+/* _EoF_ */
@@ -0,0 +1,169 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Simple fixed-window request counter:
+	tRateWindow struct {
+		sync.Mutex
+		limit  int           // allowed requests per window (0: unlimited)
+		length time.Duration // length of a window
+		start  time.Time     // start of the current window
+		count  int           // number of requests in the current window
+		stats  *tRateStats   // decisions made (kept across reloads)
+	}
+
+	// Decisions of a named rate limiter:
+	tRateStats struct {
+		allowed atomic.Uint64
+		limited atomic.Uint64
+		limit   atomic.Int64 // the limiter's current limit
+		length  atomic.Int64 // the limiter's current window length
+	}
+
+	// `TRateLimitReport` holds the counters of a rate limiter.
+	TRateLimitReport struct {
+		Limit   int64  `json:"limit"` // 0: unlimited
+		Window  string `json:"window"`
+		Allowed uint64 `json:"allowed"`
+		Limited uint64 `json:"limited"`
+	}
+)
+
+var (
+	// Rate limiter counters by name (`string` -> `*tRateStats`):
+	gRateStats sync.Map
+)
+
+// `newRateWindow()` returns a counter allowing `aLimit` requests
+// per `aLength`.
+//
+// The limiter's decisions are counted under `aName`; the counters
+// survive configuration reloads (see `RateLimitReports()`).
+//
+// Parameters:
+// - `aName`: The name to report the limiter's counters under.
+// - `aLimit`: The number of requests allowed per window.
+// - `aLength`: The length of a window.
+//
+// Returns:
+// - `*tRateWindow`: The new counter.
+func newRateWindow(aName string, aLimit int, aLength time.Duration) *tRateWindow {
+	return &tRateWindow{
+		limit:  aLimit,
+		length: aLength,
+		stats:  rateStats(aName, aLimit, aLength),
+	}
+} // newRateWindow()
+
+// `rateStats()` returns the counters of the rate limiter(s) `aName`.
+//
+// Parameters:
+// - `aName`: The name to report the counters under.
+// - `aLimit`: The number of requests allowed per window.
+// - `aLength`: The length of a window.
+//
+// Returns:
+// - `*tRateStats`: The limiter's counters.
+func rateStats(aName string, aLimit int, aLength time.Duration) *tRateStats {
+	value, _ := gRateStats.LoadOrStore(aName, &tRateStats{})
+	result := value.(*tRateStats)
+	result.limit.Store(int64(aLimit))
+	result.length.Store(int64(aLength))
+
+	return result
+} // rateStats()
+
+// `allow()` checks whether another request is allowed within the
+// current window.
+//
+// Returns:
+// - `bool`: `true` if the request is within the limit.
+func (rw *tRateWindow) allow() bool {
+	if 0 >= rw.limit {
+		return rw.stats.count(true)
+	}
+
+	rw.Lock()
+	defer rw.Unlock()
+
+	now := time.Now()
+	if rw.length <= now.Sub(rw.start) {
+		rw.start, rw.count = now, 0
+	}
+	rw.count++
+
+	return rw.stats.count(rw.count <= rw.limit)
+} // allow()
+
+// `idle()` checks whether the current window is over.
+func (rw *tRateWindow) idle(aNow time.Time) bool {
+	rw.Lock()
+	defer rw.Unlock()
+
+	return rw.length <= aNow.Sub(rw.start)
+} // idle()
+
+// `save()` returns the count of the current window.
+func (rw *tRateWindow) save() tLimiterState {
+	rw.Lock()
+	defer rw.Unlock()
+
+	return tLimiterState{Start: rw.start, Count: rw.count}
+} // save()
+
+// `restore()` sets the count of the current window.
+func (rw *tRateWindow) restore(aState tLimiterState) {
+	rw.Lock()
+	defer rw.Unlock()
+
+	rw.start, rw.count = aState.Start, aState.Count
+} // restore()
+
+// `RateLimitReports()` returns a snapshot of the counters of all rate
+// limiters (API keys as `apiKey:<name>`, CSP report collectors as
+// `csp:<host>`, and the per-client limits of a host as `client:<host>`).
+//
+// Returns:
+// - `map[string]TRateLimitReport`: The counters by limiter name.
+func RateLimitReports() map[string]TRateLimitReport {
+	result := make(map[string]TRateLimitReport)
+	gRateStats.Range(func(aKey, aValue any) bool {
+		rs := aValue.(*tRateStats)
+		result[aKey.(string)] = TRateLimitReport{
+			Limit:   rs.limit.Load(),
+			Window:  time.Duration(rs.length.Load()).String(),
+			Allowed: rs.allowed.Load(),
+			Limited: rs.limited.Load(),
+		}
+		return true
+	})
+
+	return result
+} // RateLimitReports()
+
+// `handleRateLimits()` sends the counters of all rate limiters as JSON.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func handleRateLimits(aWriter http.ResponseWriter, aRequest *http.Request) {
+	aWriter.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(aWriter).Encode(RateLimitReports())
+} // handleRateLimits()
+
+/* _EoF_ */
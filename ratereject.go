@@ -0,0 +1,159 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host response to requests refused by a rate limit:
+	tRateReject struct {
+		status     int           // HTTP status to send
+		retryAfter time.Duration // (optional) value of `Retry-After`
+		format     string        // body format: `text`, `json`, or `html`
+		exempt     []string      // path prefixes not rate limited
+	}
+)
+
+// `isExempt()` checks whether `aRequest` is exempt from rate limits.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the request's path is an exempt one.
+func (rr *tRateReject) isExempt(aRequest *http.Request) bool {
+	if nil == rr {
+		return false
+	}
+	for _, prefix := range rr.exempt {
+		if strings.HasPrefix(aRequest.URL.Path, prefix) {
+			return true
+		}
+	}
+
+	return false
+} // isExempt()
+
+// `send()` answers a request refused by a rate limit.
+//
+// Without host specific settings a plain `429 Too Many Requests` is sent.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+func (rr *tRateReject) send(aWriter http.ResponseWriter) {
+	if nil == rr {
+		http.Error(aWriter, http.StatusText(http.StatusTooManyRequests),
+			http.StatusTooManyRequests)
+		return
+	}
+
+	header := aWriter.Header()
+	header.Set("Cache-Control", "no-store")
+	retry := ""
+	if 0 < rr.retryAfter {
+		retry = strconv.Itoa(int(math.Ceil(rr.retryAfter.Seconds())))
+		header.Set("Retry-After", retry)
+	}
+	text := http.StatusText(rr.status)
+
+	switch rr.format {
+	case "json":
+		header.Set("Content-Type", "application/json")
+		aWriter.WriteHeader(rr.status)
+		body := map[string]any{"status": rr.status, "error": text}
+		if "" != retry {
+			body["retryAfter"] = int(math.Ceil(rr.retryAfter.Seconds()))
+		}
+		_ = json.NewEncoder(aWriter).Encode(body)
+
+	case "html":
+		header.Set("Content-Type", "text/html; charset=utf-8")
+		aWriter.WriteHeader(rr.status)
+		msg := ""
+		if "" != retry {
+			msg = "<p>Please try again in " + retry + " seconds.</p>\n"
+		}
+		_, _ = fmt.Fprintf(aWriter, "<!DOCTYPE html>\n<html><head><title>%[1]s</title></head>\n<body><h1>%[1]s</h1>\n%[2]s</body></html>\n",
+			html.EscapeString(text), msg)
+
+	default:
+		http.Error(aWriter, text, rr.status)
+	}
+} // send()
+
+// `readRateReject()` reads the host's response to rate limited
+// requests:
+//
+//	limitStatus = 429
+//	limitRetryAfter = 60s
+//	limitFormat = json
+//	limitExempt = /healthz, /status
+//
+// `limitFormat` is one of `text` (default), `json`, or `html`.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tRateReject`: The host's settings or `nil` if there are none.
+func readRateReject(aIni *ini.TSectionList, aSection string) *tRateReject {
+	result := &tRateReject{
+		status: http.StatusTooManyRequests,
+		format: "text",
+	}
+	found := false
+
+	if status, ok := hostInt(aIni, aSection, "limitStatus"); ok {
+		found = true
+		if (http.StatusBadRequest <= status) && (600 > status) {
+			result.status = status
+		}
+	}
+	if retry, ok := hostDuration(aIni, aSection, "limitRetryAfter"); ok {
+		found = true
+		result.retryAfter = retry
+	}
+	if s, ok := hostString(aIni, aSection, "limitFormat"); ok {
+		found = true
+		switch s = strings.ToLower(strings.TrimSpace(s)); s {
+		case "text", "json", "html":
+			result.format = s
+		default:
+			logErr("ReProx/readRateReject",
+				fmt.Sprintf("[%s] limitFormat: invalid format %q", aSection, s))
+		}
+	}
+	if s, ok := hostString(aIni, aSection, "limitExempt"); ok {
+		found = true
+		for _, path := range strings.Split(s, ",") {
+			if path = strings.TrimSpace(path); "" != path {
+				result.exempt = append(result.exempt, path)
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	return result
+} // readRateReject()
+
+/* _EoF_ */
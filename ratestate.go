@@ -0,0 +1,195 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type (
+	// State of a single rate limiter (the fields used depend on the
+	// algorithm, see `tLimiter.save()`):
+	tLimiterState struct {
+		Start  time.Time `json:"start"`            // window start, last refill, or next pass
+		Count  int       `json:"count,omitempty"`  // requests in the current window
+		Prev   int       `json:"prev,omitempty"`   // requests in the previous window
+		Tokens float64   `json:"tokens,omitempty"` // tokens left in the bucket
+	}
+
+	// The per-client limiters of a host:
+	tClientState struct {
+		Algo    string                   `json:"algo"`
+		Limit   int                      `json:"limit"`
+		Length  time.Duration            `json:"length"`
+		Clients map[string]tLimiterState `json:"clients"` // by client key
+	}
+
+	// Counters of a named rate limiter:
+	tStatsState struct {
+		Allowed uint64 `json:"allowed"`
+		Limited uint64 `json:"limited"`
+	}
+
+	// Contents of the `RateStateFile`:
+	tRateState struct {
+		Saved time.Time               `json:"saved"`
+		Hosts map[string]tClientState `json:"hosts"` // by hostname
+		Stats map[string]tStatsState  `json:"stats"` // by limiter name
+	}
+)
+
+// `SaveRateState()` writes the state of the per-client rate limiters
+// and the counters of all rate limiters to `aFilename`, so that a
+// restarted process continues with them (see `LoadRateState()`).
+//
+// Nothing is saved if a process started by `Upgrade()` took over
+// since it already read the state saved by `Upgrade()`.
+// After dropping the privileges the file (or its directory) must be
+// writable by the `RunAsUser`.
+//
+// Parameters:
+// - `aFilename`: The name of the state file (or empty to do nothing).
+//
+// Returns:
+// - `error`: A possible error writing the file.
+func SaveRateState(aFilename string) error {
+	if "" == aFilename {
+		return nil
+	}
+	gPIDFile.Lock()
+	handedOver := gPIDFile.handedOver
+	gPIDFile.Unlock()
+	if handedOver {
+		return nil
+	}
+
+	state := tRateState{
+		Saved: time.Now(),
+		Hosts: make(map[string]tClientState),
+		Stats: make(map[string]tStatsState),
+	}
+	if setup := CurrentSetup(); (nil != setup) && (nil != setup.BackendList) {
+		for host, dest := range *setup.BackendList {
+			cl := dest.clientRate
+			if nil == cl {
+				continue
+			}
+			clients := make(map[string]tLimiterState)
+			cl.windows.Range(func(aKey, aValue any) bool {
+				clients[aKey.(string)] = aValue.(tLimiter).save()
+				return true
+			})
+			state.Hosts[host] = tClientState{
+				Algo:    cl.algo,
+				Limit:   cl.limit,
+				Length:  cl.length,
+				Clients: clients,
+			}
+		}
+	}
+	gRateStats.Range(func(aKey, aValue any) bool {
+		rs := aValue.(*tRateStats)
+		state.Stats[aKey.(string)] = tStatsState{
+			Allowed: rs.allowed.Load(),
+			Limited: rs.limited.Load(),
+		}
+		return true
+	})
+
+	data, err := json.Marshal(state)
+	if nil != err {
+		return err
+	}
+	filename := jailPath(aFilename)
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if nil != err {
+		return err
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName) // no-op after successful rename
+
+	_, err = tmpFile.Write(data)
+	if e2 := tmpFile.Close(); nil == err {
+		err = e2
+	}
+	if nil != err {
+		return err
+	}
+
+	return os.Rename(tmpName, filename)
+} // SaveRateState()
+
+// `LoadRateState()` restores the state saved by `SaveRateState()` to
+// the rate limiters of the current configuration and removes the file
+// (so its counters are never added twice).
+//
+// The limiters of hosts whose `clientLimit` settings changed in the
+// meantime aren't restored. The function should be called at startup
+// after creating the proxy handler (see `NewProxyHandler()`).
+//
+// Parameters:
+// - `aFilename`: The name of the state file (or empty to do nothing).
+//
+// Returns:
+// - `error`: A possible error reading the file.
+func LoadRateState(aFilename string) error {
+	if "" == aFilename {
+		return nil
+	}
+	data, err := os.ReadFile(aFilename) // #nosec G304
+	if nil != err {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	_ = os.Remove(aFilename)
+
+	var state tRateState
+	if err = json.Unmarshal(data, &state); nil != err {
+		return fmt.Errorf("%s: %w", aFilename, err)
+	}
+
+	restored := 0
+	if setup := CurrentSetup(); (nil != setup) && (nil != setup.BackendList) {
+		for host, saved := range state.Hosts {
+			cl := (*setup.BackendList)[host].clientRate
+			if (nil == cl) || (cl.algo != saved.Algo) ||
+				(cl.limit != saved.Limit) || (cl.length != saved.Length) {
+				continue
+			}
+			for key, limiterState := range saved.Clients {
+				limiter := newLimiter(cl.algo, cl.limit, cl.length, cl.burst, cl.stats)
+				limiter.restore(limiterState)
+				cl.windows.Store(key, limiter)
+				restored++
+			}
+		}
+	}
+	for name, saved := range state.Stats {
+		// limiters no longer configured aren't reported again:
+		if value, ok := gRateStats.Load(name); ok {
+			rs := value.(*tRateStats)
+			rs.allowed.Add(saved.Allowed)
+			rs.limited.Add(saved.Limited)
+		}
+	}
+	logInfo("ReProx/LoadRateState",
+		fmt.Sprintf("%d client limiters restored from %s (saved %s)",
+			restored, aFilename, state.Saved.Format(time.RFC3339)))
+
+	return nil
+} // LoadRateState()
+
+/* _EoF_ */
@@ -0,0 +1,76 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateStateRoundTrip(t *testing.T) {
+	for _, algo := range []string{RateFixed, RateSliding, RateToken} {
+		t.Run(algo, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "ratestate.json")
+			name := "client:" + testHost
+			newLimit := func(aDest *tDestination) {
+				aDest.clientRate = &tClientLimit{
+					algo:    algo,
+					limit:   2,
+					length:  time.Hour,
+					keyMode: ClientKeyIP,
+					stats:   rateStats(name, 2, time.Hour),
+				}
+			}
+			request := httptest.NewRequest(http.MethodGet, "http://"+testHost+"/", nil)
+			request.RemoteAddr = "192.0.2.1:1234"
+			other := httptest.NewRequest(http.MethodGet, "http://"+testHost+"/", nil)
+			other.RemoteAddr = "192.0.2.2:1234"
+
+			newTestProxy(t, "http://127.0.0.1:8080", newLimit)
+			limit := (*CurrentSetup().BackendList)[testHost].clientRate
+			for range 2 {
+				if !limit.allow(request) {
+					t.Fatal("request within the limit refused")
+				}
+			}
+			value, _ := gRateStats.Load(name)
+			allowed := value.(*tRateStats).allowed.Load()
+			if err := SaveRateState(filename); nil != err {
+				t.Fatal(err)
+			}
+
+			// a new process with a fresh configuration:
+			gRateStats.Delete(name)
+			newTestProxy(t, "http://127.0.0.1:8080", newLimit)
+			if err := LoadRateState(filename); nil != err {
+				t.Fatal(err)
+			}
+			limit = (*CurrentSetup().BackendList)[testHost].clientRate
+			if limit.allow(request) {
+				t.Error("limit not restored: request allowed")
+			}
+			if !limit.allow(other) {
+				t.Error("other client refused")
+			}
+			value, _ = gRateStats.Load(name)
+			if got := value.(*tRateStats).allowed.Load(); allowed+1 != got {
+				t.Errorf("allowed = %d, want %d", got, allowed+1)
+			}
+			if _, err := os.Stat(filename); !os.IsNotExist(err) {
+				t.Errorf("state file not removed after loading: %v", err)
+			}
+		})
+	}
+} // TestRateStateRoundTrip()
+
+/* _EoF_ */
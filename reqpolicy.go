@@ -0,0 +1,96 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host policy of acceptable request methods and URLs:
+	tReqPolicy struct {
+		methods map[string]bool // (optional) allowed HTTP methods
+		allow   string          // value of the `Allow` header
+		maxURL  int             // (optional) longest request URL
+	}
+)
+
+// `refuse()` checks the method and URL of `aRequest` against the
+// policy and answers the request if they violate it.
+//
+// Disallowed methods get `405 Method Not Allowed` (with an `Allow`
+// header listing the allowed ones), URLs which are too long get
+// `414 URI Too Long`.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the request was refused.
+func (rp *tReqPolicy) refuse(aWriter http.ResponseWriter, aRequest *http.Request) bool {
+	if nil == rp {
+		return false
+	}
+
+	if (0 < len(rp.methods)) && !rp.methods[aRequest.Method] {
+		aWriter.Header().Set("Allow", rp.allow)
+		http.Error(aWriter, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return true
+	}
+	if (0 < rp.maxURL) && (rp.maxURL < len(aRequest.RequestURI)) {
+		http.Error(aWriter, http.StatusText(http.StatusRequestURITooLong),
+			http.StatusRequestURITooLong)
+		return true
+	}
+
+	return false
+} // refuse()
+
+// `readReqPolicy()` reads the host's method and URL policy:
+//
+//	allowMethods = GET, HEAD, POST
+//	maxURLLength = 2048
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tReqPolicy`: The host's policy or `nil` if there's none.
+func readReqPolicy(aIni *ini.TSectionList, aSection string) *tReqPolicy {
+	result := &tReqPolicy{}
+
+	if s, ok := hostString(aIni, aSection, "allowMethods"); ok {
+		var list []string
+		result.methods = make(map[string]bool)
+		for _, method := range strings.Split(s, ",") {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if ("" == method) || result.methods[method] {
+				continue
+			}
+			result.methods[method] = true
+			list = append(list, method)
+		}
+		result.allow = strings.Join(list, ", ")
+	}
+	result.maxURL, _ = hostInt(aIni, aSection, "maxURLLength")
+
+	if (0 == len(result.methods)) && (0 >= result.maxURL) {
+		return nil
+	}
+
+	return result
+} // readReqPolicy()
+
+/* _EoF_ */
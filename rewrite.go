@@ -0,0 +1,247 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host response body rewriting settings:
+	tBodyRewrite struct {
+		origin string   // the backend's origin (`scheme://host[:port]`)
+		types  []string // MIME types to rewrite (`text/*` allowed)
+	}
+
+	// Response body wrapper replacing `old` by `new` while streaming:
+	tRewriteBody struct {
+		src    io.ReadCloser
+		old    []byte
+		new    []byte
+		in     []byte // unprocessed input (possibly a partial match)
+		out    []byte // processed output not yet read
+		buf    []byte // read buffer
+		srcErr error  // the source's final read error
+	}
+
+	// A reader combined with the closer of another one:
+	tReadCloser struct {
+		io.Reader
+		io.Closer
+	}
+)
+
+var (
+	// MIME types rewritten if a host doesn't configure its own list:
+	rewriteDefaultTypes = []string{
+		"text/html",
+	}
+)
+
+// `Read()` reads from the wrapped body replacing all occurrences of
+// the old by the new string.
+//
+// Up to `len(old)-1` bytes are held back at the end of each chunk
+// read, since they might be the start of a match spanning chunks.
+//
+// Parameters:
+// - `aData`: The buffer to read into.
+//
+// Returns:
+// - `int`: The number of bytes read.
+// - `error`: A possible read error (including `io.EOF`).
+func (rb *tRewriteBody) Read(aData []byte) (int, error) {
+	for (0 == len(rb.out)) && (nil == rb.srcErr) {
+		if nil == rb.buf {
+			rb.buf = make([]byte, 32<<10)
+		}
+		n, err := rb.src.Read(rb.buf)
+		rb.in = append(rb.in, rb.buf[:n]...)
+		rb.srcErr = err
+
+		keep := 0
+		if nil == err {
+			keep = len(rb.old) - 1
+		}
+		rb.process(keep)
+	}
+	if 0 < len(rb.out) {
+		n := copy(aData, rb.out)
+		rb.out = rb.out[n:]
+		return n, nil
+	}
+
+	return 0, rb.srcErr
+} // Read()
+
+// `process()` moves the pending input to the output, replacing all
+// complete matches and holding back the last `aKeep` bytes (unless
+// they're part of a replaced match).
+//
+// Parameters:
+// - `aKeep`: The number of bytes to hold back.
+func (rb *tRewriteBody) process(aKeep int) {
+	limit := len(rb.in) - aKeep
+	if 0 > limit {
+		return
+	}
+
+	start := 0
+	for {
+		idx := bytes.Index(rb.in[start:], rb.old)
+		if 0 > idx {
+			break
+		}
+		rb.out = append(rb.out, rb.in[start:start+idx]...)
+		rb.out = append(rb.out, rb.new...)
+		start += idx + len(rb.old)
+	}
+	if start < limit {
+		rb.out = append(rb.out, rb.in[start:limit]...)
+		start = limit
+	}
+	rb.in = append(rb.in[:0], rb.in[start:]...)
+} // process()
+
+// `Close()` closes the wrapped body.
+//
+// Returns:
+// - `error`: A possible error closing the wrapped body.
+func (rb *tRewriteBody) Close() error {
+	return rb.src.Close()
+} // Close()
+
+// `replaceBody()` replaces all occurrences of `aOld` by `aNew` in the
+// body of `aResponse` if it's of one of the MIME types `aTypes`.
+//
+// Gzip encoded bodies are decoded first (the compression layer may
+// encode them again); responses with other encodings or announcing
+// trailers are left alone.
+//
+// Parameters:
+// - `aResponse`: The backend's response.
+// - `aTypes`: The MIME types to rewrite.
+// - `aOld`: The string to replace.
+// - `aNew`: The replacement.
+//
+// Returns:
+// - `bool`: Whether the body is rewritten.
+func replaceBody(aResponse *http.Response, aTypes []string, aOld, aNew []byte) bool {
+	header := aResponse.Header
+	if (http.MethodHead == aResponse.Request.Method) ||
+		(http.StatusNoContent == aResponse.StatusCode) ||
+		(http.StatusNotModified == aResponse.StatusCode) ||
+		("" != header.Get("Content-Range")) ||
+		(0 < len(aResponse.Trailer)) ||
+		!typeAllowed(header.Get("Content-Type"), aTypes) {
+		return false
+	}
+
+	body := aResponse.Body
+	switch strings.ToLower(header.Get("Content-Encoding")) {
+	case "":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if nil != err {
+			return false
+		}
+		body = &tReadCloser{Reader: zr, Closer: body}
+		header.Del("Content-Encoding")
+	default:
+		return false
+	}
+
+	aResponse.Body = &tRewriteBody{
+		src: body,
+		old: aOld,
+		new: aNew,
+	}
+	aResponse.ContentLength = -1
+	header.Del("Content-Length")
+	header.Del("Accept-Ranges")
+	if etag := header.Get("ETag"); ("" != etag) && !strings.HasPrefix(etag, "W/") {
+		// the rewritten body isn't byte-identical anymore:
+		header.Set("ETag", "W/"+etag)
+	}
+
+	return true
+} // replaceBody()
+
+// `rewrite()` replaces the backend's origin by the public one in the
+// body of `aResponse` if it's of an allowed MIME type.
+//
+// The public origin uses the configured hostname rather than the
+// `Host` sent by the client, so a (cached) body is the same for all
+// spellings of the hostname.
+//
+// It's meant to be used as (part of) a proxy's `ModifyResponse` hook.
+//
+// Parameters:
+// - `aResponse`: The backend's response.
+// - `aHost`: The (normalised) configured hostname.
+func (br *tBodyRewrite) rewrite(aResponse *http.Response, aHost string) {
+	if nil == br {
+		return
+	}
+
+	proto := "http"
+	if nil != aResponse.Request.TLS {
+		proto = "https"
+	}
+	replaceBody(aResponse, br.types, []byte(br.origin),
+		[]byte(proto+"://"+aHost))
+} // rewrite()
+
+// `readBodyRewrite()` reads the host's body rewriting settings:
+//
+//	rewriteBody = true
+//	rewriteTypes = text/html, text/css
+//
+// The origin to replace is taken from the host's `destURL`.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+// - `aDestURL`: The URL of the backend server.
+//
+// Returns:
+// - `*tBodyRewrite`: The host's settings or `nil` if it's disabled.
+func readBodyRewrite(aIni *ini.TSectionList, aSection, aDestURL string) *tBodyRewrite {
+	if on, _ := hostBool(aIni, aSection, "rewriteBody"); !on {
+		return nil
+	}
+	target, err := url.Parse(aDestURL)
+	if (nil != err) || ("" == target.Host) {
+		return nil
+	}
+
+	result := &tBodyRewrite{
+		origin: target.Scheme + "://" + target.Host,
+		types:  rewriteDefaultTypes,
+	}
+	if s, ok := hostString(aIni, aSection, "rewriteTypes"); ok {
+		result.types = nil
+		for _, mType := range strings.Split(s, ",") {
+			if mType = strings.ToLower(strings.TrimSpace(mType)); "" != mType {
+				result.types = append(result.types, mType)
+			}
+		}
+	}
+
+	return result
+} // readBodyRewrite()
+
+/* _EoF_ */
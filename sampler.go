@@ -0,0 +1,186 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// Metadata of a single sampled request (no bodies):
+	tSample struct {
+		Time      string `json:"time"`
+		Host      string `json:"host"`
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		Remote    string `json:"remote"`
+		UserAgent string `json:"userAgent,omitempty"`
+		Referer   string `json:"referer,omitempty"`
+	}
+
+	// An analytics sink with its own queue of samples to send:
+	tSampleSink struct {
+		url     string
+		queue   chan tSample
+		dropped int       // samples lost since the last error logged
+		logged  time.Time // time the last error was logged
+	}
+)
+
+const (
+	// Number of samples waiting to be sent before new ones get dropped:
+	sampleQueueSize = 1 << 10
+
+	// Most samples sent by a single request to a sink:
+	sampleBatchSize = 1 << 7
+
+	// Least time between two errors logged for a sink:
+	sampleLogInterval = time.Minute
+)
+
+var (
+	// The analytics sinks in use (`string` -> `*tSampleSink`):
+	gSampleSinks sync.Map
+
+	// HTTP client used to post the samples:
+	gSampleClient = &http.Client{
+		Timeout: time.Second << 2,
+	}
+)
+
+// `sampleSink()` returns the sink posting samples to `aURL`, starting
+// its sender with the first sample.
+//
+// Parameters:
+// - `aURL`: The URL of the analytics sink.
+//
+// Returns:
+// - `*tSampleSink`: The sink's queue.
+func sampleSink(aURL string) *tSampleSink {
+	if sink, ok := gSampleSinks.Load(aURL); ok {
+		return sink.(*tSampleSink)
+	}
+	sink, loaded := gSampleSinks.LoadOrStore(aURL, &tSampleSink{
+		url:   aURL,
+		queue: make(chan tSample, sampleQueueSize),
+	})
+	result := sink.(*tSampleSink)
+	if !loaded {
+		goSafe("sampler", true, result.sender)
+	}
+
+	return result
+} // sampleSink()
+
+// `sampleRequest()` queues the metadata of `aRequest` for the analytics
+// sink configured for `aDestination`.
+//
+// Only the fraction of requests given by the destination's `sampleRate`
+// is considered. The client address is anonymised according to the
+// host's `privacy` settings. If the sink's queue is full the sample is
+// silently dropped so that request processing is never delayed.
+//
+// Parameters:
+// - `aDestination`: The backend configuration of the requested host.
+// - `aRequest`: The incoming request to sample.
+func sampleRequest(aDestination *tDestination, aRequest *http.Request) {
+	if ("" == aDestination.sampleURL) || (0 >= aDestination.sampleRate) {
+		return
+	}
+	if (1 > aDestination.sampleRate) &&
+		(rand.Float64() >= aDestination.sampleRate) { // #nosec G404
+		return
+	}
+
+	sample := tSample{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Host:      aRequest.Host,
+		Method:    aRequest.Method,
+		Path:      aRequest.URL.Path,
+		Remote:    aDestination.privacy.remoteAddr(aRequest.RemoteAddr),
+		UserAgent: aRequest.UserAgent(),
+		Referer:   aRequest.Referer(),
+	}
+
+	select {
+	case sampleSink(aDestination.sampleURL).queue <- sample:
+	default: // queue full: drop the sample
+	}
+} // sampleRequest()
+
+// `sender()` posts the queued samples as JSON arrays to the sink,
+// sending all samples queued meanwhile (up to `sampleBatchSize`)
+// with a single request.
+//
+// The method runs in its own goroutine for the lifetime of
+// the program, so a slow sink delays only its own samples.
+func (ss *tSampleSink) sender() {
+	batch := make([]tSample, 0, sampleBatchSize)
+	for sample := range ss.queue {
+		batch = append(batch[:0], sample)
+	collect:
+		for sampleBatchSize > len(batch) {
+			select {
+			case sample = <-ss.queue:
+				batch = append(batch, sample)
+			default:
+				break collect
+			}
+		}
+		ss.post(batch)
+	}
+} // sender()
+
+// `post()` sends `aBatch` to the sink.
+//
+// Parameters:
+// - `aBatch`: The samples to send.
+func (ss *tSampleSink) post(aBatch []tSample) {
+	data, err := json.Marshal(aBatch)
+	if nil != err {
+		return
+	}
+
+	response, err := gSampleClient.Post(ss.url, "application/json", bytes.NewReader(data))
+	if nil != err {
+		ss.failed(len(aBatch), err)
+		return
+	}
+	// read the rest of the body so the connection can be reused:
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+	response.Body.Close()
+
+	if http.StatusMultipleChoices <= response.StatusCode {
+		ss.failed(len(aBatch), fmt.Errorf("%s", response.Status))
+	}
+} // post()
+
+// `failed()` records `aCount` samples lost by `aErr`, logging the
+// error at most once per `sampleLogInterval`.
+//
+// Parameters:
+// - `aCount`: The number of samples lost.
+// - `aErr`: The error sending them.
+func (ss *tSampleSink) failed(aCount int, aErr error) {
+	ss.dropped += aCount
+	if now := time.Now(); sampleLogInterval <= now.Sub(ss.logged) {
+		logErr("ReProx/sampleSender", fmt.Sprintf("sample sink %q: %v (%d samples dropped)",
+			ss.url, aErr, ss.dropped))
+		ss.logged, ss.dropped = now, 0
+	}
+} // failed()
+
+/* _EoF_ */
@@ -0,0 +1,55 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSampleBatches(t *testing.T) {
+	batches := make(chan []tSample, 16)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []tSample
+		if err := json.NewDecoder(r.Body).Decode(&batch); nil != err {
+			t.Error(err)
+		}
+		batches <- batch
+	}))
+	defer sink.Close()
+	dest := newDestination("http://127.0.0.1:8080")
+	dest.sampleURL, dest.sampleRate = sink.URL, 1
+	dest.privacy = &tLogPrivacy{ipMode: AnonTruncate}
+
+	const count = 50
+	for range count {
+		request := httptest.NewRequest(http.MethodGet, "http://"+testHost+"/page", nil)
+		request.RemoteAddr = "192.0.2.123:1234"
+		sampleRequest(&dest, request)
+	}
+
+	for received := 0; count > received; {
+		select {
+		case batch := <-batches:
+			for _, sample := range batch {
+				if "192.0.2.0:1234" != sample.Remote {
+					t.Fatalf("remote = %q, want %q", sample.Remote, "192.0.2.0:1234")
+				}
+			}
+			received += len(batch)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d of %d samples received", received, count)
+		}
+	}
+} // TestSampleBatches()
+
+/* _EoF_ */
@@ -0,0 +1,176 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// The time window a host section is active in:
+	tSchedule struct {
+		section string    // the host's INI section
+		from    time.Time // (optional) start of the window
+		until   time.Time // (optional) end of the window (exclusive)
+	}
+)
+
+var (
+	// Layouts accepted for `activeFrom` and `activeUntil` (in local
+	// time unless a zone is given):
+	scheduleLayouts = []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04",
+	}
+
+	// Timer applying the next scheduled configuration change:
+	gScheduleTimer *time.Timer
+
+	// Guard for `gScheduleTimer`:
+	gScheduleMtx sync.Mutex
+)
+
+// `readSchedule()` reads the `activeFrom` and `activeUntil` times of
+// a host section.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `tSchedule`: The section's time window.
+// - `error`: A possible error parsing the times.
+func readSchedule(aIni *ini.TSectionList, aSection string) (tSchedule, error) {
+	var err error
+	result := tSchedule{section: aSection}
+
+	if s, ok := aIni.AsString(aSection, "activeFrom"); ok && ("" != s) {
+		if result.from, err = parseScheduleTime(s); nil != err {
+			return result, fmt.Errorf("[%s] invalid activeFrom: %w", aSection, err)
+		}
+	}
+	if s, ok := aIni.AsString(aSection, "activeUntil"); ok && ("" != s) {
+		if result.until, err = parseScheduleTime(s); nil != err {
+			return result, fmt.Errorf("[%s] invalid activeUntil: %w", aSection, err)
+		}
+	}
+	if !result.from.IsZero() && !result.until.IsZero() && !result.from.Before(result.until) {
+		return result, fmt.Errorf("[%s] activeUntil isn't after activeFrom", aSection)
+	}
+
+	return result, nil
+} // readSchedule()
+
+// `parseScheduleTime()` parses a timestamp of `activeFrom` or
+// `activeUntil`.
+//
+// Parameters:
+// - `aValue`: The timestamp (e.g. `2024-06-01 02:00`).
+//
+// Returns:
+// - `time.Time`: The parsed time.
+// - `error`: A possible parse error.
+func parseScheduleTime(aValue string) (time.Time, error) {
+	aValue = strings.TrimSpace(aValue)
+	for _, layout := range scheduleLayouts {
+		if result, err := time.ParseInLocation(layout, aValue, time.Local); nil == err {
+			return result, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown time format %q", aValue)
+} // parseScheduleTime()
+
+// `activeAt()` checks whether the section is active at `aTime`.
+//
+// Parameters:
+// - `aTime`: The time to check.
+//
+// Returns:
+// - `bool`: `true` if `aTime` is inside the window.
+func (sc tSchedule) activeAt(aTime time.Time) bool {
+	return (sc.from.IsZero() || !aTime.Before(sc.from)) &&
+		(sc.until.IsZero() || aTime.Before(sc.until))
+} // activeAt()
+
+// `overlaps()` checks whether the window overlaps `aOther`.
+//
+// Parameters:
+// - `aOther`: The window to compare with.
+//
+// Returns:
+// - `bool`: `true` if both windows share some time.
+func (sc tSchedule) overlaps(aOther tSchedule) bool {
+	return (sc.from.IsZero() || aOther.until.IsZero() || sc.from.Before(aOther.until)) &&
+		(aOther.from.IsZero() || sc.until.IsZero() || aOther.from.Before(sc.until))
+} // overlaps()
+
+// `nextChange()` returns the earlier of `aNext` and the window's
+// first boundary after `aNow`.
+//
+// Parameters:
+// - `aNext`: The next change found so far (or zero if there's none).
+// - `aNow`: The current time.
+//
+// Returns:
+// - `time.Time`: The next change (or zero if there's none).
+func (sc tSchedule) nextChange(aNext, aNow time.Time) time.Time {
+	for _, t := range []time.Time{sc.from, sc.until} {
+		if t.After(aNow) && (aNext.IsZero() || t.Before(aNext)) {
+			aNext = t
+		}
+	}
+
+	return aNext
+} // nextChange()
+
+// `scheduleChange()` arranges for the configuration to be applied
+// again at the next `activeFrom` or `activeUntil` time of `aSetup`'s
+// hosts (if any), so that planned changes (e.g. switching a host's
+// backend at night) happen without a manual reload.
+//
+// Parameters:
+// - `aSetup`: The configuration just applied.
+func scheduleChange(aSetup *TSetup) {
+	gScheduleMtx.Lock()
+	defer gScheduleMtx.Unlock()
+
+	if nil != gScheduleTimer {
+		gScheduleTimer.Stop()
+		gScheduleTimer = nil
+	}
+	if (nil == aSetup) || aSetup.nextChange.IsZero() {
+		return
+	}
+
+	gScheduleTimer = time.AfterFunc(time.Until(aSetup.nextChange), func() {
+		if CurrentSetup() != aSetup {
+			return // replaced in the meantime
+		}
+		setup, err := newSetup(aSetup.iniData)
+		if nil != err {
+			logErr("ReProx/scheduleChange", err.Error())
+			return
+		}
+		applySetup(setup)
+		logInfo("ReProx/scheduleChange",
+			fmt.Sprintf("scheduled configuration change at %s applied",
+				aSetup.nextChange.Format(time.RFC3339)))
+	})
+} // scheduleChange()
+
+/* _EoF_ */
@@ -0,0 +1,107 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// Readiness states sent to the service manager by `SdNotify()`:
+	SdReady     = "READY=1"
+	SdReloading = "RELOADING=1"
+	SdStopping  = "STOPPING=1"
+	SdWatchdog  = "WATCHDOG=1"
+)
+
+// `SdNotify()` sends `aState` to the service manager (systemd) if
+// the program runs as a service of `Type=notify`.
+//
+// Parameters:
+// - `aState`: The newline separated state assignments (e.g. `SdReady`).
+//
+// Returns:
+// - `bool`: Whether the state was sent.
+// - `error`: A possible error sending the state.
+func SdNotify(aState string) (bool, error) {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if "" == name {
+		return false, nil
+	}
+	if '@' == name[0] { // abstract namespace
+		name = "\x00" + name[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil,
+		&net.UnixAddr{Name: name, Net: "unixgram"})
+	if nil != err {
+		return false, err
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(aState)); nil != err {
+		return false, err
+	}
+
+	return true, nil
+} // SdNotify()
+
+// `SdWatchdogInterval()` returns the interval in which the service manager
+// expects a `SdWatchdog` notification (`WatchdogSec` of the unit).
+//
+// Returns:
+// - `time.Duration`: The watchdog's timeout or `0` if it's disabled.
+func SdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if (nil != err) || (0 >= usec) {
+		return 0
+	}
+	if s := os.Getenv("WATCHDOG_PID"); "" != s {
+		// the parent's watchdog is ours after an `Upgrade()`:
+		pid, err := strconv.Atoi(s)
+		if (nil != err) || ((pid != os.Getpid()) && (pid != os.Getppid())) {
+			return 0 // meant for another process
+		}
+	}
+
+	return time.Duration(usec) * time.Microsecond
+} // SdWatchdogInterval()
+
+// `GoSdWatchdog()` notifies the service manager's watchdog (if it's
+// enabled) twice per interval as long as `aHandler` has routing data.
+//
+// Parameters:
+// - `aHandler`: The proxy handler whose routing data is checked.
+func GoSdWatchdog(aHandler *TProxyHandler) {
+	timeout := SdWatchdogInterval()
+	if 0 == timeout {
+		return
+	}
+
+	goSafe("watchdog", true, func() {
+		ticker := time.NewTicker(timeout >> 1)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if nil == aHandler.routes.Load() {
+				continue // let the service manager restart us
+			}
+			if _, err := SdNotify(SdWatchdog); nil != err {
+				logErr("ReProx/GoSdWatchdog",
+					fmt.Sprintf("watchdog notification failed: %v", err))
+			}
+		}
+	})
+} // GoSdWatchdog()
+
+/* _EoF_ */
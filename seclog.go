@@ -0,0 +1,267 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// A security relevant event for the security log:
+	tSecEvent struct {
+		name     string // short name of the event (e.g. `auth-failed`)
+		category string // ECS event category
+		severity int    // severity from 0 (low) to 10 (high)
+		reason   string // (optional) details of the event
+		client   string // client address (`host:port`)
+		host     string // (optional) requested hostname
+		method   string // (optional) request method
+		url      string // (optional) requested URL
+		agent    string // (optional) client's User-Agent
+	}
+
+	// Writer passing the server's error messages on while reporting
+	// failed TLS handshakes to the security log:
+	tTLSErrWatch struct {
+		next io.Writer
+	}
+)
+
+const (
+	// `SecLogCEF` writes the security log in ArcSight's Common Event
+	// Format.
+	SecLogCEF = "cef"
+
+	// `SecLogECS` writes the security log as Elastic Common Schema
+	// JSON objects.
+	SecLogECS = "ecs"
+)
+
+// Names of the security events:
+const (
+	secAuthFailed   = "auth-failed"
+	secBadRequest   = "bad-request"
+	secBadHost      = "host-rejected"
+	secBadSignature = "signature-failed"
+	secBadTLS       = "tls-handshake-failed"
+	secBlockedTLS   = "tls-blocked"
+	secBlockedUA    = "ua-blocked"
+	secChallenged   = "challenged"
+	secCSRF         = "csrf-failed"
+	secPolicy       = "policy-refused"
+	secRateLimited  = "rate-limited"
+)
+
+var (
+	// Sink and format of the security log (see `SetSecurityLog()`):
+	gSecLog struct {
+		sync.Mutex
+		sink   io.Writer
+		format string
+	}
+
+	// Server error message of a failed TLS handshake:
+	tlsErrRE = regexp.MustCompile(`TLS handshake error from (\S+): (.*)`)
+)
+
+// `SetSecurityLog()` sets the sink to write security relevant events
+// (refused clients, failed authentications, blocked requests, failed
+// TLS handshakes) to.
+//
+// Parameters:
+// - `aSink`: The destination of the events (`nil`: none).
+// - `aFormat`: The events' format (`cef` or `ecs`).
+func SetSecurityLog(aSink io.Writer, aFormat string) {
+	gSecLog.Lock()
+	defer gSecLog.Unlock()
+
+	gSecLog.sink, gSecLog.format = aSink, aFormat
+} // SetSecurityLog()
+
+// `WatchTLSErrors()` wraps the HTTPS server's error log `aNext` to
+// report failed TLS handshakes to the security log.
+//
+// Parameters:
+// - `aNext`: The writer of the server's error messages.
+//
+// Returns:
+// - `io.Writer`: The wrapping writer.
+func WatchTLSErrors(aNext io.Writer) io.Writer {
+	return tTLSErrWatch{next: aNext}
+} // WatchTLSErrors()
+
+// `Write()` passes the message `aData` on after checking it for a
+// failed TLS handshake.
+func (tw tTLSErrWatch) Write(aData []byte) (int, error) {
+	if match := tlsErrRE.FindSubmatch(aData); nil != match {
+		securityEvent(&tSecEvent{
+			name:     secBadTLS,
+			category: "network",
+			severity: 3,
+			reason:   string(bytes.TrimSpace(match[2])),
+			client:   string(match[1]),
+		})
+	}
+
+	return tw.next.Write(aData)
+} // Write()
+
+// `secEvent()` reports the refusal of `aRequest` to the security log.
+//
+// Parameters:
+// - `aName`: The event's name.
+// - `aSeverity`: The event's severity (0-10).
+// - `aRequest`: The refused HTTP request.
+// - `aReason`: (optional) Details of the event.
+func secEvent(aName string, aSeverity int, aRequest *http.Request, aReason string) {
+	gSecLog.Lock()
+	off := nil == gSecLog.sink
+	gSecLog.Unlock()
+	if off {
+		return
+	}
+
+	category := "intrusion_detection"
+	switch aName {
+	case secAuthFailed, secBadSignature:
+		category = "authentication"
+	case secRateLimited:
+		category = "network"
+	}
+	securityEvent(&tSecEvent{
+		name:     aName,
+		category: category,
+		severity: aSeverity,
+		reason:   aReason,
+		client:   aRequest.RemoteAddr,
+		host:     aRequest.Host,
+		method:   aRequest.Method,
+		url:      aRequest.RequestURI,
+		agent:    aRequest.UserAgent(),
+	})
+} // secEvent()
+
+// `securityEvent()` writes `aEvent` to the security log.
+//
+// Parameters:
+// - `aEvent`: The event to log.
+func securityEvent(aEvent *tSecEvent) {
+	gSecLog.Lock()
+	defer gSecLog.Unlock()
+	if nil == gSecLog.sink {
+		return
+	}
+
+	var line []byte
+	if SecLogECS == gSecLog.format {
+		line = aEvent.ecs(time.Now())
+	} else {
+		line = aEvent.cef(time.Now())
+	}
+	if _, err := gSecLog.sink.Write(line); nil != err {
+		logErr("ReProx/securityEvent", err.Error())
+	}
+} // securityEvent()
+
+// `cef()` formats the event in the Common Event Format.
+//
+// Parameters:
+// - `aTime`: The time of the event.
+//
+// Returns:
+// - `[]byte`: The formatted event (with a trailing newline).
+func (se *tSecEvent) cef(aTime time.Time) []byte {
+	header := strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	value := strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CEF:0|mwat56|reprox|%s|%s|%s|%d|rt=%d",
+		header.Replace(Version), se.name, se.name, se.severity,
+		aTime.UnixMilli())
+	ext := func(aKey, aValue string) {
+		if "" != aValue {
+			buf.WriteString(" " + aKey + "=" + value.Replace(aValue))
+		}
+	}
+	ip, port, err := net.SplitHostPort(se.client)
+	if nil != err {
+		ip = se.client
+	}
+	ext("src", ip)
+	ext("spt", port)
+	ext("dhost", se.host)
+	ext("requestMethod", se.method)
+	ext("request", se.url)
+	ext("requestClientApplication", se.agent)
+	ext("reason", se.reason)
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+} // cef()
+
+// `ecs()` formats the event as an Elastic Common Schema JSON object.
+//
+// Parameters:
+// - `aTime`: The time of the event.
+//
+// Returns:
+// - `[]byte`: The formatted event (with a trailing newline).
+func (se *tSecEvent) ecs(aTime time.Time) []byte {
+	event := map[string]any{
+		"kind":     "alert",
+		"category": []string{se.category},
+		"action":   se.name,
+		"outcome":  "failure",
+		"severity": se.severity,
+	}
+	if "" != se.reason {
+		event["reason"] = se.reason
+	}
+	source := map[string]any{"address": se.client}
+	if ip, port, err := net.SplitHostPort(se.client); nil == err {
+		source["ip"] = ip
+		if p, err := strconv.Atoi(port); nil == err {
+			source["port"] = p
+		}
+	}
+	doc := map[string]any{
+		"@timestamp": aTime.UTC().Format(time.RFC3339Nano),
+		"ecs":        map[string]string{"version": "8.11.0"},
+		"event":      event,
+		"source":     source,
+		"observer": map[string]string{
+			"vendor":  "mwat56",
+			"product": "reprox",
+			"version": Version,
+		},
+	}
+	if "" != se.host {
+		doc["url"] = map[string]string{"domain": se.host, "original": se.url}
+		doc["http"] = map[string]any{"request": map[string]string{"method": se.method}}
+	}
+	if "" != se.agent {
+		doc["user_agent"] = map[string]string{"original": se.agent}
+	}
+
+	result, _ := json.Marshal(doc)
+
+	return append(result, '\n')
+} // ecs()
+
+/* _EoF_ */
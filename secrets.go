@@ -0,0 +1,62 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// Prefix of configuration values to be read from the environment:
+	secretEnvPrefix = "env:"
+
+	// Prefix of configuration values to be read from a file:
+	secretFilePrefix = "file:"
+)
+
+// `resolveSecret()` resolves a secret reference given in the
+// configuration file.
+//
+// Values of the form `env:NAME` are replaced by the contents of the
+// environment variable `NAME`, values of the form `file:/path` by the
+// contents of the file `/path` (without trailing line breaks).
+// All other values are returned unchanged.
+//
+// Parameters:
+// - `aValue`: The configured value, possibly a secret reference.
+//
+// Returns:
+// - `string`: The resolved value.
+// - `error`: An error if the reference can't be resolved.
+func resolveSecret(aValue string) (string, error) {
+	switch {
+	case strings.HasPrefix(aValue, secretEnvPrefix):
+		name := strings.TrimPrefix(aValue, secretEnvPrefix)
+		result, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%w: environment variable %q not set",
+				ErrSecretNotFound, name)
+		}
+		return result, nil
+
+	case strings.HasPrefix(aValue, secretFilePrefix):
+		fName := strings.TrimPrefix(aValue, secretFilePrefix)
+		data, err := os.ReadFile(fName) // #nosec G304
+		if nil != err {
+			return "", fmt.Errorf("%w: %w", ErrSecretNotFound, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	return aValue, nil
+} // resolveSecret()
+
+/* _EoF_ */
@@ -0,0 +1,339 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Group of servers sharing a proxy handler which are started
+	// and (gracefully) shut down together:
+	TServer struct {
+		// The time allowed to drain the in-flight requests when `Start()`
+		// shuts the servers down (default: 8 seconds):
+		DrainTimeout time.Duration
+
+		// (optional) function called with the number of in-flight
+		// requests while draining (default: logging):
+		Progress func(aInFlight int64)
+
+		handler *TProxyHandler
+		mtx     sync.Mutex
+		served  []tServed
+		tcp     []*tTCPProxy // (optional) TCP routes (see `AddTCP()`)
+	}
+
+	// A server with its listener:
+	tServed struct {
+		server   *http.Server
+		listener net.Listener
+		certFile string // (optional) TLS certificate
+		keyFile  string // (optional) TLS key
+	}
+)
+
+const (
+	// Default time to drain the in-flight requests:
+	drainTimeout = time.Second << 3
+
+	// Interval of the drain progress reports:
+	drainInterval = time.Second
+)
+
+var (
+	// Number of proxied requests currently served:
+	gInFlight atomic.Int64
+)
+
+// `InFlight()` returns the number of proxied requests currently
+// served.
+//
+// Returns:
+// - `int64`: The number of in-flight requests.
+func InFlight() int64 {
+	return gInFlight.Load()
+} // InFlight()
+
+// `NewServer()` returns a new (empty) group of servers for `aHandler`.
+//
+// Parameters:
+// - `aHandler`: The proxy handler whose backend connections are
+// closed on shutdown.
+//
+// Returns:
+// - `*TServer`: The new server group.
+func NewServer(aHandler *TProxyHandler) *TServer {
+	result := &TServer{
+		DrainTimeout: drainTimeout,
+		handler:      aHandler,
+	}
+	OnReload(result.reloadTCP)
+
+	return result
+} // NewServer()
+
+// `Add()` adds `aServer` serving plain HTTP at `aListener`.
+//
+// Parameters:
+// - `aServer`: The server to add.
+// - `aListener`: The bound listener to serve.
+//
+// Returns:
+// - `*TServer`: The server group itself.
+func (s *TServer) Add(aServer *http.Server, aListener net.Listener) *TServer {
+	return s.AddTLS(aServer, aListener, "", "")
+} // Add()
+
+// `AddTLS()` adds `aServer` serving HTTPS at `aListener`.
+//
+// Parameters:
+// - `aServer`: The server to add.
+// - `aListener`: The bound listener to serve.
+// - `aCertFile`: The name of the TLS certificate file (or empty if
+// `aServer.TLSConfig` provides the certificate).
+// - `aKeyFile`: The name of the TLS key file.
+//
+// Returns:
+// - `*TServer`: The server group itself.
+func (s *TServer) AddTLS(aServer *http.Server, aListener net.Listener, aCertFile, aKeyFile string) *TServer {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.served = append(s.served, tServed{
+		server:   aServer,
+		listener: aListener,
+		certFile: aCertFile,
+		keyFile:  aKeyFile,
+	})
+
+	return s
+} // AddTLS()
+
+// `serve()` serves the server's listener until it's shut down.
+//
+// Returns:
+// - `error`: The reason the server stopped.
+func (ts tServed) serve() error {
+	var err error
+	if ("" != ts.certFile) || (nil != ts.server.TLSConfig) {
+		err = ts.server.ServeTLS(ts.listener, ts.certFile, ts.keyFile)
+	} else {
+		err = ts.server.Serve(ts.listener)
+	}
+	if (nil != err) && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", ts.listener.Addr(), err)
+	}
+
+	return nil
+} // serve()
+
+// `servers()` returns the servers added so far.
+//
+// Returns:
+// - `[]tServed`: The group's servers.
+func (s *TServer) servers() []tServed {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return append([]tServed(nil), s.served...)
+} // servers()
+
+// `Start()` serves all servers of the group until `aCtx` is done
+// or one of them fails; then all servers are shut down, draining
+// the in-flight requests for at most `DrainTimeout`.
+//
+// Parameters:
+// - `aCtx`: The context whose end stops the servers.
+//
+// Returns:
+// - `error`: The first error of a server or of the shutdown.
+func (s *TServer) Start(aCtx context.Context) error {
+	served, tcp := s.servers(), s.tcpProxies()
+	errs := make(chan error, len(served)+len(tcp))
+	for _, ts := range served {
+		go func() {
+			errs <- ts.serve()
+		}()
+	}
+	for _, tp := range tcp {
+		go func() {
+			errs <- tp.serve()
+		}()
+	}
+
+	var result error
+	pending := len(served) + len(tcp)
+	select {
+	case <-aCtx.Done():
+	case result = <-errs:
+		pending--
+	}
+
+	timeout := s.DrainTimeout
+	if 0 >= timeout {
+		timeout = drainTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.Shutdown(ctx); nil == result {
+		result = err
+	}
+	for ; 0 < pending; pending-- {
+		if err := <-errs; nil == result {
+			result = err
+		}
+	}
+
+	return result
+} // Start()
+
+// `Shutdown()` gracefully stops all servers (and TCP routes) of the
+// group: their listeners are closed at once while the in-flight
+// requests are drained until `aCtx` is done; connections still open
+// then are closed forcibly.
+// Finally the idle connections to the backends are closed.
+//
+// Parameters:
+// - `aCtx`: The context limiting the draining.
+//
+// Returns:
+// - `error`: The context's error if the draining didn't finish.
+func (s *TServer) Shutdown(aCtx context.Context) error {
+	var (
+		result error
+		mtx    sync.Mutex
+		wg     sync.WaitGroup
+	)
+	done, reported := make(chan struct{}), make(chan struct{})
+	go func() {
+		s.reportDrain(done)
+		close(reported)
+	}()
+
+	for _, ts := range s.servers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ts.server.Shutdown(aCtx); nil != err {
+				_ = ts.server.Close()
+				mtx.Lock()
+				if nil == result {
+					result = err
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+	for _, tp := range s.tcpProxies() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tp.Shutdown(aCtx); nil != err {
+				mtx.Lock()
+				if nil == result {
+					result = err
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-reported
+
+	if nil != s.handler {
+		s.handler.closeIdleConnections()
+	}
+	http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+
+	return result
+} // Shutdown()
+
+// `reportDrain()` reports the number of in-flight requests until
+// `aDone` is closed.
+//
+// Parameters:
+// - `aDone`: The channel closed when the draining has finished.
+func (s *TServer) reportDrain(aDone <-chan struct{}) {
+	report := s.Progress
+	if nil == report {
+		report = func(aInFlight int64) {
+			logInfo("ReProx/Shutdown",
+				fmt.Sprintf("draining %d in-flight requests", aInFlight))
+		}
+	}
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-aDone:
+			report(gInFlight.Load())
+			return
+		case <-ticker.C:
+			report(gInFlight.Load())
+		}
+	}
+} // reportDrain()
+
+// `closeIdleConnections()` closes the idle connections of all
+// backends' private transports.
+func (ph *TProxyHandler) closeIdleConnections() {
+	closeIdleProxies(ph.routes.Load().backendServers)
+} // closeIdleConnections()
+
+// `closeIdleTransport()` closes the idle connections of a backend
+// transport (`http.Transport` or `http2.Transport`).
+//
+// Parameters:
+// - `aTransport`: The transport of a host's reverse proxy.
+func closeIdleTransport(aTransport http.RoundTripper) {
+	if transport, ok := aTransport.(interface{ CloseIdleConnections() }); ok {
+		transport.CloseIdleConnections()
+	}
+} // closeIdleTransport()
+
+// `closeIdleProxies()` closes the idle connections of the private
+// transports of `aServers`.
+//
+// Parameters:
+// - `aServers`: The hosts whose backend connections to close.
+func closeIdleProxies(aServers tBackendServers) {
+	closeIdle := func(aProxy *httputil.ReverseProxy) {
+		if nil == aProxy {
+			return
+		}
+		closeIdleTransport(aProxy.Transport)
+	}
+
+	for _, dest := range aServers {
+		closeIdle(dest.destProxy)
+		if nil != dest.lazyProxy {
+			closeIdle(dest.lazyProxy.Swap(nil))
+		}
+		if nil != dest.abTest {
+			for _, variant := range dest.abTest.variants {
+				variant.Lock()
+				closeIdle(variant.proxy)
+				variant.Unlock()
+			}
+		}
+	}
+} // closeIdleProxies()
+
+/* _EoF_ */
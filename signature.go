@@ -0,0 +1,220 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host verification of HMAC request signatures:
+	tSignature struct {
+		secret   []byte           // shared secret
+		newHash  func() hash.Hash // hash function of the HMAC
+		header   string           // header carrying the signature
+		parts    []string         // components of the signed string
+		tsHeader string           // (optional) header carrying a timestamp
+		maxSkew  time.Duration    // largest clock difference allowed
+		maxBody  int64            // largest body to sign
+	}
+)
+
+// `canonical()` builds the string to sign from the configured parts
+// of `aRequest`, joined by newlines.
+//
+// The body is read (up to `maxBody` bytes) and put back for the
+// backend.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `[]byte`: The string to sign.
+// - `bool`: `false` if the body is too large.
+func (sg *tSignature) canonical(aRequest *http.Request) ([]byte, bool) {
+	var buf bytes.Buffer
+	for idx, part := range sg.parts {
+		if 0 < idx {
+			buf.WriteByte('\n')
+		}
+		switch part {
+		case "method":
+			buf.WriteString(aRequest.Method)
+		case "host":
+			buf.WriteString(aRequest.Host)
+		case "path":
+			buf.WriteString(aRequest.URL.EscapedPath())
+		case "query":
+			buf.WriteString(aRequest.URL.RawQuery)
+		case "timestamp":
+			buf.WriteString(aRequest.Header.Get(sg.tsHeader))
+		case "body":
+			if nil == aRequest.Body {
+				continue
+			}
+			body, err := io.ReadAll(io.LimitReader(aRequest.Body, sg.maxBody+1))
+			_ = aRequest.Body.Close()
+			if (nil != err) || (sg.maxBody < int64(len(body))) {
+				return nil, false
+			}
+			aRequest.Body = io.NopCloser(bytes.NewReader(body))
+			buf.Write(body)
+		default: // "header:<name>"
+			buf.WriteString(aRequest.Header.Get(strings.TrimPrefix(part, "header:")))
+		}
+	}
+
+	return buf.Bytes(), true
+} // canonical()
+
+// `verify()` checks the signature sent with `aRequest`.
+//
+// The signature may be hex or base64 encoded and prefixed by the
+// hash's name (e.g. `sha256=…`). If a timestamp header is configured
+// it must hold a Unix time within `maxSkew` of the current time.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `int`: `0` if the signature is valid, the HTTP status to send
+// otherwise.
+func (sg *tSignature) verify(aRequest *http.Request) int {
+	sent := strings.TrimSpace(aRequest.Header.Get(sg.header))
+	if _, value, ok := strings.Cut(sent, "="); ok && strings.HasPrefix(sent, "sha") {
+		sent = value
+	}
+	if "" == sent {
+		return http.StatusUnauthorized
+	}
+
+	if "" != sg.tsHeader {
+		ts, err := strconv.ParseInt(aRequest.Header.Get(sg.tsHeader), 10, 64)
+		if nil != err {
+			return http.StatusUnauthorized
+		}
+		if skew := time.Since(time.Unix(ts, 0)); sg.maxSkew < time.Duration(math.Abs(float64(skew))) {
+			return http.StatusUnauthorized
+		}
+	}
+
+	data, ok := sg.canonical(aRequest)
+	if !ok {
+		return http.StatusRequestEntityTooLarge
+	}
+	mac := hmac.New(sg.newHash, sg.secret)
+	mac.Write(data)
+	want := mac.Sum(nil)
+
+	got, err := hex.DecodeString(sent)
+	if nil != err {
+		if got, err = base64.StdEncoding.DecodeString(sent); nil != err {
+			return http.StatusUnauthorized
+		}
+	}
+	if !hmac.Equal(want, got) {
+		return http.StatusUnauthorized
+	}
+
+	return 0
+} // verify()
+
+// `readSignature()` reads the host's request signature settings:
+//
+//	signSecret = env:API_SIGNING_KEY
+//	signHeader = X-Signature
+//	signHash = sha256
+//	signParts = method, path, query, timestamp, body
+//	signTimestamp = X-Timestamp
+//	signMaxSkew = 5m
+//	signMaxBody = 1048576
+//
+// `signHash` is `sha256` (default) or `sha512`; `signParts` lists the
+// request's parts to sign (in order, joined by newlines): `method`,
+// `host`, `path`, `query`, `timestamp`, `body`, and `header:<name>`.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tSignature`: The host's settings or `nil` if it's disabled.
+func readSignature(aIni *ini.TSectionList, aSection string) *tSignature {
+	secret, ok := hostString(aIni, aSection, "signSecret")
+	if !ok || ("" == secret) {
+		return nil
+	}
+
+	result := &tSignature{
+		secret:  []byte(secret),
+		newHash: sha256.New,
+		header:  "X-Signature",
+		parts:   []string{"method", "path", "query", "body"},
+		maxSkew: time.Minute * 5,
+		maxBody: 1 << 20,
+	}
+	if s, ok := hostString(aIni, aSection, "signHeader"); ok && ("" != s) {
+		result.header = s
+	}
+	if s, ok := hostString(aIni, aSection, "signHash"); ok {
+		switch s = strings.ToLower(strings.TrimSpace(s)); s {
+		case "sha256":
+		case "sha512":
+			result.newHash = sha512.New
+		default:
+			logErr("ReProx/readSignature",
+				fmt.Sprintf("[%s] signHash: invalid hash %q", aSection, s))
+		}
+	}
+	if s, ok := hostString(aIni, aSection, "signTimestamp"); ok {
+		result.tsHeader = strings.TrimSpace(s)
+	}
+	if s, ok := hostString(aIni, aSection, "signParts"); ok {
+		result.parts = nil
+		for _, part := range strings.Split(s, ",") {
+			part = strings.TrimSpace(part)
+			switch lower := strings.ToLower(part); {
+			case "" == part:
+			case "method" == lower, "host" == lower, "path" == lower,
+				"query" == lower, "timestamp" == lower, "body" == lower:
+				result.parts = append(result.parts, lower)
+			case strings.HasPrefix(lower, "header:"):
+				result.parts = append(result.parts, "header:"+strings.TrimSpace(part[7:]))
+			default:
+				logErr("ReProx/readSignature",
+					fmt.Sprintf("[%s] signParts: invalid part %q", aSection, part))
+			}
+		}
+	}
+	if skew, ok := hostDuration(aIni, aSection, "signMaxSkew"); ok && (0 < skew) {
+		result.maxSkew = skew
+	}
+	if size, ok := hostInt(aIni, aSection, "signMaxBody"); ok && (0 < size) {
+		result.maxBody = int64(size)
+	}
+
+	return result
+} // readSignature()
+
+/* _EoF_ */
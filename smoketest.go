@@ -0,0 +1,172 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// `TSmokeResult` holds the outcome of a host's latest smoke test.
+	TSmokeResult struct {
+		Time     string `json:"time"`
+		Path     string `json:"path"`
+		Status   int    `json:"status"`
+		OK       bool   `json:"ok"`
+		Latency  string `json:"latency"`
+		Runs     uint64 `json:"runs"`
+		Failures uint64 `json:"failures"`
+	}
+
+	// Minimal `http.ResponseWriter` recording a smoke test's status:
+	tSmokeWriter struct {
+		header http.Header
+		status int
+	}
+)
+
+const (
+	// User agent of the synthetic smoke test requests:
+	smokeUserAgent = "reprox-smoketest"
+)
+
+var (
+	// Latest smoke test results by host:
+	gSmokeResults = make(map[string]TSmokeResult)
+
+	// Guard for `gSmokeResults`:
+	gSmokeMtx sync.RWMutex
+)
+
+// `Header()` returns the response header map.
+func (sw *tSmokeWriter) Header() http.Header {
+	return sw.header
+} // Header()
+
+// `Write()` discards the response body.
+func (sw *tSmokeWriter) Write(aData []byte) (int, error) {
+	if 0 == sw.status {
+		sw.status = http.StatusOK
+	}
+
+	return len(aData), nil
+} // Write()
+
+// `WriteHeader()` records the final (non-informational) status code.
+func (sw *tSmokeWriter) WriteHeader(aStatus int) {
+	if (0 == sw.status) && (http.StatusOK <= aStatus) {
+		sw.status = aStatus
+	}
+} // WriteHeader()
+
+// `goSmokeTest()` periodically sends a synthetic request for `aPath`
+// of `aHost` through the proxy handler, recording the result and
+// logging failures.
+//
+// A test fails if the response status is `400` or above.
+//
+// The method is meant to run in its own goroutine (see
+// `startWorkers()`) until a reload removes the host or changes its
+// smoke test settings.
+//
+// Parameters:
+// - `aHost`: The (outside) hostname to test.
+// - `aPath`: The URL path to request.
+// - `aInterval`: The time between two tests.
+func (ph *TProxyHandler) goSmokeTest(aHost, aPath string, aInterval time.Duration) {
+	ticker := time.NewTicker(aInterval)
+	defer ticker.Stop()
+	stop := func() {
+		ph.Lock()
+		delete(ph.smokeTests, smokeKey(aHost, aPath, aInterval))
+		ph.Unlock()
+	}
+
+	for range ticker.C {
+		dest, ok := ph.routes.Load().backendServers[aHost]
+		if !ok || (aPath != dest.smokePath) || (aInterval != dest.smokeEvery) {
+			stop() // replaced by a reload
+			return
+		}
+		request, err := http.NewRequest(http.MethodGet, "http://"+aHost+aPath, nil)
+		if nil != err {
+			logErr("ReProx/goSmokeTest",
+				fmt.Sprintf("%s%s: %v", aHost, aPath, err))
+			stop()
+			return
+		}
+		request.Header.Set("User-Agent", smokeUserAgent)
+		request.RemoteAddr = "127.0.0.1:0"
+		writer := &tSmokeWriter{header: make(http.Header)}
+
+		start := time.Now()
+		ph.ServeHTTP(writer, request)
+		latency := time.Since(start)
+		if 0 == writer.status {
+			writer.status = http.StatusOK
+		}
+
+		gSmokeMtx.Lock()
+		result := gSmokeResults[aHost]
+		result.Time = start.Format(time.RFC3339)
+		result.Path = aPath
+		result.Status = writer.status
+		result.OK = http.StatusBadRequest > writer.status
+		result.Latency = latency.String()
+		result.Runs++
+		if !result.OK {
+			result.Failures++
+		}
+		gSmokeResults[aHost] = result
+		gSmokeMtx.Unlock()
+
+		if !result.OK {
+			logErr("ReProx/goSmokeTest",
+				fmt.Sprintf("smoke test %s%s failed: status %d after %v",
+					aHost, aPath, writer.status, latency))
+		}
+	}
+} // goSmokeTest()
+
+// `smokeKey()` returns the key identifying a host's smoke test.
+//
+// Parameters:
+// - `aHost`: The (outside) hostname to test.
+// - `aPath`: The URL path to request.
+// - `aInterval`: The time between two tests.
+//
+// Returns:
+// - `string`: The smoke test's key.
+func smokeKey(aHost, aPath string, aInterval time.Duration) string {
+	return aHost + aPath + " " + aInterval.String()
+} // smokeKey()
+
+// `handleSmokeTests()` sends the latest smoke test results as JSON.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+func handleSmokeTests(aWriter http.ResponseWriter, aRequest *http.Request) {
+	gSmokeMtx.RLock()
+	data, err := json.Marshal(gSmokeResults)
+	gSmokeMtx.RUnlock()
+	if nil != err {
+		http.Error(aWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	aWriter.Header().Set("Content-Type", "application/json")
+	_, _ = aWriter.Write(data)
+} // handleSmokeTests()
+
+/* _EoF_ */
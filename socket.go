@@ -0,0 +1,117 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// `TSocketOptions` holds the options of the listening sockets.
+	TSocketOptions struct {
+		ReusePort bool          // whether other processes may listen at the address
+		NoDelay   bool          // whether to send small packets at once
+		KeepAlive time.Duration // interval of TCP keep-alive probes (`0`: Go's default, `-1`: off)
+	}
+
+	// Listener setting `TCP_NODELAY` of the accepted connections:
+	tNoDelayListener struct {
+		net.Listener
+		noDelay bool
+	}
+)
+
+// `Accept()` waits for the next connection and sets its option.
+//
+// Returns:
+// - `net.Conn`: The accepted connection.
+// - `error`: A possible error accepting the connection.
+func (nl tNoDelayListener) Accept() (net.Conn, error) {
+	conn, err := nl.Listener.Accept()
+	if nil != err {
+		return nil, err
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.SetNoDelay(nl.noDelay)
+	}
+
+	return conn, nil
+} // Accept()
+
+// `Listen()` binds a listening TCP socket with the options to `aAddr`.
+//
+// With `ReusePort` several processes can listen at the same address
+// (`SO_REUSEPORT`), the kernel distributing the connections among
+// them, e.g. to start a new version before stopping the old one, or
+// to run one process per CPU core.
+// A socket handed over by the old process (see `Upgrade()`) is used
+// instead of binding a new one.
+//
+// Parameters:
+// - `aAddr`: The address to listen at.
+//
+// Returns:
+// - `net.Listener`: The bound listener.
+// - `error`: A possible error binding the socket.
+func (so TSocketOptions) Listen(aAddr string) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: so.KeepAlive}
+	if so.ReusePort {
+		lc.Control = reusePort
+	}
+
+	result := gHandoff.inherit(aAddr)
+	if nil == result {
+		var err error
+		if result, err = lc.Listen(context.Background(), "tcp", aAddr); nil != err {
+			return nil, err
+		}
+	}
+	gHandoff.register(aAddr, result)
+	if !so.NoDelay {
+		// Go enables `TCP_NODELAY` by default
+		result = tNoDelayListener{Listener: result, noDelay: false}
+	}
+
+	return result, nil
+} // Listen()
+
+// `readSocketOptions()` reads the options of the listening sockets:
+//
+//	ReusePort = true
+//	TCPNoDelay = true
+//	TCPKeepAlive = 30s
+//
+// `TCPNoDelay` defaults to `true`, `TCPKeepAlive` to Go's default
+// (`15s`); `0` turns keep-alive probes off.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+//
+// Returns:
+// - `TSocketOptions`: The sockets' options.
+func readSocketOptions(aIni *ini.TSectionList) (rOptions TSocketOptions) {
+	rOptions.ReusePort, _ = hostBool(aIni, ini.DefSection, "ReusePort")
+	rOptions.NoDelay = true
+	if on, ok := hostBool(aIni, ini.DefSection, "TCPNoDelay"); ok {
+		rOptions.NoDelay = on
+	}
+	if interval, ok := hostDuration(aIni, ini.DefSection, "TCPKeepAlive"); ok {
+		if rOptions.KeepAlive = interval; 0 == interval {
+			rOptions.KeepAlive = -1
+		}
+	}
+
+	return
+} // readSocketOptions()
+
+/* _EoF_ */
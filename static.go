@@ -0,0 +1,169 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Directory of static files served without asking the backend:
+	tStaticFiles struct {
+		root  string // the directory (outside a `Chroot` jail)
+		mtx   sync.RWMutex
+		etags map[string]tStaticETag // by filename
+	}
+
+	// The `ETag` of a file's version:
+	tStaticETag struct {
+		size    int64
+		modTime time.Time
+		etag    string
+	}
+)
+
+const (
+	// Most files whose `ETag` is remembered per host:
+	staticMaxETags = 1 << 14
+)
+
+// `serve()` sends the file named by `aRequest`'s path if there is one
+// in the directory.
+//
+// The file is passed to `http.ServeContent()` as an `*os.File`, so
+// the kernel copies it to plain HTTP connections (`sendfile()`)
+// without passing it through buffers of the program; `Range` and
+// conditional requests are answered from the file's `ETag`.
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the request was served (otherwise it's forwarded).
+func (sf *tStaticFiles) serve(aWriter http.ResponseWriter, aRequest *http.Request) bool {
+	if (nil == sf) ||
+		((http.MethodGet != aRequest.Method) && (http.MethodHead != aRequest.Method)) {
+		return false
+	}
+	name := path.Clean("/" + aRequest.URL.Path)
+	if strings.Contains(name, "/.") {
+		return false // no hidden files (e.g. `.git`)
+	}
+	if strings.HasSuffix(aRequest.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+
+	file, err := os.Open(filepath.Join(jailPath(sf.root), filepath.FromSlash(name))) // #nosec G304
+	if nil != err {
+		return false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if (nil != err) || !info.Mode().IsRegular() {
+		return false
+	}
+
+	if etag := sf.etag(name, file, info); "" != etag {
+		aWriter.Header().Set("ETag", etag)
+	}
+	http.ServeContent(aWriter, aRequest, name, info.ModTime(), file)
+
+	return true
+} // serve()
+
+// `etag()` returns the `ETag` of the file's current version.
+//
+// The `ETag` (a hash of the contents) is computed once per version of
+// a file, i.e. again only after its size or modification time changed.
+//
+// Parameters:
+// - `aName`: The (cleaned) URL path of the file.
+// - `aFile`: The open file.
+// - `aInfo`: The file's information.
+//
+// Returns:
+// - `string`: The file's `ETag` (or empty if it can't be read).
+func (sf *tStaticFiles) etag(aName string, aFile *os.File, aInfo os.FileInfo) string {
+	sf.mtx.RLock()
+	known, ok := sf.etags[aName]
+	sf.mtx.RUnlock()
+	if ok && (known.size == aInfo.Size()) && known.modTime.Equal(aInfo.ModTime()) {
+		return known.etag
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(aFile, 0, aInfo.Size())); nil != err {
+		return ""
+	}
+	known = tStaticETag{
+		size:    aInfo.Size(),
+		modTime: aInfo.ModTime(),
+		etag:    `"` + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:18]) + `"`,
+	}
+
+	sf.mtx.Lock()
+	if staticMaxETags <= len(sf.etags) {
+		clear(sf.etags) // start over rather than grow without bounds
+	}
+	sf.etags[aName] = known
+	sf.mtx.Unlock()
+
+	return known.etag
+} // etag()
+
+// `readStatic()` reads the host's directory of static files:
+//
+//	staticDir = /srv/www/example.com
+//
+// Files found there are sent directly (see `serve()`); requests for
+// others are forwarded to the backend as usual.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tStaticFiles`: The host's files or `nil` if there are none.
+func readStatic(aIni *ini.TSectionList, aSection string) *tStaticFiles {
+	dir, ok := hostString(aIni, aSection, "staticDir")
+	if !ok || ("" == dir) {
+		return nil
+	}
+	root, err := filepath.Abs(dir)
+	if nil == err {
+		var info os.FileInfo
+		if info, err = os.Stat(root); (nil == err) && !info.IsDir() {
+			err = fmt.Errorf("not a directory")
+		}
+	}
+	if nil != err {
+		logErr("ReProx/readStatic", fmt.Sprintf("[%s] staticDir %q: %v", aSection, dir, err))
+		return nil
+	}
+
+	return &tStaticFiles{
+		root:  root,
+		etags: make(map[string]tStaticETag),
+	}
+} // readStatic()
+
+/* _EoF_ */
@@ -0,0 +1,69 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticFiles(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "backend")
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "style.css"), []byte("body{}"), 0o600); nil != err {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".secret"), []byte("hidden"), 0o600); nil != err {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("index"), 0o600); nil != err {
+		t.Fatal(err)
+	}
+	ph := newTestProxy(t, backend.URL, func(aDest *tDestination) {
+		aDest.static = &tStaticFiles{root: dir, etags: make(map[string]tStaticETag)}
+	})
+	get := func(aPath, aETag string) *http.Response {
+		request := httptest.NewRequest(http.MethodGet, "http://"+testHost+aPath, nil)
+		if "" != aETag {
+			request.Header.Set("If-None-Match", aETag)
+		}
+		recorder := httptest.NewRecorder()
+		ph.ServeHTTP(recorder, request)
+		return recorder.Result()
+	}
+
+	response := get("/style.css", "")
+	body, _ := io.ReadAll(response.Body)
+	etag := response.Header.Get("ETag")
+	if (http.StatusOK != response.StatusCode) || ("body{}" != string(body)) || ("" == etag) {
+		t.Fatalf("static file: %d %q (ETag %q)", response.StatusCode, body, etag)
+	}
+	if response = get("/style.css", etag); http.StatusNotModified != response.StatusCode {
+		t.Errorf("conditional request: %d, want %d", response.StatusCode, http.StatusNotModified)
+	}
+	if response = get("/", ""); http.StatusOK != response.StatusCode {
+		t.Errorf("index page: %d, want %d", response.StatusCode, http.StatusOK)
+	}
+	for _, path := range []string{"/missing.css", "/.secret", "/../" + filepath.Base(dir) + "/style.css"} {
+		response = get(path, "")
+		if body, _ = io.ReadAll(response.Body); "backend" != string(body) {
+			t.Errorf("%s: %q, want the backend's response", path, body)
+		}
+	}
+} // TestStaticFiles()
+
+/* _EoF_ */
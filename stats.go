@@ -0,0 +1,172 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Request counters of a single host:
+	tHostStats struct {
+		requests    atomic.Uint64
+		errors      atomic.Uint64
+		cspReports  atomic.Uint64
+		cacheHits   atomic.Uint64
+		cacheMisses atomic.Uint64
+		uaBlocked   atomic.Uint64
+		latency     tLatency
+		statuses    [6]atomic.Uint64 // upstream responses by status class
+	}
+
+	// `THostReport` holds the request counters of a single host.
+	THostReport struct {
+		Requests    uint64 `json:"requests"`
+		Errors      uint64 `json:"errors"`
+		CSPReports  uint64 `json:"cspReports,omitempty"`
+		CacheHits   uint64 `json:"cacheHits,omitempty"`
+		CacheMisses uint64 `json:"cacheMisses,omitempty"`
+		UABlocked   uint64 `json:"uaBlocked,omitempty"`
+	}
+
+	// `TShutdownReport` summarises the program's run at shutdown.
+	TShutdownReport struct {
+		Reason  string                 `json:"reason"`
+		Started string                 `json:"started"`
+		Uptime  string                 `json:"uptime"`
+		Drained int64                  `json:"drainedConnections"`
+		Hosts   map[string]THostReport `json:"hosts"`
+	}
+)
+
+var (
+	// Time the program was started:
+	gStartTime = time.Now()
+
+	// Request counters by host (`string` -> `*tHostStats`):
+	gStats sync.Map
+)
+
+// `hostStats()` returns the request counters of `aHost`.
+//
+// Parameters:
+// - `aHost`: The requested hostname.
+//
+// Returns:
+// - `*tHostStats`: The host's counters.
+func hostStats(aHost string) *tHostStats {
+	if hs, ok := gStats.Load(aHost); ok {
+		return hs.(*tHostStats)
+	}
+	hs, _ := gStats.LoadOrStore(aHost, &tHostStats{})
+
+	return hs.(*tHostStats)
+} // hostStats()
+
+// `countError()` increments the error counter of `aHost`.
+//
+// Parameters:
+// - `aHost`: The requested hostname.
+func countError(aHost string) {
+	hostStats(aHost).errors.Add(1)
+} // countError()
+
+// `countStatus()` increments the counter of the status class of an
+// upstream response.
+//
+// Parameters:
+// - `aStatus`: The backend's response status (`0`: request failed).
+func (hs *tHostStats) countStatus(aStatus int) {
+	class := aStatus / 100
+	if (1 > class) || (5 < class) {
+		class = 0
+	}
+	hs.statuses[class].Add(1)
+} // countStatus()
+
+// `countRequest()` increments the request counter of `aHost`.
+//
+// Parameters:
+// - `aHost`: The requested hostname.
+func countRequest(aHost string) {
+	hostStats(aHost).requests.Add(1)
+} // countRequest()
+
+// `NewShutdownReport()` returns a summary of the program's run.
+//
+// Parameters:
+// - `aReason`: The reason for shutting down.
+// - `aDrained`: The number of connections open at shutdown.
+//
+// Returns:
+// - `*TShutdownReport`: The report to log.
+func NewShutdownReport(aReason string, aDrained int64) *TShutdownReport {
+	result := &TShutdownReport{
+		Reason:  aReason,
+		Started: gStartTime.Format(time.RFC3339),
+		Uptime:  time.Since(gStartTime).Round(time.Second).String(),
+		Drained: aDrained,
+		Hosts:   make(map[string]THostReport),
+	}
+	gStats.Range(func(aKey, aValue any) bool {
+		hs := aValue.(*tHostStats)
+		result.Hosts[aKey.(string)] = THostReport{
+			Requests:    hs.requests.Load(),
+			Errors:      hs.errors.Load(),
+			CSPReports:  hs.cspReports.Load(),
+			CacheHits:   hs.cacheHits.Load(),
+			CacheMisses: hs.cacheMisses.Load(),
+			UABlocked:   hs.uaBlocked.Load(),
+		}
+		return true
+	})
+
+	return result
+} // NewShutdownReport()
+
+// `Send()` writes the report to the error log and posts it to the
+// configured `ShutdownWebhook` (if any).
+//
+// Returns:
+// - `error`: A possible error encoding or posting the report.
+func (sr *TShutdownReport) Send() error {
+	data, err := json.Marshal(sr)
+	if nil != err {
+		return err
+	}
+	logErr("ReProx/shutdown", string(data))
+
+	setup := CurrentSetup()
+	if (nil == setup) || ("" == setup.ShutdownWebhook) {
+		return nil
+	}
+	client := &http.Client{
+		Timeout: time.Second << 2,
+	}
+	response, err := client.Post(setup.ShutdownWebhook,
+		"application/json", bytes.NewReader(data))
+	if nil != err {
+		return err
+	}
+	defer response.Body.Close()
+
+	if http.StatusBadRequest <= response.StatusCode {
+		return fmt.Errorf("%w: shutdown: %s", ErrWebhook, response.Status)
+	}
+
+	return nil
+} // Send()
+
+/* _EoF_ */
@@ -0,0 +1,94 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Syntax of a DNS hostname (after IDNA conversion):
+	hostnameRE = regexp.MustCompile(`^(?i)[a-z0-9_]([a-z0-9_-]{0,62}\.)*[a-z0-9_-]{0,63}\.?$`)
+)
+
+// `validHost()` checks whether `aHost` is a well-formed `Host` header
+// value, i.e. a hostname or an IP address with an optional port.
+//
+// Parameters:
+// - `aHost`: The value to check.
+//
+// Returns:
+// - `bool`: `true` if `aHost` is well-formed.
+func validHost(aHost string) bool {
+	host := aHost
+	if h, port, err := net.SplitHostPort(aHost); nil == err {
+		if p, err := strconv.Atoi(port); (nil != err) || (0 >= p) || (65535 < p) {
+			return false
+		}
+		host = h
+	} else if strings.HasPrefix(aHost, "[") {
+		host = strings.TrimSuffix(strings.TrimPrefix(aHost, "["), "]")
+	}
+	if "" == host {
+		return false
+	}
+	if nil != net.ParseIP(host) {
+		return true
+	}
+
+	return hostnameRE.MatchString(normaliseHost(host))
+} // validHost()
+
+// `strictCheck()` checks `aRequest` for ambiguities which backends
+// with laxer parsers might read differently than the proxy does
+// (request smuggling).
+//
+// Go's parser already rejects requests with several different
+// `Content-Length` values or unsupported transfer codings, and drops
+// `Content-Length` when a body is sent `chunked`; this check rejects
+//
+//   - `Transfer-Encoding` in HTTP/1.0 requests or other than a single
+//     `chunked` coding,
+//   - `Content-Length` together with `Transfer-Encoding` (if still
+//     present),
+//   - absolute-form request targets naming unconfigured hosts,
+//   - malformed `Host` headers.
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the request is acceptable.
+func (ph *TProxyHandler) strictCheck(aRequest *http.Request) bool {
+	if 0 < len(aRequest.TransferEncoding) {
+		if (1 == aRequest.ProtoMajor) && (0 == aRequest.ProtoMinor) {
+			return false
+		}
+		if (1 != len(aRequest.TransferEncoding)) ||
+			("chunked" != strings.ToLower(aRequest.TransferEncoding[0])) {
+			return false
+		}
+		if "" != aRequest.Header.Get("Content-Length") {
+			return false
+		}
+	}
+
+	if ("*" != aRequest.RequestURI) && !strings.HasPrefix(aRequest.RequestURI, "/") &&
+		(http.MethodConnect != aRequest.Method) && !ph.HasHost(aRequest.URL.Hostname()) {
+		return false
+	}
+
+	return validHost(aRequest.Host)
+} // strictCheck()
+
+/* _EoF_ */
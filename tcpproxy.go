@@ -0,0 +1,344 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// `TTCPRoute` describes a TCP stream forwarded to a backend
+	// (e.g. for IMAP or a database).
+	TTCPRoute struct {
+		Address string // the address to listen at (e.g. `:993`)
+		Backend string // the backend's `host:port`
+		TLS     bool   // whether to terminate TLS
+	}
+
+	// A running TCP route with its open connections:
+	tTCPProxy struct {
+		route    TTCPRoute
+		listener net.Listener
+		mtx      sync.Mutex
+		conns    map[net.Conn]struct{}
+		wg       sync.WaitGroup
+		closed   bool
+	}
+)
+
+const (
+	// Name of the INI section configuring the TCP routes:
+	tcpRoutesSection = "tcp_routes"
+
+	// Time allowed to connect a TCP route's backend:
+	tcpDialTimeout = 10 * time.Second
+)
+
+// `readTCPRoutes()` reads the `[tcp_routes]` section mapping listen
+// ports (or addresses) to the backends to forward the connections
+// to, optionally terminating TLS with the HTTPS certificate:
+//
+//	[tcp_routes]
+//	993 = imap.internal:143, tls
+//	5433 = db.internal:5432
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+//
+// Returns:
+// - `[]TTCPRoute`: The configured routes (if any).
+// - `[]string`: The configuration errors found.
+func readTCPRoutes(aIni *ini.TSectionList) ([]TTCPRoute, []string) {
+	var (
+		conflicts []string
+		result    []TTCPRoute
+	)
+	seen := make(map[string]bool)
+
+	aIni.Walk(func(aSection, aKey, aValue string) {
+		if tcpRoutesSection != aSection {
+			return
+		}
+		route := TTCPRoute{Address: strings.TrimSpace(aKey)}
+		if !strings.Contains(route.Address, ":") {
+			route.Address = ":" + route.Address
+		}
+		if _, port, err := net.SplitHostPort(route.Address); (nil != err) || ("" == port) {
+			conflicts = append(conflicts,
+				fmt.Sprintf("[%s] invalid address %q", tcpRoutesSection, aKey))
+			return
+		}
+		if seen[route.Address] {
+			conflicts = append(conflicts,
+				fmt.Sprintf("[%s] %q configured twice", tcpRoutesSection, route.Address))
+			return
+		}
+		seen[route.Address] = true
+
+		backend, option, _ := strings.Cut(aValue, ",")
+		route.Backend = strings.TrimSpace(backend)
+		if _, _, err := net.SplitHostPort(route.Backend); nil != err {
+			conflicts = append(conflicts,
+				fmt.Sprintf("[%s] %s: invalid backend %q", tcpRoutesSection, route.Address, backend))
+			return
+		}
+		switch option = strings.ToLower(strings.TrimSpace(option)); option {
+		case "":
+		case "tls":
+			route.TLS = true
+		default:
+			conflicts = append(conflicts,
+				fmt.Sprintf("[%s] %s: invalid option %q", tcpRoutesSection, route.Address, option))
+			return
+		}
+		result = append(result, route)
+	})
+
+	return result, conflicts
+} // readTCPRoutes()
+
+// `AddTCP()` adds the TCP route `aRoute` served at `aListener`.
+//
+// The route's backend is looked up in the current configuration for
+// each connection, so changing it takes effect with the next reload;
+// connections for a route no longer configured are refused.
+// Routes added by a reload (or whose `tls` option changed) need a
+// restart since their sockets are bound at startup (see `reloadTCP()`).
+//
+// Parameters:
+// - `aRoute`: The route to serve.
+// - `aListener`: The bound listener to serve.
+// - `aConfig`: The TLS configuration (if the route terminates TLS).
+//
+// Returns:
+// - `*TServer`: The server group itself.
+func (s *TServer) AddTCP(aRoute TTCPRoute, aListener net.Listener, aConfig *tls.Config) *TServer {
+	if aRoute.TLS && (nil != aConfig) {
+		aListener = tls.NewListener(aListener, aConfig)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.tcp = append(s.tcp, &tTCPProxy{
+		route:    aRoute,
+		listener: aListener,
+		conns:    make(map[net.Conn]struct{}),
+	})
+
+	return s
+} // AddTCP()
+
+// `tcpProxies()` returns the TCP routes added so far.
+//
+// Returns:
+// - `[]*tTCPProxy`: The group's TCP routes.
+func (s *TServer) tcpProxies() []*tTCPProxy {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return append([]*tTCPProxy(nil), s.tcp...)
+} // tcpProxies()
+
+// `reloadTCP()` logs the changes of the TCP routes by a reload which
+// don't take effect until the program is restarted.
+//
+// Parameters:
+// - `aOld`: The previous configuration (unused).
+// - `aNew`: The configuration just loaded.
+func (s *TServer) reloadTCP(aOld, aNew *TSetup) {
+	running := make(map[string]TTCPRoute)
+	for _, tp := range s.tcpProxies() {
+		running[tp.route.Address] = tp.route
+	}
+	for _, route := range aNew.TCPRoutes {
+		current, ok := running[route.Address]
+		switch {
+		case !ok:
+			logErr("ReProx/reloadTCP", fmt.Sprintf(
+				"[%s] %s: new route needs a restart", tcpRoutesSection, route.Address))
+		case current.TLS != route.TLS:
+			logErr("ReProx/reloadTCP", fmt.Sprintf(
+				"[%s] %s: changed TLS option needs a restart", tcpRoutesSection, route.Address))
+		}
+		delete(running, route.Address)
+	}
+	for addr := range running {
+		logInfo("ReProx/reloadTCP", fmt.Sprintf(
+			"[%s] %s: route removed, connections are refused", tcpRoutesSection, addr))
+	}
+} // reloadTCP()
+
+// `backend()` returns the currently configured backend of the route.
+//
+// Returns:
+// - `string`: The backend's `host:port` (or empty if there's none).
+func (tp *tTCPProxy) backend() string {
+	setup := CurrentSetup()
+	if nil == setup {
+		return tp.route.Backend
+	}
+	for _, route := range setup.TCPRoutes {
+		if route.Address == tp.route.Address {
+			return route.Backend
+		}
+	}
+
+	return ""
+} // backend()
+
+// `serve()` accepts connections until the route is shut down.
+//
+// Returns:
+// - `error`: The reason the route stopped.
+func (tp *tTCPProxy) serve() error {
+	for {
+		conn, err := tp.listener.Accept()
+		if nil != err {
+			tp.mtx.Lock()
+			closed := tp.closed
+			tp.mtx.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return fmt.Errorf("%s: %w", tp.listener.Addr(), err)
+		}
+		if !tp.track(conn, true) {
+			_ = conn.Close()
+			continue
+		}
+		tp.wg.Add(1)
+		goSafe("tcp", false, func() {
+			defer tp.wg.Done()
+			defer tp.track(conn, false)
+			tp.forward(conn)
+		})
+	}
+} // serve()
+
+// `track()` adds `aConn` to (or removes it from) the open connections.
+//
+// Parameters:
+// - `aConn`: The client's connection.
+// - `aAdd`: Whether to add or remove `aConn`.
+//
+// Returns:
+// - `bool`: `false` if the route is already shut down.
+func (tp *tTCPProxy) track(aConn net.Conn, aAdd bool) bool {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+
+	if !aAdd {
+		delete(tp.conns, aConn)
+		return true
+	}
+	if tp.closed {
+		return false
+	}
+	tp.conns[aConn] = struct{}{}
+
+	return true
+} // track()
+
+// `forward()` copies the data between the client's connection and
+// a new connection to the route's backend until both sides are done.
+//
+// Parameters:
+// - `aClient`: The client's connection.
+func (tp *tTCPProxy) forward(aClient net.Conn) {
+	defer aClient.Close()
+
+	addr := tp.backend()
+	if "" == addr {
+		logErr("ReProx/tcp",
+			fmt.Sprintf("%s: route no longer configured", tp.route.Address))
+		return
+	}
+	backend, err := net.DialTimeout("tcp", addr, tcpDialTimeout)
+	if nil != err {
+		logErr("ReProx/tcp", fmt.Sprintf("%s: %v", tp.route.Address, err))
+		return
+	}
+	defer backend.Close()
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(backend, aClient)
+		closeWrite(backend)
+		close(done)
+	}()
+	_, _ = io.Copy(aClient, backend)
+	closeWrite(aClient)
+	<-done
+} // forward()
+
+// `closeWrite()` signals the end of the data sent to `aConn`'s peer
+// while still reading its answer (if the connection supports it).
+//
+// Parameters:
+// - `aConn`: The connection to half-close.
+func closeWrite(aConn net.Conn) {
+	if conn, ok := aConn.(interface{ CloseWrite() error }); ok {
+		_ = conn.CloseWrite()
+		return
+	}
+	_ = aConn.Close()
+} // closeWrite()
+
+// `Shutdown()` closes the route's listener and waits for the open
+// connections to finish until `aCtx` is done; connections still
+// open then are closed forcibly.
+//
+// Parameters:
+// - `aCtx`: The context limiting the draining.
+//
+// Returns:
+// - `error`: The context's error if the draining didn't finish.
+func (tp *tTCPProxy) Shutdown(aCtx context.Context) error {
+	tp.mtx.Lock()
+	tp.closed = true
+	tp.mtx.Unlock()
+	_ = tp.listener.Close()
+
+	done := make(chan struct{})
+	go func() {
+		tp.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-aCtx.Done():
+	}
+
+	tp.mtx.Lock()
+	for conn := range tp.conns {
+		_ = conn.Close()
+	}
+	tp.mtx.Unlock()
+	<-done
+
+	return aCtx.Err()
+} // Shutdown()
+
+/* _EoF_ */
@@ -0,0 +1,77 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// `TTimeouts` holds the client timeouts of a listener (`0`: none).
+	TTimeouts struct {
+		Read       time.Duration // reading the entire request
+		ReadHeader time.Duration // reading the request headers
+		Write      time.Duration // writing the response
+		Idle       time.Duration // waiting for the next request
+	}
+)
+
+// `Apply()` sets the listener's timeouts for `aServer`.
+//
+// Parameters:
+// - `aServer`: The server to configure.
+//
+// Returns:
+// - `*http.Server`: The configured server.
+func (to TTimeouts) Apply(aServer *http.Server) *http.Server {
+	aServer.ReadTimeout = to.Read
+	aServer.ReadHeaderTimeout = to.ReadHeader
+	aServer.WriteTimeout = to.Write
+	aServer.IdleTimeout = to.Idle
+
+	return aServer
+} // Apply()
+
+// `readTimeouts()` reads the timeouts of the listener whose settings
+// start with `aPrefix` (`HTTP` or `HTTPS`).
+//
+// The listener specific `<prefix>ReadTimeout`, `<prefix>ReadHeaderTimeout`,
+// `<prefix>WriteTimeout`, and `<prefix>IdleTimeout` settings default to
+// the general ones without prefix, and those to `4s`, `2s`, none, and
+// none (i.e. the read timeout) respectively.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aPrefix`: The listener's settings prefix.
+//
+// Returns:
+// - `TTimeouts`: The listener's timeouts.
+func readTimeouts(aIni *ini.TSectionList, aPrefix string) TTimeouts {
+	timeout := func(aKey string, aDefault time.Duration) time.Duration {
+		if result, ok := hostDuration(aIni, ini.DefSection, aPrefix+aKey); ok {
+			return result
+		}
+		if result, ok := hostDuration(aIni, ini.DefSection, aKey); ok {
+			return result
+		}
+		return aDefault
+	}
+
+	return TTimeouts{
+		Read:       timeout("ReadTimeout", time.Second<<2),
+		ReadHeader: timeout("ReadHeaderTimeout", time.Second<<1),
+		Write:      timeout("WriteTimeout", 0),
+		Idle:       timeout("IdleTimeout", 0),
+	}
+} // readTimeouts()
+
+/* _EoF_ */
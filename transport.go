@@ -0,0 +1,110 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host tuning of the backend connections (`0`: default):
+	tTransport struct {
+		maxIdle      int           // idle connections kept to the backend
+		maxConns     int           // total connections to the backend
+		dialTimeout  time.Duration // establishing a connection
+		headerWait   time.Duration // waiting for the response headers
+		noKeepAlives bool          // whether to use a connection only once
+		dnsTTL       time.Duration // caching of the backend's addresses
+	}
+)
+
+// `apply()` sets the tuned values of `aTransport`.
+//
+// Parameters:
+// - `aTransport`: The host's private transport.
+func (tt *tTransport) apply(aTransport *http.Transport) {
+	if nil == tt {
+		return
+	}
+	if 0 < tt.maxIdle {
+		aTransport.MaxIdleConnsPerHost = tt.maxIdle
+	}
+	if 0 < tt.maxConns {
+		aTransport.MaxConnsPerHost = tt.maxConns
+	}
+	if (0 < tt.dialTimeout) || (0 < tt.dnsTTL) {
+		aTransport.DialContext = tt.dialer()
+	}
+	if 0 < tt.headerWait {
+		aTransport.ResponseHeaderTimeout = tt.headerWait
+	}
+	aTransport.DisableKeepAlives = tt.noKeepAlives
+} // apply()
+
+// `dialer()` returns the dial function for the backend connections.
+//
+// Returns:
+// - `tDialFunc`: The dial function honouring the tuned values.
+func (tt *tTransport) dialer() tDialFunc {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if nil == tt {
+		return dialer.DialContext
+	}
+	if 0 < tt.dialTimeout {
+		dialer.Timeout = tt.dialTimeout
+	}
+	if 0 < tt.dnsTTL {
+		return gDNSCache.dialer(dialer, tt.dnsTTL)
+	}
+
+	return dialer.DialContext
+} // dialer()
+
+// `readTransport()` reads the host's backend connection settings:
+//
+//	maxIdleConns = 64
+//	maxConns = 256
+//	dialTimeout = 5s
+//	responseHeaderTimeout = 30s
+//	disableKeepAlives = false
+//	dnsCacheTTL = 1m
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tTransport`: The host's settings or `nil` if there are none.
+func readTransport(aIni *ini.TSectionList, aSection string) *tTransport {
+	result := &tTransport{}
+
+	result.maxIdle, _ = hostInt(aIni, aSection, "maxIdleConns")
+	result.maxConns, _ = hostInt(aIni, aSection, "maxConns")
+	result.dialTimeout, _ = hostDuration(aIni, aSection, "dialTimeout")
+	result.headerWait, _ = hostDuration(aIni, aSection, "responseHeaderTimeout")
+	result.noKeepAlives, _ = hostBool(aIni, aSection, "disableKeepAlives")
+	result.dnsTTL, _ = hostDuration(aIni, aSection, "dnsCacheTTL")
+
+	if (0 >= result.maxIdle) && (0 >= result.maxConns) &&
+		(0 >= result.dialTimeout) && (0 >= result.headerWait) &&
+		!result.noKeepAlives && (0 >= result.dnsTTL) {
+		return nil
+	}
+
+	return result
+} // readTransport()
+
+/* _EoF_ */
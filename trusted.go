@@ -0,0 +1,125 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// `inNetworks()` checks whether `aIP` belongs to one of `aNetworks`.
+//
+// Parameters:
+// - `aIP`: The address to check.
+// - `aNetworks`: The networks to search.
+//
+// Returns:
+// - `bool`: `true` if `aIP` is within one of the networks.
+func inNetworks(aIP net.IP, aNetworks []*net.IPNet) bool {
+	for _, network := range aNetworks {
+		if network.Contains(aIP) {
+			return true
+		}
+	}
+
+	return false
+} // inNetworks()
+
+// `parseNetworks()` parses the comma separated list of CIDR networks
+// (or single addresses) `aList`.
+//
+// Parameters:
+// - `aList`: The configured list.
+//
+// Returns:
+// - `[]*net.IPNet`: The parsed networks.
+// - `error`: An error naming the first invalid entry.
+func parseNetworks(aList string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, cidr := range strings.Split(aList, ",") {
+		if cidr = strings.TrimSpace(cidr); "" == cidr {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if nil == ip {
+				return nil, fmt.Errorf("invalid address %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); nil != ip4 {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if nil != err {
+			return nil, err
+		}
+		result = append(result, network)
+	}
+
+	return result, nil
+} // parseNetworks()
+
+// `realClient()` replaces the `RemoteAddr` of `aRequest` by the client
+// address reported by trusted proxies (e.g. a CDN), so that rate
+// limits, ACLs, and logs use the actual client's address.
+//
+// If the immediate peer is trusted, the `X-Forwarded-For` list is
+// walked from the right as long as the addresses are trusted; the
+// first untrusted one is the client. Without `X-Forwarded-For` the
+// `X-Real-IP` header is used. The trusted hops are removed from
+// `X-Forwarded-For`, so the backend sees the client as the last hop.
+//
+// Parameters:
+// - `aTrusted`: The trusted proxies' networks.
+// - `aRequest`: The incoming HTTP request.
+func realClient(aTrusted []*net.IPNet, aRequest *http.Request) {
+	host, _, err := net.SplitHostPort(aRequest.RemoteAddr)
+	if nil != err {
+		host = aRequest.RemoteAddr
+	}
+	if peer := net.ParseIP(host); (nil == peer) || !inNetworks(peer, aTrusted) {
+		return
+	}
+
+	var client net.IP
+	if values := aRequest.Header.Values("X-Forwarded-For"); 0 < len(values) {
+		hops := strings.Split(strings.Join(values, ","), ",")
+		pos := len(hops)
+		for idx := len(hops) - 1; 0 <= idx; idx-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[idx]))
+			if nil == hop {
+				break
+			}
+			client, pos = hop, idx
+			if !inNetworks(hop, aTrusted) {
+				break
+			}
+		}
+		if nil != client {
+			// keep the hops before the client:
+			if 0 < pos {
+				aRequest.Header.Set("X-Forwarded-For", strings.Join(hops[:pos], ","))
+			} else {
+				aRequest.Header.Del("X-Forwarded-For")
+			}
+		}
+	} else if ip := net.ParseIP(strings.TrimSpace(aRequest.Header.Get("X-Real-IP"))); nil != ip {
+		client = ip
+	}
+	if nil != client {
+		aRequest.RemoteAddr = net.JoinHostPort(client.String(), "0")
+	}
+} // realClient()
+
+/* _EoF_ */
@@ -0,0 +1,99 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/mwat56/ini"
+)
+
+type (
+	// Per-host User-Agent filter:
+	tUAFilter struct {
+		pattern *regexp.Regexp // User-Agents to refuse
+		status  int            // HTTP status to send
+		tarpit  time.Duration  // (optional) delay before answering
+	}
+)
+
+// `refuse()` checks whether the client's User-Agent matches the
+// filter and answers the request if so.
+//
+// Tarpitted requests are delayed (unless the client goes away) before
+// the status is sent, to slow down scrapers.
+//
+// Parameters:
+// - `aHost`: The (normalised) requested hostname.
+// - `aWriter`: The `ResponseWriter` to write HTTP response headers and body.
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if the request was refused.
+func (uf *tUAFilter) refuse(aHost string, aWriter http.ResponseWriter, aRequest *http.Request) bool {
+	if (nil == uf) || !uf.pattern.MatchString(aRequest.UserAgent()) {
+		return false
+	}
+	hostStats(aHost).uaBlocked.Add(1)
+
+	if 0 < uf.tarpit {
+		timer := time.NewTimer(uf.tarpit)
+		select {
+		case <-timer.C:
+		case <-aRequest.Context().Done():
+			timer.Stop()
+			return true
+		}
+	}
+	http.Error(aWriter, http.StatusText(uf.status), uf.status)
+
+	return true
+} // refuse()
+
+// `readUAFilter()` reads the host's User-Agent filter settings:
+//
+//	uaBlock = (?i)(ahrefs|semrush|mj12)bot
+//	uaStatus = 403
+//	uaTarpit = 10s
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file.
+// - `aSection`: The name of the host's INI section.
+//
+// Returns:
+// - `*tUAFilter`: The host's filter or `nil` if there's none.
+func readUAFilter(aIni *ini.TSectionList, aSection string) *tUAFilter {
+	s, ok := hostString(aIni, aSection, "uaBlock")
+	if !ok || ("" == s) {
+		return nil
+	}
+	pattern, err := regexp.Compile(s)
+	if nil != err {
+		logErr("ReProx/readUAFilter",
+			fmt.Sprintf("[%s] uaBlock: %v", aSection, err))
+		return nil
+	}
+
+	result := &tUAFilter{
+		pattern: pattern,
+		status:  http.StatusForbidden,
+	}
+	if status, ok := hostInt(aIni, aSection, "uaStatus"); ok &&
+		(http.StatusBadRequest <= status) && (600 > status) {
+		result.status = status
+	}
+	result.tarpit, _ = hostDuration(aIni, aSection, "uaTarpit")
+
+	return result
+} // readUAFilter()
+
+/* _EoF_ */
@@ -0,0 +1,78 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mwat56/ini"
+)
+
+const (
+	// Name of the INI section defining template variables:
+	varsSection = "Vars"
+
+	// Maximum nesting depth of variable references:
+	varsMaxDepth = 8
+)
+
+var (
+	// Regular expression matching a `${name}` variable reference:
+	varsRefRE = regexp.MustCompile(`\$\{(\w+)\}`)
+)
+
+// `expandVars()` replaces all `${name}` references in the values of
+// `aIni` by the respective variable defined in the `[Vars]` section.
+//
+// Variables may refer to other variables; references to undefined
+// variables are logged and left unchanged.
+//
+// Parameters:
+// - `aIni`: The INI data read from the configuration file(s).
+func expandVars(aIni *ini.TSectionList) {
+	type tUpdate struct {
+		section, key, value string
+	}
+	var updates []tUpdate
+	vars := make(map[string]string)
+
+	aIni.Walk(func(aSection, aKey, aValue string) {
+		if varsSection == aSection {
+			vars[aKey] = aValue
+		}
+	})
+
+	var expand func(aSection, aValue string, aDepth int) string
+	expand = func(aSection, aValue string, aDepth int) string {
+		return varsRefRE.ReplaceAllStringFunc(aValue, func(aRef string) string {
+			name := aRef[2 : len(aRef)-1]
+			value, ok := vars[name]
+			if !ok || (varsMaxDepth <= aDepth) {
+				logErr("ReProx/expandVars",
+					fmt.Sprintf("[%s] can't resolve %s", aSection, aRef))
+				return aRef
+			}
+			return expand(aSection, value, aDepth+1)
+		})
+	}
+
+	aIni.Walk(func(aSection, aKey, aValue string) {
+		if (varsSection != aSection) && strings.Contains(aValue, "${") {
+			updates = append(updates,
+				tUpdate{aSection, aKey, expand(aSection, aValue, 0)})
+		}
+	})
+	for _, u := range updates {
+		aIni.UpdateSectKeyStr(u.section, u.key, u.value)
+	}
+} // expandVars()
+
+/* _EoF_ */
@@ -0,0 +1,91 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+type (
+	// `TVersionInfo` describes the running program and its configuration.
+	TVersionInfo struct {
+		Version    string `json:"version"`
+		Commit     string `json:"commit"`
+		GoVersion  string `json:"goVersion"`
+		ConfigHash string `json:"configHash"`
+	}
+)
+
+var (
+	// `Version` is the program's build version;
+	// it's meant to be set at link time by
+	// `-ldflags "-X github.com/mwat56/reprox.Version=…"`.
+	Version = "devel"
+
+	// `Commit` is the VCS revision the program was built from;
+	// if not set at link time the Go build info is used.
+	Commit = ""
+)
+
+// `configHash()` returns the hex encoded SHA-256 hash of `aConfig`.
+//
+// Parameters:
+// - `aConfig`: The textual representation of the loaded configuration.
+//
+// Returns:
+// - `string`: The hash of the configuration data.
+func configHash(aConfig string) string {
+	sum := sha256.Sum256([]byte(aConfig))
+
+	return hex.EncodeToString(sum[:])
+} // configHash()
+
+// `GetVersionInfo()` returns the build version, commit, Go version
+// and the hash of the currently loaded configuration.
+//
+// Returns:
+// - `TVersionInfo`: The current version information.
+func GetVersionInfo() TVersionInfo {
+	result := TVersionInfo{
+		Version:   Version,
+		Commit:    Commit,
+		GoVersion: runtime.Version(),
+	}
+	if setup := CurrentSetup(); nil != setup {
+		result.ConfigHash = setup.ConfigHash
+	}
+
+	if "" == result.Commit {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range info.Settings {
+				if "vcs.revision" == setting.Key {
+					result.Commit = setting.Value
+					break
+				}
+			}
+		}
+	}
+
+	return result
+} // GetVersionInfo()
+
+// `String()` returns the version information as a single log line.
+//
+// Returns:
+// - `string`: The textual representation of the version information.
+func (vi TVersionInfo) String() string {
+	return fmt.Sprintf("version %s, commit %s, %s, config %s",
+		vi.Version, vi.Commit, vi.GoVersion, vi.ConfigHash)
+} // String()
+
+/* _EoF_ */
@@ -0,0 +1,117 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// Backend connection of an upgraded request (e.g. a WebSocket)
+	// which is closed after a period without any traffic:
+	tIdleConn struct {
+		io.ReadWriteCloser
+		idle  time.Duration
+		timer *time.Timer
+	}
+)
+
+// `isUpgrade()` checks whether `aRequest` asks to switch protocols
+// (e.g. to a WebSocket).
+//
+// Parameters:
+// - `aRequest`: The incoming HTTP request.
+//
+// Returns:
+// - `bool`: `true` if it's an `Upgrade` request.
+func isUpgrade(aRequest *http.Request) bool {
+	if "" == aRequest.Header.Get("Upgrade") {
+		return false
+	}
+	for _, value := range aRequest.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold("upgrade", strings.TrimSpace(token)) {
+				return true
+			}
+		}
+	}
+
+	return false
+} // isUpgrade()
+
+// `prepareUpgrade()` clears the read and write deadlines the server
+// set for `aRequest`'s connection, since they would otherwise cut off
+// the long-lived connection once it's switched (and taken over by
+// the reverse proxy).
+//
+// Parameters:
+// - `aWriter`: The `ResponseWriter` of the upgrade request.
+func prepareUpgrade(aWriter http.ResponseWriter) {
+	rc := http.NewResponseController(aWriter)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+} // prepareUpgrade()
+
+// `upgraded()` arranges for the backend connection of the switched
+// response `aResponse` to be closed after `aIdle` without traffic in
+// either direction, which closes the client's connection as well.
+//
+// Parameters:
+// - `aResponse`: The backend's `101 Switching Protocols` response.
+// - `aIdle`: The idle timeout (`0`: none).
+func upgraded(aResponse *http.Response, aIdle time.Duration) {
+	conn, ok := aResponse.Body.(io.ReadWriteCloser)
+	if !ok || (0 >= aIdle) {
+		return
+	}
+
+	host := aResponse.Request.Host
+	aResponse.Body = &tIdleConn{
+		ReadWriteCloser: conn,
+		idle:            aIdle,
+		timer: time.AfterFunc(aIdle, func() {
+			logInfo("ReProx/upgraded",
+				fmt.Sprintf("%s: connection idle for %s, closed", host, aIdle))
+			_ = conn.Close()
+		}),
+	}
+} // upgraded()
+
+// `Read()` reads from the backend, restarting the idle timer.
+func (ic *tIdleConn) Read(aData []byte) (int, error) {
+	n, err := ic.ReadWriteCloser.Read(aData)
+	if 0 < n {
+		ic.timer.Reset(ic.idle)
+	}
+
+	return n, err
+} // Read()
+
+// `Write()` writes to the backend, restarting the idle timer.
+func (ic *tIdleConn) Write(aData []byte) (int, error) {
+	n, err := ic.ReadWriteCloser.Write(aData)
+	if 0 < n {
+		ic.timer.Reset(ic.idle)
+	}
+
+	return n, err
+} // Write()
+
+// `Close()` stops the idle timer and closes the backend connection.
+func (ic *tIdleConn) Close() error {
+	ic.timer.Stop()
+
+	return ic.ReadWriteCloser.Close()
+} // Close()
+
+/* _EoF_ */
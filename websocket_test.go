@@ -0,0 +1,166 @@
+/*
+Copyright © 2024  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package reprox
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// Read and write timeouts of the test frontend:
+	testConnTimeout = 200 * time.Millisecond
+)
+
+// `newEchoBackend()` returns a backend switching each request to the
+// `echo` protocol and then echoing the data it receives.
+//
+// Parameters:
+// - `t`: The running test.
+//
+// Returns:
+// - `*httptest.Server`: The running backend.
+func newEchoBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUpgrade(r) {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if nil != err {
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Connection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		_ = rw.Flush()
+		_, _ = io.Copy(conn, rw)
+	}))
+} // newEchoBackend()
+
+// `dialUpgraded()` connects to `aFront` and switches the connection
+// to the `echo` protocol.
+//
+// Parameters:
+// - `t`: The running test.
+// - `aFront`: The proxy's server.
+//
+// Returns:
+// - `net.Conn`: The switched connection.
+// - `*bufio.Reader`: The connection's reader.
+func dialUpgraded(t *testing.T, aFront *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", aFront.Listener.Addr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_, _ = io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: "+testHost+
+		"\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if http.StatusSwitchingProtocols != resp.StatusCode {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+
+	return conn, reader
+} // dialUpgraded()
+
+// `newTimeoutFront()` returns a frontend serving `aProxy` with short
+// read and write timeouts.
+//
+// Parameters:
+// - `aProxy`: The proxy handler to serve.
+//
+// Returns:
+// - `*httptest.Server`: The running frontend.
+func newTimeoutFront(aProxy http.Handler) *httptest.Server {
+	result := httptest.NewUnstartedServer(aProxy)
+	result.Config.ReadTimeout = testConnTimeout
+	result.Config.WriteTimeout = testConnTimeout
+	result.Start()
+
+	return result
+} // newTimeoutFront()
+
+func TestUpgradeOutlivesServerTimeouts(t *testing.T) {
+	backend := newEchoBackend(t)
+	defer backend.Close()
+	front := newTimeoutFront(newTestProxy(t, backend.URL, nil))
+	defer front.Close()
+
+	conn, reader := dialUpgraded(t, front)
+	for _, msg := range []string{"first\n", "second\n"} {
+		// wait past the server's deadlines before each message:
+		time.Sleep(2 * testConnTimeout)
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := io.WriteString(conn, msg); nil != err {
+			t.Fatal(err)
+		}
+		got, err := reader.ReadString('\n')
+		if nil != err {
+			t.Fatalf("echo of %q: %v", msg, err)
+		}
+		if msg != got {
+			t.Errorf("echo = %q, want %q", got, msg)
+		}
+	}
+} // TestUpgradeOutlivesServerTimeouts()
+
+func TestUpgradeIdleTimeout(t *testing.T) {
+	backend := newEchoBackend(t)
+	defer backend.Close()
+	front := newTimeoutFront(newTestProxy(t, backend.URL, func(aDest *tDestination) {
+		aDest.wsIdle = 3 * testConnTimeout
+	}))
+	defer front.Close()
+
+	conn, reader := dialUpgraded(t, front)
+	// traffic restarts the idle timer:
+	for range 3 {
+		time.Sleep(2 * testConnTimeout)
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+		_, _ = io.WriteString(conn, "ping\n")
+		if got, err := reader.ReadString('\n'); (nil != err) || ("ping\n" != got) {
+			t.Fatalf("echo = %q, %v; want %q", got, err, "ping\n")
+		}
+	}
+
+	start := time.Now()
+	_ = conn.SetReadDeadline(start.Add(10 * testConnTimeout))
+	_, err := reader.ReadByte()
+	var netErr net.Error
+	switch {
+	case nil == err:
+		t.Fatal("data received on an idle connection")
+	case errors.As(err, &netErr) && netErr.Timeout():
+		t.Fatal("idle connection not closed by the proxy")
+	case !errors.Is(err, io.EOF) && !strings.Contains(err.Error(), "reset"):
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); 2*testConnTimeout > elapsed {
+		t.Errorf("connection closed after %s, want >= %s", elapsed, 2*testConnTimeout)
+	}
+} // TestUpgradeIdleTimeout()
+
+/* _EoF_ */